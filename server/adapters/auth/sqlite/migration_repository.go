@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+)
+
+// Verify SQLiteMigrationRepository implements ports.LegacyUserMigrationRepository
+var _ ports.LegacyUserMigrationRepository = (*SQLiteMigrationRepository)(nil)
+
+// SQLiteMigrationRepository records which legacy users have been migrated to Kratos.
+type SQLiteMigrationRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteMigrationRepository creates a new instance of SQLiteMigrationRepository.
+func NewSQLiteMigrationRepository(db *sql.DB) *SQLiteMigrationRepository {
+	return &SQLiteMigrationRepository{db: db}
+}
+
+// InitMigrationSchema creates the `legacy_user_migrations` mapping table if it doesn't already exist.
+func (s *SQLiteMigrationRepository) InitMigrationSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS legacy_user_migrations (
+		legacy_user_id INTEGER PRIMARY KEY,
+		username TEXT NOT NULL,
+		identity_id TEXT NOT NULL,
+		migrated_at DATETIME NOT NULL,
+		messages_rewritten INTEGER NOT NULL DEFAULT 0,
+		rewritten_message_count INTEGER NOT NULL DEFAULT 0
+	);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing legacy user migration schema: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetMigration retrieves the migration record of a legacy user.
+// Returns (nil, nil) if the user has not been migrated yet.
+func (s *SQLiteMigrationRepository) GetMigration(legacyUserID int64) (*ports.LegacyUserMigration, error) {
+	query := `SELECT legacy_user_id, username, identity_id, migrated_at, messages_rewritten, rewritten_message_count
+		FROM legacy_user_migrations WHERE legacy_user_id = ?`
+	var m ports.LegacyUserMigration
+	err := s.db.QueryRow(query, legacyUserID).Scan(&m.LegacyUserID, &m.Username, &m.IdentityID, &m.MigratedAt, &m.MessagesRewritten, &m.RewrittenMessageCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Not migrated yet
+		}
+		log.Printf("Error scanning migration of legacy user %d: %v", legacyUserID, err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+// SaveMigration records that a legacy user now maps to a Kratos identity.
+func (s *SQLiteMigrationRepository) SaveMigration(m ports.LegacyUserMigration) error {
+	query := `INSERT INTO legacy_user_migrations (legacy_user_id, username, identity_id, migrated_at, messages_rewritten, rewritten_message_count)
+		VALUES (?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, m.LegacyUserID, m.Username, m.IdentityID, m.MigratedAt, m.MessagesRewritten, m.RewrittenMessageCount)
+	if err != nil {
+		log.Printf("Error saving migration of legacy user %d: %v", m.LegacyUserID, err)
+		return err
+	}
+	return nil
+}
+
+// MarkMessagesRewritten records that the authorship of the user's messages has been rewritten.
+func (s *SQLiteMigrationRepository) MarkMessagesRewritten(legacyUserID int64, count int64) error {
+	_, err := s.db.Exec("UPDATE legacy_user_migrations SET messages_rewritten = 1, rewritten_message_count = ? WHERE legacy_user_id = ?", count, legacyUserID)
+	if err != nil {
+		log.Printf("Error marking messages of legacy user %d as rewritten: %v", legacyUserID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteServiceAccountRepository implements ports.ServiceAccountRepository
+var _ ports.ServiceAccountRepository = (*SQLiteServiceAccountRepository)(nil)
+
+// SQLiteServiceAccountRepository implements the ports.ServiceAccountRepository interface using SQLite.
+type SQLiteServiceAccountRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteServiceAccountRepository creates a new instance of SQLiteServiceAccountRepository.
+func NewSQLiteServiceAccountRepository(db *sql.DB) *SQLiteServiceAccountRepository {
+	return &SQLiteServiceAccountRepository{db: db}
+}
+
+// InitServiceAccountSchema creates the `service_accounts` and `api_keys` tables if they don't already exist.
+func (s *SQLiteServiceAccountRepository) InitServiceAccountSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS service_accounts (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		disabled_at DATETIME
+	);
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		service_account_id TEXT NOT NULL REFERENCES service_accounts(id),
+		prefix TEXT NOT NULL UNIQUE,
+		key_hash TEXT NOT NULL,
+		scopes TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME,
+		revoked_at DATETIME,
+		last_used_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_service_account ON api_keys (service_account_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing service account schema: %v", err)
+		return err
+	}
+	log.Println("Service account schema initialized successfully.")
+	return nil
+}
+
+// CreateServiceAccount adds a new service account.
+func (s *SQLiteServiceAccountRepository) CreateServiceAccount(account models.ServiceAccount) error {
+	_, err := s.db.Exec("INSERT INTO service_accounts (id, name, description, created_by, created_at, disabled_at) VALUES (?, ?, ?, ?, ?, ?)",
+		account.ID, account.Name, account.Description, account.CreatedBy, account.CreatedAt, account.DisabledAt)
+	if err != nil {
+		log.Printf("Error creating service account %s: %v", account.Name, err)
+		return err
+	}
+	return nil
+}
+
+// GetServiceAccount retrieves a service account by ID.
+// Returns (nil, nil) if the account does not exist.
+func (s *SQLiteServiceAccountRepository) GetServiceAccount(id string) (*models.ServiceAccount, error) {
+	row := s.db.QueryRow("SELECT id, name, description, created_by, created_at, disabled_at FROM service_accounts WHERE id = ?", id)
+	account, err := scanServiceAccount(row)
+	if err == sql.ErrNoRows {
+		return nil, nil // Account not found
+	}
+	if err != nil {
+		log.Printf("Error scanning service account %s: %v", id, err)
+		return nil, err
+	}
+	return account, nil
+}
+
+// ListServiceAccounts retrieves all service accounts ordered by name.
+func (s *SQLiteServiceAccountRepository) ListServiceAccounts() ([]models.ServiceAccount, error) {
+	rows, err := s.db.Query("SELECT id, name, description, created_by, created_at, disabled_at FROM service_accounts ORDER BY name ASC")
+	if err != nil {
+		log.Printf("Error querying service accounts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			log.Printf("Error scanning service account row: %v", err)
+			return nil, err
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating service account rows: %v", err)
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// SetServiceAccountDisabled disables the account at disabledAt, or re-enables it if nil.
+func (s *SQLiteServiceAccountRepository) SetServiceAccountDisabled(id string, disabledAt *time.Time) error {
+	_, err := s.db.Exec("UPDATE service_accounts SET disabled_at = ? WHERE id = ?", disabledAt, id)
+	if err != nil {
+		log.Printf("Error updating service account %s: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key and sets key.ID to the generated ID.
+func (s *SQLiteServiceAccountRepository) CreateAPIKey(key *models.APIKey) error {
+	res, err := s.db.Exec("INSERT INTO api_keys (service_account_id, prefix, key_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		key.ServiceAccountID, key.Prefix, key.Hash, strings.Join(key.Scopes, " "), key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		log.Printf("Error creating API key for service account %s: %v", key.ServiceAccountID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created API key: %v", err)
+		return err
+	}
+	key.ID = id
+	return nil
+}
+
+const apiKeyColumns = "id, service_account_id, prefix, key_hash, scopes, created_at, expires_at, revoked_at, last_used_at"
+
+// GetAPIKey retrieves an API key by ID.
+// Returns (nil, nil) if the key does not exist.
+func (s *SQLiteServiceAccountRepository) GetAPIKey(id int64) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Key not found
+	}
+	if err != nil {
+		log.Printf("Error scanning API key %d: %v", id, err)
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetAPIKeyByPrefix retrieves an API key by its public prefix.
+// Returns (nil, nil) if no key has that prefix.
+func (s *SQLiteServiceAccountRepository) GetAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = ?", prefix))
+	if err == sql.ErrNoRows {
+		return nil, nil // Key not found
+	}
+	if err != nil {
+		log.Printf("Error scanning API key with prefix %s: %v", prefix, err)
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListAPIKeys retrieves all keys of a service account, newest first.
+func (s *SQLiteServiceAccountRepository) ListAPIKeys(serviceAccountID string) ([]models.APIKey, error) {
+	rows, err := s.db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE service_account_id = ? ORDER BY id DESC", serviceAccountID)
+	if err != nil {
+		log.Printf("Error querying API keys of %s: %v", serviceAccountID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			log.Printf("Error scanning API key row: %v", err)
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating API key rows: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key as revoked. Revoking twice keeps the first revocation time.
+func (s *SQLiteServiceAccountRepository) RevokeAPIKey(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?", at, id)
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// ExpireAPIKey sets the expiry of a key, unless it already expires earlier.
+func (s *SQLiteServiceAccountRepository) ExpireAPIKey(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET expires_at = ? WHERE id = ? AND (expires_at IS NULL OR expires_at > ?)", at, id, at)
+	if err != nil {
+		log.Printf("Error setting expiry of API key %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// TouchAPIKey records when a key was last used.
+func (s *SQLiteServiceAccountRepository) TouchAPIKey(id int64, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, id)
+	if err != nil {
+		log.Printf("Error updating last use of API key %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanServiceAccount(row rowScanner) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	var disabledAt sql.NullTime
+	if err := row.Scan(&account.ID, &account.Name, &account.Description, &account.CreatedBy, &account.CreatedAt, &disabledAt); err != nil {
+		return nil, err
+	}
+	account.DisabledAt = timePtr(disabledAt)
+	return &account, nil
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.ServiceAccountID, &key.Prefix, &key.Hash, &scopes, &key.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	key.ExpiresAt = timePtr(expiresAt)
+	key.RevokedAt = timePtr(revokedAt)
+	key.LastUsedAt = timePtr(lastUsedAt)
+	return &key, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
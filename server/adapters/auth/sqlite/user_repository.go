@@ -93,3 +93,30 @@ func (s *SQLiteUserRepository) GetUserByID(id int64) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+// ListUsers retrieves all users ordered by ID.
+func (s *SQLiteUserRepository) ListUsers() ([]models.User, error) {
+	rows, err := s.db.Query("SELECT id, username, password_hash FROM users ORDER BY id ASC")
+	if err != nil {
+		log.Printf("Error querying users: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		var passwordHash sql.NullString
+		if err := rows.Scan(&user.ID, &user.Username, &passwordHash); err != nil {
+			log.Printf("Error scanning user row: %v", err)
+			return nil, err
+		}
+		user.PasswordHash = passwordHash.String
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating user rows: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
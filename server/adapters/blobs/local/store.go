@@ -0,0 +1,102 @@
+// Package local keeps blobs as files below a directory, for single-server
+// deployments.
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"keeper/server/core/ports"
+)
+
+// Verify Store implements ports.BlobStore
+var _ ports.BlobStore = (*Store)(nil)
+
+// Store implements ports.BlobStore on the local filesystem. Each key is a
+// path below the root directory.
+type Store struct {
+	root string
+}
+
+// NewStore creates a Store below dir, creating the directory if needed.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating blob directory %s: %w", dir, err)
+	}
+	return &Store{root: dir}, nil
+}
+
+// path maps a key to a file below the root, refusing keys that would leave it.
+func (s *Store) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so
+// readers never see a partial blob.
+func (s *Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("creating directory of blob %s: %w", key, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("creating blob %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	n, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing blob %s: %w", key, err)
+	}
+	if n != size {
+		return fmt.Errorf("writing blob %s: got %d bytes, expected %d", key, n, size)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storing blob %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens the file of a blob.
+func (s *Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ports.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening blob %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// Delete removes the file of a blob.
+func (s *Store) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Error deleting blob %s: %v", key, err)
+		return err
+	}
+	return nil
+}
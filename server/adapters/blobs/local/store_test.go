@@ -0,0 +1,56 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"keeper/server/core/ports"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "rooms/1/map", strings.NewReader("the cellar"), 10, "text/plain"); err != nil {
+		t.Fatalf("Put() failed: %v", err)
+	}
+	if err := store.Put(ctx, "rooms/1/short", strings.NewReader("abc"), 10, "text/plain"); err == nil {
+		t.Errorf("Expected a truncated upload to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blobs", "rooms", "1", "short")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no blob after a failed upload, got %v", err)
+	}
+
+	body, err := store.Get(ctx, "rooms/1/map")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "the cellar" {
+		t.Errorf("Expected the stored content, got %q", got)
+	}
+
+	if err := store.Delete(ctx, "rooms/1/map"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if err := store.Delete(ctx, "rooms/1/map"); err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed, got %v", err)
+	}
+	if _, err := store.Get(ctx, "rooms/1/map"); !errors.Is(err, ports.ErrBlobNotFound) {
+		t.Errorf("Expected ErrBlobNotFound, got %v", err)
+	}
+	for _, key := range []string{"", "/etc/passwd", "../outside", "rooms/../../outside"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Expected key %q to be refused", key)
+		}
+	}
+}
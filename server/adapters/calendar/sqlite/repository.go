@@ -0,0 +1,329 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteCalendarRepository implements ports.CalendarRepository
+var _ ports.CalendarRepository = (*SQLiteCalendarRepository)(nil)
+
+// SQLiteCalendarRepository implements the ports.CalendarRepository interface using SQLite.
+type SQLiteCalendarRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteCalendarRepository creates a new instance of SQLiteCalendarRepository.
+func NewSQLiteCalendarRepository(db *sql.DB) *SQLiteCalendarRepository {
+	return &SQLiteCalendarRepository{db: db}
+}
+
+// InitCalendarSchema creates the `calendar_events`, `event_attendees`,
+// `event_reminders` and `calendar_feeds` tables if they don't already exist.
+// Reminder offsets are stored as a JSON array of minutes.
+func (s *SQLiteCalendarRepository) InitCalendarSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS calendar_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		starts_at DATETIME NOT NULL,
+		timezone TEXT NOT NULL,
+		duration INTEGER NOT NULL DEFAULT 0,
+		reminders TEXT NOT NULL DEFAULT '[]',
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_calendar_events_room ON calendar_events (room_id, starts_at);
+	CREATE TABLE IF NOT EXISTS event_attendees (
+		event_id INTEGER NOT NULL REFERENCES calendar_events(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		response TEXT NOT NULL,
+		responded_at DATETIME NOT NULL,
+		PRIMARY KEY (event_id, user_id)
+	);
+	CREATE TABLE IF NOT EXISTS event_reminders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL REFERENCES calendar_events(id) ON DELETE CASCADE,
+		due_at DATETIME NOT NULL,
+		sent_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_event_reminders_due ON event_reminders (sent_at, due_at);
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		user_id TEXT NOT NULL,
+		prefix TEXT NOT NULL UNIQUE,
+		hash TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (room_id, user_id)
+	);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing calendar schema: %v", err)
+		return err
+	}
+	log.Println("Calendar schema initialized successfully.")
+	return nil
+}
+
+const eventColumns = "id, room_id, title, description, starts_at, timezone, duration, reminders, created_by, created_at, updated_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanEvent(row rowScanner) (*models.CalendarEvent, error) {
+	var e models.CalendarEvent
+	var reminders string
+	var updatedAt sql.NullTime
+	if err := row.Scan(&e.ID, &e.RoomID, &e.Title, &e.Description, &e.StartsAt, &e.Timezone, &e.Duration, &reminders, &e.CreatedBy, &e.CreatedAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(reminders), &e.Reminders); err != nil {
+		return nil, err
+	}
+	if updatedAt.Valid {
+		e.UpdatedAt = &updatedAt.Time
+	}
+	return &e, nil
+}
+
+// CreateEvent stores a new event and sets event.ID to the generated ID.
+func (s *SQLiteCalendarRepository) CreateEvent(event *models.CalendarEvent) error {
+	reminders, err := json.Marshal(event.Reminders)
+	if err != nil {
+		log.Printf("Error encoding reminders: %v", err)
+		return err
+	}
+	res, err := s.db.Exec("INSERT INTO calendar_events (room_id, title, description, starts_at, timezone, duration, reminders, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.RoomID, event.Title, event.Description, event.StartsAt, event.Timezone, event.Duration, string(reminders), event.CreatedBy, event.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating event %s in room %d: %v", event.Title, event.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created event: %v", err)
+		return err
+	}
+	event.ID = id
+	return nil
+}
+
+// GetEvent retrieves an event with its attendees.
+// Returns (nil, nil) if the event does not exist.
+func (s *SQLiteCalendarRepository) GetEvent(id int64) (*models.CalendarEvent, error) {
+	event, err := scanEvent(s.db.QueryRow("SELECT "+eventColumns+" FROM calendar_events WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Event not found
+	}
+	if err != nil {
+		log.Printf("Error scanning event %d: %v", id, err)
+		return nil, err
+	}
+	if event.Attendees, err = s.attendees(id); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// ListEvents retrieves the events of a room starting at or after from, soonest first.
+func (s *SQLiteCalendarRepository) ListEvents(roomID int64, from time.Time) ([]models.CalendarEvent, error) {
+	rows, err := s.db.Query("SELECT "+eventColumns+" FROM calendar_events WHERE room_id = ? AND starts_at >= ? ORDER BY starts_at ASC, id ASC", roomID, from)
+	if err != nil {
+		log.Printf("Error querying events of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.CalendarEvent{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			log.Printf("Error scanning event row: %v", err)
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating event rows: %v", err)
+		return nil, err
+	}
+	rows.Close()
+	for i := range events {
+		if events[i].Attendees, err = s.attendees(events[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// attendees retrieves the answers to an event in the order they were first given.
+func (s *SQLiteCalendarRepository) attendees(eventID int64) ([]models.Attendee, error) {
+	rows, err := s.db.Query("SELECT user_id, name, response, responded_at FROM event_attendees WHERE event_id = ? ORDER BY rowid ASC", eventID)
+	if err != nil {
+		log.Printf("Error querying attendees of event %d: %v", eventID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []models.Attendee{}
+	for rows.Next() {
+		var a models.Attendee
+		if err := rows.Scan(&a.UserID, &a.Name, &a.Response, &a.RespondedAt); err != nil {
+			log.Printf("Error scanning attendee row: %v", err)
+			return nil, err
+		}
+		attendees = append(attendees, a)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating attendee rows: %v", err)
+		return nil, err
+	}
+	return attendees, nil
+}
+
+// UpdateEvent saves the details, reminder offsets and update time of an event.
+func (s *SQLiteCalendarRepository) UpdateEvent(event *models.CalendarEvent) error {
+	reminders, err := json.Marshal(event.Reminders)
+	if err != nil {
+		log.Printf("Error encoding reminders: %v", err)
+		return err
+	}
+	_, err = s.db.Exec("UPDATE calendar_events SET title = ?, description = ?, starts_at = ?, timezone = ?, duration = ?, reminders = ?, updated_at = ? WHERE id = ?",
+		event.Title, event.Description, event.StartsAt, event.Timezone, event.Duration, string(reminders), event.UpdatedAt, event.ID)
+	if err != nil {
+		log.Printf("Error updating event %d: %v", event.ID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteEvent removes an event with its attendees and reminders in one transaction.
+func (s *SQLiteCalendarRepository) DeleteEvent(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		"DELETE FROM event_attendees WHERE event_id = ?",
+		"DELETE FROM event_reminders WHERE event_id = ?",
+		"DELETE FROM calendar_events WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			log.Printf("Error deleting event %d: %v", id, err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveAttendee creates or replaces a member's answer to an event.
+func (s *SQLiteCalendarRepository) SaveAttendee(eventID int64, a models.Attendee) error {
+	_, err := s.db.Exec(`INSERT INTO event_attendees (event_id, user_id, name, response, responded_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(event_id, user_id) DO UPDATE SET name = excluded.name, response = excluded.response, responded_at = excluded.responded_at`,
+		eventID, a.UserID, a.Name, a.Response, a.RespondedAt)
+	if err != nil {
+		log.Printf("Error saving answer of %s to event %d: %v", a.UserID, eventID, err)
+		return err
+	}
+	return nil
+}
+
+// ScheduleReminders replaces the unsent reminders of an event in one transaction.
+func (s *SQLiteCalendarRepository) ScheduleReminders(eventID int64, dueAt []time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM event_reminders WHERE event_id = ? AND sent_at IS NULL", eventID); err != nil {
+		log.Printf("Error deleting reminders of event %d: %v", eventID, err)
+		return err
+	}
+	for _, due := range dueAt {
+		if _, err := tx.Exec("INSERT INTO event_reminders (event_id, due_at) VALUES (?, ?)", eventID, due); err != nil {
+			log.Printf("Error scheduling reminder of event %d: %v", eventID, err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DueReminders retrieves up to limit unsent reminders due at or before now, oldest first.
+func (s *SQLiteCalendarRepository) DueReminders(now time.Time, limit int) ([]models.Reminder, error) {
+	rows, err := s.db.Query("SELECT id, event_id, due_at FROM event_reminders WHERE sent_at IS NULL AND due_at <= ? ORDER BY due_at ASC, id ASC LIMIT ?", now, limit)
+	if err != nil {
+		log.Printf("Error querying due reminders: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []models.Reminder{}
+	for rows.Next() {
+		var r models.Reminder
+		if err := rows.Scan(&r.ID, &r.EventID, &r.DueAt); err != nil {
+			log.Printf("Error scanning reminder row: %v", err)
+			return nil, err
+		}
+		reminders = append(reminders, r)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating reminder rows: %v", err)
+		return nil, err
+	}
+	return reminders, nil
+}
+
+// MarkReminderSent records that a reminder was handled.
+func (s *SQLiteCalendarRepository) MarkReminderSent(id int64, sentAt time.Time) error {
+	if _, err := s.db.Exec("UPDATE event_reminders SET sent_at = ? WHERE id = ?", sentAt, id); err != nil {
+		log.Printf("Error marking reminder %d as sent: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// SaveCalendarFeed creates or replaces the feed of a member of a room and
+// sets feed.ID to its ID.
+func (s *SQLiteCalendarRepository) SaveCalendarFeed(feed *models.CalendarFeed) error {
+	err := s.db.QueryRow(`INSERT INTO calendar_feeds (room_id, user_id, prefix, hash, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(room_id, user_id) DO UPDATE SET prefix = excluded.prefix, hash = excluded.hash, created_at = excluded.created_at
+		RETURNING id`,
+		feed.RoomID, feed.UserID, feed.Prefix, feed.Hash, feed.CreatedAt).Scan(&feed.ID)
+	if err != nil {
+		log.Printf("Error saving calendar feed of %s in room %d: %v", feed.UserID, feed.RoomID, err)
+		return err
+	}
+	return nil
+}
+
+// GetCalendarFeedByPrefix retrieves a feed by the public prefix of its token.
+// Returns (nil, nil) if no feed has the prefix.
+func (s *SQLiteCalendarRepository) GetCalendarFeedByPrefix(prefix string) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	err := s.db.QueryRow("SELECT id, room_id, user_id, prefix, hash, created_at FROM calendar_feeds WHERE prefix = ?", prefix).
+		Scan(&feed.ID, &feed.RoomID, &feed.UserID, &feed.Prefix, &feed.Hash, &feed.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil // Feed not found
+	}
+	if err != nil {
+		log.Printf("Error scanning calendar feed %s: %v", prefix, err)
+		return nil, err
+	}
+	return &feed, nil
+}
@@ -0,0 +1,141 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteCharacterRepository implements ports.CharacterRepository
+var _ ports.CharacterRepository = (*SQLiteCharacterRepository)(nil)
+
+// SQLiteCharacterRepository implements the ports.CharacterRepository interface using SQLite.
+type SQLiteCharacterRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteCharacterRepository creates a new instance of SQLiteCharacterRepository.
+func NewSQLiteCharacterRepository(db *sql.DB) *SQLiteCharacterRepository {
+	return &SQLiteCharacterRepository{db: db}
+}
+
+// InitCharacterSchema creates the `characters` table if it doesn't already exist.
+// Sheets are stored as JSON text.
+func (s *SQLiteCharacterRepository) InitCharacterSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS characters (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		owner_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		avatar_url TEXT NOT NULL DEFAULT '',
+		template TEXT NOT NULL,
+		sheet TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_characters_room_name ON characters (room_id, name COLLATE NOCASE);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing character schema: %v", err)
+		return err
+	}
+	log.Println("Character schema initialized successfully.")
+	return nil
+}
+
+const characterColumns = "id, room_id, owner_id, name, avatar_url, template, sheet, created_at, updated_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCharacter(row rowScanner) (*models.Character, error) {
+	var c models.Character
+	var sheet string
+	if err := row.Scan(&c.ID, &c.RoomID, &c.OwnerID, &c.Name, &c.AvatarURL, &c.Template, &sheet, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.Sheet = []byte(sheet)
+	return &c, nil
+}
+
+// CreateCharacter stores a new character and sets character.ID to the generated ID.
+func (s *SQLiteCharacterRepository) CreateCharacter(character *models.Character) error {
+	res, err := s.db.Exec("INSERT INTO characters (room_id, owner_id, name, avatar_url, template, sheet, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		character.RoomID, character.OwnerID, character.Name, character.AvatarURL, character.Template, string(character.Sheet), character.CreatedAt, character.UpdatedAt)
+	if err != nil {
+		log.Printf("Error creating character %s in room %d: %v", character.Name, character.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created character: %v", err)
+		return err
+	}
+	character.ID = id
+	return nil
+}
+
+// GetCharacter retrieves a character by ID.
+// Returns (nil, nil) if the character does not exist.
+func (s *SQLiteCharacterRepository) GetCharacter(id int64) (*models.Character, error) {
+	c, err := scanCharacter(s.db.QueryRow("SELECT "+characterColumns+" FROM characters WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Character not found
+	}
+	if err != nil {
+		log.Printf("Error scanning character %d: %v", id, err)
+		return nil, err
+	}
+	return c, nil
+}
+
+// ListCharacters retrieves the characters of a room ordered by name.
+func (s *SQLiteCharacterRepository) ListCharacters(roomID int64) ([]models.Character, error) {
+	rows, err := s.db.Query("SELECT "+characterColumns+" FROM characters WHERE room_id = ? ORDER BY name COLLATE NOCASE ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying characters of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	characters := []models.Character{}
+	for rows.Next() {
+		c, err := scanCharacter(rows)
+		if err != nil {
+			log.Printf("Error scanning character row: %v", err)
+			return nil, err
+		}
+		characters = append(characters, *c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating character rows: %v", err)
+		return nil, err
+	}
+	return characters, nil
+}
+
+// UpdateCharacter saves the name, avatar, sheet and update time of a character.
+func (s *SQLiteCharacterRepository) UpdateCharacter(character *models.Character) error {
+	_, err := s.db.Exec("UPDATE characters SET name = ?, avatar_url = ?, sheet = ?, updated_at = ? WHERE id = ?",
+		character.Name, character.AvatarURL, string(character.Sheet), character.UpdatedAt, character.ID)
+	if err != nil {
+		log.Printf("Error updating character %d: %v", character.ID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCharacter removes a character.
+func (s *SQLiteCharacterRepository) DeleteCharacter(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM characters WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting character %d: %v", id, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteCommandRepository implements ports.CommandRepository
+var _ ports.CommandRepository = (*SQLiteCommandRepository)(nil)
+
+// SQLiteCommandRepository implements the ports.CommandRepository interface using SQLite.
+type SQLiteCommandRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteCommandRepository creates a new instance of SQLiteCommandRepository.
+func NewSQLiteCommandRepository(db *sql.DB) *SQLiteCommandRepository {
+	return &SQLiteCommandRepository{db: db}
+}
+
+// InitCommandSchema creates the `commands` table if it doesn't already exist.
+func (s *SQLiteCommandRepository) InitCommandSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS commands (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		usage TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL DEFAULT '',
+		service_account_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		UNIQUE (service_account_id, name)
+	);
+	CREATE INDEX IF NOT EXISTS idx_commands_name ON commands (name);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing command schema: %v", err)
+		return err
+	}
+	log.Println("Command schema initialized successfully.")
+	return nil
+}
+
+const commandColumns = "id, name, usage, description, service_account_id, url, secret, created_at"
+
+// CreateCommand stores a new command and sets cmd.ID to the generated ID.
+func (s *SQLiteCommandRepository) CreateCommand(cmd *models.Command) error {
+	res, err := s.db.Exec("INSERT INTO commands (name, usage, description, service_account_id, url, secret, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		cmd.Name, cmd.Usage, cmd.Description, cmd.ServiceAccountID, cmd.URL, cmd.Secret, cmd.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating command /%s: %v", cmd.Name, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created command: %v", err)
+		return err
+	}
+	cmd.ID = id
+	return nil
+}
+
+// GetCommand retrieves a command of a service account by name.
+// Returns (nil, nil) if the service account has no command with that name.
+func (s *SQLiteCommandRepository) GetCommand(serviceAccountID, name string) (*models.Command, error) {
+	var cmd models.Command
+	err := s.db.QueryRow("SELECT "+commandColumns+" FROM commands WHERE service_account_id = ? AND name = ?", serviceAccountID, name).
+		Scan(&cmd.ID, &cmd.Name, &cmd.Usage, &cmd.Description, &cmd.ServiceAccountID, &cmd.URL, &cmd.Secret, &cmd.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil // Command not found
+	}
+	if err != nil {
+		log.Printf("Error scanning command /%s: %v", name, err)
+		return nil, err
+	}
+	return &cmd, nil
+}
+
+// ListCommandsNamed retrieves the commands of every service account with
+// that name, oldest first.
+func (s *SQLiteCommandRepository) ListCommandsNamed(name string) ([]models.Command, error) {
+	return s.queryCommands("SELECT "+commandColumns+" FROM commands WHERE name = ? ORDER BY id ASC", name)
+}
+
+// ListCommands retrieves the commands of a service account, or all commands
+// if serviceAccountID is empty, ordered by name.
+func (s *SQLiteCommandRepository) ListCommands(serviceAccountID string) ([]models.Command, error) {
+	query, args := "SELECT "+commandColumns+" FROM commands", []interface{}{}
+	if serviceAccountID != "" {
+		query += " WHERE service_account_id = ?"
+		args = append(args, serviceAccountID)
+	}
+	return s.queryCommands(query+" ORDER BY name ASC, id ASC", args...)
+}
+
+func (s *SQLiteCommandRepository) queryCommands(query string, args ...interface{}) ([]models.Command, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error querying commands: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []models.Command{}
+	for rows.Next() {
+		var cmd models.Command
+		if err := rows.Scan(&cmd.ID, &cmd.Name, &cmd.Usage, &cmd.Description, &cmd.ServiceAccountID, &cmd.URL, &cmd.Secret, &cmd.CreatedAt); err != nil {
+			log.Printf("Error scanning command row: %v", err)
+			return nil, err
+		}
+		commands = append(commands, cmd)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating command rows: %v", err)
+		return nil, err
+	}
+	return commands, nil
+}
+
+// DeleteCommand removes a command.
+func (s *SQLiteCommandRepository) DeleteCommand(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM commands WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting command %d: %v", id, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteFileRepository implements ports.FileRepository
+var _ ports.FileRepository = (*SQLiteFileRepository)(nil)
+
+// SQLiteFileRepository implements the ports.FileRepository interface using SQLite.
+type SQLiteFileRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteFileRepository creates a new instance of SQLiteFileRepository.
+func NewSQLiteFileRepository(db *sql.DB) *SQLiteFileRepository {
+	return &SQLiteFileRepository{db: db}
+}
+
+// InitFileSchema creates the `files` table if it doesn't already exist, and
+// adds the image columns to tables created before them. Files that have not
+// been posted have a message_id of 0.
+func (s *SQLiteFileRepository) InitFileSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL DEFAULT 0,
+		uploaded_by TEXT NOT NULL,
+		name TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		thumbnails TEXT NOT NULL DEFAULT '', -- JSON array, '' if none
+		blob_key TEXT NOT NULL UNIQUE,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_files_message ON files (message_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing file schema: %v", err)
+		return err
+	}
+	if err := s.ensureColumns(
+		"width INTEGER NOT NULL DEFAULT 0",
+		"height INTEGER NOT NULL DEFAULT 0",
+		"thumbnails TEXT NOT NULL DEFAULT ''",
+	); err != nil {
+		log.Printf("Error upgrading file schema: %v", err)
+		return err
+	}
+	log.Println("File schema initialized successfully.")
+	return nil
+}
+
+// ensureColumns adds the given column definitions to the files table if
+// their columns are missing.
+func (s *SQLiteFileRepository) ensureColumns(definitions ...string) error {
+	rows, err := s.db.Query("SELECT name FROM pragma_table_info('files')")
+	if err != nil {
+		return fmt.Errorf("failed to read columns of files: %w", err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan columns of files: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns of files: %w", err)
+	}
+	for _, definition := range definitions {
+		name, _, _ := strings.Cut(definition, " ")
+		if existing[name] {
+			continue
+		}
+		if _, err := s.db.Exec("ALTER TABLE files ADD COLUMN " + definition); err != nil {
+			return fmt.Errorf("failed to add column files.%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+const fileColumns = "id, room_id, message_id, uploaded_by, name, content_type, size, width, height, thumbnails, blob_key, created_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFile(row rowScanner) (*models.File, error) {
+	var file models.File
+	var thumbnails string
+	if err := row.Scan(&file.ID, &file.RoomID, &file.MessageID, &file.UploadedBy, &file.Name, &file.ContentType, &file.Size, &file.Width, &file.Height, &thumbnails, &file.Key, &file.CreatedAt); err != nil {
+		return nil, err
+	}
+	if thumbnails != "" {
+		if err := json.Unmarshal([]byte(thumbnails), &file.Thumbnails); err != nil {
+			return nil, fmt.Errorf("decoding thumbnails of file %d: %w", file.ID, err)
+		}
+	}
+	return &file, nil
+}
+
+// CreateFile stores a new file and sets file.ID to the generated ID.
+func (s *SQLiteFileRepository) CreateFile(file *models.File) error {
+	var thumbnails string
+	if len(file.Thumbnails) > 0 {
+		b, err := json.Marshal(file.Thumbnails)
+		if err != nil {
+			log.Printf("Error encoding thumbnails of file in room %d: %v", file.RoomID, err)
+			return err
+		}
+		thumbnails = string(b)
+	}
+	res, err := s.db.Exec("INSERT INTO files (room_id, message_id, uploaded_by, name, content_type, size, width, height, thumbnails, blob_key, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		file.RoomID, file.MessageID, file.UploadedBy, file.Name, file.ContentType, file.Size, file.Width, file.Height, thumbnails, file.Key, file.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating file in room %d: %v", file.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created file: %v", err)
+		return err
+	}
+	file.ID = id
+	return nil
+}
+
+// GetFile retrieves a file by ID.
+// Returns (nil, nil) if the file does not exist.
+func (s *SQLiteFileRepository) GetFile(id int64) (*models.File, error) {
+	file, err := scanFile(s.db.QueryRow("SELECT "+fileColumns+" FROM files WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error getting file %d: %v", id, err)
+		return nil, err
+	}
+	return file, nil
+}
+
+// AttachFiles links files that have not been posted to a message.
+func (s *SQLiteFileRepository) AttachFiles(messageID int64, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []interface{}{messageID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := "UPDATE files SET message_id = ? WHERE message_id = 0 AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	if _, err := s.db.Exec(query, args...); err != nil {
+		log.Printf("Error attaching files to message %d: %v", messageID, err)
+		return err
+	}
+	return nil
+}
+
+// ListMessageFiles returns the files of a message, oldest first.
+func (s *SQLiteFileRepository) ListMessageFiles(messageID int64) ([]models.File, error) {
+	rows, err := s.db.Query("SELECT "+fileColumns+" FROM files WHERE message_id = ? ORDER BY id", messageID)
+	if err != nil {
+		log.Printf("Error listing files of message %d: %v", messageID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			log.Printf("Error scanning file row: %v", err)
+			return nil, err
+		}
+		files = append(files, *file)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating file rows: %v", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// DeleteFile removes a file.
+func (s *SQLiteFileRepository) DeleteFile(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM files WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting file %d: %v", id, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteInitiativeRepository implements ports.InitiativeRepository
+var _ ports.InitiativeRepository = (*SQLiteInitiativeRepository)(nil)
+
+// SQLiteInitiativeRepository implements the ports.InitiativeRepository interface using SQLite.
+type SQLiteInitiativeRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteInitiativeRepository creates a new instance of SQLiteInitiativeRepository.
+func NewSQLiteInitiativeRepository(db *sql.DB) *SQLiteInitiativeRepository {
+	return &SQLiteInitiativeRepository{db: db}
+}
+
+// InitInitiativeSchema creates the `initiative` and `combatants` tables if
+// they don't already exist. Rolls are stored as JSON text, and combatants
+// without initiative have NULL.
+func (s *SQLiteInitiativeRepository) InitInitiativeSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS initiative (
+		room_id INTEGER PRIMARY KEY,
+		round INTEGER NOT NULL DEFAULT 0,
+		turn_id INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS combatants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		character_id INTEGER NOT NULL DEFAULT 0,
+		owner_id TEXT NOT NULL,
+		dice TEXT NOT NULL DEFAULT '',
+		initiative INTEGER,
+		roll TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_combatants_room ON combatants (room_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing initiative schema: %v", err)
+		return err
+	}
+	log.Println("Initiative schema initialized successfully.")
+	return nil
+}
+
+// GetInitiative retrieves the round and turn of a room's turn order.
+// Returns (nil, nil) if the room has none.
+func (s *SQLiteInitiativeRepository) GetInitiative(roomID int64) (*models.Initiative, error) {
+	initiative := models.Initiative{RoomID: roomID}
+	err := s.db.QueryRow("SELECT round, turn_id, updated_at FROM initiative WHERE room_id = ?", roomID).
+		Scan(&initiative.Round, &initiative.TurnID, &initiative.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil // No turn order
+	}
+	if err != nil {
+		log.Printf("Error scanning initiative of room %d: %v", roomID, err)
+		return nil, err
+	}
+	return &initiative, nil
+}
+
+// SaveInitiative creates or updates the round, turn and update time of a room's turn order.
+func (s *SQLiteInitiativeRepository) SaveInitiative(initiative *models.Initiative) error {
+	_, err := s.db.Exec(`INSERT INTO initiative (room_id, round, turn_id, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(room_id) DO UPDATE SET round = excluded.round, turn_id = excluded.turn_id, updated_at = excluded.updated_at`,
+		initiative.RoomID, initiative.Round, initiative.TurnID, initiative.UpdatedAt)
+	if err != nil {
+		log.Printf("Error saving initiative of room %d: %v", initiative.RoomID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteInitiative removes a room's turn order and its combatants in one transaction.
+func (s *SQLiteInitiativeRepository) DeleteInitiative(roomID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM combatants WHERE room_id = ?", roomID); err != nil {
+		log.Printf("Error deleting combatants of room %d: %v", roomID, err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM initiative WHERE room_id = ?", roomID); err != nil {
+		log.Printf("Error deleting initiative of room %d: %v", roomID, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+const combatantColumns = "id, room_id, name, character_id, owner_id, dice, initiative, roll, created_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCombatant(row rowScanner) (*models.Combatant, error) {
+	var c models.Combatant
+	var initiative sql.NullInt64
+	var roll string
+	if err := row.Scan(&c.ID, &c.RoomID, &c.Name, &c.CharacterID, &c.OwnerID, &c.Dice, &initiative, &roll, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	if initiative.Valid {
+		value := int(initiative.Int64)
+		c.Initiative = &value
+	}
+	if roll != "" {
+		if err := json.Unmarshal([]byte(roll), &c.Roll); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// CreateCombatant stores a new combatant and sets combatant.ID to the generated ID.
+func (s *SQLiteInitiativeRepository) CreateCombatant(combatant *models.Combatant) error {
+	roll, err := encodeRoll(combatant.Roll)
+	if err != nil {
+		log.Printf("Error encoding initiative roll: %v", err)
+		return err
+	}
+	res, err := s.db.Exec("INSERT INTO combatants (room_id, name, character_id, owner_id, dice, initiative, roll, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		combatant.RoomID, combatant.Name, combatant.CharacterID, combatant.OwnerID, combatant.Dice, combatant.Initiative, roll, combatant.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating combatant %s in room %d: %v", combatant.Name, combatant.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created combatant: %v", err)
+		return err
+	}
+	combatant.ID = id
+	return nil
+}
+
+// ListCombatants retrieves the combatants of a room in the order they were added.
+func (s *SQLiteInitiativeRepository) ListCombatants(roomID int64) ([]models.Combatant, error) {
+	rows, err := s.db.Query("SELECT "+combatantColumns+" FROM combatants WHERE room_id = ? ORDER BY id ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying combatants of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	combatants := []models.Combatant{}
+	for rows.Next() {
+		c, err := scanCombatant(rows)
+		if err != nil {
+			log.Printf("Error scanning combatant row: %v", err)
+			return nil, err
+		}
+		combatants = append(combatants, *c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating combatant rows: %v", err)
+		return nil, err
+	}
+	return combatants, nil
+}
+
+// UpdateCombatant saves the initiative and roll of a combatant.
+func (s *SQLiteInitiativeRepository) UpdateCombatant(combatant *models.Combatant) error {
+	roll, err := encodeRoll(combatant.Roll)
+	if err != nil {
+		log.Printf("Error encoding initiative roll: %v", err)
+		return err
+	}
+	if _, err := s.db.Exec("UPDATE combatants SET initiative = ?, roll = ? WHERE id = ?", combatant.Initiative, roll, combatant.ID); err != nil {
+		log.Printf("Error updating combatant %d: %v", combatant.ID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCombatant removes a combatant.
+func (s *SQLiteInitiativeRepository) DeleteCombatant(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM combatants WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting combatant %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// encodeRoll stores a roll as a JSON object, or "" if there is none.
+func encodeRoll(roll *models.Roll) (string, error) {
+	if roll == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(roll)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,231 @@
+package smtp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"keeper/server/adapters/mail/smtp"
+	"keeper/server/models"
+)
+
+// received is an email as the sink got it.
+type received struct {
+	from string
+	to   []string
+	data string
+}
+
+// sink is a local SMTP server that accepts every email, like MailSlurper.
+type sink struct {
+	listener net.Listener
+	mu       sync.Mutex
+	mails    []received
+}
+
+// startSink listens on a free local port, with TLS from the first byte if
+// config is set.
+func startSink(t *testing.T, config *tls.Config) *sink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	s := &sink{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *sink) addr() string { return s.listener.Addr().String() }
+
+func (s *sink) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.mails...)
+}
+
+func (s *sink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ESMTP")
+	var mail received
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			tp.PrintfLine("250-sink")
+			tp.PrintfLine("250 8BITMIME")
+		case "HELO", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "RSET":
+			mail = received{}
+			tp.PrintfLine("250 OK")
+		case "MAIL":
+			mail.from = path(arg)
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, path(arg))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			mail.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, mail)
+			s.mu.Unlock()
+			mail = received{}
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// path returns the address in the argument of MAIL or RCPT, e.g.
+// "FROM:<a@example.com> BODY=8BITMIME".
+func path(arg string) string {
+	_, rest, _ := strings.Cut(arg, "<")
+	address, _, _ := strings.Cut(rest, ">")
+	return address
+}
+
+// selfSigned returns a TLS config with a throwaway certificate for 127.0.0.1.
+func selfSigned(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestMailer_Send(t *testing.T) {
+	s := startSink(t, nil)
+	mailer, err := smtp.NewMailer(smtp.Config{URI: "smtp://" + s.addr() + "/", From: "Keeper Chat <no-reply@keeper.example>"})
+	if err != nil {
+		t.Fatalf("NewMailer() failed: %v", err)
+	}
+
+	email := models.Email{
+		To:      "annie@example.com",
+		ToName:  "Annie Wilkes",
+		Subject: "2 unread mentions in Café\r\nBcc: everyone@example.com",
+		Text:    "Keeper in #table: @annie the door is open\n\n" + strings.Repeat("Iä! ", 40) + "\n.\nend",
+	}
+	if err := mailer.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	mails := s.received()
+	if len(mails) != 1 || mails[0].from != "no-reply@keeper.example" || len(mails[0].to) != 1 || mails[0].to[0] != "annie@example.com" {
+		t.Fatalf("Expected one email from no-reply to annie, got %+v", mails)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	if err != nil {
+		t.Fatalf("Failed to parse the email: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "2 unread mentions in Café Bcc: everyone@example.com" {
+		t.Errorf("Expected the subject on one line, got %q (%v)", subject, err)
+	}
+	if msg.Header.Get("Bcc") != "" {
+		t.Errorf("Expected no header to be injected, got Bcc %q", msg.Header.Get("Bcc"))
+	}
+	if to, err := msg.Header.AddressList("To"); err != nil || to[0].Name != "Annie Wilkes" {
+		t.Errorf("Expected the recipient's name, got %v (%v)", to, err)
+	}
+	if msg.Header.Get("Message-ID") == "" || msg.Header.Get("Date") == "" {
+		t.Errorf("Expected Message-ID and Date headers, got %v", msg.Header)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("Failed to decode the body: %v", err)
+	}
+	if want := email.Text + "\n"; string(body) != want { // The sink reads lines without CR
+		t.Errorf("Unexpected body:\n%q\nwant\n%q", body, want)
+	}
+}
+
+func TestMailer_SendImplicitTLS(t *testing.T) {
+	s := startSink(t, selfSigned(t))
+	email := models.Email{To: "annie@example.com", Subject: "Hi", Text: "Hello"}
+
+	strict, err := smtp.NewMailer(smtp.Config{URI: "smtps://" + s.addr(), From: "no-reply@keeper.example", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewMailer() failed: %v", err)
+	}
+	if err := strict.Send(context.Background(), email); err == nil {
+		t.Error("Expected the self-signed certificate to be refused")
+	}
+
+	lenient, err := smtp.NewMailer(smtp.Config{URI: "smtps://test:test@" + s.addr() + "/?skip_ssl_verify=true", From: "no-reply@keeper.example"})
+	if err != nil {
+		t.Fatalf("NewMailer() failed: %v", err)
+	}
+	if err := lenient.Send(context.Background(), email); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+	if mails := s.received(); len(mails) != 1 {
+		t.Errorf("Expected one email, got %+v", mails)
+	}
+}
+
+func TestNewMailer_Invalid(t *testing.T) {
+	for _, cfg := range []smtp.Config{
+		{URI: "http://mail.example.com", From: "no-reply@keeper.example"},
+		{URI: "smtp://", From: "no-reply@keeper.example"},
+		{URI: "smtp://mail.example.com", From: "not an address"},
+	} {
+		if _, err := smtp.NewMailer(cfg); err == nil {
+			t.Errorf("NewMailer(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteMentionRepository implements ports.MentionRepository
+var _ ports.MentionRepository = (*SQLiteMentionRepository)(nil)
+
+// SQLiteMentionRepository implements the ports.MentionRepository interface using SQLite.
+type SQLiteMentionRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteMentionRepository creates a new instance of SQLiteMentionRepository.
+func NewSQLiteMentionRepository(db *sql.DB) *SQLiteMentionRepository {
+	return &SQLiteMentionRepository{db: db}
+}
+
+// InitMentionSchema creates the `mentions` table if it doesn't already
+// exist. A message mentions each user at most once.
+func (s *SQLiteMentionRepository) InitMentionSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS mentions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		room_id INTEGER NOT NULL,
+		message_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		read_at DATETIME,
+		UNIQUE (message_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions (user_id, id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing mention schema: %v", err)
+		return err
+	}
+	log.Println("Mention schema initialized successfully.")
+	return nil
+}
+
+// CreateMention stores a mention and sets its ID, unless the message already
+// mentioned the user.
+func (s *SQLiteMentionRepository) CreateMention(mention *models.Mention) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO mentions (user_id, room_id, message_id, kind, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (message_id, user_id) DO NOTHING`,
+		mention.UserID, mention.RoomID, mention.MessageID, mention.Kind, mention.CreatedAt)
+	if err != nil {
+		log.Printf("Error saving mention of %s in message %d: %v", mention.UserID, mention.MessageID, err)
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of saved mention: %v", err)
+		return false, err
+	}
+	mention.ID = id
+	return true, nil
+}
+
+// ListMentions returns a page of a user's mentions, newest first.
+func (s *SQLiteMentionRepository) ListMentions(query ports.MentionQuery) ([]models.Mention, error) {
+	sqlQuery := "SELECT id, user_id, room_id, message_id, kind, created_at, read_at FROM mentions WHERE user_id = ?"
+	args := []interface{}{query.UserID}
+	if query.UnreadOnly {
+		sqlQuery += " AND read_at IS NULL"
+	}
+	if query.BeforeID > 0 {
+		sqlQuery += " AND id < ?"
+		args = append(args, query.BeforeID)
+	}
+	if query.AfterID > 0 {
+		sqlQuery += " AND id > ?"
+		args = append(args, query.AfterID)
+	}
+	limit := query.Limit
+	if limit <= 0 || limit > ports.MaxMessagePageSize {
+		limit = ports.MaxMessagePageSize
+	}
+	if query.OldestFirst {
+		sqlQuery += " ORDER BY id LIMIT ?"
+	} else {
+		sqlQuery += " ORDER BY id DESC LIMIT ?"
+	}
+	args = append(args, limit)
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		log.Printf("Error querying mentions of %s: %v", query.UserID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []models.Mention{}
+	for rows.Next() {
+		var m models.Mention
+		var readAt sql.NullTime
+		if err := rows.Scan(&m.ID, &m.UserID, &m.RoomID, &m.MessageID, &m.Kind, &m.CreatedAt, &readAt); err != nil {
+			log.Printf("Error scanning mention row: %v", err)
+			return nil, err
+		}
+		if readAt.Valid {
+			m.ReadAt = &readAt.Time
+		}
+		mentions = append(mentions, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating mention rows: %v", err)
+		return nil, err
+	}
+	return mentions, nil
+}
+
+// ListUnreadMentionUsers returns the IDs of the users who have unread mentions.
+func (s *SQLiteMentionRepository) ListUnreadMentionUsers() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT user_id FROM mentions WHERE read_at IS NULL ORDER BY user_id")
+	if err != nil {
+		log.Printf("Error querying users with unread mentions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("Error scanning user with unread mentions: %v", err)
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+// MarkMentionsRead marks the given unread mentions of the user as read, or
+// all of them if ids is empty.
+func (s *SQLiteMentionRepository) MarkMentionsRead(userID string, ids []int64, t time.Time) (int64, error) {
+	query := "UPDATE mentions SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{t, userID}
+	if len(ids) > 0 {
+		query += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	res, err := s.db.Exec(query, args...)
+	if err != nil {
+		log.Printf("Error marking mentions of %s as read: %v", userID, err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteMessageMentions removes the mentions of a deleted message.
+func (s *SQLiteMentionRepository) DeleteMessageMentions(messageID int64) error {
+	if _, err := s.db.Exec("DELETE FROM mentions WHERE message_id = ?", messageID); err != nil {
+		log.Printf("Error deleting mentions of message %d: %v", messageID, err)
+		return err
+	}
+	return nil
+}
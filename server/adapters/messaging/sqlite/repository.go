@@ -2,7 +2,9 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"log"
+	"slices"
 	"time" // Included for completeness, may be used by specific timestamp logic later
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
@@ -25,6 +27,7 @@ func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
 }
 
 // InitSchema creates the necessary database schema (tables) if they don't already exist.
+// Columns added after the first release are appended to existing tables.
 func (s *SQLiteRepository) InitSchema() error {
 	query := `
 	CREATE TABLE IF NOT EXISTS messages (
@@ -38,14 +41,74 @@ func (s *SQLiteRepository) InitSchema() error {
 		log.Printf("Error initializing schema: %v", err)
 		return err
 	}
+	err = ensureColumns(s.db, "messages", []column{
+		{"room_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"user_id", "TEXT NOT NULL DEFAULT ''"},
+		{"author_type", "TEXT NOT NULL DEFAULT 'user'"},
+		{"edited_at", "DATETIME"},
+		{"attachments", "TEXT NOT NULL DEFAULT ''"},
+		{"kind", "TEXT NOT NULL DEFAULT ''"},
+		{"roll", "TEXT NOT NULL DEFAULT ''"},
+		{"visible_to", "TEXT NOT NULL DEFAULT ''"},
+		{"revealed_at", "DATETIME"},
+		{"character_id", "INTEGER NOT NULL DEFAULT 0"},
+		{"character_name", "TEXT NOT NULL DEFAULT ''"},
+		{"character_avatar_url", "TEXT NOT NULL DEFAULT ''"},
+		{"in_character", "INTEGER NOT NULL DEFAULT 0"},
+		{"files", "TEXT NOT NULL DEFAULT ''"},
+		{"previews", "TEXT NOT NULL DEFAULT ''"},
+		{"format", "TEXT NOT NULL DEFAULT ''"},
+		{"html", "TEXT NOT NULL DEFAULT ''"},
+	})
+	if err != nil {
+		log.Printf("Error migrating messages schema: %v", err)
+		return err
+	}
+	if _, err := s.db.Exec("CREATE INDEX IF NOT EXISTS idx_messages_room_timestamp ON messages (room_id, timestamp)"); err != nil {
+		log.Printf("Error creating messages index: %v", err)
+		return err
+	}
 	log.Println("Database schema initialized successfully.")
 	return nil
 }
 
 // SaveMessage saves a new message to the SQLite database.
-// The ID of the message is automatically generated by the database.
+// The ID of the message is automatically generated by the database;
+// use CreateMessage when the caller needs it.
 func (s *SQLiteRepository) SaveMessage(msg models.Message) error {
-	query := "INSERT INTO messages (user, text, timestamp) VALUES (?, ?, ?)"
+	return s.CreateMessage(&msg)
+}
+
+// CreateMessage saves a new message and sets msg.ID to the generated ID.
+func (s *SQLiteRepository) CreateMessage(msg *models.Message) error {
+	if msg.AuthorType == "" {
+		msg.AuthorType = models.AuthorTypeUser
+	}
+	attachments, err := encodeAttachments(msg.Attachments)
+	if err != nil {
+		log.Printf("Error encoding message attachments: %v", err)
+		return err
+	}
+	files, err := encodeFiles(msg.Files)
+	if err != nil {
+		log.Printf("Error encoding message files: %v", err)
+		return err
+	}
+	roll, err := encodeRoll(msg.Roll)
+	if err != nil {
+		log.Printf("Error encoding message roll: %v", err)
+		return err
+	}
+	visibleTo, err := encodeVisibleTo(msg.VisibleTo)
+	if err != nil {
+		log.Printf("Error encoding message visibility: %v", err)
+		return err
+	}
+	var character models.Speaker
+	if msg.Character != nil {
+		character = *msg.Character
+	}
+	query := "INSERT INTO messages (room_id, user_id, user, author_type, kind, text, format, html, attachments, files, roll, visible_to, character_id, character_name, character_avatar_url, in_character, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	stmt, err := s.db.Prepare(query)
 	if err != nil {
 		log.Printf("Error preparing save message statement: %v", err)
@@ -53,32 +116,189 @@ func (s *SQLiteRepository) SaveMessage(msg models.Message) error {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(msg.User, msg.Text, msg.Timestamp)
+	res, err := stmt.Exec(msg.RoomID, msg.UserID, msg.User, msg.AuthorType, msg.Kind, msg.Text, msg.Format, msg.HTML, attachments, files, roll, visibleTo,
+		character.ID, character.Name, character.AvatarURL, msg.InCharacter, msg.Timestamp)
 	if err != nil {
 		log.Printf("Error executing save message statement: %v", err)
 		return err
 	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of saved message: %v", err)
+		return err
+	}
+	msg.ID = id
 	return nil
 }
 
+// messageColumns are the columns read by scanMessage, in order.
+const messageColumns = "id, room_id, user_id, user, author_type, kind, text, format, html, attachments, files, previews, roll, visible_to, " +
+	"character_id, character_name, character_avatar_url, in_character, timestamp, edited_at, revealed_at"
+
 // GetMessages retrieves all messages from the SQLite database, ordered by timestamp.
 func (s *SQLiteRepository) GetMessages() ([]models.Message, error) {
-	query := "SELECT id, user, text, timestamp FROM messages ORDER BY timestamp ASC"
+	query := "SELECT " + messageColumns + " FROM messages ORDER BY timestamp ASC"
 	rows, err := s.db.Query(query)
 	if err != nil {
 		log.Printf("Error querying messages: %v", err)
 		return nil, err
 	}
+	return scanMessages(rows)
+}
+
+// GetMessage retrieves a message by ID.
+// Returns (nil, nil) if the message does not exist.
+func (s *SQLiteRepository) GetMessage(id int64) (*models.Message, error) {
+	rows, err := s.db.Query("SELECT "+messageColumns+" FROM messages WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Error querying message %d: %v", id, err)
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return nil, err // Message not found if both are nil
+	}
+	return &messages[0], nil
+}
+
+// ListMessages retrieves a page of a room's history in chronological order:
+// the newest query.Limit messages older than query.BeforeID (if set),
+// leaving out those hidden from query.Viewer (if set) and, with
+// query.InCharacter, out-of-character ones.
+func (s *SQLiteRepository) ListMessages(query ports.MessageQuery) ([]models.Message, error) {
+	limit := query.Limit
+	if limit <= 0 || limit > ports.MaxMessagePageSize {
+		limit = ports.MaxMessagePageSize
+	}
+	sqlQuery := "SELECT " + messageColumns + " FROM messages WHERE room_id = ?"
+	args := []interface{}{query.RoomID}
+	if query.BeforeID > 0 {
+		sqlQuery += " AND id < ?"
+		args = append(args, query.BeforeID)
+	}
+	if query.AfterID > 0 {
+		sqlQuery += " AND id > ?"
+		args = append(args, query.AfterID)
+	}
+	if query.Viewer != "" {
+		sqlQuery += " AND (visible_to = '' OR EXISTS (SELECT 1 FROM json_each(messages.visible_to) WHERE value = ?))"
+		args = append(args, query.Viewer)
+	}
+	if query.InCharacter {
+		sqlQuery += " AND in_character = 1"
+	}
+	sqlQuery += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		log.Printf("Error querying messages of room %d: %v", query.RoomID, err)
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(messages)
+	return messages, nil
+}
+
+// UpdateMessage saves the text and its HTML, edit time, visibility and
+// reveal time of an existing message.
+func (s *SQLiteRepository) UpdateMessage(msg *models.Message) error {
+	visibleTo, err := encodeVisibleTo(msg.VisibleTo)
+	if err != nil {
+		log.Printf("Error encoding visibility of message %d: %v", msg.ID, err)
+		return err
+	}
+	_, err = s.db.Exec("UPDATE messages SET text = ?, html = ?, edited_at = ?, visible_to = ?, revealed_at = ? WHERE id = ?", msg.Text, msg.HTML, msg.EditedAt, visibleTo, msg.RevealedAt, msg.ID)
+	if err != nil {
+		log.Printf("Error updating message %d: %v", msg.ID, err)
+		return err
+	}
+	return nil
+}
+
+// SetMessagePreviews replaces the link previews of a message.
+func (s *SQLiteRepository) SetMessagePreviews(id int64, previews []models.LinkPreview) error {
+	var encoded string
+	if len(previews) > 0 {
+		b, err := json.Marshal(previews)
+		if err != nil {
+			log.Printf("Error encoding previews of message %d: %v", id, err)
+			return err
+		}
+		encoded = string(b)
+	}
+	if _, err := s.db.Exec("UPDATE messages SET previews = ? WHERE id = ?", encoded, id); err != nil {
+		log.Printf("Error updating previews of message %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteMessage removes a message.
+func (s *SQLiteRepository) DeleteMessage(id int64) error {
+	_, err := s.db.Exec("DELETE FROM messages WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Error deleting message %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// scanMessages reads all rows selected with messageColumns and closes rows.
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
 	defer rows.Close()
 
-	var messages []models.Message
+	messages := []models.Message{}
 	for rows.Next() {
 		var msg models.Message
 		var timestampStr string // Read timestamp as string first
-		if err := rows.Scan(&msg.ID, &msg.User, &msg.Text, &timestampStr); err != nil {
+		var attachments, files, previews, roll, visibleTo string
+		var character models.Speaker
+		var editedAt, revealedAt sql.NullTime
+		if err := rows.Scan(&msg.ID, &msg.RoomID, &msg.UserID, &msg.User, &msg.AuthorType, &msg.Kind, &msg.Text, &msg.Format, &msg.HTML, &attachments, &files, &previews, &roll, &visibleTo,
+			&character.ID, &character.Name, &character.AvatarURL, &msg.InCharacter, &timestampStr, &editedAt, &revealedAt); err != nil {
 			log.Printf("Error scanning message row: %v", err)
 			return nil, err
 		}
+		if attachments != "" {
+			if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+				log.Printf("Error decoding attachments of message %d: %v", msg.ID, err)
+				return nil, err
+			}
+		}
+		if files != "" {
+			if err := json.Unmarshal([]byte(files), &msg.Files); err != nil {
+				log.Printf("Error decoding files of message %d: %v", msg.ID, err)
+				return nil, err
+			}
+			for i := range msg.Files {
+				msg.Files[i].MessageID = msg.ID
+			}
+		}
+		if previews != "" {
+			if err := json.Unmarshal([]byte(previews), &msg.Previews); err != nil {
+				log.Printf("Error decoding previews of message %d: %v", msg.ID, err)
+				return nil, err
+			}
+		}
+		if roll != "" {
+			if err := json.Unmarshal([]byte(roll), &msg.Roll); err != nil {
+				log.Printf("Error decoding roll of message %d: %v", msg.ID, err)
+				return nil, err
+			}
+		}
+		if visibleTo != "" {
+			if err := json.Unmarshal([]byte(visibleTo), &msg.VisibleTo); err != nil {
+				log.Printf("Error decoding visibility of message %d: %v", msg.ID, err)
+				return nil, err
+			}
+		}
+		if character.ID != 0 {
+			msg.Character = &character
+		}
 		// Parse the timestamp string into time.Time
 		// SQLite DATETIME is typically YYYY-MM-DD HH:MM:SS
 		parsedTime, err := time.Parse("2006-01-02 15:04:05", timestampStr)
@@ -93,6 +313,12 @@ func (s *SQLiteRepository) GetMessages() ([]models.Message, error) {
 			}
 		}
 		msg.Timestamp = parsedTime
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Time
+		}
+		if revealedAt.Valid {
+			msg.RevealedAt = &revealedAt.Time
+		}
 		messages = append(messages, msg)
 	}
 
@@ -103,3 +329,71 @@ func (s *SQLiteRepository) GetMessages() ([]models.Message, error) {
 
 	return messages, nil
 }
+
+// encodeAttachments stores attachments as a JSON array, or "" if there are none.
+func encodeAttachments(attachments []models.Attachment) (string, error) {
+	if len(attachments) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(attachments)
+	return string(b), err
+}
+
+// encodeFiles stores the metadata of files as a JSON array, or "" if there
+// are none. Their message ID is left out, as it is not known yet.
+func encodeFiles(files []models.File) (string, error) {
+	if len(files) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(files)
+	return string(b), err
+}
+
+// encodeVisibleTo stores a visibility list as a JSON array, or "" if the
+// message is visible to everyone.
+func encodeVisibleTo(ids []string) (string, error) {
+	if len(ids) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(ids)
+	return string(b), err
+}
+
+// encodeRoll stores a roll as a JSON object, or "" if there is none.
+func encodeRoll(roll *models.Roll) (string, error) {
+	if roll == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(roll)
+	return string(b), err
+}
+
+// CountLegacyMessages returns how many messages by the given author name have
+// no author ID, i.e. were posted before identities were introduced.
+// The name is compared case-insensitively.
+func (s *SQLiteRepository) CountLegacyMessages(user string) (int64, error) {
+	var count int64
+	err := s.db.QueryRow("SELECT COUNT(*) FROM messages WHERE user_id = '' AND user = ? COLLATE NOCASE", user).Scan(&count)
+	if err != nil {
+		log.Printf("Error counting legacy messages of %s: %v", user, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// AssignLegacyMessages attributes the messages counted by CountLegacyMessages
+// to userID and returns how many were updated. Messages that already have an
+// author ID are left untouched, so calling it again is safe.
+func (s *SQLiteRepository) AssignLegacyMessages(user, userID string) (int64, error) {
+	res, err := s.db.Exec("UPDATE messages SET user_id = ? WHERE user_id = '' AND user = ? COLLATE NOCASE", userID, user)
+	if err != nil {
+		log.Printf("Error assigning legacy messages of %s: %v", user, err)
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Printf("Error reading updated legacy message count: %v", err)
+		return 0, err
+	}
+	return n, nil
+}
@@ -3,8 +3,10 @@ package sqlite_test
 import (
 	"database/sql"
 	"keeper/server/adapters/messaging/sqlite" // Package being tested
+	"keeper/server/core/ports"
 	"keeper/server/models"
 	"os"
+	"reflect"
 	"sort"
 	"testing"
 	"time"
@@ -315,3 +317,235 @@ func TestGetMessages_Empty(t *testing.T) {
 // - Error handling in DB operations (e.g., simulate DB connection failure - harder with in-memory)
 // - Concurrency tests if the repository is meant to be used concurrently (though SQLite has limitations)
 // - Test timestamp parsing in GetMessages with various formats if the DB could store them differently.
+
+func TestListMessages_Paging(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	base := time.Date(2024, 5, 1, 19, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		msg := &models.Message{RoomID: 1, UserID: "u", User: "U", Text: string(rune('a' + i)), Timestamp: base.Add(time.Duration(i) * time.Minute)}
+		if err := repo.CreateMessage(msg); err != nil {
+			t.Fatalf("CreateMessage() failed: %v", err)
+		}
+	}
+	if err := repo.CreateMessage(&models.Message{RoomID: 2, Text: "other room", Timestamp: base}); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	latest, err := repo.ListMessages(ports.MessageQuery{RoomID: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListMessages() failed: %v", err)
+	}
+	if len(latest) != 2 || latest[0].Text != "d" || latest[1].Text != "e" {
+		t.Fatalf("Expected the two latest messages in order, got %+v", latest)
+	}
+
+	older, err := repo.ListMessages(ports.MessageQuery{RoomID: 1, BeforeID: latest[0].ID})
+	if err != nil {
+		t.Fatalf("ListMessages() with BeforeID failed: %v", err)
+	}
+	if len(older) != 3 || older[0].Text != "a" || older[2].Text != "c" {
+		t.Errorf("Expected the three older messages, got %+v", older)
+	}
+}
+
+func TestListMessages_Viewer(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+	public := &models.Message{RoomID: 1, UserID: "keeper", Text: "You enter the library.", Timestamp: now}
+	whisper := &models.Message{RoomID: 1, UserID: "keeper", Text: "You notice a hidden door.", VisibleTo: []string{"keeper", "alice"}, Timestamp: now}
+	for _, msg := range []*models.Message{public, whisper} {
+		if err := repo.CreateMessage(msg); err != nil {
+			t.Fatalf("CreateMessage() failed: %v", err)
+		}
+	}
+
+	for viewer, want := range map[string]int{"alice": 2, "keeper": 2, "bob": 1, "": 2} {
+		got, err := repo.ListMessages(ports.MessageQuery{RoomID: 1, Viewer: viewer})
+		if err != nil || len(got) != want {
+			t.Errorf("Expected %d messages for viewer %q, got %+v, %v", want, viewer, got, err)
+		}
+	}
+
+	revealedAt := now.Truncate(time.Second)
+	whisper.VisibleTo, whisper.RevealedAt = nil, &revealedAt
+	if err := repo.UpdateMessage(whisper); err != nil {
+		t.Fatalf("UpdateMessage() failed: %v", err)
+	}
+	got, err := repo.ListMessages(ports.MessageQuery{RoomID: 1, Viewer: "bob"})
+	if err != nil || len(got) != 2 || got[1].VisibleTo != nil || got[1].RevealedAt == nil {
+		t.Errorf("Expected bob to see the revealed whisper, got %+v, %v", got, err)
+	}
+}
+
+func TestUpdateAndDeleteMessage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	msg := &models.Message{RoomID: 1, UserID: "u", User: "U", Text: "*tpyo*", Format: models.MessageFormatMarkdown, HTML: "<p><em>tpyo</em></p>", Timestamp: time.Now().UTC()}
+	if err := repo.CreateMessage(msg); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+	editedAt := time.Now().UTC().Truncate(time.Second)
+	msg.Text = "*typo*"
+	msg.HTML = "<p><em>typo</em></p>"
+	msg.EditedAt = &editedAt
+	if err := repo.UpdateMessage(msg); err != nil {
+		t.Fatalf("UpdateMessage() failed: %v", err)
+	}
+
+	got, err := repo.GetMessage(msg.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetMessage() returned %v, %v", got, err)
+	}
+	if got.Text != "*typo*" || got.Format != models.MessageFormatMarkdown || got.HTML != "<p><em>typo</em></p>" || got.EditedAt == nil || !got.EditedAt.Equal(editedAt) || got.AuthorType != models.AuthorTypeUser {
+		t.Errorf("Unexpected updated message: %+v", got)
+	}
+
+	if err := repo.DeleteMessage(msg.ID); err != nil {
+		t.Fatalf("DeleteMessage() failed: %v", err)
+	}
+	if got, err := repo.GetMessage(msg.ID); err != nil || got != nil {
+		t.Errorf("Expected (nil, nil) for a deleted message, got %v, %v", got, err)
+	}
+}
+
+func TestCreateMessage_Attachments(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	msg := &models.Message{
+		RoomID:      1,
+		UserID:      "wh_1",
+		User:        "CI",
+		AuthorType:  models.AuthorTypeWebhook,
+		Attachments: []models.Attachment{{Title: "Build #42 passed", URL: "https://ci.example.com/42", Color: "#1f883d"}},
+		Timestamp:   time.Now().UTC(),
+	}
+	if err := repo.CreateMessage(msg); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+	plain := &models.Message{RoomID: 1, UserID: "u", User: "U", Kind: models.MessageKindEmote, Text: "waves", Timestamp: time.Now().UTC()}
+	if err := repo.CreateMessage(plain); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	got, err := repo.GetMessage(msg.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetMessage() returned %v, %v", got, err)
+	}
+	if got.AuthorType != models.AuthorTypeWebhook || len(got.Attachments) != 1 || got.Attachments[0] != msg.Attachments[0] {
+		t.Errorf("Expected the attachment to round-trip, got %+v", got)
+	}
+	if got, _ := repo.GetMessage(plain.ID); got.Attachments != nil || got.Kind != models.MessageKindEmote {
+		t.Errorf("Expected an emote without attachments, got %+v", got)
+	}
+}
+
+func TestCreateMessage_Files(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	file := models.File{ID: 3, RoomID: 1, UploadedBy: "u", Name: "map.png", ContentType: "image/png", Size: 1024, URL: "/api/v1/files/3/content", Key: "rooms/1/abc", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	msg := &models.Message{RoomID: 1, UserID: "u", User: "U", Files: []models.File{file}, Timestamp: time.Now().UTC()}
+	if err := repo.CreateMessage(msg); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	got, err := repo.GetMessage(msg.ID)
+	if err != nil || got == nil || len(got.Files) != 1 {
+		t.Fatalf("GetMessage() returned %+v, %v", got, err)
+	}
+	want := file
+	want.MessageID, want.Key = msg.ID, ""
+	if !reflect.DeepEqual(got.Files[0], want) {
+		t.Errorf("Expected the file to round-trip without its blob key, got %+v", got.Files[0])
+	}
+}
+
+func TestCreateMessage_Roll(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	roll := &models.Roll{
+		Expression: "4d6kh3",
+		Label:      "Strength",
+		Terms:      []models.RollTerm{{Notation: "4d6kh3", Sides: 6, Dice: []models.Die{{Result: 6}, {Result: 1, Dropped: true}, {Result: 4}, {Result: 5}}, Value: 15}},
+		Total:      15,
+	}
+	msg := &models.Message{RoomID: 1, UserID: "u", User: "U", Kind: models.MessageKindRoll, Text: "rolled 4d6kh3", Roll: roll, Timestamp: time.Now().UTC()}
+	if err := repo.CreateMessage(msg); err != nil {
+		t.Fatalf("CreateMessage() failed: %v", err)
+	}
+
+	got, err := repo.GetMessage(msg.ID)
+	if err != nil || got == nil || got.Roll == nil {
+		t.Fatalf("GetMessage() returned %+v, %v", got, err)
+	}
+	if !reflect.DeepEqual(got.Roll, roll) {
+		t.Errorf("Expected the roll to round-trip, got %+v", got.Roll)
+	}
+}
+
+func TestListMessages_InCharacter(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+
+	now := time.Now().UTC()
+	speaker := &models.Speaker{ID: 7, Name: "Harvey Walters", AvatarURL: "https://example.com/harvey.png"}
+	messages := []*models.Message{
+		{RoomID: 1, UserID: "alice", Text: "Who goes there?", Character: speaker, InCharacter: true, Timestamp: now},
+		{RoomID: 1, UserID: "keeper", Text: "The lights go out.", InCharacter: true, Timestamp: now},
+		{RoomID: 1, UserID: "alice", Text: "brb, pizza", Timestamp: now},
+	}
+	for _, msg := range messages {
+		if err := repo.CreateMessage(msg); err != nil {
+			t.Fatalf("CreateMessage() failed: %v", err)
+		}
+	}
+
+	got, err := repo.ListMessages(ports.MessageQuery{RoomID: 1, InCharacter: true})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("Expected the two in-character messages, got %+v, %v", got, err)
+	}
+	if got[0].Character == nil || *got[0].Character != *speaker || !got[0].InCharacter {
+		t.Errorf("Expected the speaker to round-trip, got %+v", got[0])
+	}
+	if got[1].Character != nil || !got[1].InCharacter {
+		t.Errorf("Expected narration without a speaker, got %+v", got[1])
+	}
+	if all, err := repo.ListMessages(ports.MessageQuery{RoomID: 1}); err != nil || len(all) != 3 || all[2].InCharacter {
+		t.Errorf("Expected table talk in the full history, got %+v, %v", all, err)
+	}
+}
@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteRoomRepository implements ports.RoomRepository
+var _ ports.RoomRepository = (*SQLiteRoomRepository)(nil)
+
+// SQLiteRoomRepository implements the ports.RoomRepository interface using SQLite.
+type SQLiteRoomRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteRoomRepository creates a new instance of SQLiteRoomRepository.
+func NewSQLiteRoomRepository(db *sql.DB) *SQLiteRoomRepository {
+	return &SQLiteRoomRepository{db: db}
+}
+
+// InitRoomSchema creates the `rooms` and `room_members` tables if they don't already exist.
+func (s *SQLiteRoomRepository) InitRoomSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS rooms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_by TEXT NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS room_members (
+		room_id INTEGER NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+		user_id TEXT NOT NULL,
+		role TEXT NOT NULL,
+		joined_at DATETIME NOT NULL,
+		PRIMARY KEY (room_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_room_members_user ON room_members (user_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing room schema: %v", err)
+		return err
+	}
+	if err := ensureColumns(s.db, "rooms", []column{{"topic", "TEXT NOT NULL DEFAULT ''"}}); err != nil {
+		log.Printf("Error migrating rooms schema: %v", err)
+		return err
+	}
+	log.Println("Room schema initialized successfully.")
+	return nil
+}
+
+// CreateRoom adds a new room to the database and sets room.ID.
+func (s *SQLiteRoomRepository) CreateRoom(room *models.Room) error {
+	res, err := s.db.Exec("INSERT INTO rooms (name, topic, created_by, created_at) VALUES (?, ?, ?, ?)",
+		room.Name, room.Topic, room.CreatedBy, room.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating room '%s': %v", room.Name, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of room '%s': %v", room.Name, err)
+		return err
+	}
+	room.ID = id
+	return nil
+}
+
+// roomColumns are the columns read by scanRoom and scanRooms, in order.
+const roomColumns = "id, name, topic, created_by, created_at"
+
+// UpdateRoom saves the name and topic of an existing room.
+func (s *SQLiteRoomRepository) UpdateRoom(room *models.Room) error {
+	_, err := s.db.Exec("UPDATE rooms SET name = ?, topic = ? WHERE id = ?", room.Name, room.Topic, room.ID)
+	if err != nil {
+		log.Printf("Error updating room %d: %v", room.ID, err)
+		return err
+	}
+	return nil
+}
+
+// GetRoom retrieves a room by its ID.
+// Returns (nil, nil) if the room is not found.
+func (s *SQLiteRoomRepository) GetRoom(id int64) (*models.Room, error) {
+	row := s.db.QueryRow("SELECT "+roomColumns+" FROM rooms WHERE id = ?", id)
+	return scanRoom(row)
+}
+
+// GetRoomByName retrieves a room by its unique name.
+// Returns (nil, nil) if the room is not found.
+func (s *SQLiteRoomRepository) GetRoomByName(name string) (*models.Room, error) {
+	row := s.db.QueryRow("SELECT "+roomColumns+" FROM rooms WHERE name = ?", name)
+	return scanRoom(row)
+}
+
+// ListRooms retrieves all rooms ordered by name.
+func (s *SQLiteRoomRepository) ListRooms() ([]models.Room, error) {
+	rows, err := s.db.Query("SELECT " + roomColumns + " FROM rooms ORDER BY name ASC")
+	if err != nil {
+		log.Printf("Error querying rooms: %v", err)
+		return nil, err
+	}
+	return scanRooms(rows)
+}
+
+// ListRoomsForMember retrieves the rooms a user is a member of, ordered by name.
+func (s *SQLiteRoomRepository) ListRoomsForMember(userID string) ([]models.Room, error) {
+	query := `SELECT r.id, r.name, r.topic, r.created_by, r.created_at FROM rooms r
+		JOIN room_members m ON m.room_id = r.id
+		WHERE m.user_id = ? ORDER BY r.name ASC`
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		log.Printf("Error querying rooms of %s: %v", userID, err)
+		return nil, err
+	}
+	return scanRooms(rows)
+}
+
+// scanRooms reads all rows of a room query and closes rows.
+func scanRooms(rows *sql.Rows) ([]models.Room, error) {
+	defer rows.Close()
+
+	rooms := []models.Room{}
+	for rows.Next() {
+		var room models.Room
+		if err := rows.Scan(&room.ID, &room.Name, &room.Topic, &room.CreatedBy, &room.CreatedAt); err != nil {
+			log.Printf("Error scanning room row: %v", err)
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating room rows: %v", err)
+		return nil, err
+	}
+	return rooms, nil
+}
+
+// AddMember adds a user to a room. Adding an existing member updates their role
+// but keeps the original join time.
+func (s *SQLiteRoomRepository) AddMember(member models.RoomMember) error {
+	query := `
+	INSERT INTO room_members (room_id, user_id, role, joined_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT (room_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err := s.db.Exec(query, member.RoomID, member.UserID, member.Role, member.JoinedAt)
+	if err != nil {
+		log.Printf("Error adding member %s to room %d: %v", member.UserID, member.RoomID, err)
+		return err
+	}
+	return nil
+}
+
+// GetMember retrieves the membership of a user in a room.
+// Returns (nil, nil) if the user is not a member.
+func (s *SQLiteRoomRepository) GetMember(roomID int64, userID string) (*models.RoomMember, error) {
+	row := s.db.QueryRow("SELECT room_id, user_id, role, joined_at FROM room_members WHERE room_id = ? AND user_id = ?", roomID, userID)
+
+	var member models.RoomMember
+	err := row.Scan(&member.RoomID, &member.UserID, &member.Role, &member.JoinedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Not a member
+		}
+		log.Printf("Error scanning member %s of room %d: %v", userID, roomID, err)
+		return nil, err
+	}
+	return &member, nil
+}
+
+// ListMembers retrieves the members of a room in join order.
+func (s *SQLiteRoomRepository) ListMembers(roomID int64) ([]models.RoomMember, error) {
+	rows, err := s.db.Query("SELECT room_id, user_id, role, joined_at FROM room_members WHERE room_id = ? ORDER BY joined_at ASC, user_id ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying members of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.RoomMember{}
+	for rows.Next() {
+		var member models.RoomMember
+		if err := rows.Scan(&member.RoomID, &member.UserID, &member.Role, &member.JoinedAt); err != nil {
+			log.Printf("Error scanning member row: %v", err)
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating member rows: %v", err)
+		return nil, err
+	}
+	return members, nil
+}
+
+func scanRoom(row *sql.Row) (*models.Room, error) {
+	var room models.Room
+	err := row.Scan(&room.ID, &room.Name, &room.Topic, &room.CreatedBy, &room.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Room not found
+		}
+		log.Printf("Error scanning room row: %v", err)
+		return nil, err
+	}
+	return &room, nil
+}
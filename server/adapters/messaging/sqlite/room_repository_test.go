@@ -0,0 +1,138 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"keeper/server/adapters/messaging/sqlite"
+	"keeper/server/models"
+)
+
+func TestRoomRepository_CreateAndGet(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := sqlite.NewSQLiteRoomRepository(db)
+	if err := repo.InitRoomSchema(); err != nil {
+		t.Fatalf("InitRoomSchema() failed: %v", err)
+	}
+
+	room := &models.Room{Name: "general", CreatedBy: "alice-id", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := repo.CreateRoom(room); err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	if room.ID == 0 {
+		t.Fatal("Expected CreateRoom() to set the room ID")
+	}
+
+	byID, err := repo.GetRoom(room.ID)
+	if err != nil || byID == nil {
+		t.Fatalf("GetRoom() returned %v, %v", byID, err)
+	}
+	if byID.Name != "general" || byID.CreatedBy != "alice-id" {
+		t.Errorf("Unexpected room: %+v", byID)
+	}
+
+	byName, err := repo.GetRoomByName("general")
+	if err != nil || byName == nil || byName.ID != room.ID {
+		t.Errorf("GetRoomByName() returned %v, %v", byName, err)
+	}
+
+	missing, err := repo.GetRoomByName("nowhere")
+	if err != nil || missing != nil {
+		t.Errorf("Expected (nil, nil) for a missing room, got %v, %v", missing, err)
+	}
+
+	if err := repo.CreateRoom(&models.Room{Name: "general", CreatedAt: time.Now()}); err == nil {
+		t.Error("Expected duplicate room name to be rejected")
+	}
+
+	byID.Topic = "Session 12: the Dunwich horror"
+	if err := repo.UpdateRoom(byID); err != nil {
+		t.Fatalf("UpdateRoom() failed: %v", err)
+	}
+	if rooms, err := repo.ListRoomsForMember("nobody"); err != nil || len(rooms) != 0 {
+		t.Errorf("Expected no rooms for a non-member, got %v, %v", rooms, err)
+	}
+	if updated, _ := repo.GetRoom(room.ID); updated.Topic != byID.Topic {
+		t.Errorf("Expected the topic to be saved, got %+v", updated)
+	}
+}
+
+func TestRoomRepository_Members(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	repo := sqlite.NewSQLiteRoomRepository(db)
+	if err := repo.InitRoomSchema(); err != nil {
+		t.Fatalf("InitRoomSchema() failed: %v", err)
+	}
+	room := &models.Room{Name: "table", CreatedAt: time.Now()}
+	if err := repo.CreateRoom(room); err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+
+	joined := time.Now().UTC().Truncate(time.Second)
+	for _, m := range []models.RoomMember{
+		{RoomID: room.ID, UserID: "alice", Role: models.RoomRoleOwner, JoinedAt: joined},
+		{RoomID: room.ID, UserID: "bob", Role: models.RoomRoleMember, JoinedAt: joined.Add(time.Minute)},
+		// Re-adding updates the role but not the join time.
+		{RoomID: room.ID, UserID: "bob", Role: models.RoomRoleOwner, JoinedAt: joined.Add(time.Hour)},
+	} {
+		if err := repo.AddMember(m); err != nil {
+			t.Fatalf("AddMember(%+v) failed: %v", m, err)
+		}
+	}
+
+	members, err := repo.ListMembers(room.ID)
+	if err != nil {
+		t.Fatalf("ListMembers() failed: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 members, got %d", len(members))
+	}
+
+	bob, err := repo.GetMember(room.ID, "bob")
+	if err != nil || bob == nil {
+		t.Fatalf("GetMember() returned %v, %v", bob, err)
+	}
+	if bob.Role != models.RoomRoleOwner {
+		t.Errorf("Expected updated role '%s', got '%s'", models.RoomRoleOwner, bob.Role)
+	}
+	if !bob.JoinedAt.Equal(joined.Add(time.Minute)) {
+		t.Errorf("Expected original join time %v, got %v", joined.Add(time.Minute), bob.JoinedAt)
+	}
+
+	stranger, err := repo.GetMember(room.ID, "mallory")
+	if err != nil || stranger != nil {
+		t.Errorf("Expected (nil, nil) for a non-member, got %v, %v", stranger, err)
+	}
+}
+
+func TestInitSchema_MigratesLegacyMessages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// The original messages table, without room or author IDs.
+	_, err := db.Exec(`CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, user TEXT, text TEXT, timestamp DATETIME);
+		INSERT INTO messages (user, text, timestamp) VALUES ('Alice', 'legacy', '2023-01-01 10:00:00');`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+
+	repo := sqlite.NewSQLiteRepository(db)
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() on legacy table failed: %v", err)
+	}
+	if err := repo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() is not idempotent: %v", err)
+	}
+
+	messages, err := repo.GetMessages()
+	if err != nil {
+		t.Fatalf("GetMessages() failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].Text != "legacy" || messages[0].RoomID != 0 || messages[0].UserID != "" {
+		t.Errorf("Unexpected migrated messages: %+v", messages)
+	}
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// column is a column definition used by ensureColumns.
+type column struct {
+	name       string
+	definition string
+}
+
+// ensureColumns adds the given columns to table if they are missing, so that
+// databases created by older versions of the server are upgraded in place.
+func ensureColumns(db *sql.DB, table string, columns []column) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			typeName  string
+			notnull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &typeName, &notnull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan columns of %s: %w", table, err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	rows.Close()
+
+	for _, c := range columns {
+		if existing[c.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c.name, c.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, c.name, err)
+		}
+	}
+	return nil
+}
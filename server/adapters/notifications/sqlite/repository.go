@@ -0,0 +1,107 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteNotificationRepository implements ports.NotificationRepository
+var _ ports.NotificationRepository = (*SQLiteNotificationRepository)(nil)
+
+// SQLiteNotificationRepository implements the ports.NotificationRepository interface using SQLite.
+type SQLiteNotificationRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteNotificationRepository creates a new instance of SQLiteNotificationRepository.
+func NewSQLiteNotificationRepository(db *sql.DB) *SQLiteNotificationRepository {
+	return &SQLiteNotificationRepository{db: db}
+}
+
+// InitNotificationSchema creates the `notification_preferences` and
+// `notification_digests` tables if they don't already exist.
+func (s *SQLiteNotificationRepository) InitNotificationSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS notification_preferences (
+		user_id TEXT PRIMARY KEY,
+		email_digest TEXT NOT NULL,
+		mentions BOOLEAN NOT NULL,
+		direct_messages BOOLEAN NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS notification_digests (
+		user_id TEXT PRIMARY KEY,
+		last_mention_id INTEGER NOT NULL,
+		sent_at DATETIME NOT NULL
+	);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing notification schema: %v", err)
+		return err
+	}
+	log.Println("Notification schema initialized successfully.")
+	return nil
+}
+
+// GetPreferences returns the saved preferences of a user, or nil if they
+// never saved any.
+func (s *SQLiteNotificationRepository) GetPreferences(userID string) (*models.NotificationPreferences, error) {
+	prefs := models.NotificationPreferences{UserID: userID}
+	var updatedAt sql.NullTime
+	err := s.db.QueryRow("SELECT email_digest, mentions, direct_messages, updated_at FROM notification_preferences WHERE user_id = ?", userID).
+		Scan(&prefs.EmailDigest, &prefs.Mentions, &prefs.DirectMessages, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error getting notification preferences of %s: %v", userID, err)
+		return nil, err
+	}
+	if updatedAt.Valid {
+		prefs.UpdatedAt = &updatedAt.Time
+	}
+	return &prefs, nil
+}
+
+// SavePreferences creates or replaces the preferences of a user.
+func (s *SQLiteNotificationRepository) SavePreferences(prefs models.NotificationPreferences) error {
+	_, err := s.db.Exec(`INSERT INTO notification_preferences (user_id, email_digest, mentions, direct_messages, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET email_digest = excluded.email_digest, mentions = excluded.mentions,
+			direct_messages = excluded.direct_messages, updated_at = excluded.updated_at`,
+		prefs.UserID, prefs.EmailDigest, prefs.Mentions, prefs.DirectMessages, prefs.UpdatedAt)
+	if err != nil {
+		log.Printf("Error saving notification preferences of %s: %v", prefs.UserID, err)
+	}
+	return err
+}
+
+// GetDigestState returns what the digests of a user have covered, or nil if
+// they never got one.
+func (s *SQLiteNotificationRepository) GetDigestState(userID string) (*ports.DigestState, error) {
+	state := ports.DigestState{UserID: userID}
+	err := s.db.QueryRow("SELECT last_mention_id, sent_at FROM notification_digests WHERE user_id = ?", userID).
+		Scan(&state.LastMentionID, &state.SentAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error getting digest state of %s: %v", userID, err)
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveDigestState creates or replaces the digest state of a user.
+func (s *SQLiteNotificationRepository) SaveDigestState(state ports.DigestState) error {
+	_, err := s.db.Exec(`INSERT INTO notification_digests (user_id, last_mention_id, sent_at) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET last_mention_id = excluded.last_mention_id, sent_at = excluded.sent_at`,
+		state.UserID, state.LastMentionID, state.SentAt)
+	if err != nil {
+		log.Printf("Error saving digest state of %s: %v", state.UserID, err)
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteLinkPreviewRepository implements ports.LinkPreviewRepository
+var _ ports.LinkPreviewRepository = (*SQLiteLinkPreviewRepository)(nil)
+
+// SQLiteLinkPreviewRepository implements the ports.LinkPreviewRepository interface using SQLite.
+type SQLiteLinkPreviewRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteLinkPreviewRepository creates a new instance of SQLiteLinkPreviewRepository.
+func NewSQLiteLinkPreviewRepository(db *sql.DB) *SQLiteLinkPreviewRepository {
+	return &SQLiteLinkPreviewRepository{db: db}
+}
+
+// InitLinkPreviewSchema creates the `link_previews` table if it doesn't
+// already exist. Previews are stored as JSON.
+func (s *SQLiteLinkPreviewRepository) InitLinkPreviewSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS link_previews (
+		url TEXT PRIMARY KEY,
+		preview TEXT NOT NULL,
+		fetched_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_link_previews_fetched ON link_previews (fetched_at);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing link preview schema: %v", err)
+		return err
+	}
+	log.Println("Link preview schema initialized successfully.")
+	return nil
+}
+
+// GetLinkPreview retrieves the cached preview of a URL.
+// Returns (nil, zero time, nil) if it is not cached.
+func (s *SQLiteLinkPreviewRepository) GetLinkPreview(url string) (*models.LinkPreview, time.Time, error) {
+	var encoded string
+	var fetchedAt time.Time
+	err := s.db.QueryRow("SELECT preview, fetched_at FROM link_previews WHERE url = ?", url).Scan(&encoded, &fetchedAt)
+	if err == sql.ErrNoRows {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		log.Printf("Error getting preview of %s: %v", url, err)
+		return nil, time.Time{}, err
+	}
+	var preview models.LinkPreview
+	if err := json.Unmarshal([]byte(encoded), &preview); err != nil {
+		log.Printf("Error decoding preview of %s: %v", url, err)
+		return nil, time.Time{}, err
+	}
+	return &preview, fetchedAt, nil
+}
+
+// SaveLinkPreview caches a preview, replacing an older one of its URL.
+func (s *SQLiteLinkPreviewRepository) SaveLinkPreview(preview models.LinkPreview, fetchedAt time.Time) error {
+	encoded, err := json.Marshal(preview)
+	if err != nil {
+		log.Printf("Error encoding preview of %s: %v", preview.URL, err)
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO link_previews (url, preview, fetched_at) VALUES (?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET preview = excluded.preview, fetched_at = excluded.fetched_at`,
+		preview.URL, string(encoded), fetchedAt)
+	if err != nil {
+		log.Printf("Error saving preview of %s: %v", preview.URL, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteLinkPreviewsBefore removes previews fetched before t.
+func (s *SQLiteLinkPreviewRepository) DeleteLinkPreviewsBefore(t time.Time) (int64, error) {
+	res, err := s.db.Exec("DELETE FROM link_previews WHERE fetched_at < ?", t)
+	if err != nil {
+		log.Printf("Error deleting link previews: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
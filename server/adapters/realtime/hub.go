@@ -0,0 +1,146 @@
+// Package realtime fans room events out to connected WebSocket clients.
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+
+	"keeper/server/models"
+)
+
+// sendBufferSize is how many frames may queue up for a client before it is
+// considered too slow and disconnected.
+const sendBufferSize = 64
+
+// Client is one connection registered with the hub. Frames for it are read
+// from Send by the connection's writer.
+type Client struct {
+	ID    string // Principal ID, for logging
+	send  chan []byte
+	rooms map[int64]bool
+}
+
+// NewClient creates a client for the principal with the given ID.
+func NewClient(id string) *Client {
+	return &Client{ID: id, send: make(chan []byte, sendBufferSize), rooms: make(map[int64]bool)}
+}
+
+// Send returns the channel of frames to write to the connection. It is closed
+// when the client is unregistered or dropped for being too slow.
+func (c *Client) Send() <-chan []byte {
+	return c.send
+}
+
+// Hub tracks connected clients and the rooms they are subscribed to.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*Client]bool
+}
+
+// NewHub creates an empty hub.
+func NewHub() *Hub {
+	return &Hub{clients: make(map[*Client]bool)}
+}
+
+// Register adds a client to the hub.
+func (h *Hub) Register(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = true
+}
+
+// Unregister removes a client and closes its send channel. It is safe to call
+// for clients that were already dropped.
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+// Subscribe delivers events of the room to the client from now on.
+// Callers check that the client may read the room.
+func (h *Hub) Subscribe(c *Client, roomID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		c.rooms[roomID] = true
+	}
+}
+
+// Unsubscribe stops delivering events of the room to the client.
+func (h *Hub) Unsubscribe(c *Client, roomID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(c.rooms, roomID)
+}
+
+// Publish sends an event to every client subscribed to its room, or only to
+// the recipient's clients if the event has one. Personal events reach the
+// recipients' clients whether they are subscribed or not.
+func (h *Hub) Publish(event models.Event) {
+	frame, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshalling %s event: %v", event.Type, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if len(event.Recipients) > 0 && !slices.Contains(event.Recipients, c.ID) {
+			continue
+		}
+		if c.rooms[event.RoomID] || (event.Personal && len(event.Recipients) > 0) {
+			h.deliver(c, frame)
+		}
+	}
+}
+
+// IsOnline reports whether the principal has a connected client. It
+// implements ports.Presence.
+func (h *Hub) IsOnline(principalID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if c.ID == principalID {
+			return true
+		}
+	}
+	return false
+}
+
+// SendTo queues a frame for a single client, e.g. a reply or an error.
+func (h *Hub) SendTo(c *Client, v interface{}) {
+	frame, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error marshalling frame for %s: %v", c.ID, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		h.deliver(c, frame)
+	}
+}
+
+// deliver queues a frame without blocking; clients that fall too far behind
+// are dropped so one slow connection cannot stall the room. h.mu must be held.
+func (h *Hub) deliver(c *Client, frame []byte) {
+	select {
+	case c.send <- frame:
+	default:
+		log.Printf("Dropping WebSocket client %s: send buffer full", c.ID)
+		h.remove(c)
+	}
+}
+
+// remove deletes c and closes its channel. h.mu must be held.
+func (h *Hub) remove(c *Client) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
@@ -0,0 +1,122 @@
+package realtime_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"keeper/server/adapters/realtime"
+	"keeper/server/models"
+)
+
+func receive(t *testing.T, c *realtime.Client) (models.Event, bool) {
+	t.Helper()
+	select {
+	case frame, ok := <-c.Send():
+		if !ok {
+			return models.Event{}, false
+		}
+		var event models.Event
+		if err := json.Unmarshal(frame, &event); err != nil {
+			t.Fatalf("Failed to decode frame %s: %v", frame, err)
+		}
+		return event, true
+	default:
+		return models.Event{}, false
+	}
+}
+
+func TestHub_Publish_OnlySubscribedRooms(t *testing.T) {
+	hub := realtime.NewHub()
+	alice, bob := realtime.NewClient("alice"), realtime.NewClient("bob")
+	hub.Register(alice)
+	hub.Register(bob)
+	hub.Subscribe(alice, 1)
+	hub.Subscribe(bob, 2)
+
+	hub.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 1, Message: &models.Message{ID: 7, Text: "hi"}})
+
+	event, ok := receive(t, alice)
+	if !ok || event.Type != models.EventMessageCreated || event.Message.ID != 7 {
+		t.Errorf("Expected alice to receive the event, got %+v (ok %v)", event, ok)
+	}
+	if event, ok := receive(t, bob); ok {
+		t.Errorf("Expected bob not to receive events of room 1, got %+v", event)
+	}
+
+	hub.Unsubscribe(alice, 1)
+	hub.Publish(models.Event{Type: models.EventMessageDeleted, RoomID: 1, MessageID: 7})
+	if event, ok := receive(t, alice); ok {
+		t.Errorf("Expected no events after unsubscribing, got %+v", event)
+	}
+}
+
+func TestHub_Publish_OnlyToRecipients(t *testing.T) {
+	hub := realtime.NewHub()
+	alice, bob := realtime.NewClient("alice"), realtime.NewClient("bob")
+	hub.Register(alice)
+	hub.Register(bob)
+	hub.Subscribe(alice, 1)
+	hub.Subscribe(bob, 1)
+
+	hub.Publish(models.Event{Type: models.EventMessageEphemeral, RoomID: 1, Message: &models.Message{Text: "only for bob"}, Recipients: []string{"bob"}})
+
+	if event, ok := receive(t, bob); !ok || event.Message.Text != "only for bob" {
+		t.Errorf("Expected bob to receive the event, got %+v (ok %v)", event, ok)
+	}
+	if event, ok := receive(t, alice); ok {
+		t.Errorf("Expected alice not to receive bob's event, got %+v", event)
+	}
+}
+
+func TestHub_Publish_PersonalEvents(t *testing.T) {
+	hub := realtime.NewHub()
+	alice, bob := realtime.NewClient("alice"), realtime.NewClient("bob")
+	hub.Register(alice)
+	hub.Register(bob)
+	hub.Subscribe(bob, 2)
+
+	mention := &models.Mention{ID: 3, UserID: "alice", RoomID: 1, MessageID: 7}
+	hub.Publish(models.Event{Type: models.EventMentionCreated, RoomID: 1, Mention: mention, Recipients: []string{"alice"}, Personal: true})
+
+	if event, ok := receive(t, alice); !ok || event.Mention == nil || event.Mention.ID != 3 {
+		t.Errorf("Expected alice to receive the mention outside the room, got %+v (ok %v)", event, ok)
+	}
+	if event, ok := receive(t, bob); ok {
+		t.Errorf("Expected bob not to receive alice's mention, got %+v", event)
+	}
+}
+
+func TestHub_IsOnline(t *testing.T) {
+	hub := realtime.NewHub()
+	alice := realtime.NewClient("alice")
+	hub.Register(alice)
+
+	if !hub.IsOnline("alice") || hub.IsOnline("bob") {
+		t.Errorf("Expected only alice to be online")
+	}
+	hub.Unregister(alice)
+	if hub.IsOnline("alice") {
+		t.Errorf("Expected alice to be offline after unregistering")
+	}
+}
+
+func TestHub_DropsSlowClients(t *testing.T) {
+	hub := realtime.NewHub()
+	slow := realtime.NewClient("slow")
+	hub.Register(slow)
+	hub.Subscribe(slow, 1)
+
+	// Nobody reads from slow, so its buffer fills up and it gets dropped.
+	for i := 0; i < 100; i++ {
+		hub.Publish(models.Event{Type: models.EventMessageDeleted, RoomID: 1, MessageID: int64(i)})
+	}
+
+	frames := 0
+	for range slow.Send() {
+		frames++
+	}
+	if frames == 0 || frames >= 100 {
+		t.Errorf("Expected the buffered frames followed by a closed channel, got %d frames", frames)
+	}
+	hub.Unregister(slow) // Must not panic on an already dropped client.
+}
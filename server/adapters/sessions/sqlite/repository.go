@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteSessionRepository implements ports.SessionRepository
+var _ ports.SessionRepository = (*SQLiteSessionRepository)(nil)
+
+// SQLiteSessionRepository implements the ports.SessionRepository interface using SQLite.
+type SQLiteSessionRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteSessionRepository creates a new instance of SQLiteSessionRepository.
+func NewSQLiteSessionRepository(db *sql.DB) *SQLiteSessionRepository {
+	return &SQLiteSessionRepository{db: db}
+}
+
+// InitSessionSchema creates the `sessions` table if it doesn't already exist.
+// Running sessions have an end_message_id of 0.
+func (s *SQLiteSessionRepository) InitSessionSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		started_by TEXT NOT NULL,
+		start_message_id INTEGER NOT NULL,
+		end_message_id INTEGER NOT NULL DEFAULT 0,
+		started_at DATETIME NOT NULL,
+		ended_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_sessions_room ON sessions (room_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing session schema: %v", err)
+		return err
+	}
+	log.Println("Session schema initialized successfully.")
+	return nil
+}
+
+const sessionColumns = "id, room_id, title, started_by, start_message_id, end_message_id, started_at, ended_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	var endedAt sql.NullTime
+	if err := row.Scan(&session.ID, &session.RoomID, &session.Title, &session.StartedBy, &session.StartMessageID, &session.EndMessageID, &session.StartedAt, &endedAt); err != nil {
+		return nil, err
+	}
+	if endedAt.Valid {
+		session.EndedAt = &endedAt.Time
+	}
+	return &session, nil
+}
+
+// CreateSession stores a new session and sets session.ID to the generated ID.
+func (s *SQLiteSessionRepository) CreateSession(session *models.Session) error {
+	res, err := s.db.Exec("INSERT INTO sessions (room_id, title, started_by, start_message_id, end_message_id, started_at, ended_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		session.RoomID, session.Title, session.StartedBy, session.StartMessageID, session.EndMessageID, session.StartedAt, session.EndedAt)
+	if err != nil {
+		log.Printf("Error creating session in room %d: %v", session.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created session: %v", err)
+		return err
+	}
+	session.ID = id
+	return nil
+}
+
+// GetSession retrieves a session by ID.
+// Returns (nil, nil) if the session does not exist.
+func (s *SQLiteSessionRepository) GetSession(id int64) (*models.Session, error) {
+	session, err := scanSession(s.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Session not found
+	}
+	if err != nil {
+		log.Printf("Error scanning session %d: %v", id, err)
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions retrieves the sessions of a room, oldest first.
+func (s *SQLiteSessionRepository) ListSessions(roomID int64) ([]models.Session, error) {
+	rows, err := s.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE room_id = ? ORDER BY id ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying sessions of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			log.Printf("Error scanning session row: %v", err)
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating session rows: %v", err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// EndSession saves the end marker and time of a session.
+func (s *SQLiteSessionRepository) EndSession(session *models.Session) error {
+	_, err := s.db.Exec("UPDATE sessions SET end_message_id = ?, ended_at = ? WHERE id = ?", session.EndMessageID, session.EndedAt, session.ID)
+	if err != nil {
+		log.Printf("Error ending session %d: %v", session.ID, err)
+		return err
+	}
+	return nil
+}
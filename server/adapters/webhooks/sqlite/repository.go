@@ -0,0 +1,387 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Verify SQLiteWebhookRepository implements the webhook repositories
+var (
+	_ ports.WebhookRepository         = (*SQLiteWebhookRepository)(nil)
+	_ ports.IncomingWebhookRepository = (*SQLiteWebhookRepository)(nil)
+)
+
+// defaultDeliveryPageSize applies when a DeliveryQuery has no limit.
+const defaultDeliveryPageSize = 100
+
+// SQLiteWebhookRepository implements the ports.WebhookRepository and
+// ports.IncomingWebhookRepository interfaces using SQLite.
+type SQLiteWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteWebhookRepository creates a new instance of SQLiteWebhookRepository.
+func NewSQLiteWebhookRepository(db *sql.DB) *SQLiteWebhookRepository {
+	return &SQLiteWebhookRepository{db: db}
+}
+
+// InitWebhookSchema creates the `webhooks`, `webhook_deliveries` and
+// `incoming_webhooks` tables if they don't already exist.
+func (s *SQLiteWebhookRepository) InitWebhookSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhooks_room ON webhooks (room_id);
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_attempt_at DATETIME,
+		last_status_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		replay_of INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		delivered_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id);
+	CREATE TABLE IF NOT EXISTS incoming_webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		room_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL UNIQUE,
+		hash TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_incoming_webhooks_room ON incoming_webhooks (room_id);`
+	_, err := s.db.Exec(query)
+	if err != nil {
+		log.Printf("Error initializing webhook schema: %v", err)
+		return err
+	}
+	log.Println("Webhook schema initialized successfully.")
+	return nil
+}
+
+const webhookColumns = "id, room_id, url, secret, events, created_by, created_at"
+
+// CreateWebhook stores a new webhook and sets webhook.ID to the generated ID.
+func (s *SQLiteWebhookRepository) CreateWebhook(webhook *models.Webhook) error {
+	res, err := s.db.Exec("INSERT INTO webhooks (room_id, url, secret, events, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		webhook.RoomID, webhook.URL, webhook.Secret, strings.Join(webhook.Events, " "), webhook.CreatedBy, webhook.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating webhook for room %d: %v", webhook.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created webhook: %v", err)
+		return err
+	}
+	webhook.ID = id
+	return nil
+}
+
+// GetWebhook retrieves a webhook by ID.
+// Returns (nil, nil) if the webhook does not exist.
+func (s *SQLiteWebhookRepository) GetWebhook(id int64) (*models.Webhook, error) {
+	webhook, err := scanWebhook(s.db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Webhook not found
+	}
+	if err != nil {
+		log.Printf("Error scanning webhook %d: %v", id, err)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// ListWebhooks retrieves the webhooks of a room in creation order.
+func (s *SQLiteWebhookRepository) ListWebhooks(roomID int64) ([]models.Webhook, error) {
+	rows, err := s.db.Query("SELECT "+webhookColumns+" FROM webhooks WHERE room_id = ? ORDER BY id ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying webhooks of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			log.Printf("Error scanning webhook row: %v", err)
+			return nil, err
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating webhook rows: %v", err)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook together with its deliveries.
+func (s *SQLiteWebhookRepository) DeleteWebhook(id int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction to delete webhook %d: %v", id, err)
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		log.Printf("Error deleting deliveries of webhook %d: %v", id, err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting webhook %d: %v", id, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+const deliveryColumns = "id, webhook_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, last_status_code, last_error, replay_of, created_at, delivered_at"
+
+// CreateDelivery queues a delivery and sets delivery.ID to the generated ID.
+func (s *SQLiteWebhookRepository) CreateDelivery(delivery *models.WebhookDelivery) error {
+	res, err := s.db.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, status, attempts, next_attempt_at, replay_of, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		delivery.WebhookID, delivery.EventType, delivery.Payload, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ReplayOf, delivery.CreatedAt)
+	if err != nil {
+		log.Printf("Error queuing delivery for webhook %d: %v", delivery.WebhookID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of queued delivery: %v", err)
+		return err
+	}
+	delivery.ID = id
+	return nil
+}
+
+// GetDelivery retrieves a delivery by ID.
+// Returns (nil, nil) if the delivery does not exist.
+func (s *SQLiteWebhookRepository) GetDelivery(id int64) (*models.WebhookDelivery, error) {
+	delivery, err := scanDelivery(s.db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil // Delivery not found
+	}
+	if err != nil {
+		log.Printf("Error scanning delivery %d: %v", id, err)
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ListDeliveries retrieves deliveries matching query, newest first.
+func (s *SQLiteWebhookRepository) ListDeliveries(query ports.DeliveryQuery) ([]models.WebhookDelivery, error) {
+	where, args := []string{"1 = 1"}, []interface{}{}
+	if query.WebhookID != 0 {
+		where = append(where, "webhook_id = ?")
+		args = append(args, query.WebhookID)
+	}
+	if query.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, query.Status)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultDeliveryPageSize
+	}
+	args = append(args, limit)
+	return s.queryDeliveries("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT ?", args...)
+}
+
+// DueDeliveries retrieves pending deliveries due at or before now, oldest first.
+func (s *SQLiteWebhookRepository) DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.queryDeliveries("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at ASC, id ASC LIMIT ?",
+		models.DeliveryPending, now.UTC(), limit)
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt.
+func (s *SQLiteWebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	_, err := s.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+		last_status_code = ?, last_error = ?, delivered_at = ? WHERE id = ?`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.LastAttemptAt,
+		delivery.LastStatusCode, delivery.LastError, delivery.DeliveredAt, delivery.ID)
+	if err != nil {
+		log.Printf("Error updating delivery %d: %v", delivery.ID, err)
+		return err
+	}
+	return nil
+}
+
+const incomingWebhookColumns = "id, room_id, name, prefix, hash, created_by, created_at, last_used_at"
+
+// CreateIncomingWebhook stores a new incoming webhook and sets hook.ID to the generated ID.
+func (s *SQLiteWebhookRepository) CreateIncomingWebhook(hook *models.IncomingWebhook) error {
+	res, err := s.db.Exec("INSERT INTO incoming_webhooks (room_id, name, prefix, hash, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		hook.RoomID, hook.Name, hook.Prefix, hook.Hash, hook.CreatedBy, hook.CreatedAt)
+	if err != nil {
+		log.Printf("Error creating incoming webhook for room %d: %v", hook.RoomID, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error reading ID of created incoming webhook: %v", err)
+		return err
+	}
+	hook.ID = id
+	return nil
+}
+
+// GetIncomingWebhook retrieves an incoming webhook by ID.
+// Returns (nil, nil) if the webhook does not exist.
+func (s *SQLiteWebhookRepository) GetIncomingWebhook(id int64) (*models.IncomingWebhook, error) {
+	return s.getIncomingWebhook("id = ?", id)
+}
+
+// GetIncomingWebhookByPrefix retrieves an incoming webhook by its token prefix.
+// Returns (nil, nil) if no webhook has the prefix.
+func (s *SQLiteWebhookRepository) GetIncomingWebhookByPrefix(prefix string) (*models.IncomingWebhook, error) {
+	return s.getIncomingWebhook("prefix = ?", prefix)
+}
+
+func (s *SQLiteWebhookRepository) getIncomingWebhook(where string, arg interface{}) (*models.IncomingWebhook, error) {
+	hook, err := scanIncomingWebhook(s.db.QueryRow("SELECT "+incomingWebhookColumns+" FROM incoming_webhooks WHERE "+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, nil // Incoming webhook not found
+	}
+	if err != nil {
+		log.Printf("Error scanning incoming webhook (%s %v): %v", where, arg, err)
+		return nil, err
+	}
+	return hook, nil
+}
+
+// ListIncomingWebhooks retrieves the incoming webhooks of a room in creation order.
+func (s *SQLiteWebhookRepository) ListIncomingWebhooks(roomID int64) ([]models.IncomingWebhook, error) {
+	rows, err := s.db.Query("SELECT "+incomingWebhookColumns+" FROM incoming_webhooks WHERE room_id = ? ORDER BY id ASC", roomID)
+	if err != nil {
+		log.Printf("Error querying incoming webhooks of room %d: %v", roomID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []models.IncomingWebhook{}
+	for rows.Next() {
+		hook, err := scanIncomingWebhook(rows)
+		if err != nil {
+			log.Printf("Error scanning incoming webhook row: %v", err)
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating incoming webhook rows: %v", err)
+		return nil, err
+	}
+	return hooks, nil
+}
+
+// DeleteIncomingWebhook deletes an incoming webhook. Its messages are kept.
+func (s *SQLiteWebhookRepository) DeleteIncomingWebhook(id int64) error {
+	if _, err := s.db.Exec("DELETE FROM incoming_webhooks WHERE id = ?", id); err != nil {
+		log.Printf("Error deleting incoming webhook %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// TouchIncomingWebhook records the last use of an incoming webhook.
+func (s *SQLiteWebhookRepository) TouchIncomingWebhook(id int64, usedAt time.Time) error {
+	if _, err := s.db.Exec("UPDATE incoming_webhooks SET last_used_at = ? WHERE id = ?", usedAt, id); err != nil {
+		log.Printf("Error touching incoming webhook %d: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteWebhookRepository) queryDeliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Printf("Error querying webhook deliveries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			log.Printf("Error scanning delivery row: %v", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating delivery rows: %v", err)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	if err := row.Scan(&webhook.ID, &webhook.RoomID, &webhook.URL, &webhook.Secret, &events, &webhook.CreatedBy, &webhook.CreatedAt); err != nil {
+		return nil, err
+	}
+	webhook.Events = strings.Fields(events)
+	return &webhook, nil
+}
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var lastAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &lastAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.ReplayOf, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	d.LastAttemptAt = timePtr(lastAttemptAt)
+	d.DeliveredAt = timePtr(deliveredAt)
+	return &d, nil
+}
+
+func scanIncomingWebhook(row rowScanner) (*models.IncomingWebhook, error) {
+	var hook models.IncomingWebhook
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&hook.ID, &hook.RoomID, &hook.Name, &hook.Prefix, &hook.Hash, &hook.CreatedBy, &hook.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	hook.LastUsedAt = timePtr(lastUsedAt)
+	return &hook, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
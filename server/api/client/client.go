@@ -0,0 +1,250 @@
+// Package client is a Go client for the chat API described by api/openapi.yaml.
+// Its tests check every request it sends against that document, so the client
+// cannot drift from the server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
+)
+
+// Error is a non-2xx response from the server.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("keeper API: %d %s", e.StatusCode, e.Message)
+}
+
+// Client calls the chat API as a person (Kratos session token) or a service
+// account (API key).
+type Client struct {
+	baseURL    string
+	credential string
+
+	// HTTPClient performs the requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the server at baseURL, e.g. http://localhost:8080.
+// Credentials starting with kpr_ are sent as API keys, others as session tokens.
+func NewClient(baseURL, credential string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), credential: credential, HTTPClient: http.DefaultClient}
+}
+
+// MessageQuery selects a page of room history. Zero values are omitted.
+type MessageQuery struct {
+	Before      int64 // Only messages older than this ID
+	Limit       int   // 1 to 100
+	InCharacter bool  // Leave out table talk
+}
+
+// ListRooms returns the rooms the caller is a member of.
+func (c *Client) ListRooms(ctx context.Context) ([]models.Room, error) {
+	var resp struct {
+		Rooms []models.Room `json:"rooms"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/v1/rooms", nil, &resp)
+	return resp.Rooms, err
+}
+
+// CreateRoom creates a room owned by the caller.
+func (c *Client) CreateRoom(ctx context.Context, name string) (*models.Room, error) {
+	var room models.Room
+	if err := c.do(ctx, http.MethodPost, "/api/v1/rooms", map[string]string{"name": name}, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetRoom returns a room the caller is a member of.
+func (c *Client) GetRoom(ctx context.Context, roomID int64) (*models.Room, error) {
+	var room models.Room
+	if err := c.do(ctx, http.MethodGet, roomPath(roomID, ""), nil, &room); err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// ListMembers returns the members of a room.
+func (c *Client) ListMembers(ctx context.Context, roomID int64) ([]models.RoomMember, error) {
+	var resp struct {
+		Members []models.RoomMember `json:"members"`
+	}
+	err := c.do(ctx, http.MethodGet, roomPath(roomID, "/members"), nil, &resp)
+	return resp.Members, err
+}
+
+// AddMember adds a user or service account to a room. An empty role means member.
+func (c *Client) AddMember(ctx context.Context, roomID int64, userID, role string) (*models.RoomMember, error) {
+	body := map[string]string{"user_id": userID}
+	if role != "" {
+		body["role"] = role
+	}
+	var member models.RoomMember
+	if err := c.do(ctx, http.MethodPost, roomPath(roomID, "/members"), body, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// ListMessages returns a page of room history in chronological order.
+func (c *Client) ListMessages(ctx context.Context, roomID int64, query MessageQuery) ([]models.Message, error) {
+	params := url.Values{}
+	if query.Before > 0 {
+		params.Set("before", strconv.FormatInt(query.Before, 10))
+	}
+	if query.Limit > 0 {
+		params.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.InCharacter {
+		params.Set("in_character", "true")
+	}
+	path := roomPath(roomID, "/messages")
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var resp struct {
+		Messages []models.Message `json:"messages"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &resp)
+	return resp.Messages, err
+}
+
+// PostMessage posts a message to a room. Text starting with / runs a slash
+// command, whose answer may be an ephemeral message that is not stored.
+func (c *Client) PostMessage(ctx context.Context, roomID int64, text string) (*models.Message, error) {
+	var msg models.Message
+	if err := c.do(ctx, http.MethodPost, roomPath(roomID, "/messages"), map[string]string{"text": text}, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Roll rolls dice like "4d6kh3+2" on the server and posts the result to a
+// room. The label says what the roll is for and may be empty.
+func (c *Client) Roll(ctx context.Context, roomID int64, dice, label string) (*models.Message, error) {
+	var msg models.Message
+	if err := c.do(ctx, http.MethodPost, roomPath(roomID, "/rolls"), map[string]string{"dice": dice, "label": label}, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// EditMessage replaces the text of one of the caller's messages.
+func (c *Client) EditMessage(ctx context.Context, roomID, messageID int64, text string) (*models.Message, error) {
+	var msg models.Message
+	path := roomPath(roomID, "/messages/"+strconv.FormatInt(messageID, 10))
+	if err := c.do(ctx, http.MethodPatch, path, map[string]string{"text": text}, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DeleteMessage deletes a message.
+func (c *Client) DeleteMessage(ctx context.Context, roomID, messageID int64) error {
+	return c.do(ctx, http.MethodDelete, roomPath(roomID, "/messages/"+strconv.FormatInt(messageID, 10)), nil, nil)
+}
+
+// RevealMessage shows a whisper or hidden roll to the whole room.
+func (c *Client) RevealMessage(ctx context.Context, roomID, messageID int64) (*models.Message, error) {
+	var msg models.Message
+	path := roomPath(roomID, "/messages/"+strconv.FormatInt(messageID, 10)+"/reveal")
+	if err := c.do(ctx, http.MethodPost, path, nil, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SearchUsers searches the member directory by name, nickname or email.
+func (c *Client) SearchUsers(ctx context.Context, query string, limit int) ([]usersmanagement.PublicProfile, error) {
+	params := url.Values{}
+	if query != "" {
+		params.Set("q", query)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/api/users"
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	var resp struct {
+		Users []usersmanagement.PublicProfile `json:"users"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &resp)
+	return resp.Users, err
+}
+
+// GetUser returns the public profile of a member.
+func (c *Client) GetUser(ctx context.Context, id string) (*usersmanagement.PublicProfile, error) {
+	var profile usersmanagement.PublicProfile
+	if err := c.do(ctx, http.MethodGet, "/api/users/"+url.PathEscape(id), nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func roomPath(roomID int64, suffix string) string {
+	return "/api/v1/rooms/" + strconv.FormatInt(roomID, 10) + suffix
+}
+
+// do sends a JSON request and decodes a JSON response into out, if not nil.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encoding %s %s request: %w", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("building %s %s request: %w", method, path, err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if strings.HasPrefix(c.credential, "kpr_") {
+		req.Header.Set("Authorization", "Bearer "+c.credential)
+	} else if c.credential != "" {
+		req.Header.Set("X-Session-Token", c.credential)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			apiErr.Error = http.StatusText(resp.StatusCode)
+		}
+		return &Error{StatusCode: resp.StatusCode, Message: apiErr.Error}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"keeper/server/api"
+	"keeper/server/api/client"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// specServer validates every request against the OpenAPI document and answers
+// with canned bodies keyed by operation ID.
+func specServer(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+	doc.Servers = nil
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("Failed to build the OpenAPI router: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := router.FindRoute(r)
+		if err != nil {
+			t.Errorf("%s %s is not in the OpenAPI document: %v", r.Method, r.URL, err)
+			http.NotFound(w, r)
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			t.Errorf("%s (%s %s) does not match the spec: %v", route.Operation.OperationID, r.Method, r.URL, err)
+		}
+		body, ok := responses[route.Operation.OperationID]
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClient_RequestsMatchSpec(t *testing.T) {
+	message := `{"id": 3, "room_id": 1, "user": "Alice", "author_type": "user", "text": "hi", "timestamp": "2026-01-02T15:04:05Z"}`
+	server := specServer(t, map[string]string{
+		"listRooms":       `{"rooms": [{"id": 1, "name": "table"}]}`,
+		"createRoom":      `{"id": 1, "name": "table"}`,
+		"getRoom":         `{"id": 1, "name": "table"}`,
+		"listRoomMembers": `{"members": [{"room_id": 1, "user_id": "alice-id", "role": "owner"}]}`,
+		"addRoomMember":   `{"room_id": 1, "user_id": "sa_dice", "role": "member"}`,
+		"listMessages":    `{"messages": [` + message + `]}`,
+		"postMessage":     message,
+		"editMessage":     message,
+		"roll":            message,
+		"revealMessage":   message,
+		"listUsers":       `{"users": [{"id": "alice-id", "display_name": "Alice"}]}`,
+		"getUser":         `{"id": "alice-id", "display_name": "Alice"}`,
+	})
+	c := client.NewClient(server.URL, "kpr_key")
+	ctx := context.Background()
+
+	if rooms, err := c.ListRooms(ctx); err != nil || len(rooms) != 1 {
+		t.Errorf("ListRooms() = %v, %v", rooms, err)
+	}
+	if room, err := c.CreateRoom(ctx, "table"); err != nil || room.Name != "table" {
+		t.Errorf("CreateRoom() = %v, %v", room, err)
+	}
+	if _, err := c.GetRoom(ctx, 1); err != nil {
+		t.Errorf("GetRoom() failed: %v", err)
+	}
+	if members, err := c.ListMembers(ctx, 1); err != nil || len(members) != 1 {
+		t.Errorf("ListMembers() = %v, %v", members, err)
+	}
+	if _, err := c.AddMember(ctx, 1, "sa_dice", ""); err != nil {
+		t.Errorf("AddMember() failed: %v", err)
+	}
+	if messages, err := c.ListMessages(ctx, 1, client.MessageQuery{Before: 10, Limit: 50, InCharacter: true}); err != nil || len(messages) != 1 {
+		t.Errorf("ListMessages() = %v, %v", messages, err)
+	}
+	if msg, err := c.PostMessage(ctx, 1, "hi"); err != nil || msg.ID != 3 {
+		t.Errorf("PostMessage() = %v, %v", msg, err)
+	}
+	if _, err := c.Roll(ctx, 1, "4d6kh3", "Strength"); err != nil {
+		t.Errorf("Roll() failed: %v", err)
+	}
+	if _, err := c.EditMessage(ctx, 1, 3, "hi!"); err != nil {
+		t.Errorf("EditMessage() failed: %v", err)
+	}
+	if _, err := c.RevealMessage(ctx, 1, 3); err != nil {
+		t.Errorf("RevealMessage() failed: %v", err)
+	}
+	if err := c.DeleteMessage(ctx, 1, 3); err != nil {
+		t.Errorf("DeleteMessage() failed: %v", err)
+	}
+	if users, err := c.SearchUsers(ctx, "ali", 5); err != nil || len(users) != 1 {
+		t.Errorf("SearchUsers() = %v, %v", users, err)
+	}
+	if user, err := c.GetUser(ctx, "alice-id"); err != nil || user.DisplayName != "Alice" {
+		t.Errorf("GetUser() = %v, %v", user, err)
+	}
+}
+
+func TestClient_ReturnsAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": "Not a member of this room"}`))
+	}))
+	defer server.Close()
+
+	_, err := client.NewClient(server.URL, "session").PostMessage(context.Background(), 1, "hi")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Message != "Not a member of this room" {
+		t.Fatalf("Expected a 403 client.Error, got %v", err)
+	}
+}
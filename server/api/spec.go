@@ -0,0 +1,17 @@
+// Package api holds the machine-readable descriptions of the server's
+// interfaces: an OpenAPI 3 document for the HTTP API and an AsyncAPI
+// document for the WebSocket frames. Both are embedded in the server binary
+// and served from /api/openapi.yaml and /api/asyncapi.yaml.
+package api
+
+import _ "embed" // Spec documents
+
+// OpenAPI is the OpenAPI 3 document of the HTTP API.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+// AsyncAPI is the AsyncAPI document of the WebSocket frames.
+//
+//go:embed asyncapi.yaml
+var AsyncAPI []byte
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"keeper/server/core/ports"
+	usersmanagement "keeper/server/users-management"
+)
+
+// RecoveryLinkRequest is the optional body of the recovery-link endpoint.
+type RecoveryLinkRequest struct {
+	ExpiresIn string `json:"expires_in,omitempty"`
+}
+
+// SessionListResponse is the body of GET /api/admin/identities/{id}/sessions.
+type SessionListResponse struct {
+	Sessions []usersmanagement.SessionInfo `json:"sessions"`
+}
+
+// registerAdminRoutes mounts the admin identity management API.
+// Every route requires a session of a user with the admin role.
+func registerAdminRoutes(mux *http.ServeMux, authSvc ports.AuthService, adminSvc *usersmanagement.AdminService) {
+	mux.Handle("POST /api/admin/identities", requireAdmin(authSvc, createIdentityHandler(adminSvc)))
+	mux.Handle("POST /api/admin/identities/{id}/deactivate", requireAdmin(authSvc, setIdentityStateHandler(adminSvc, false)))
+	mux.Handle("POST /api/admin/identities/{id}/reactivate", requireAdmin(authSvc, setIdentityStateHandler(adminSvc, true)))
+	mux.Handle("DELETE /api/admin/identities/{id}/sessions", requireAdmin(authSvc, revokeSessionsHandler(adminSvc)))
+	mux.Handle("GET /api/admin/identities/{id}/sessions", requireAdmin(authSvc, listSessionsHandler(adminSvc)))
+	mux.Handle("POST /api/admin/identities/{id}/recovery-link", requireAdmin(authSvc, recoveryLinkHandler(adminSvc)))
+}
+
+// adminContextKey carries the authenticated admin through the request context.
+type adminContextKey struct{}
+
+// adminFromContext returns the admin authenticated by requireAdmin.
+func adminFromContext(ctx context.Context) *usersmanagement.User {
+	user, _ := ctx.Value(adminContextKey{}).(*usersmanagement.User)
+	return user
+}
+
+// requireAdmin rejects requests that are not authenticated as an admin.
+// The admin is available to next through adminFromContext.
+func requireAdmin(authSvc ports.AuthService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authUser := authenticateRequest(w, r, authSvc)
+		if authUser == nil {
+			return
+		}
+		if !authUser.IsAdmin() {
+			log.Printf("User %s (ID: %s) denied access to %s %s", authUser.Email, authUser.ID, r.Method, r.URL.Path)
+			respondError(w, http.StatusForbidden, "Admin role required")
+			return
+		}
+		log.Printf("Admin %s (ID: %s): %s %s", authUser.Email, authUser.ID, r.Method, r.URL.Path)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, authUser)))
+	})
+}
+
+// respondAdminError maps AdminService errors to HTTP responses.
+func respondAdminError(w http.ResponseWriter, err error, message string) {
+	log.Printf("%s: %v", message, err)
+	if errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+		respondError(w, http.StatusNotFound, "Identity not found")
+		return
+	}
+	if errors.Is(err, usersmanagement.ErrIdentityExists) {
+		respondError(w, http.StatusConflict, "Identity already exists")
+		return
+	}
+	if errors.Is(err, usersmanagement.ErrInvalidAdminRequest) {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondError(w, http.StatusBadGateway, message)
+}
+
+func createIdentityHandler(adminSvc *usersmanagement.AdminService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req usersmanagement.CreateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		user, err := adminSvc.CreateUser(r.Context(), req)
+		if err != nil {
+			respondAdminError(w, err, "Failed to create identity")
+			return
+		}
+		respondJSON(w, http.StatusCreated, user)
+	}
+}
+
+func setIdentityStateHandler(adminSvc *usersmanagement.AdminService, active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			user *usersmanagement.User
+			err  error
+		)
+		if active {
+			user, err = adminSvc.ReactivateUser(r.Context(), r.PathValue("id"))
+		} else {
+			user, err = adminSvc.DeactivateUser(r.Context(), r.PathValue("id"))
+		}
+		if err != nil {
+			respondAdminError(w, err, "Failed to change identity state")
+			return
+		}
+		respondJSON(w, http.StatusOK, user)
+	}
+}
+
+func revokeSessionsHandler(adminSvc *usersmanagement.AdminService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := adminSvc.RevokeSessions(r.Context(), r.PathValue("id")); err != nil {
+			respondAdminError(w, err, "Failed to revoke sessions")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listSessionsHandler lists active sessions; ?all=true includes inactive ones.
+func listSessionsHandler(adminSvc *usersmanagement.AdminService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		activeOnly := r.URL.Query().Get("all") != "true"
+		sessions, err := adminSvc.ListSessions(r.Context(), r.PathValue("id"), activeOnly)
+		if err != nil {
+			respondAdminError(w, err, "Failed to list sessions")
+			return
+		}
+		respondJSON(w, http.StatusOK, SessionListResponse{Sessions: sessions})
+	}
+}
+
+func recoveryLinkHandler(adminSvc *usersmanagement.AdminService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req RecoveryLinkRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+		}
+		link, err := adminSvc.CreateRecoveryLink(r.Context(), r.PathValue("id"), req.ExpiresIn)
+		if err != nil {
+			respondAdminError(w, err, "Failed to create recovery link")
+			return
+		}
+		respondJSON(w, http.StatusCreated, link)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// EventRequest is the body of POST /api/v1/rooms/{id}/events and PUT /api/v1/events/{eventID}.
+type EventRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	StartsAt    string `json:"starts_at"`                  // Local time in timezone, e.g. "2026-10-24T19:00", or RFC 3339
+	Timezone    string `json:"timezone,omitempty"`         // IANA name; defaults to UTC
+	Duration    int    `json:"duration_minutes,omitempty"` // 0 if open-ended
+	Reminders   []int  `json:"reminders,omitempty"`        // Minutes before the start; the server's defaults if missing
+}
+
+// EventListResponse is the body of GET /api/v1/rooms/{id}/events.
+type EventListResponse struct {
+	Events []models.CalendarEvent `json:"events"`
+}
+
+// RSVPRequest is the body of PUT /api/v1/events/{eventID}/rsvp.
+type RSVPRequest struct {
+	Response string `json:"response"` // yes, no or maybe
+}
+
+// CalendarFeedResponse is the body of POST /api/v1/rooms/{id}/calendar-feed.
+type CalendarFeedResponse struct {
+	Token string `json:"token"` // Only returned once
+	URL   string `json:"url"`   // Subscribe to this in a calendar app
+}
+
+// registerCalendarRoutes mounts the scheduled sessions of rooms, answers to
+// them and the iCalendar feeds of rooms. Feeds are read with a secret token
+// in the URL, since calendar apps cannot sign in.
+func registerCalendarRoutes(mux *http.ServeMux, authSvc ports.AuthService, calendar *services.CalendarService) {
+	mux.Handle("GET /api/v1/rooms/{id}/events", withPrincipal(authSvc, listEventsHandler(calendar)))
+	mux.Handle("POST /api/v1/rooms/{id}/events", withPrincipal(authSvc, createEventHandler(calendar)))
+	mux.Handle("GET /api/v1/rooms/{id}/events.ics", withPrincipal(authSvc, roomCalendarHandler(calendar)))
+	mux.Handle("POST /api/v1/rooms/{id}/calendar-feed", withPrincipal(authSvc, issueCalendarFeedHandler(calendar)))
+	mux.Handle("GET /api/v1/events/{eventID}", withPrincipal(authSvc, getEventHandler(calendar)))
+	mux.Handle("PUT /api/v1/events/{eventID}", withPrincipal(authSvc, updateEventHandler(calendar)))
+	mux.Handle("DELETE /api/v1/events/{eventID}", withPrincipal(authSvc, deleteEventHandler(calendar)))
+	mux.Handle("PUT /api/v1/events/{eventID}/rsvp", withPrincipal(authSvc, rsvpHandler(calendar)))
+	mux.Handle("GET /api/v1/calendars/{token}", calendarFeedHandler(calendar))
+}
+
+// eventDraft converts an EventRequest for the CalendarService.
+func (req EventRequest) eventDraft() services.EventDraft {
+	return services.EventDraft{
+		Title:       req.Title,
+		Description: req.Description,
+		Start:       req.StartsAt,
+		Timezone:    req.Timezone,
+		Duration:    req.Duration,
+		Reminders:   req.Reminders,
+	}
+}
+
+// respondCalendarError maps calendar errors, falling back to respondChatError.
+func respondCalendarError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrEventNotFound):
+		respondError(w, http.StatusNotFound, "Event not found")
+	case errors.Is(err, services.ErrInvalidFeedToken):
+		respondError(w, http.StatusNotFound, "Calendar not found")
+	default:
+		respondChatError(w, err)
+	}
+}
+
+func listEventsHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		events, err := calendar.ListEvents(p, roomID)
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, EventListResponse{Events: events})
+	}
+}
+
+func createEventHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req EventRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		event, err := calendar.CreateEvent(p, roomID, req.eventDraft())
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, event)
+	}
+}
+
+func getEventHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "eventID")
+		if !ok {
+			return
+		}
+		event, err := calendar.GetEvent(p, id)
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, event)
+	}
+}
+
+func updateEventHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "eventID")
+		if !ok {
+			return
+		}
+		var req EventRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		event, err := calendar.UpdateEvent(p, id, req.eventDraft())
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, event)
+	}
+}
+
+func deleteEventHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "eventID")
+		if !ok {
+			return
+		}
+		if err := calendar.DeleteEvent(p, id); err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func rsvpHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "eventID")
+		if !ok {
+			return
+		}
+		var req RSVPRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		event, err := calendar.RSVP(p, id, req.Response)
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, event)
+	}
+}
+
+func issueCalendarFeedHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		token, err := calendar.IssueCalendarFeed(p, roomID)
+		if err != nil {
+			respondCalendarError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, CalendarFeedResponse{Token: token, URL: absoluteURL(r, "/api/v1/calendars/"+token)})
+	}
+}
+
+func roomCalendarHandler(calendar *services.CalendarService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		name, events, err := calendar.Calendar(p, roomID)
+		respondICS(w, name, events, err)
+	}
+}
+
+func calendarFeedHandler(calendar *services.CalendarService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, events, err := calendar.FeedCalendar(r.PathValue("token"))
+		respondICS(w, name, events, err)
+	}
+}
+
+// respondICS writes the events of a room as an iCalendar file, or the error.
+func respondICS(w http.ResponseWriter, room string, events []models.CalendarEvent, err error) {
+	if err != nil {
+		respondCalendarError(w, err)
+		return
+	}
+	var body bytes.Buffer
+	if err := services.WriteICS(&body, room, events); err != nil {
+		respondCalendarError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", services.ICSContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/server/models"
+)
+
+func TestCalendarAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+
+	start := time.Now().Add(72 * time.Hour).Truncate(time.Minute)
+	body := fmt.Sprintf(`{"title": "The Haunting", "starts_at": %q, "timezone": "Europe/Berlin", "duration_minutes": 240, "reminders": [60]}`,
+		start.In(time.UTC).Format("2006-01-02T15:04"))
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/events", `{"title": "Soon", "starts_at": "tomorrow"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unreadable start, got %d", status)
+	}
+	var event models.CalendarEvent
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/events", body, &event); status != http.StatusCreated || event.ID != 1 {
+		t.Fatalf("Expected 201 scheduling an event, got %d %+v", status, event)
+	}
+	if status := call(t, server, "alice", "PUT", "/api/v1/events/1/rsvp", `{"response": "yes"}`, &event); status != http.StatusOK || len(event.Attendees) != 1 {
+		t.Errorf("Expected 200 answering, got %d %+v", status, event)
+	}
+	if status := call(t, server, "kpr_read-key", "PUT", "/api/v1/events/1/rsvp", `{"response": "yes"}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a read-only key, got %d", status)
+	}
+
+	var list EventListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/events", "", &list); status != http.StatusOK || len(list.Events) != 1 {
+		t.Errorf("Expected one upcoming event, got %d %+v", status, list)
+	}
+	var messages MessageListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/messages", "", &messages); status != http.StatusOK ||
+		!slices.ContainsFunc(messages.Messages, func(m models.Message) bool { return strings.HasPrefix(m.Text, "Bob scheduled The Haunting") }) {
+		t.Errorf("Expected the event to be announced, got %d %+v", status, messages)
+	}
+
+	if _, ics := download(t, server.URL+"/api/v1/rooms/1/events.ics"); !strings.Contains(ics, "SUMMARY:The Haunting\r\n") {
+		t.Errorf("Expected the event in the calendar, got:\n%s", ics)
+	}
+	var feed CalendarFeedResponse
+	if status := call(t, server, "kpr_read-key", "POST", "/api/v1/rooms/1/calendar-feed", "", nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a bot feed, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/calendar-feed", "", &feed); status != http.StatusCreated || !strings.HasSuffix(feed.URL, "/api/v1/calendars/"+feed.Token) {
+		t.Fatalf("Expected 201 creating a feed, got %d %+v", status, feed)
+	}
+	if status := call(t, server, "", "GET", "/api/v1/calendars/"+feed.Token, "", nil); status != http.StatusOK {
+		t.Errorf("Expected 200 for the feed without credentials, got %d", status)
+	}
+	if status := call(t, server, "", "GET", "/api/v1/calendars/kcal_nothing_here", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown feed, got %d", status)
+	}
+
+	if status := call(t, server, "alice", "PUT", "/api/v1/events/1", `{"title": "The Haunting, part 2", "starts_at": "`+start.Add(24*time.Hour).UTC().Format(time.RFC3339)+`"}`, &event); status != http.StatusOK || event.Title != "The Haunting, part 2" || !slices.Equal(event.Reminders, []int{60}) {
+		t.Errorf("Expected 200 moving the event with its reminders, got %d %+v", status, event)
+	}
+	if status := call(t, server, "bob", "DELETE", "/api/v1/events/1", "", nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204 cancelling, got %d", status)
+	}
+	if status := call(t, server, "alice", "GET", "/api/v1/events/1", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a cancelled event, got %d", status)
+	}
+}
+
+func TestParseReminderOffsets(t *testing.T) {
+	if got, err := parseReminderOffsets("24h, 1h,10m"); err != nil || !slices.Equal(got, []int{1440, 60, 10}) {
+		t.Errorf("Expected 1440, 60 and 10 minutes, got %v, %v", got, err)
+	}
+	if got, err := parseReminderOffsets("none"); err != nil || got == nil || len(got) != 0 {
+		t.Errorf("Expected no reminders, got %v, %v", got, err)
+	}
+	for _, value := range []string{"1d", "30s", "1h,1h,1h,1h,1h,1h"} {
+		if _, err := parseReminderOffsets(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
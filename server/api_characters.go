@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// CreateCharacterRequest is the body of POST /api/v1/rooms/{id}/characters.
+type CreateCharacterRequest struct {
+	OwnerID   string          `json:"owner_id,omitempty"` // Room owners may create characters for other members
+	Name      string          `json:"name"`
+	AvatarURL string          `json:"avatar_url,omitempty"`
+	Template  string          `json:"template,omitempty"` // Defaults to coc7
+	Sheet     json.RawMessage `json:"sheet"`
+}
+
+// UpdateCharacterRequest is the body of PUT /api/v1/characters/{characterID}.
+type UpdateCharacterRequest struct {
+	Name      string          `json:"name"`
+	AvatarURL string          `json:"avatar_url,omitempty"`
+	Sheet     json.RawMessage `json:"sheet"`
+}
+
+// CharacterListResponse is the body of GET /api/v1/rooms/{id}/characters.
+type CharacterListResponse struct {
+	Characters []models.Character `json:"characters"`
+}
+
+// registerCharacterRoutes mounts the characters of rooms and the schemas of
+// their sheet templates.
+func registerCharacterRoutes(mux *http.ServeMux, authSvc ports.AuthService, characters *services.CharacterService) {
+	mux.Handle("GET /api/v1/rooms/{id}/characters", withPrincipal(authSvc, listCharactersHandler(characters)))
+	mux.Handle("POST /api/v1/rooms/{id}/characters", withPrincipal(authSvc, createCharacterHandler(characters)))
+	mux.Handle("GET /api/v1/characters/{characterID}", withPrincipal(authSvc, getCharacterHandler(characters)))
+	mux.Handle("PUT /api/v1/characters/{characterID}", withPrincipal(authSvc, updateCharacterHandler(characters)))
+	mux.Handle("DELETE /api/v1/characters/{characterID}", withPrincipal(authSvc, deleteCharacterHandler(characters)))
+	mux.Handle("GET /api/v1/character-templates/{name}", withPrincipal(authSvc, characterTemplateHandler(characters)))
+}
+
+// respondCharacterError maps character errors, falling back to chat errors.
+func respondCharacterError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrCharacterExists):
+		respondError(w, http.StatusConflict, "A character with that name already exists in this room")
+	case errors.Is(err, services.ErrTemplateNotFound):
+		respondError(w, http.StatusNotFound, "Template not found")
+	default:
+		respondChatError(w, err)
+	}
+}
+
+func listCharactersHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		list, err := characters.ListCharacters(p, roomID)
+		if err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, CharacterListResponse{Characters: list})
+	}
+}
+
+func createCharacterHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req CreateCharacterRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		character, err := characters.CreateCharacter(p, roomID, services.CharacterDraft{
+			OwnerID:   req.OwnerID,
+			Name:      req.Name,
+			AvatarURL: req.AvatarURL,
+			Template:  req.Template,
+			Sheet:     req.Sheet,
+		})
+		if err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, character)
+	}
+}
+
+func getCharacterHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "characterID")
+		if !ok {
+			return
+		}
+		character, err := characters.GetCharacter(p, id)
+		if err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, character)
+	}
+}
+
+func updateCharacterHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "characterID")
+		if !ok {
+			return
+		}
+		var req UpdateCharacterRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		character, err := characters.UpdateCharacter(p, id, services.CharacterDraft{Name: req.Name, AvatarURL: req.AvatarURL, Sheet: req.Sheet})
+		if err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, character)
+	}
+}
+
+func deleteCharacterHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "characterID")
+		if !ok {
+			return
+		}
+		if err := characters.DeleteCharacter(p, id); err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// characterTemplateHandler serves the JSON schema of a sheet template, so
+// clients can build their character forms from it.
+func characterTemplateHandler(characters *services.CharacterService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		schema, err := characters.Template(r.PathValue("name"))
+		if err != nil {
+			respondCharacterError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, schema)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"keeper/server/models"
+)
+
+const investigatorSheet = `{
+	"characteristics": {"STR": 45, "CON": 50, "SIZ": 60, "DEX": 55, "APP": 50, "INT": 80, "POW": 65, "EDU": 85},
+	"skills": {"Spot Hidden": 60, "Library Use": 70}
+}`
+
+func TestCharactersAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+
+	var character models.Character
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/characters", `{"name": "Harvey Walters", "sheet": `+investigatorSheet+`}`, &character); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a character, got %d", status)
+	}
+	if character.OwnerID != "bob-id" || character.Template != models.CharacterTemplateCoC7 {
+		t.Errorf("Expected bob's coc7 character, got %+v", character)
+	}
+	var list CharacterListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/characters", "", &list); status != http.StatusOK || len(list.Characters) != 1 {
+		t.Errorf("Expected alice to see bob's character, got %d %+v", status, list)
+	}
+
+	var roll models.Message
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/rolls", `{"skill": "Spot Hidden"}`, &roll); status != http.StatusCreated {
+		t.Fatalf("Expected 201 rolling a skill, got %d", status)
+	}
+	if roll.Roll == nil || roll.Roll.Check == nil || roll.Roll.Check.Target != 60 || roll.Roll.Check.Character != "Harvey Walters" {
+		t.Errorf("Expected a check against Spot Hidden 60, got %+v", roll.Roll)
+	}
+	var command models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "/roll Harvey Walters: Library Use b1"}`, &command); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for a GM check, got %d", status)
+	}
+	if command.Roll == nil || command.Roll.Check == nil || command.Roll.Expression != "d100b1" || !strings.Contains(command.Text, "against 70") {
+		t.Errorf("Expected a check against Library Use with a bonus die, got %+v", command)
+	}
+
+	var template map[string]interface{}
+	if status := call(t, server, "bob", "GET", "/api/v1/character-templates/coc7", "", &template); status != http.StatusOK || template["type"] != "object" {
+		t.Errorf("Expected the coc7 schema, got %d %v", status, template)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"invalid sheet", "bob", "POST", "/api/v1/rooms/1/characters", `{"name": "Ann", "sheet": {"skills": {}}}`, http.StatusBadRequest},
+		{"duplicate name", "alice", "POST", "/api/v1/rooms/1/characters", `{"name": "harvey walters", "sheet": ` + investigatorSheet + `}`, http.StatusConflict},
+		{"bot", "kpr_bot-key", "POST", "/api/v1/rooms/1/characters", `{"name": "Ann", "sheet": ` + investigatorSheet + `}`, http.StatusForbidden},
+		{"unknown skill", "bob", "POST", "/api/v1/rooms/1/rolls", `{"skill": "Astrology"}`, http.StatusBadRequest},
+		{"unknown character", "alice", "POST", "/api/v1/rooms/1/rolls", `{"skill": "Spot Hidden", "character_id": 99}`, http.StatusNotFound},
+		{"unknown template", "bob", "GET", "/api/v1/character-templates/dnd5e", "", http.StatusNotFound},
+		{"other room", "kpr_read-key", "GET", "/api/v1/characters/1", "", http.StatusNotFound},
+		{"rename", "bob", "PUT", "/api/v1/characters/1", `{"name": "Harvey", "sheet": ` + investigatorSheet + `}`, http.StatusOK},
+		{"delete", "alice", "DELETE", "/api/v1/characters/1", "", http.StatusNoContent},
+		{"deleted", "bob", "GET", "/api/v1/characters/1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
+
+func TestCharactersAPI_InCharacter(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "sa_dice"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding the bot, got %d", status)
+	}
+	var character models.Character
+	body := `{"name": "Harvey Walters", "avatar_url": "https://example.com/harvey.png", "sheet": ` + investigatorSheet + `}`
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/characters", body, &character); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a character, got %d", status)
+	}
+	if character.AvatarURL != "https://example.com/harvey.png" {
+		t.Errorf("Expected the avatar URL, got %+v", character)
+	}
+
+	alice, bob := dialWS(t, server, "alice"), dialWS(t, server, "bob")
+	var msg models.Message
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "Who goes there?", "character_id": 1}`, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 speaking as a character, got %d", status)
+	}
+	if msg.Character == nil || msg.Character.Name != "Harvey Walters" || msg.Character.AvatarURL != character.AvatarURL || !msg.InCharacter {
+		t.Errorf("Expected the message to be in character, got %+v", msg)
+	}
+	if event := readEvent(t, alice); event.Message == nil || event.Message.Character == nil || event.Message.Character.Name != "Harvey Walters" {
+		t.Errorf("Expected the broadcast to carry the character, got %+v", event)
+	}
+	if err := bob.WriteJSON(ClientFrame{RoomID: 1, Text: "The lights go out.", InCharacter: true}); err != nil {
+		t.Fatalf("Failed to send a frame: %v", err)
+	}
+	if event := readEvent(t, alice); event.Message == nil || !event.Message.InCharacter || event.Message.Character != nil {
+		t.Errorf("Expected in-character narration, got %+v", event)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "brb, pizza"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for table talk, got %d", status)
+	}
+
+	var history MessageListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/messages?in_character=true", "", &history); status != http.StatusOK || len(history.Messages) != 2 {
+		t.Errorf("Expected the two in-character messages, got %d %+v", status, history)
+	}
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/messages?in_character=maybe", "", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed filter, got %d", status)
+	}
+	if status := call(t, server, "kpr_bot-key", "POST", "/api/v1/rooms/1/messages", `{"text": "Boo", "character_id": 1}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 speaking as someone else's character, got %d", status)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// RegisterCommandRequest is the body of POST /api/v1/commands.
+type RegisterCommandRequest struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// RegisterCommandResponse returns the new command with the secret its
+// invocations are signed with. The secret is only ever shown in this response.
+type RegisterCommandResponse struct {
+	Command *models.Command `json:"command"`
+	Secret  string          `json:"secret"`
+}
+
+// CommandListResponse is the body of GET /api/v1/commands and GET /api/v1/rooms/{id}/commands.
+type CommandListResponse struct {
+	Commands []models.Command `json:"commands"`
+}
+
+// registerCommandRoutes mounts the slash commands available in a room and
+// command registration for bots.
+func registerCommandRoutes(mux *http.ServeMux, authSvc ports.AuthService, commands *services.CommandRegistry) {
+	mux.Handle("GET /api/v1/rooms/{id}/commands", withPrincipal(authSvc, listRoomCommandsHandler(commands)))
+	mux.Handle("GET /api/v1/commands", withPrincipal(authSvc, listBotCommandsHandler(commands)))
+	mux.Handle("POST /api/v1/commands", withPrincipal(authSvc, registerBotCommandHandler(commands)))
+	mux.Handle("DELETE /api/v1/commands/{name}", withPrincipal(authSvc, deleteBotCommandHandler(commands)))
+}
+
+// respondCommandError maps command registry errors, falling back to chat errors.
+func respondCommandError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrCommandExists):
+		respondError(w, http.StatusConflict, "A command with that name already exists")
+	case errors.Is(err, services.ErrCommandNotFound):
+		respondError(w, http.StatusNotFound, "Command not found")
+	default:
+		respondChatError(w, err)
+	}
+}
+
+func listRoomCommandsHandler(commands *services.CommandRegistry) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		list, err := commands.RoomCommands(p, roomID)
+		if err != nil {
+			respondCommandError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, CommandListResponse{Commands: list})
+	}
+}
+
+func listBotCommandsHandler(commands *services.CommandRegistry) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		list, err := commands.ListBotCommands(p)
+		if err != nil {
+			respondCommandError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, CommandListResponse{Commands: list})
+	}
+}
+
+func registerBotCommandHandler(commands *services.CommandRegistry) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		var req RegisterCommandRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		cmd, secret, err := commands.RegisterBotCommand(p, req.Name, req.Usage, req.Description, req.URL)
+		if err != nil {
+			respondCommandError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, RegisterCommandResponse{Command: cmd, Secret: secret})
+	}
+}
+
+func deleteBotCommandHandler(commands *services.CommandRegistry) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		if err := commands.DeleteBotCommand(p, r.PathValue("name")); err != nil {
+			respondCommandError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
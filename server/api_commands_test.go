@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func TestCommandsAPI_EphemeralRepliesReachOnlyTheSender(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	aliceConn := dialWS(t, server, "alice")
+	bobConn := dialWS(t, server, "bob")
+
+	var reply models.Message
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "/topic"}`, &reply); status != http.StatusOK {
+		t.Fatalf("Expected 200 for an ephemeral reply, got %d", status)
+	}
+	if !reply.Ephemeral || reply.AuthorType != models.AuthorTypeSystem {
+		t.Errorf("Expected an ephemeral system reply, got %+v", reply)
+	}
+	if event := readEvent(t, bobConn); event.Type != models.EventMessageEphemeral || event.Message.Text != reply.Text {
+		t.Errorf("Expected bob to receive the reply, got %+v", event)
+	}
+
+	var emote models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "/me lights a candle"}`, &emote); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for /me, got %d", status)
+	}
+	if event := readEvent(t, aliceConn); event.Type != models.EventMessageCreated || event.Message.Kind != models.MessageKindEmote {
+		t.Errorf("Expected alice's next event to be her emote, not bob's reply, got %+v", event)
+	}
+
+	var list CommandListResponse
+	if status := call(t, server, "bob", "GET", "/api/v1/rooms/1/commands", "", &list); status != http.StatusOK || len(list.Commands) != 14 {
+		t.Errorf("Expected the built-in commands, got %d %+v", status, list)
+	}
+}
+
+func TestCommandsAPI_BotCommands(t *testing.T) {
+	server := newTestServer(t)
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(services.CommandResponse{Text: "The stars are right."})
+	}))
+	defer bot.Close()
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "sa_dice"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding the bot, got %d", status)
+	}
+
+	body := `{"name": "omen", "usage": "[question]", "description": "Ask the stars.", "url": "` + bot.URL + `"}`
+	var registered RegisterCommandResponse
+	if status := call(t, server, "kpr_cmd-key", "POST", "/api/v1/commands", body, &registered); status != http.StatusCreated {
+		t.Fatalf("Expected 201 registering a command, got %d", status)
+	}
+	if registered.Command.Name != "omen" || registered.Secret == "" {
+		t.Errorf("Unexpected registration %+v", registered)
+	}
+
+	var msg models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "/omen"}`, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for the bot's answer, got %d", status)
+	}
+	if msg.UserID != "sa_dice" || msg.Text != "The stars are right." {
+		t.Errorf("Expected the answer to be posted as the bot, got %+v", msg)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"missing scope", "kpr_bot-key", "POST", "/api/v1/commands", body, http.StatusForbidden},
+		{"people cannot register", "alice", "POST", "/api/v1/commands", body, http.StatusForbidden},
+		{"duplicate", "kpr_cmd-key", "POST", "/api/v1/commands", body, http.StatusConflict},
+		{"built-in name", "kpr_cmd-key", "POST", "/api/v1/commands", `{"name": "roll", "url": "https://example.com"}`, http.StatusConflict},
+		{"bad url", "kpr_cmd-key", "POST", "/api/v1/commands", `{"name": "fate", "url": "ftp://example.com"}`, http.StatusBadRequest},
+		{"list", "kpr_cmd-key", "GET", "/api/v1/commands", "", http.StatusOK},
+		{"non-member lists room commands", "bob", "GET", "/api/v1/rooms/1/commands", "", http.StatusForbidden},
+		{"delete", "kpr_cmd-key", "DELETE", "/api/v1/commands/omen", "", http.StatusNoContent},
+		{"delete again", "kpr_cmd-key", "DELETE", "/api/v1/commands/omen", "", http.StatusNotFound},
+		{"unknown command", "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "/omen"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// FileLinkResponse is the body of POST /api/v1/files/{fileID}/link.
+type FileLinkResponse struct {
+	URL       string    `json:"url"` // Works without credentials until it expires
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// multipartOverhead is how much a multipart upload may exceed the largest
+// file, for its boundaries and part headers.
+const multipartOverhead = 64 << 10
+
+// registerFileRoutes mounts uploads and downloads of files. Files are
+// uploaded as multipart/form-data and posted by listing their IDs in
+// file_ids of a message.
+func registerFileRoutes(mux *http.ServeMux, authSvc ports.AuthService, files *services.FileService) {
+	mux.Handle("POST /api/v1/rooms/{id}/files", withPrincipal(authSvc, uploadFileHandler(files)))
+	mux.Handle("GET /api/v1/files/{fileID}", withPrincipal(authSvc, getFileHandler(files)))
+	mux.Handle("POST /api/v1/files/{fileID}/link", withPrincipal(authSvc, fileLinkHandler(files)))
+	mux.Handle("GET /api/v1/files/{fileID}/content", fileContentHandler(authSvc, files))
+}
+
+// respondFileError maps FileService errors to HTTP responses.
+func respondFileError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrFileNotFound):
+		respondError(w, http.StatusNotFound, "File not found")
+	case errors.Is(err, services.ErrFileTooLarge), errors.As(err, &tooLarge):
+		respondError(w, http.StatusRequestEntityTooLarge, "File too large")
+	case errors.Is(err, services.ErrUnsupportedFileType):
+		respondError(w, http.StatusUnsupportedMediaType, errorDetail(err))
+	default:
+		respondChatError(w, err)
+	}
+}
+
+func uploadFileHandler(files *services.FileService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, files.MaxSize()+multipartOverhead)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Expected a multipart/form-data body")
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				respondError(w, http.StatusBadRequest, "Missing the file part")
+				return
+			}
+			if err != nil {
+				respondFileError(w, err)
+				return
+			}
+			if part.FormName() != "file" {
+				part.Close()
+				continue
+			}
+			file, err := files.Upload(r.Context(), p, roomID, part.FileName(), part)
+			if err != nil {
+				respondFileError(w, err)
+				return
+			}
+			respondJSON(w, http.StatusCreated, file)
+			return
+		}
+	}
+}
+
+func getFileHandler(files *services.FileService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "fileID")
+		if !ok {
+			return
+		}
+		file, err := files.GetFile(p, id)
+		if err != nil {
+			respondFileError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, file)
+	}
+}
+
+func fileLinkHandler(files *services.FileService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "fileID")
+		if !ok {
+			return
+		}
+		path, expires, err := files.SignedURL(p, id)
+		if err != nil {
+			respondFileError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, FileLinkResponse{URL: absoluteURL(r, path), ExpiresAt: expires})
+	}
+}
+
+// fileContentHandler serves the content of a file, or of one of its
+// thumbnails, to members who may see it or to anyone with a signed URL.
+func fileContentHandler(authSvc ports.AuthService, files *services.FileService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "fileID")
+		if !ok {
+			return
+		}
+		var file *models.File
+		var body io.ReadCloser
+		var err error
+		query := r.URL.Query()
+		if query.Has("signature") {
+			file, body, err = files.OpenSigned(r.Context(), id, query.Get("expires"), query.Get("signature"), query.Get("thumbnail"))
+		} else {
+			p := authenticatePrincipal(w, r, authSvc)
+			if p == nil {
+				return
+			}
+			file, body, err = files.Open(r.Context(), p, id, query.Get("thumbnail"))
+		}
+		if err != nil {
+			respondFileError(w, err)
+			return
+		}
+		defer body.Close()
+
+		disposition := "attachment"
+		if file.IsImage() {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", file.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("Error sending file %d: %v", file.ID, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// upload posts content as the file part of a multipart body.
+func upload(t *testing.T, server *httptest.Server, token, path, name, content string, out interface{}) int {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatalf("Failed to build multipart body: %v", err)
+	}
+	io.WriteString(part, content)
+	form.Close()
+	req, err := http.NewRequest("POST", server.URL+path, &body)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Session-Token", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response of POST %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestFilesAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 320, 200))); err != nil {
+		t.Fatalf("Encoding image failed: %v", err)
+	}
+	picture := encoded.String()
+	var file models.File
+	if status := upload(t, server, "alice", "/api/v1/rooms/1/files", "crypt.png", picture, &file); status != http.StatusCreated {
+		t.Fatalf("Expected 201 uploading an image, got %d", status)
+	}
+	if file.ContentType != "image/png" || file.Name != "crypt.png" || file.Size != int64(len(picture)) || file.Width != 320 || len(file.Thumbnails) != 1 {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	if status := upload(t, server, "alice", "/api/v1/rooms/1/files", "page.html", "<html><body>", nil); status != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for HTML, got %d", status)
+	}
+	if status := upload(t, server, "alice", "/api/v1/rooms/1/files", "huge.txt", strings.Repeat("a", services.DefaultMaxFileSize+1), nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a file over the limit, got %d", status)
+	}
+	if status := call(t, server, "bob", "GET", fmt.Sprintf("/api/v1/files/%d", file.ID), "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for someone else's unposted file, got %d", status)
+	}
+
+	var msg models.Message
+	body := fmt.Sprintf(`{"text": "", "file_ids": [%d]}`, file.ID)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", body, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting the file, got %d", status)
+	}
+	if len(msg.Files) != 1 || msg.Files[0].MessageID != msg.ID {
+		t.Errorf("Expected the file on the message, got %+v", msg.Files)
+	}
+	var history struct {
+		Messages []models.Message `json:"messages"`
+	}
+	if status := call(t, server, "bob", "GET", "/api/v1/rooms/1/messages", "", &history); status != http.StatusOK || len(history.Messages) != 1 || len(history.Messages[0].Files) != 1 || len(history.Messages[0].Files[0].Thumbnails) != 1 {
+		t.Fatalf("Expected the file with its thumbnail in the history, got %d %+v", status, history.Messages)
+	}
+
+	header, content := download(t, server.URL+msg.Files[0].URL)
+	if content != picture || header.Get("Content-Type") != "image/png" || header.Get("Content-Disposition") != `inline; filename=crypt.png` || header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Unexpected download %q with headers %v", content, header)
+	}
+	resp, err := http.Get(server.URL + msg.Files[0].URL)
+	if err != nil {
+		t.Fatalf("GET without credentials failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 downloading without credentials, got %d", resp.StatusCode)
+	}
+
+	var link FileLinkResponse
+	if status := call(t, server, "bob", "POST", fmt.Sprintf("/api/v1/files/%d/link", file.ID), "", &link); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a link, got %d", status)
+	}
+	resp, err = http.Get(link.URL)
+	if err != nil {
+		t.Fatalf("GET of the signed link failed: %v", err)
+	}
+	signed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(signed) != picture {
+		t.Errorf("Expected the signed link to work without credentials, got %d %q", resp.StatusCode, signed)
+	}
+	resp, err = http.Get(link.URL + "&thumbnail=small")
+	if err != nil {
+		t.Fatalf("GET of the signed thumbnail failed: %v", err)
+	}
+	thumb, err := png.DecodeConfig(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || err != nil || thumb.Width != 160 || thumb.Height != 100 {
+		t.Errorf("Expected a 160x100 thumbnail, got %d %+v, %v", resp.StatusCode, thumb, err)
+	}
+	resp, err = http.Get(strings.Replace(link.URL, "signature=", "signature=0", 1))
+	if err != nil {
+		t.Fatalf("GET of a forged link failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a wrong signature, got %d", resp.StatusCode)
+	}
+}
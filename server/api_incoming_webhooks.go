@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// maxIncomingMessageBytes bounds the body of a request to an incoming webhook.
+const maxIncomingMessageBytes = 64 << 10
+
+// CreateIncomingWebhookRequest is the body of POST /api/v1/rooms/{id}/incoming-webhooks.
+type CreateIncomingWebhookRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateIncomingWebhookResponse returns the new webhook with its URL. The URL
+// contains the secret token and is only ever shown in this response.
+type CreateIncomingWebhookResponse struct {
+	IncomingWebhook *models.IncomingWebhook `json:"incoming_webhook"`
+	Token           string                  `json:"token"`
+	URL             string                  `json:"url"`
+}
+
+// IncomingWebhookListResponse is the body of GET /api/v1/rooms/{id}/incoming-webhooks.
+type IncomingWebhookListResponse struct {
+	IncomingWebhooks []models.IncomingWebhook `json:"incoming_webhooks"`
+}
+
+// registerIncomingWebhookRoutes mounts incoming webhook management for room
+// owners and the unauthenticated endpoint the webhooks post to.
+func registerIncomingWebhookRoutes(mux *http.ServeMux, authSvc ports.AuthService, hooks *services.IncomingWebhookService) {
+	mux.Handle("GET /api/v1/rooms/{id}/incoming-webhooks", withPrincipal(authSvc, listIncomingWebhooksHandler(hooks)))
+	mux.Handle("POST /api/v1/rooms/{id}/incoming-webhooks", withPrincipal(authSvc, createIncomingWebhookHandler(hooks)))
+	mux.Handle("DELETE /api/v1/rooms/{id}/incoming-webhooks/{hookID}", withPrincipal(authSvc, deleteIncomingWebhookHandler(hooks)))
+	mux.Handle("POST /api/v1/hooks/{token}", postIncomingWebhookHandler(hooks))
+}
+
+// incomingWebhookURL returns the absolute URL a webhook with token posts to,
+// as seen by the client that created it.
+func incomingWebhookURL(r *http.Request, token string) string {
+	return absoluteURL(r, "/api/v1/hooks/"+token)
+}
+
+// absoluteURL returns path on this server as seen by the client of r.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+func listIncomingWebhooksHandler(hooks *services.IncomingWebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		list, err := hooks.ListIncomingWebhooks(p, roomID)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, IncomingWebhookListResponse{IncomingWebhooks: list})
+	}
+}
+
+func createIncomingWebhookHandler(hooks *services.IncomingWebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req CreateIncomingWebhookRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		hook, token, err := hooks.CreateIncomingWebhook(p, roomID, req.Name)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, CreateIncomingWebhookResponse{IncomingWebhook: hook, Token: token, URL: incomingWebhookURL(r, token)})
+	}
+}
+
+func deleteIncomingWebhookHandler(hooks *services.IncomingWebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		hookID, ok := pathID(w, r, "hookID")
+		if !ok {
+			return
+		}
+		if err := hooks.DeleteIncomingWebhook(p, roomID, hookID); err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// postIncomingWebhookHandler posts the message of an external system. The
+// token in the path is the only credential.
+func postIncomingWebhookHandler(hooks *services.IncomingWebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxIncomingMessageBytes)
+		var in services.IncomingMessage
+		if !decodeBody(w, r, &in) {
+			return
+		}
+		msg, err := hooks.Post(r.PathValue("token"), in)
+		var limited *services.RateLimitError
+		switch {
+		case err == nil:
+			respondJSON(w, http.StatusCreated, msg)
+		case errors.Is(err, services.ErrInvalidWebhookToken):
+			respondError(w, http.StatusNotFound, "Webhook not found")
+		case errors.As(err, &limited):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			respondError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		default:
+			respondChatError(w, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"keeper/server/models"
+)
+
+func TestIncomingWebhooksAPI_PostIsBroadcast(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/incoming-webhooks", `{"name": "CI"}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a member creating an incoming webhook, got %d", status)
+	}
+
+	var created CreateIncomingWebhookResponse
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/incoming-webhooks", `{"name": "CI"}`, &created); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating an incoming webhook, got %d", status)
+	}
+	if !strings.HasPrefix(created.URL, server.URL+"/api/v1/hooks/") || !strings.HasSuffix(created.URL, created.Token) {
+		t.Fatalf("Expected the webhook URL to contain the token, got %+v", created)
+	}
+	hookPath := strings.TrimPrefix(created.URL, server.URL)
+
+	conn := dialWS(t, server, "bob")
+	body := `{"text": "Build #42 passed", "username": "nightly", "attachments": [{"title": "Logs", "url": "https://ci.example.com/42"}]}`
+	var msg models.Message
+	if status := call(t, server, "", "POST", hookPath, body, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting through the webhook, got %d", status)
+	}
+	event := readEvent(t, conn)
+	if event.Type != models.EventMessageCreated || event.Message.AuthorType != models.AuthorTypeWebhook || event.Message.User != "nightly" || len(event.Message.Attachments) != 1 {
+		t.Errorf("Expected the webhook message to be broadcast, got %+v", event.Message)
+	}
+
+	var list IncomingWebhookListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/incoming-webhooks", "", &list); status != http.StatusOK || len(list.IncomingWebhooks) != 1 {
+		t.Fatalf("Expected one incoming webhook, got %d %+v", status, list)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"unknown token", "", "POST", "/api/v1/hooks/khk_0000_nope", `{"text": "hi"}`, http.StatusNotFound},
+		{"empty message", "", "POST", hookPath, `{"text": ""}`, http.StatusBadRequest},
+		{"member lists", "bob", "GET", "/api/v1/rooms/1/incoming-webhooks", "", http.StatusForbidden},
+		{"owner deletes", "alice", "DELETE", "/api/v1/rooms/1/incoming-webhooks/1", "", http.StatusNoContent},
+		{"deleted token", "", "POST", hookPath, `{"text": "hi"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
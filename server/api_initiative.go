@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// AddCombatantRequest is the body of POST /api/v1/rooms/{id}/initiative/combatants.
+type AddCombatantRequest struct {
+	Name        string `json:"name,omitempty"`         // Defaults to the character's name
+	CharacterID int64  `json:"character_id,omitempty"` // A character you play, or any if you own the room
+	Dice        string `json:"dice,omitempty"`         // Rolled for initiative, e.g. "d20+2"
+	Initiative  *int   `json:"initiative,omitempty"`   // A fixed initiative instead of dice
+}
+
+// registerInitiativeRoutes mounts the turn orders of rooms. Every change
+// answers with the whole turn order, which is also pushed to the room as
+// initiative.updated.
+func registerInitiativeRoutes(mux *http.ServeMux, authSvc ports.AuthService, initiative *services.InitiativeService) {
+	mux.Handle("GET /api/v1/rooms/{id}/initiative", withPrincipal(authSvc, getInitiativeHandler(initiative)))
+	mux.Handle("DELETE /api/v1/rooms/{id}/initiative", withPrincipal(authSvc, endCombatHandler(initiative)))
+	mux.Handle("POST /api/v1/rooms/{id}/initiative/combatants", withPrincipal(authSvc, addCombatantHandler(initiative)))
+	mux.Handle("DELETE /api/v1/rooms/{id}/initiative/combatants/{combatantID}", withPrincipal(authSvc, removeCombatantHandler(initiative)))
+	mux.Handle("POST /api/v1/rooms/{id}/initiative/combatants/{combatantID}/roll", withPrincipal(authSvc, rollInitiativeHandler(initiative, true)))
+	mux.Handle("POST /api/v1/rooms/{id}/initiative/roll", withPrincipal(authSvc, rollInitiativeHandler(initiative, false)))
+	mux.Handle("POST /api/v1/rooms/{id}/initiative/next", withPrincipal(authSvc, nextTurnHandler(initiative)))
+}
+
+func getInitiativeHandler(initiative *services.InitiativeService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		state, err := initiative.Initiative(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, state)
+	}
+}
+
+func endCombatHandler(initiative *services.InitiativeService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		if err := initiative.EndCombat(p, roomID); err != nil {
+			respondChatError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func addCombatantHandler(initiative *services.InitiativeService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req AddCombatantRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		state, err := initiative.AddCombatant(p, roomID, services.CombatantDraft{
+			Name:        req.Name,
+			CharacterID: req.CharacterID,
+			Dice:        req.Dice,
+			Initiative:  req.Initiative,
+		})
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, state)
+	}
+}
+
+func removeCombatantHandler(initiative *services.InitiativeService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		combatantID, ok := pathID(w, r, "combatantID")
+		if !ok {
+			return
+		}
+		state, err := initiative.RemoveCombatant(p, roomID, combatantID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, state)
+	}
+}
+
+// rollInitiativeHandler rolls for the combatant in the path, or without one
+// for every combatant the caller controls that has not rolled yet.
+func rollInitiativeHandler(initiative *services.InitiativeService, one bool) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var combatantID int64
+		if one {
+			if combatantID, ok = pathID(w, r, "combatantID"); !ok {
+				return
+			}
+		}
+		state, err := initiative.RollInitiative(p, roomID, combatantID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, state)
+	}
+}
+
+func nextTurnHandler(initiative *services.InitiativeService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		state, err := initiative.NextTurn(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, state)
+	}
+}
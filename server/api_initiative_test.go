@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"keeper/server/models"
+)
+
+func TestInitiativeAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/characters", `{"name": "Harvey Walters", "sheet": `+investigatorSheet+`}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a character, got %d", status)
+	}
+	bob := dialWS(t, server, "bob")
+
+	var state models.Initiative
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/initiative/combatants", `{"character_id": 1}`, &state); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding a character, got %d", status)
+	}
+	if len(state.Combatants) != 1 || state.Combatants[0].Initiative == nil || *state.Combatants[0].Initiative != 55 {
+		t.Errorf("Expected Harvey to act on his DEX, got %+v", state)
+	}
+	if event := readEvent(t, bob); event.Type != models.EventInitiativeUpdated || event.Initiative == nil || len(event.Initiative.Combatants) != 1 {
+		t.Errorf("Expected initiative.updated, got %+v", event)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/initiative/combatants", `{"name": "Cultist", "initiative": 60}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding a cultist, got %d", status)
+	}
+	readEvent(t, bob)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/initiative/next", "", &state); status != http.StatusOK {
+		t.Fatalf("Expected 200 starting the fight, got %d", status)
+	}
+	if state.Round != 1 || state.TurnID != 2 || state.Combatants[0].Name != "Cultist" {
+		t.Errorf("Expected the cultist to act first in round 1, got %+v", state)
+	}
+	if event := readEvent(t, bob); event.Initiative == nil || event.Initiative.TurnID != 2 {
+		t.Errorf("Expected the cultist's turn to be pushed, got %+v", event)
+	}
+
+	var current models.Initiative
+	if status := call(t, server, "kpr_read-key", "GET", "/api/v1/rooms/1/initiative", "", &current); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-member bot, got %d", status)
+	}
+	if status := call(t, server, "bob", "GET", "/api/v1/rooms/1/initiative", "", &current); status != http.StatusOK || current.TurnID != 2 || current.Round != 1 {
+		t.Errorf("Expected the stored turn order, got %d %+v", status, current)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"not bob's turn", "bob", "POST", "/api/v1/rooms/1/initiative/next", "", http.StatusForbidden},
+		{"fixed initiative", "alice", "POST", "/api/v1/rooms/1/initiative/combatants/2/roll", "", http.StatusBadRequest},
+		{"unknown combatant", "alice", "POST", "/api/v1/rooms/1/initiative/combatants/9/roll", "", http.StatusNotFound},
+		{"nobody to roll", "bob", "POST", "/api/v1/rooms/1/initiative/roll", "", http.StatusBadRequest},
+		{"someone else's combatant", "bob", "DELETE", "/api/v1/rooms/1/initiative/combatants/2", "", http.StatusForbidden},
+		{"bad dice", "bob", "POST", "/api/v1/rooms/1/initiative/combatants", `{"name": "Dog", "dice": "2x"}`, http.StatusBadRequest},
+		{"player ends the fight", "bob", "DELETE", "/api/v1/rooms/1/initiative", "", http.StatusForbidden},
+		{"remove", "alice", "DELETE", "/api/v1/rooms/1/initiative/combatants/2", "", http.StatusOK},
+		{"end", "alice", "DELETE", "/api/v1/rooms/1/initiative", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
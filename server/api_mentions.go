@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// MentionListResponse is the body of GET /api/v1/mentions.
+type MentionListResponse struct {
+	Mentions []models.Mention `json:"mentions"`
+	Unread   int              `json:"unread"` // All unread mentions, not only this page
+}
+
+// MarkMentionsReadRequest is the body of POST /api/v1/mentions/read.
+type MarkMentionsReadRequest struct {
+	IDs []int64 `json:"ids"` // Empty marks every mention as read
+}
+
+// MarkMentionsReadResponse is the response of POST /api/v1/mentions/read.
+type MarkMentionsReadResponse struct {
+	Unread int `json:"unread"`
+}
+
+// registerMentionRoutes mounts the mentions inbox of the caller.
+func registerMentionRoutes(mux *http.ServeMux, authSvc ports.AuthService, mentions *services.MentionService) {
+	mux.Handle("GET /api/v1/mentions", withPrincipal(authSvc, listMentionsHandler(mentions)))
+	mux.Handle("POST /api/v1/mentions/read", withPrincipal(authSvc, markMentionsReadHandler(mentions)))
+}
+
+// listMentionsHandler returns the caller's mentions, newest first. Query
+// parameters: unread, which leaves out read mentions, before (mention ID)
+// and limit.
+func listMentionsHandler(mentions *services.MentionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		var query ports.MentionQuery
+		if raw := r.URL.Query().Get("unread"); raw != "" {
+			unread, err := strconv.ParseBool(raw)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "unread must be true or false")
+				return
+			}
+			query.UnreadOnly = unread
+		}
+		if raw := r.URL.Query().Get("before"); raw != "" {
+			before, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || before < 1 {
+				respondError(w, http.StatusBadRequest, "before must be a mention ID")
+				return
+			}
+			query.BeforeID = before
+		}
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > ports.MaxMessagePageSize {
+				respondError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+				return
+			}
+			query.Limit = limit
+		}
+
+		inbox, unread, err := mentions.Inbox(p, query)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, MentionListResponse{Mentions: inbox, Unread: unread})
+	}
+}
+
+func markMentionsReadHandler(mentions *services.MentionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		var req MarkMentionsReadRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		unread, err := mentions.MarkRead(p, req.IDs)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, MarkMentionsReadResponse{Unread: unread})
+	}
+}
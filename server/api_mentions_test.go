@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"keeper/server/models"
+)
+
+func TestMentionsAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	// bob connects before joining, so the socket is not subscribed to the room.
+	bob := dialWS(t, server, "bob")
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+
+	var msg models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "@bob, the door is open"}`, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting, got %d", status)
+	}
+	event := readEvent(t, bob)
+	if event.Type != models.EventMentionCreated || event.Mention == nil || event.Mention.Kind != models.MentionUser || event.Mention.Message == nil || event.Mention.Message.ID != msg.ID {
+		t.Fatalf("Expected a mention.created event for the message, got %+v", event)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "@room roll Luck"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting, got %d", status)
+	}
+	readEvent(t, bob)
+
+	var inbox MentionListResponse
+	if status := call(t, server, "bob", "GET", "/api/v1/mentions", "", &inbox); status != http.StatusOK {
+		t.Fatalf("Expected 200 listing mentions, got %d", status)
+	}
+	if len(inbox.Mentions) != 2 || inbox.Unread != 2 || inbox.Mentions[0].Kind != models.MentionRoom || inbox.Mentions[1].Message.Text != "@bob, the door is open" {
+		t.Errorf("Expected both mentions, newest first, got %+v", inbox)
+	}
+	if status := call(t, server, "alice", "GET", "/api/v1/mentions", "", &inbox); status != http.StatusOK || len(inbox.Mentions) != 0 {
+		t.Errorf("Expected authors not to mention themselves, got %d %+v", status, inbox)
+	}
+
+	var read MarkMentionsReadResponse
+	if status := call(t, server, "bob", "POST", "/api/v1/mentions/read", `{"ids": [1]}`, &read); status != http.StatusOK || read.Unread != 1 {
+		t.Errorf("Expected one unread mention left, got %d %+v", status, read)
+	}
+	if status := call(t, server, "bob", "GET", "/api/v1/mentions?unread=true", "", &inbox); status != http.StatusOK || len(inbox.Mentions) != 1 || inbox.Mentions[0].ID != 2 {
+		t.Errorf("Expected only the @room mention to be unread, got %d %+v", status, inbox)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/mentions/read", `{}`, &read); status != http.StatusOK || read.Unread != 0 {
+		t.Errorf("Expected no unread mentions left, got %d %+v", status, read)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"anonymous", "", "GET", "/api/v1/mentions", "", http.StatusUnauthorized},
+		{"bad limit", "bob", "GET", "/api/v1/mentions?limit=500", "", http.StatusBadRequest},
+		{"bad unread", "bob", "GET", "/api/v1/mentions?unread=maybe", "", http.StatusBadRequest},
+		{"missing body", "bob", "POST", "/api/v1/mentions/read", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, status)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// NotificationPreferencesRequest is the body of PUT /api/v1/notifications/preferences.
+type NotificationPreferencesRequest struct {
+	EmailDigest    string `json:"email_digest"` // off, hourly or daily
+	Mentions       bool   `json:"mentions"`
+	DirectMessages bool   `json:"direct_messages"`
+}
+
+// registerNotificationRoutes mounts the notification preferences of the caller.
+func registerNotificationRoutes(mux *http.ServeMux, authSvc ports.AuthService, notifications *services.NotificationService) {
+	mux.Handle("GET /api/v1/notifications/preferences", withPrincipal(authSvc, getNotificationPreferencesHandler(notifications)))
+	mux.Handle("PUT /api/v1/notifications/preferences", withPrincipal(authSvc, setNotificationPreferencesHandler(notifications)))
+}
+
+func getNotificationPreferencesHandler(notifications *services.NotificationService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		prefs, err := notifications.Preferences(p)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, prefs)
+	}
+}
+
+func setNotificationPreferencesHandler(notifications *services.NotificationService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		var req NotificationPreferencesRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		prefs, err := notifications.SetPreferences(p, models.NotificationPreferences{
+			EmailDigest:    req.EmailDigest,
+			Mentions:       req.Mentions,
+			DirectMessages: req.DirectMessages,
+		})
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, prefs)
+	}
+}
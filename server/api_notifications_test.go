@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"keeper/server/models"
+)
+
+func TestNotificationPreferencesAPI(t *testing.T) {
+	server := newTestServer(t)
+
+	var prefs models.NotificationPreferences
+	if status := call(t, server, "bob", "GET", "/api/v1/notifications/preferences", "", &prefs); status != http.StatusOK {
+		t.Fatalf("Expected 200 getting preferences, got %d", status)
+	}
+	if prefs.EmailDigest != models.DigestHourly || !prefs.Mentions || !prefs.DirectMessages || prefs.UpdatedAt != nil {
+		t.Errorf("Expected the defaults, got %+v", prefs)
+	}
+
+	body := `{"email_digest": "daily", "mentions": true, "direct_messages": false}`
+	if status := call(t, server, "bob", "PUT", "/api/v1/notifications/preferences", body, &prefs); status != http.StatusOK {
+		t.Fatalf("Expected 200 saving preferences, got %d", status)
+	}
+	prefs = models.NotificationPreferences{}
+	if status := call(t, server, "bob", "GET", "/api/v1/notifications/preferences", "", &prefs); status != http.StatusOK {
+		t.Fatalf("Expected 200 getting preferences, got %d", status)
+	}
+	if prefs.EmailDigest != models.DigestDaily || !prefs.Mentions || prefs.DirectMessages || prefs.UpdatedAt == nil {
+		t.Errorf("Expected the saved preferences, got %+v", prefs)
+	}
+	if status := call(t, server, "alice", "GET", "/api/v1/notifications/preferences", "", &prefs); status != http.StatusOK || prefs.EmailDigest != models.DigestHourly {
+		t.Errorf("Expected alice to keep the defaults, got %d %+v", status, prefs)
+	}
+
+	tests := []struct {
+		name, credential, method, body string
+		want                           int
+	}{
+		{"anonymous", "", "GET", "", http.StatusUnauthorized},
+		{"bot", "kpr_bot-key", "GET", "", http.StatusForbidden},
+		{"weekly", "bob", "PUT", `{"email_digest": "weekly"}`, http.StatusBadRequest},
+		{"missing body", "bob", "PUT", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if status := call(t, server, tt.credential, tt.method, "/api/v1/notifications/preferences", tt.body, nil); status != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, status)
+		}
+	}
+}
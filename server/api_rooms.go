@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// CreateRoomRequest is the body of POST /api/v1/rooms.
+type CreateRoomRequest struct {
+	Name string `json:"name"`
+}
+
+// AddMemberRequest is the body of POST /api/v1/rooms/{id}/members.
+type AddMemberRequest struct {
+	UserID string `json:"user_id"` // Kratos identity or service account ID
+	Role   string `json:"role,omitempty"`
+}
+
+// MessageRequest is the body of PATCH /api/v1/rooms/{id}/messages/{messageID}.
+type MessageRequest struct {
+	Text string `json:"text"`
+}
+
+// PostMessageRequest is the body of POST /api/v1/rooms/{id}/messages.
+type PostMessageRequest struct {
+	Text        string   `json:"text"`
+	Format      string   `json:"format,omitempty"`       // "plain" (the default) or "markdown"
+	VisibleTo   []string `json:"visible_to,omitempty"`   // Members who may see a whisper, besides the author
+	CharacterID int64    `json:"character_id,omitempty"` // Speaks as this character of the room
+	InCharacter bool     `json:"in_character,omitempty"` // Narration that is part of the fiction
+	FileIDs     []int64  `json:"file_ids,omitempty"`     // Uploads to post with the message
+}
+
+// RollRequest is the body of POST /api/v1/rooms/{id}/rolls. With a skill,
+// it is a check against a character's sheet.
+type RollRequest struct {
+	Dice        string   `json:"dice"`                   // e.g. "4d6kh3+2"; for checks, "" or d100 with bonus or penalty dice
+	Label       string   `json:"label,omitempty"`        // What the roll is for
+	VisibleTo   []string `json:"visible_to,omitempty"`   // Members who may see a hidden roll, besides the roller
+	Skill       string   `json:"skill,omitempty"`        // e.g. "Spot Hidden"
+	CharacterID int64    `json:"character_id,omitempty"` // Defaults to the caller's only character in the room
+}
+
+// RoomListResponse is the body of GET /api/v1/rooms.
+type RoomListResponse struct {
+	Rooms []models.Room `json:"rooms"`
+}
+
+// MemberListResponse is the body of GET /api/v1/rooms/{id}/members.
+type MemberListResponse struct {
+	Members []models.RoomMember `json:"members"`
+}
+
+// MessageListResponse is the body of GET /api/v1/rooms/{id}/messages.
+// Messages are in chronological order; pass the first ID as ?before= to page back.
+type MessageListResponse struct {
+	Messages []models.Message `json:"messages"`
+}
+
+// registerRoomRoutes mounts the versioned rooms and messages API. Changes are
+// broadcast to WebSocket clients by the chat service, just like changes made over /ws.
+func registerRoomRoutes(mux *http.ServeMux, authSvc ports.AuthService, chatSvc ports.ChatService) {
+	mux.Handle("GET /api/v1/rooms", withPrincipal(authSvc, listRoomsHandler(chatSvc)))
+	mux.Handle("POST /api/v1/rooms", withPrincipal(authSvc, createRoomHandler(chatSvc)))
+	mux.Handle("GET /api/v1/rooms/{id}", withPrincipal(authSvc, getRoomHandler(chatSvc)))
+	mux.Handle("GET /api/v1/rooms/{id}/members", withPrincipal(authSvc, listMembersHandler(chatSvc)))
+	mux.Handle("POST /api/v1/rooms/{id}/members", withPrincipal(authSvc, addMemberHandler(chatSvc)))
+	mux.Handle("GET /api/v1/rooms/{id}/messages", withPrincipal(authSvc, listMessagesHandler(chatSvc)))
+	mux.Handle("POST /api/v1/rooms/{id}/messages", withPrincipal(authSvc, postMessageHandler(chatSvc)))
+	mux.Handle("POST /api/v1/rooms/{id}/rolls", withPrincipal(authSvc, rollHandler(chatSvc)))
+	mux.Handle("PATCH /api/v1/rooms/{id}/messages/{messageID}", withPrincipal(authSvc, editMessageHandler(chatSvc)))
+	mux.Handle("DELETE /api/v1/rooms/{id}/messages/{messageID}", withPrincipal(authSvc, deleteMessageHandler(chatSvc)))
+	mux.Handle("POST /api/v1/rooms/{id}/messages/{messageID}/reveal", withPrincipal(authSvc, revealMessageHandler(chatSvc)))
+}
+
+// principalHandler is a handler for an authenticated principal.
+type principalHandler func(w http.ResponseWriter, r *http.Request, p *models.Principal)
+
+// withPrincipal authenticates the request with a Kratos session or API key.
+// Scopes are checked per operation by the chat service.
+func withPrincipal(authSvc ports.AuthService, next principalHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := authenticatePrincipal(w, r, authSvc)
+		if principal == nil {
+			return
+		}
+		next(w, r, principal)
+	})
+}
+
+// pathID parses a numeric path parameter. On failure it writes a 404 and returns false.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusNotFound, "Not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeBody decodes a JSON request body. On failure it writes a 400 and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+func listRoomsHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		rooms, err := chatSvc.ListRooms(p)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, RoomListResponse{Rooms: rooms})
+	}
+}
+
+func createRoomHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		var req CreateRoomRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		room, err := chatSvc.CreateRoom(p, req.Name)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, room)
+	}
+}
+
+func getRoomHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		room, err := chatSvc.GetRoom(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, room)
+	}
+}
+
+func listMembersHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		members, err := chatSvc.ListMembers(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, MemberListResponse{Members: members})
+	}
+}
+
+func addMemberHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req AddMemberRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		member, err := chatSvc.AddMember(p, roomID, req.UserID, req.Role)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, member)
+	}
+}
+
+// listMessagesHandler returns room history. Query parameters: before (message ID),
+// limit and in_character, which leaves out table talk.
+func listMessagesHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		query := ports.MessageQuery{RoomID: roomID}
+		if raw := r.URL.Query().Get("before"); raw != "" {
+			before, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || before < 1 {
+				respondError(w, http.StatusBadRequest, "before must be a message ID")
+				return
+			}
+			query.BeforeID = before
+		}
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > ports.MaxMessagePageSize {
+				respondError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+				return
+			}
+			query.Limit = limit
+		}
+		if raw := r.URL.Query().Get("in_character"); raw != "" {
+			inCharacter, err := strconv.ParseBool(raw)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "in_character must be true or false")
+				return
+			}
+			query.InCharacter = inCharacter
+		}
+
+		messages, err := chatSvc.History(p, query)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, MessageListResponse{Messages: messages})
+	}
+}
+
+func postMessageHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req PostMessageRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		msg, err := chatSvc.SendMessageContext(r.Context(), p, ports.MessageDraft{
+			RoomID:      roomID,
+			Text:        req.Text,
+			Format:      req.Format,
+			VisibleTo:   req.VisibleTo,
+			CharacterID: req.CharacterID,
+			InCharacter: req.InCharacter,
+			FileIDs:     req.FileIDs,
+		})
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		if msg.Ephemeral {
+			// A command answered only the sender; nothing was stored.
+			respondJSON(w, http.StatusOK, msg)
+			return
+		}
+		respondJSON(w, http.StatusCreated, msg)
+	}
+}
+
+func rollHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req RollRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		msg, err := chatSvc.Roll(p, ports.RollDraft{
+			RoomID:      roomID,
+			Dice:        req.Dice,
+			Label:       req.Label,
+			VisibleTo:   req.VisibleTo,
+			Skill:       req.Skill,
+			CharacterID: req.CharacterID,
+		})
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, msg)
+	}
+}
+
+func editMessageHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		messageID, ok := pathID(w, r, "messageID")
+		if !ok {
+			return
+		}
+		var req MessageRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		msg, err := chatSvc.EditMessage(p, roomID, messageID, req.Text)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, msg)
+	}
+}
+
+func deleteMessageHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		messageID, ok := pathID(w, r, "messageID")
+		if !ok {
+			return
+		}
+		if err := chatSvc.DeleteMessage(p, roomID, messageID); err != nil {
+			respondChatError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func revealMessageHandler(chatSvc ports.ChatService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		messageID, ok := pathID(w, r, "messageID")
+		if !ok {
+			return
+		}
+		msg, err := chatSvc.RevealMessage(p, roomID, messageID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, msg)
+	}
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	"keeper/server/adapters/blobs/local"
+	calendarsqlite "keeper/server/adapters/calendar/sqlite"
+	characterssqlite "keeper/server/adapters/characters/sqlite"
+	commandssqlite "keeper/server/adapters/commands/sqlite"
+	filessqlite "keeper/server/adapters/files/sqlite"
+	initiativesqlite "keeper/server/adapters/initiative/sqlite"
+	mentionssqlite "keeper/server/adapters/mentions/sqlite"
+	messagingsqlite "keeper/server/adapters/messaging/sqlite"
+	notificationssqlite "keeper/server/adapters/notifications/sqlite"
+	"keeper/server/adapters/realtime"
+	sessionssqlite "keeper/server/adapters/sessions/sqlite"
+	webhookssqlite "keeper/server/adapters/webhooks/sqlite"
+	"keeper/server/core/services"
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
+
+	"github.com/gorilla/websocket"
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// stubAuth authenticates fixed session tokens and API keys.
+type stubAuth struct {
+	sessions map[string]*usersmanagement.User
+	keys     map[string]*models.Principal
+}
+
+func (s *stubAuth) ValidateToken(ctx context.Context, token string) (*usersmanagement.User, error) {
+	if u, ok := s.sessions[token]; ok {
+		return u, nil
+	}
+	return nil, services.ErrInvalidToken
+}
+
+func (s *stubAuth) AuthenticateAPIKey(ctx context.Context, key string) (*models.Principal, error) {
+	if p, ok := s.keys[key]; ok {
+		return p, nil
+	}
+	return nil, services.ErrInvalidAPIKey
+}
+
+// LookupUser finds the users of the stub sessions by ID.
+func (s *stubAuth) LookupUser(ctx context.Context, id string) (*usersmanagement.User, error) {
+	for _, u := range s.sessions {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, usersmanagement.ErrIdentityNotFound
+}
+
+// LookupUsers finds the users of the stub sessions by ID.
+func (s *stubAuth) LookupUsers(ctx context.Context, ids []string) (map[string]*usersmanagement.User, error) {
+	found := map[string]*usersmanagement.User{}
+	for _, u := range s.sessions {
+		if slices.Contains(ids, u.ID) {
+			found[u.ID] = u
+		}
+	}
+	return found, nil
+}
+
+// newTestServer serves the rooms API and /ws over an in-memory database.
+// Every HTTP exchange is validated against the OpenAPI document.
+// Sessions: "alice" and "bob"; API keys: "bot-key" (read and write), "read-key" (read only)
+// and "cmd-key" (read, write and commands:register), all of service account sa_dice.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1) // Each connection to :memory: is a separate database.
+	t.Cleanup(func() { db.Close() })
+
+	messageRepo := messagingsqlite.NewSQLiteRepository(db)
+	roomRepo := messagingsqlite.NewSQLiteRoomRepository(db)
+	if err := messageRepo.InitSchema(); err != nil {
+		t.Fatalf("InitSchema() failed: %v", err)
+	}
+	if err := roomRepo.InitRoomSchema(); err != nil {
+		t.Fatalf("InitRoomSchema() failed: %v", err)
+	}
+
+	authSvc := &stubAuth{
+		sessions: map[string]*usersmanagement.User{
+			"alice": {ID: "alice-id", Email: "alice@example.com", Profile: usersmanagement.Profile{Nickname: "Alice"}},
+			"bob":   {ID: "bob-id", Email: "bob@example.com", Profile: usersmanagement.Profile{Nickname: "Bob"}},
+		},
+		keys: map[string]*models.Principal{
+			"kpr_bot-key":  {ID: "sa_dice", Type: models.AuthorTypeBot, DisplayName: "dice-bot", Scopes: []string{models.ScopeMessagesRead, models.ScopeMessagesWrite}},
+			"kpr_read-key": {ID: "sa_dice", Type: models.AuthorTypeBot, DisplayName: "dice-bot", Scopes: []string{models.ScopeMessagesRead}},
+			"kpr_cmd-key":  {ID: "sa_dice", Type: models.AuthorTypeBot, DisplayName: "dice-bot", Scopes: []string{models.ScopeMessagesRead, models.ScopeMessagesWrite, models.ScopeCommandsRegister}},
+		},
+	}
+	webhookRepo := webhookssqlite.NewSQLiteWebhookRepository(db)
+	if err := webhookRepo.InitWebhookSchema(); err != nil {
+		t.Fatalf("InitWebhookSchema() failed: %v", err)
+	}
+	accountRepo := authsqlite.NewSQLiteServiceAccountRepository(db)
+	if err := accountRepo.InitServiceAccountSchema(); err != nil {
+		t.Fatalf("InitServiceAccountSchema() failed: %v", err)
+	}
+	if err := accountRepo.CreateServiceAccount(models.ServiceAccount{ID: "sa_dice", Name: "dice-bot", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateServiceAccount() failed: %v", err)
+	}
+	commandRepo := commandssqlite.NewSQLiteCommandRepository(db)
+	if err := commandRepo.InitCommandSchema(); err != nil {
+		t.Fatalf("InitCommandSchema() failed: %v", err)
+	}
+	characterRepo := characterssqlite.NewSQLiteCharacterRepository(db)
+	if err := characterRepo.InitCharacterSchema(); err != nil {
+		t.Fatalf("InitCharacterSchema() failed: %v", err)
+	}
+	initiativeRepo := initiativesqlite.NewSQLiteInitiativeRepository(db)
+	if err := initiativeRepo.InitInitiativeSchema(); err != nil {
+		t.Fatalf("InitInitiativeSchema() failed: %v", err)
+	}
+	sessionRepo := sessionssqlite.NewSQLiteSessionRepository(db)
+	if err := sessionRepo.InitSessionSchema(); err != nil {
+		t.Fatalf("InitSessionSchema() failed: %v", err)
+	}
+	calendarRepo := calendarsqlite.NewSQLiteCalendarRepository(db)
+	if err := calendarRepo.InitCalendarSchema(); err != nil {
+		t.Fatalf("InitCalendarSchema() failed: %v", err)
+	}
+	fileRepo := filessqlite.NewSQLiteFileRepository(db)
+	if err := fileRepo.InitFileSchema(); err != nil {
+		t.Fatalf("InitFileSchema() failed: %v", err)
+	}
+	mentionRepo := mentionssqlite.NewSQLiteMentionRepository(db)
+	if err := mentionRepo.InitMentionSchema(); err != nil {
+		t.Fatalf("InitMentionSchema() failed: %v", err)
+	}
+	notificationRepo := notificationssqlite.NewSQLiteNotificationRepository(db)
+	if err := notificationRepo.InitNotificationSchema(); err != nil {
+		t.Fatalf("InitNotificationSchema() failed: %v", err)
+	}
+	blobs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	hub := realtime.NewHub()
+	authz := services.NewRoomAuthorizer(roomRepo)
+	webhookSvc := services.NewWebhookService(webhookRepo, authz)
+	mentions := services.NewMentionService(mentionRepo, roomRepo, messageRepo, userDirectory{authSvc}, hub, hub)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go mentions.Run(ctx)
+	chatSvc := services.NewChatService(messageRepo, roomRepo, authz, services.Publishers{hub, webhookSvc, mentions})
+	commands := services.NewCommandRegistry(commandRepo, accountRepo, authz)
+	commands.SetAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}) // Bots are local test servers
+	chatSvc.SetCommands(commands)
+	characters := services.NewCharacterService(characterRepo, roomRepo, authz)
+	chatSvc.SetCharacters(characters)
+	initiative := services.NewInitiativeService(initiativeRepo, authz, services.Publishers{hub, webhookSvc})
+	initiative.SetCharacters(characters)
+	chatSvc.SetInitiative(initiative)
+	sessions := services.NewSessionService(sessionRepo, authz, chatSvc)
+	chatSvc.SetSessions(sessions)
+	calendar := services.NewCalendarService(calendarRepo, authz, chatSvc)
+	chatSvc.SetCalendar(calendar)
+	files := services.NewFileService(fileRepo, blobs, messageRepo, authz)
+	chatSvc.SetFiles(files)
+	notifications := services.NewNotificationService(notificationRepo, mentionRepo, roomRepo, messageRepo, userDirectory{authSvc}, hub)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(w, r, chatSvc, hub, authSvc)
+	})
+	registerRoomRoutes(mux, authSvc, chatSvc)
+	registerWebhookRoutes(mux, authSvc, webhookSvc)
+	registerIncomingWebhookRoutes(mux, authSvc, services.NewIncomingWebhookService(webhookRepo, authz, chatSvc))
+	registerCommandRoutes(mux, authSvc, commands)
+	registerCharacterRoutes(mux, authSvc, characters)
+	registerInitiativeRoutes(mux, authSvc, initiative)
+	registerGameSessionRoutes(mux, authSvc, sessions)
+	registerCalendarRoutes(mux, authSvc, calendar)
+	registerFileRoutes(mux, authSvc, files)
+	registerMentionRoutes(mux, authSvc, mentions)
+	registerNotificationRoutes(mux, authSvc, notifications)
+	registerSpecRoutes(mux)
+	server := httptest.NewServer(validateAgainstSpec(t, mux))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// call performs a request authenticated with a session token, or an API key if it starts with kpr_.
+func call(t *testing.T, server *httptest.Server, credential, method, path, body string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if strings.HasPrefix(credential, "kpr_") {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	} else if credential != "" {
+		req.Header.Set("X-Session-Token", credential)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func dialWS(t *testing.T, server *httptest.Server, token string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"X-Session-Token": {token}})
+	if err != nil {
+		t.Fatalf("Failed to dial WebSocket: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) models.Event {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event models.Event
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read WebSocket frame: %v", err)
+	}
+	return event
+}
+
+func TestRoomsAPI_MessagesAreBroadcast(t *testing.T) {
+	server := newTestServer(t)
+
+	var room models.Room
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, &room); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "sa_dice"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding the bot, got %d", status)
+	}
+
+	conn := dialWS(t, server, "alice")
+
+	var posted models.Message
+	if status := call(t, server, "kpr_bot-key", "POST", "/api/v1/rooms/1/messages", `{"text": "Rolled 2d6: 9"}`, &posted); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting as bot, got %d", status)
+	}
+	if posted.AuthorType != models.AuthorTypeBot || posted.UserID != "sa_dice" {
+		t.Errorf("Expected a bot-authored message, got %+v", posted)
+	}
+
+	event := readEvent(t, conn)
+	if event.Type != models.EventMessageCreated || event.Message == nil || event.Message.ID != posted.ID {
+		t.Fatalf("Expected message.created for %d over WebSocket, got %+v", posted.ID, event)
+	}
+
+	// Messages posted over the socket go through the same path.
+	if err := conn.WriteJSON(ClientFrame{Type: frameMessageCreate, RoomID: room.ID, Text: "Nice roll"}); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	event = readEvent(t, conn)
+	if event.Type != models.EventMessageCreated || event.Message.User != "Alice" {
+		t.Fatalf("Expected alice's message to be broadcast, got %+v", event)
+	}
+
+	if status := call(t, server, "alice", "PATCH", "/api/v1/rooms/1/messages/2", `{"text": "Nice roll!"}`, nil); status != http.StatusOK {
+		t.Fatalf("Expected 200 editing own message, got %d", status)
+	}
+	if event := readEvent(t, conn); event.Type != models.EventMessageUpdated || event.Message.EditedAt == nil {
+		t.Errorf("Expected message.updated, got %+v", event)
+	}
+	if status := call(t, server, "alice", "DELETE", "/api/v1/rooms/1/messages/1", "", nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 when the owner deletes a message, got %d", status)
+	}
+	if event := readEvent(t, conn); event.Type != models.EventMessageDeleted || event.MessageID != 1 {
+		t.Errorf("Expected message.deleted, got %+v", event)
+	}
+
+	var history MessageListResponse
+	if status := call(t, server, "kpr_read-key", "GET", "/api/v1/rooms/1/messages", "", &history); status != http.StatusOK {
+		t.Fatalf("Expected 200 reading history, got %d", status)
+	}
+	if len(history.Messages) != 1 || history.Messages[0].Text != "Nice roll!" {
+		t.Errorf("Unexpected history: %+v", history.Messages)
+	}
+}
+
+func TestRoomsAPI_Markdown(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	conn := dialWS(t, server, "alice")
+
+	var posted models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "- *lamp*\n- <rope>", "format": "markdown"}`, &posted); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting Markdown, got %d", status)
+	}
+	if want := "<ul>\n<li><em>lamp</em></li>\n<li>&lt;rope&gt;</li>\n</ul>"; posted.Format != models.MessageFormatMarkdown || posted.HTML != want {
+		t.Errorf("Expected the list rendered as %q, got %+v", want, posted)
+	}
+	readEvent(t, conn)
+
+	if err := conn.WriteJSON(ClientFrame{Type: frameMessageCreate, RoomID: 1, Text: "`/roll`", Format: models.MessageFormatMarkdown}); err != nil {
+		t.Fatalf("Failed to write frame: %v", err)
+	}
+	if event := readEvent(t, conn); event.Type != models.EventMessageCreated || event.Message.HTML != "<p><code>/roll</code></p>" {
+		t.Errorf("Expected Markdown sent over the socket to be rendered, got %+v", event)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "hi", "format": "rtf"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", status)
+	}
+}
+
+func TestRoomsAPI_Authorization(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "private"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "secret"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting, got %d", status)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"no credentials", "", "GET", "/api/v1/rooms", "", http.StatusUnauthorized},
+		{"non-member reads", "bob", "GET", "/api/v1/rooms/1/messages", "", http.StatusForbidden},
+		{"non-member posts", "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "hi"}`, http.StatusForbidden},
+		{"missing room", "alice", "GET", "/api/v1/rooms/99", "", http.StatusNotFound},
+		{"empty message", "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "  "}`, http.StatusBadRequest},
+		{"duplicate room", "alice", "POST", "/api/v1/rooms", `{"name": "private"}`, http.StatusConflict},
+		{"bot creates room", "kpr_bot-key", "POST", "/api/v1/rooms", `{"name": "bots"}`, http.StatusForbidden},
+		{"invalid key", "kpr_nope", "GET", "/api/v1/rooms", "", http.StatusUnauthorized},
+		{"bad limit", "alice", "GET", "/api/v1/rooms/1/messages?limit=0", "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+
+	// Members other than the author and owners cannot edit or delete.
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	if status := call(t, server, "bob", "PATCH", "/api/v1/rooms/1/messages/1", `{"text": "edited"}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 editing someone else's message, got %d", status)
+	}
+	if status := call(t, server, "bob", "DELETE", "/api/v1/rooms/1/messages/1", "", nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 deleting someone else's message, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/members", `{"user_id": "mallory"}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 when a member adds members, got %d", status)
+	}
+}
+
+func TestWebSocket_ChecksOrigin(t *testing.T) {
+	server := newTestServer(t)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	for origin, ok := range map[string]bool{
+		"":                      true, // Not a browser
+		server.URL:              true,
+		"http://localhost:8081": true,
+		"https://evil.example":  false,
+	} {
+		header := http.Header{"Cookie": {"ory_kratos_session=alice"}}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if ok && err != nil {
+			t.Errorf("Expected a connection from origin %q, got %v", origin, err)
+		}
+		if !ok && (err == nil || resp == nil || resp.StatusCode != http.StatusForbidden) {
+			t.Errorf("Expected origin %q to be refused with 403, got %v", origin, err)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestRoomsAPI_Rolls(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+
+	var msg models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/rolls", `{"dice": "4d6kh3", "label": "Strength"}`, &msg); status != http.StatusCreated {
+		t.Fatalf("Expected 201 rolling dice, got %d", status)
+	}
+	if msg.Kind != models.MessageKindRoll || msg.Roll == nil || msg.Roll.Total < 3 || msg.Roll.Total > 18 || len(msg.Roll.Terms[0].Dice) != 4 {
+		t.Errorf("Expected a structured 4d6kh3 roll, got %+v", msg)
+	}
+
+	var command models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "/roll d100b1 Spot Hidden"}`, &command); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for /roll, got %d", status)
+	}
+	if command.Roll == nil || command.Roll.Label != "Spot Hidden" {
+		t.Errorf("Expected /roll to post a structured roll, got %+v", command)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"edit a roll", "alice", "PATCH", "/api/v1/rooms/1/messages/1", `{"text": "rolled 4d6kh3: [6, 6, 6, (6)] = 18"}`, http.StatusForbidden},
+		{"bad dice", "alice", "POST", "/api/v1/rooms/1/rolls", `{"dice": "4d6kh5"}`, http.StatusBadRequest},
+		{"not a member", "bob", "POST", "/api/v1/rooms/1/rolls", `{"dice": "d20"}`, http.StatusForbidden},
+		{"read-only key", "kpr_read-key", "POST", "/api/v1/rooms/1/rolls", `{"dice": "d20"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
+
+func TestRoomsAPI_Whispers(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	for _, id := range []string{"bob-id", "sa_dice"} {
+		if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "`+id+`"}`, nil); status != http.StatusCreated {
+			t.Fatalf("Expected 201 adding %s, got %d", id, status)
+		}
+	}
+	bobConn := dialWS(t, server, "bob")
+
+	var whisper models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "The bot is a cultist.", "visible_to": ["sa_dice"]}`, &whisper); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for a whisper, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "Night falls."}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for a message, got %d", status)
+	}
+	if event := readEvent(t, bobConn); event.Message == nil || event.Message.Text != "Night falls." {
+		t.Errorf("Expected bob to skip the whisper, got %+v", event)
+	}
+
+	var hidden models.Message
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "/hroll d100 Sanity"}`, &hidden); status != http.StatusCreated {
+		t.Fatalf("Expected 201 for /hroll, got %d", status)
+	}
+	if event := readEvent(t, bobConn); event.Message == nil || event.Message.ID != hidden.ID {
+		t.Errorf("Expected bob to see his hidden roll, got %+v", event)
+	}
+
+	for credential, want := range map[string]int{"alice": 3, "bob": 2, "kpr_read-key": 2} {
+		var page MessageListResponse
+		if status := call(t, server, credential, "GET", "/api/v1/rooms/1/messages", "", &page); status != http.StatusOK || len(page.Messages) != want {
+			t.Errorf("Expected %s to see %d messages, got %d %+v", credential, want, status, page)
+		}
+	}
+
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages/1/reveal", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 revealing a whisper bob cannot see, got %d", status)
+	}
+	var revealed models.Message
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages/1/reveal", "", &revealed); status != http.StatusOK || revealed.VisibleTo != nil || revealed.RevealedAt == nil {
+		t.Fatalf("Expected 200 revealing the whisper, got %d %+v", status, revealed)
+	}
+	if event := readEvent(t, bobConn); event.Type != models.EventMessageRevealed || event.Message.ID != whisper.ID {
+		t.Errorf("Expected bob to receive the revealed whisper, got %+v", event)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages/1/reveal", "", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 revealing a public message, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/messages", `{"text": "psst", "visible_to": ["mallory"]}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 whispering to a non-member, got %d", status)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// CreateServiceAccountRequest is the body of POST /api/admin/service-accounts.
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Scopes      []string `json:"scopes"`
+}
+
+// CreateServiceAccountResponse returns the new account with its first key.
+// The key secret is only ever shown in this response.
+type CreateServiceAccountResponse struct {
+	ServiceAccount *models.ServiceAccount `json:"service_account"`
+	Key            *services.IssuedKey    `json:"key"`
+}
+
+// IssueKeyRequest is the body of POST /api/admin/service-accounts/{id}/keys.
+type IssueKeyRequest struct {
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in,omitempty"` // Go duration, e.g. "720h"; empty for no expiry
+}
+
+// RotateKeyRequest is the optional body of the key rotation endpoint.
+type RotateKeyRequest struct {
+	GracePeriod string `json:"grace_period,omitempty"` // How long the old key keeps working, e.g. "24h"
+}
+
+// ServiceAccountListResponse is the body of GET /api/admin/service-accounts.
+type ServiceAccountListResponse struct {
+	ServiceAccounts []models.ServiceAccount `json:"service_accounts"`
+}
+
+// APIKeyListResponse is the body of GET /api/admin/service-accounts/{id}/keys.
+type APIKeyListResponse struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+// registerServiceAccountRoutes mounts the admin API for bots and their API keys.
+func registerServiceAccountRoutes(mux *http.ServeMux, authSvc ports.AuthService, svc *services.ServiceAccountService) {
+	mux.Handle("POST /api/admin/service-accounts", requireAdmin(authSvc, createServiceAccountHandler(svc)))
+	mux.Handle("GET /api/admin/service-accounts", requireAdmin(authSvc, listServiceAccountsHandler(svc)))
+	mux.Handle("POST /api/admin/service-accounts/{id}/disable", requireAdmin(authSvc, setServiceAccountDisabledHandler(svc, true)))
+	mux.Handle("POST /api/admin/service-accounts/{id}/enable", requireAdmin(authSvc, setServiceAccountDisabledHandler(svc, false)))
+	mux.Handle("GET /api/admin/service-accounts/{id}/keys", requireAdmin(authSvc, listAPIKeysHandler(svc)))
+	mux.Handle("POST /api/admin/service-accounts/{id}/keys", requireAdmin(authSvc, issueAPIKeyHandler(svc)))
+	mux.Handle("POST /api/admin/service-accounts/{id}/keys/{keyID}/rotate", requireAdmin(authSvc, rotateAPIKeyHandler(svc)))
+	mux.Handle("DELETE /api/admin/service-accounts/{id}/keys/{keyID}", requireAdmin(authSvc, revokeAPIKeyHandler(svc)))
+}
+
+// respondServiceAccountError maps ServiceAccountService errors to HTTP responses.
+func respondServiceAccountError(w http.ResponseWriter, err error, message string) {
+	log.Printf("%s: %v", message, err)
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound):
+		respondError(w, http.StatusNotFound, "Service account not found")
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		respondError(w, http.StatusNotFound, "API key not found")
+	case errors.Is(err, services.ErrInvalidServiceAccountRequest):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, message)
+	}
+}
+
+// parseOptionalDuration parses a Go duration, treating "" as 0.
+func parseOptionalDuration(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+func createServiceAccountHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateServiceAccountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		account, key, err := svc.CreateServiceAccount(req.Name, req.Description, adminFromContext(r.Context()).ID, req.Scopes)
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to create service account")
+			return
+		}
+		respondJSON(w, http.StatusCreated, CreateServiceAccountResponse{ServiceAccount: account, Key: key})
+	}
+}
+
+func listServiceAccountsHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accounts, err := svc.ListServiceAccounts()
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to list service accounts")
+			return
+		}
+		respondJSON(w, http.StatusOK, ServiceAccountListResponse{ServiceAccounts: accounts})
+	}
+}
+
+func setServiceAccountDisabledHandler(svc *services.ServiceAccountService, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		account, err := svc.SetDisabled(r.PathValue("id"), disabled)
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to update service account")
+			return
+		}
+		respondJSON(w, http.StatusOK, account)
+	}
+}
+
+func listAPIKeysHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := svc.ListKeys(r.PathValue("id"))
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to list API keys")
+			return
+		}
+		respondJSON(w, http.StatusOK, APIKeyListResponse{Keys: keys})
+	}
+}
+
+func issueAPIKeyHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req IssueKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		ttl, err := parseOptionalDuration(req.ExpiresIn)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "expires_in must be a duration such as 720h")
+			return
+		}
+		key, err := svc.IssueKey(r.PathValue("id"), req.Scopes, ttl)
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to issue API key")
+			return
+		}
+		respondJSON(w, http.StatusCreated, key)
+	}
+}
+
+func rotateAPIKeyHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := strconv.ParseInt(r.PathValue("keyID"), 10, 64)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		var req RotateKeyRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+		}
+		grace, err := parseOptionalDuration(req.GracePeriod)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "grace_period must be a duration such as 24h")
+			return
+		}
+		key, err := svc.RotateKey(r.PathValue("id"), keyID, grace)
+		if err != nil {
+			respondServiceAccountError(w, err, "Failed to rotate API key")
+			return
+		}
+		respondJSON(w, http.StatusCreated, key)
+	}
+}
+
+func revokeAPIKeyHandler(svc *services.ServiceAccountService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := strconv.ParseInt(r.PathValue("keyID"), 10, 64)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		if err := svc.RevokeKey(r.PathValue("id"), keyID); err != nil {
+			respondServiceAccountError(w, err, "Failed to revoke API key")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// StartGameSessionRequest is the body of POST /api/v1/rooms/{id}/sessions.
+type StartGameSessionRequest struct {
+	Title string `json:"title,omitempty"` // Defaults to "Session N"
+}
+
+// GameSessionListResponse is the body of GET /api/v1/rooms/{id}/sessions.
+type GameSessionListResponse struct {
+	Sessions []models.Session `json:"sessions"`
+}
+
+// registerGameSessionRoutes mounts the game sessions of rooms and the download of
+// their transcripts.
+func registerGameSessionRoutes(mux *http.ServeMux, authSvc ports.AuthService, sessions *services.SessionService) {
+	mux.Handle("GET /api/v1/rooms/{id}/sessions", withPrincipal(authSvc, listGameSessionsHandler(sessions)))
+	mux.Handle("POST /api/v1/rooms/{id}/sessions", withPrincipal(authSvc, startGameSessionHandler(sessions)))
+	mux.Handle("POST /api/v1/rooms/{id}/sessions/end", withPrincipal(authSvc, endGameSessionHandler(sessions)))
+	mux.Handle("GET /api/v1/sessions/{sessionID}", withPrincipal(authSvc, getGameSessionHandler(sessions)))
+	mux.Handle("GET /api/v1/sessions/{sessionID}/transcript", withPrincipal(authSvc, transcriptHandler(sessions)))
+}
+
+func listGameSessionsHandler(sessions *services.SessionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		list, err := sessions.ListSessions(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, GameSessionListResponse{Sessions: list})
+	}
+}
+
+func startGameSessionHandler(sessions *services.SessionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req StartGameSessionRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		session, err := sessions.StartSession(p, roomID, req.Title)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, session)
+	}
+}
+
+func endGameSessionHandler(sessions *services.SessionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		session, err := sessions.EndSession(p, roomID)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, session)
+	}
+}
+
+func getGameSessionHandler(sessions *services.SessionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "sessionID")
+		if !ok {
+			return
+		}
+		session, err := sessions.GetSession(p, id)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, session)
+	}
+}
+
+// transcriptHandler downloads a transcript as Markdown (the default), HTML
+// or JSON, as chosen by ?format=.
+func transcriptHandler(sessions *services.SessionService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		id, ok := pathID(w, r, "sessionID")
+		if !ok {
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = services.TranscriptMarkdown
+		}
+		var inCharacter bool
+		if raw := r.URL.Query().Get("in_character"); raw != "" {
+			var err error
+			if inCharacter, err = strconv.ParseBool(raw); err != nil {
+				respondError(w, http.StatusBadRequest, "in_character must be true or false")
+				return
+			}
+		}
+
+		transcript, err := sessions.Transcript(p, id, inCharacter)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		contentType, name, err := services.TranscriptFile(format, transcript)
+		if err != nil {
+			respondChatError(w, err)
+			return
+		}
+		var body bytes.Buffer
+		if err := services.WriteTranscript(&body, format, transcript); err != nil {
+			respondChatError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body.Bytes())
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"keeper/server/models"
+)
+
+// download fetches a transcript as alice and returns its headers and body.
+func download(t *testing.T, url string) (http.Header, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	req.Header.Set("X-Session-Token", "alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for %s, got %d %s, %v", url, resp.StatusCode, body, err)
+	}
+	return resp.Header, string(body)
+}
+
+func TestGameSessionsAPI(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/sessions", `{}`, nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a member starting a session, got %d", status)
+	}
+
+	var session models.Session
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/sessions", `{"title": "The Haunting"}`, &session); status != http.StatusCreated || session.StartMessageID == 0 {
+		t.Fatalf("Expected 201 starting a session, got %d %+v", status, session)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/sessions", `{}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 starting a second session, got %d", status)
+	}
+	if status := call(t, server, "bob", "POST", "/api/v1/rooms/1/messages", `{"text": "I check the cellar"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 posting, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/sessions/end", "", &session); status != http.StatusOK || session.EndedAt == nil {
+		t.Fatalf("Expected 200 ending the session, got %d %+v", status, session)
+	}
+
+	var list GameSessionListResponse
+	if status := call(t, server, "bob", "GET", "/api/v1/rooms/1/sessions", "", &list); status != http.StatusOK || len(list.Sessions) != 1 {
+		t.Errorf("Expected one session, got %d %+v", status, list)
+	}
+	if status := call(t, server, "kpr_read-key", "GET", "/api/v1/sessions/1", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a bot outside the room, got %d", status)
+	}
+
+	header, body := download(t, server.URL+"/api/v1/sessions/1/transcript")
+	if header.Get("Content-Type") != "text/markdown; charset=utf-8" || header.Get("Content-Disposition") != `attachment; filename="table-1-the-haunting.md"` {
+		t.Errorf("Expected a Markdown attachment, got %v", header)
+	}
+	if !strings.Contains(body, "**Bob:** I check the cellar") {
+		t.Errorf("Expected bob's message in the transcript, got:\n%s", body)
+	}
+	if _, body := download(t, server.URL+"/api/v1/sessions/1/transcript?format=html"); !strings.Contains(body, "<h1>The Haunting</h1>") {
+		t.Errorf("Expected an HTML transcript, got:\n%s", body)
+	}
+	var transcript models.Transcript
+	if status := call(t, server, "alice", "GET", "/api/v1/sessions/1/transcript?format=json&in_character=true", "", &transcript); status != http.StatusOK || len(transcript.Messages) != 0 {
+		t.Errorf("Expected an empty in-character transcript, got %d %+v", status, transcript)
+	}
+	if status := call(t, server, "alice", "GET", "/api/v1/sessions/1/transcript?format=pdf", "", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", status)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"keeper/server/api"
+)
+
+// registerSpecRoutes serves the OpenAPI and AsyncAPI documents. They are public
+// so that tooling can fetch them without credentials.
+func registerSpecRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /api/openapi.yaml", specHandler(api.OpenAPI))
+	mux.Handle("GET /api/asyncapi.yaml", specHandler(api.AsyncAPI))
+}
+
+func specHandler(document []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(document)
+	}
+}
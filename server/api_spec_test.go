@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"keeper/server/api"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	// Transcripts and calendars are downloaded as text; validate them like text/plain.
+	for _, contentType := range []string{"text/markdown", "text/html", "text/calendar"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.RegisteredBodyDecoder("text/plain"))
+	}
+	// Uploaded files are served with their own type.
+	for _, contentType := range []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"} {
+		openapi3filter.RegisterBodyDecoder(contentType, openapi3filter.FileBodyDecoder)
+	}
+}
+
+func loadOpenAPI(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(api.OpenAPI)
+	if err != nil {
+		t.Fatalf("Failed to load the OpenAPI document: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("The OpenAPI document is invalid: %v", err)
+	}
+	return doc
+}
+
+// validateAgainstSpec wraps handler so that every request and response that
+// passes through it is checked against the OpenAPI document. Requests the spec
+// rejects must be rejected by the handler too, with a 4xx status.
+func validateAgainstSpec(t *testing.T, handler http.Handler) http.Handler {
+	t.Helper()
+	doc := loadOpenAPI(t)
+	doc.Servers = nil // Match the test server's host.
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("Failed to build the OpenAPI router: %v", err)
+	}
+	options := &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			handler.ServeHTTP(w, r) // Described by the AsyncAPI document.
+			return
+		}
+		route, pathParams, err := router.FindRoute(r)
+		if err != nil {
+			t.Errorf("%s %s is not in the OpenAPI document: %v", r.Method, r.URL.Path, err)
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		input := &openapi3filter.RequestValidationInput{Request: r, PathParams: pathParams, Route: route, Options: options}
+		requestErr := openapi3filter.ValidateRequest(r.Context(), input)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+
+		if requestErr != nil && (recorder.Code < 400 || recorder.Code >= 500) {
+			t.Errorf("%s %s violates the spec (%v) but the server answered %d", r.Method, r.URL.Path, requestErr, recorder.Code)
+		}
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 recorder.Code,
+			Header:                 recorder.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(recorder.Body.Bytes())),
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		})
+		if err != nil {
+			t.Errorf("Response %d to %s %s does not match the spec: %v", recorder.Code, r.Method, r.URL.Path, err)
+		}
+
+		for key, values := range recorder.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(recorder.Code)
+		w.Write(recorder.Body.Bytes())
+	})
+}
+
+func TestOpenAPISpec_IsValid(t *testing.T) {
+	loadOpenAPI(t)
+}
+
+func TestAsyncAPISpec_IsValidYAML(t *testing.T) {
+	var doc struct {
+		AsyncAPI string                 `yaml:"asyncapi"`
+		Channels map[string]interface{} `yaml:"channels"`
+	}
+	if err := yaml.Unmarshal(api.AsyncAPI, &doc); err != nil {
+		t.Fatalf("Failed to parse the AsyncAPI document: %v", err)
+	}
+	if doc.AsyncAPI == "" || doc.Channels["/ws"] == nil {
+		t.Errorf("Expected an AsyncAPI document describing /ws, got %+v", doc)
+	}
+}
+
+// routePattern matches route registrations such as mux.Handle("GET /api/users", ...).
+var routePattern = regexp.MustCompile(`mux\.Handle(?:Func)?\("([A-Z]+) (/[^"]*)"`)
+
+// TestOpenAPISpec_DocumentsAllRoutes fails when a route is registered without
+// being added to the OpenAPI document.
+func TestOpenAPISpec_DocumentsAllRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("Failed to list source files: %v", err)
+	}
+	routes := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		for _, match := range routePattern.FindAllStringSubmatch(string(source), -1) {
+			routes++
+			method, path := match[1], match[2]
+			item := doc.Paths.Find(path)
+			if item == nil || item.GetOperation(method) == nil {
+				t.Errorf("%s: %s %s is not documented in api/openapi.yaml", file, method, path)
+			}
+		}
+	}
+	if routes == 0 {
+		t.Fatal("Expected to find route registrations")
+	}
+}
+
+func TestSpecRoutes_ServeDocuments(t *testing.T) {
+	server := newTestServer(t)
+	for path, want := range map[string][]byte{"/api/openapi.yaml": api.OpenAPI, "/api/asyncapi.yaml": api.AsyncAPI} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+			t.Errorf("Expected %s to serve the embedded document, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
+)
+
+// UserListResponse is the body of GET /api/users.
+type UserListResponse struct {
+	Users []usersmanagement.PublicProfile `json:"users"`
+}
+
+// registerUserRoutes mounts the user directory API. Service accounts need the users:read scope.
+func registerUserRoutes(mux *http.ServeMux, authSvc ports.AuthService, userSvc *usersmanagement.UserService) {
+	mux.Handle("GET /api/users", listUsersHandler(authSvc, userSvc))
+	mux.Handle("GET /api/users/{id}", getUserHandler(authSvc, userSvc))
+}
+
+// listUsersHandler searches the member directory.
+// Query parameters: q (substring search), email (exact login identifier), limit.
+func listUsersHandler(authSvc ports.AuthService, userSvc *usersmanagement.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticatePrincipal(w, r, authSvc, models.ScopeUsersRead) == nil {
+			return
+		}
+
+		if email := r.URL.Query().Get("email"); email != "" {
+			user, err := userSvc.GetUserByEmail(r.Context(), email)
+			if errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+				respondJSON(w, http.StatusOK, UserListResponse{Users: []usersmanagement.PublicProfile{}})
+				return
+			}
+			if err != nil {
+				log.Printf("Error looking up user by email: %v", err)
+				respondError(w, http.StatusBadGateway, "Failed to look up user")
+				return
+			}
+			respondJSON(w, http.StatusOK, UserListResponse{Users: []usersmanagement.PublicProfile{user.PublicProfile()}})
+			return
+		}
+
+		limit := 0
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 {
+				respondError(w, http.StatusBadRequest, "limit must be a positive integer")
+				return
+			}
+			limit = parsed
+		}
+
+		users, err := userSvc.SearchUsers(r.Context(), r.URL.Query().Get("q"), limit)
+		if err != nil {
+			log.Printf("Error searching users: %v", err)
+			respondError(w, http.StatusBadGateway, "Failed to search users")
+			return
+		}
+		profiles := make([]usersmanagement.PublicProfile, 0, len(users))
+		for _, u := range users {
+			profiles = append(profiles, u.PublicProfile())
+		}
+		respondJSON(w, http.StatusOK, UserListResponse{Users: profiles})
+	}
+}
+
+// getUserHandler returns the public profile of a single user.
+func getUserHandler(authSvc ports.AuthService, userSvc *usersmanagement.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if authenticatePrincipal(w, r, authSvc, models.ScopeUsersRead) == nil {
+			return
+		}
+
+		user, err := userSvc.LookupUser(r.Context(), r.PathValue("id"))
+		if errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+			respondError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching user %s: %v", r.PathValue("id"), err)
+			respondError(w, http.StatusBadGateway, "Failed to fetch user")
+			return
+		}
+		respondJSON(w, http.StatusOK, user.PublicProfile())
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// CreateWebhookRequest is the body of POST /api/v1/rooms/{id}/webhooks.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // Defaults to all events
+}
+
+// CreateWebhookResponse returns the new webhook with its signing secret.
+// The secret is only ever shown in this response.
+type CreateWebhookResponse struct {
+	Webhook *models.Webhook `json:"webhook"`
+	Secret  string          `json:"secret"`
+}
+
+// WebhookListResponse is the body of GET /api/v1/rooms/{id}/webhooks.
+type WebhookListResponse struct {
+	Webhooks []models.Webhook `json:"webhooks"`
+}
+
+// DeliveryListResponse is the body of GET /api/admin/webhook-deliveries.
+type DeliveryListResponse struct {
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+// registerWebhookRoutes mounts webhook management for room owners and the
+// admin API to inspect and replay deliveries.
+func registerWebhookRoutes(mux *http.ServeMux, authSvc ports.AuthService, webhooks *services.WebhookService) {
+	mux.Handle("GET /api/v1/rooms/{id}/webhooks", withPrincipal(authSvc, listWebhooksHandler(webhooks)))
+	mux.Handle("POST /api/v1/rooms/{id}/webhooks", withPrincipal(authSvc, createWebhookHandler(webhooks)))
+	mux.Handle("DELETE /api/v1/rooms/{id}/webhooks/{webhookID}", withPrincipal(authSvc, deleteWebhookHandler(webhooks)))
+	mux.Handle("GET /api/admin/webhook-deliveries", requireAdmin(authSvc, listDeliveriesHandler(webhooks)))
+	mux.Handle("GET /api/admin/webhook-deliveries/{id}", requireAdmin(authSvc, getDeliveryHandler(webhooks)))
+	mux.Handle("POST /api/admin/webhook-deliveries/{id}/replay", requireAdmin(authSvc, replayDeliveryHandler(webhooks)))
+}
+
+// respondWebhookError maps WebhookService errors to HTTP responses.
+func respondWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		respondError(w, http.StatusNotFound, "Webhook not found")
+	case errors.Is(err, services.ErrDeliveryNotFound):
+		respondError(w, http.StatusNotFound, "Delivery not found")
+	default:
+		respondChatError(w, err)
+	}
+}
+
+func listWebhooksHandler(webhooks *services.WebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		list, err := webhooks.ListWebhooks(p, roomID)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, WebhookListResponse{Webhooks: list})
+	}
+}
+
+func createWebhookHandler(webhooks *services.WebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		var req CreateWebhookRequest
+		if !decodeBody(w, r, &req) {
+			return
+		}
+		webhook, secret, err := webhooks.CreateWebhook(p, roomID, req.URL, req.Events)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, CreateWebhookResponse{Webhook: webhook, Secret: secret})
+	}
+}
+
+func deleteWebhookHandler(webhooks *services.WebhookService) principalHandler {
+	return func(w http.ResponseWriter, r *http.Request, p *models.Principal) {
+		roomID, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		webhookID, ok := pathID(w, r, "webhookID")
+		if !ok {
+			return
+		}
+		if err := webhooks.DeleteWebhook(p, roomID, webhookID); err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listDeliveriesHandler lists deliveries, newest first.
+// Query parameters: status (pending, delivered or dead), webhook_id, limit.
+func listDeliveriesHandler(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := ports.DeliveryQuery{Status: r.URL.Query().Get("status")}
+		if raw := r.URL.Query().Get("webhook_id"); raw != "" {
+			id, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "webhook_id must be a number")
+				return
+			}
+			query.WebhookID = id
+		}
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > 100 {
+				respondError(w, http.StatusBadRequest, "limit must be between 1 and 100")
+				return
+			}
+			query.Limit = limit
+		}
+		deliveries, err := webhooks.ListDeliveries(query)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, DeliveryListResponse{Deliveries: deliveries})
+	}
+}
+
+func getDeliveryHandler(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		delivery, err := webhooks.GetDelivery(id)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, delivery)
+	}
+}
+
+func replayDeliveryHandler(webhooks *services.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "id")
+		if !ok {
+			return
+		}
+		replay, err := webhooks.ReplayDelivery(id)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, replay)
+	}
+}
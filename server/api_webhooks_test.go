@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWebhooksAPI_OwnersManageWebhooks(t *testing.T) {
+	server := newTestServer(t)
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms", `{"name": "table"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a room, got %d", status)
+	}
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/members", `{"user_id": "bob-id"}`, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201 adding bob, got %d", status)
+	}
+
+	var created CreateWebhookResponse
+	body := `{"url": "https://ci.example.com/keeper", "events": ["message.created"]}`
+	if status := call(t, server, "alice", "POST", "/api/v1/rooms/1/webhooks", body, &created); status != http.StatusCreated {
+		t.Fatalf("Expected 201 creating a webhook, got %d", status)
+	}
+	if created.Secret == "" || created.Webhook.ID == 0 {
+		t.Errorf("Expected the webhook and its secret, got %+v", created)
+	}
+
+	var list WebhookListResponse
+	if status := call(t, server, "alice", "GET", "/api/v1/rooms/1/webhooks", "", &list); status != http.StatusOK || len(list.Webhooks) != 1 {
+		t.Fatalf("Expected one webhook, got %d %+v", status, list)
+	}
+
+	tests := []struct {
+		name, credential, method, path, body string
+		want                                 int
+	}{
+		{"member lists", "bob", "GET", "/api/v1/rooms/1/webhooks", "", http.StatusForbidden},
+		{"member creates", "bob", "POST", "/api/v1/rooms/1/webhooks", body, http.StatusForbidden},
+		{"unknown event", "alice", "POST", "/api/v1/rooms/1/webhooks", `{"url": "https://example.com", "events": ["nope"]}`, http.StatusBadRequest},
+		{"missing webhook", "alice", "DELETE", "/api/v1/rooms/1/webhooks/99", "", http.StatusNotFound},
+		{"deliveries need admin", "alice", "GET", "/api/admin/webhook-deliveries", "", http.StatusForbidden},
+		{"owner deletes", "alice", "DELETE", "/api/v1/rooms/1/webhooks/1", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := call(t, server, tt.credential, tt.method, tt.path, tt.body, nil); status != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, status)
+			}
+		})
+	}
+}
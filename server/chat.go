@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"keeper/server/core/services"
+)
+
+// chatErrorStatus maps ChatService errors to an HTTP status and a client-facing
+// message. Unexpected errors are logged and reported generically.
+func chatErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrRoomNotFound):
+		return http.StatusNotFound, "Room not found"
+	case errors.Is(err, services.ErrMessageNotFound):
+		return http.StatusNotFound, "Message not found"
+	case errors.Is(err, services.ErrCharacterNotFound):
+		return http.StatusNotFound, "Character not found"
+	case errors.Is(err, services.ErrCombatantNotFound):
+		return http.StatusNotFound, "Combatant not found"
+	case errors.Is(err, services.ErrSessionNotFound):
+		return http.StatusNotFound, "Session not found"
+	case errors.Is(err, services.ErrRoomExists):
+		return http.StatusConflict, "A room with that name already exists"
+	case errors.Is(err, services.ErrNotRoomMember):
+		return http.StatusForbidden, "Not a member of this room"
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden, errorDetail(err)
+	case errors.Is(err, services.ErrInvalidInput):
+		return http.StatusBadRequest, errorDetail(err)
+	default:
+		log.Printf("Chat operation failed: %v", err)
+		return http.StatusInternalServerError, "Internal server error"
+	}
+}
+
+// errorDetail strips the sentinel prefix from errors built as fmt.Errorf("%w: detail", sentinel).
+func errorDetail(err error) string {
+	if _, detail, ok := strings.Cut(err.Error(), ": "); ok {
+		return detail
+	}
+	return err.Error()
+}
+
+// respondChatError writes a ChatService error as a JSON error response.
+func respondChatError(w http.ResponseWriter, err error) {
+	status, message := chatErrorStatus(err)
+	respondError(w, status, message)
+}
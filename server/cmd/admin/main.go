@@ -0,0 +1,169 @@
+// Command admin manages Kratos identities for Keeper operators, so that
+// accounts can be administered without raw calls to the Kratos admin API.
+//
+// Usage (from the server directory):
+//
+//	go run ./cmd/admin <command> [flags] [identity]
+//
+// The identity argument is either a Kratos identity ID or the email the user
+// logs in with. Output is JSON on stdout.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	usersmanagement "keeper/server/users-management"
+)
+
+const usage = `Usage: admin <command> [flags] [identity]
+
+Commands:
+  create            Create an identity (-email, -password, -first, -last, -nickname, -admin)
+  find              Show the identity with the given ID or email
+  deactivate        Deactivate an identity and revoke all of its sessions
+  reactivate        Reactivate a deactivated identity
+  revoke-sessions   Revoke all sessions of an identity
+  recovery-link     Generate an account recovery link (-expires 1h)
+  sessions          List sessions of an identity (-all to include inactive ones)
+  grant-admin       Grant the admin role
+  revoke-admin      Remove the admin role
+
+Environment:
+  KRATOS_ADMIN_URL   Kratos admin API (default http://127.0.0.1:4434)
+  KRATOS_PUBLIC_URL  Kratos public API (default http://127.0.0.1:4433)
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	kratosAdminURL := envOrDefault("KRATOS_ADMIN_URL", "http://127.0.0.1:4434")
+	kratosPublicURL := envOrDefault("KRATOS_PUBLIC_URL", "http://127.0.0.1:4433")
+	kratosClient, err := usersmanagement.NewKratosClient(kratosAdminURL, kratosPublicURL)
+	if err != nil {
+		log.Fatalf("Failed to create Kratos client: %v", err)
+	}
+	userSvc := usersmanagement.NewUserService(kratosClient)
+	adminSvc := usersmanagement.NewAdminService(kratosClient, userSvc)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	command, args := os.Args[1], os.Args[2:]
+	switch command {
+	case "create":
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		var req usersmanagement.CreateUserRequest
+		fs.StringVar(&req.Email, "email", "", "email the user logs in with (required)")
+		fs.StringVar(&req.Password, "password", "", "initial password; omit to require a recovery link")
+		fs.StringVar(&req.FirstName, "first", "", "first name")
+		fs.StringVar(&req.LastName, "last", "", "last name")
+		fs.StringVar(&req.Nickname, "nickname", "", "nickname")
+		fs.BoolVar(&req.Admin, "admin", false, "grant the admin role")
+		fs.Parse(args)
+		user, err := adminSvc.CreateUser(ctx, req)
+		exitOnError(err)
+		printJSON(user)
+
+	case "find":
+		printJSON(resolveUser(ctx, userSvc, singleArg(command, args)))
+
+	case "deactivate":
+		user := resolveUser(ctx, userSvc, singleArg(command, args))
+		updated, err := adminSvc.DeactivateUser(ctx, user.ID)
+		exitOnError(err)
+		printJSON(updated)
+
+	case "reactivate":
+		user := resolveUser(ctx, userSvc, singleArg(command, args))
+		updated, err := adminSvc.ReactivateUser(ctx, user.ID)
+		exitOnError(err)
+		printJSON(updated)
+
+	case "revoke-sessions":
+		user := resolveUser(ctx, userSvc, singleArg(command, args))
+		exitOnError(adminSvc.RevokeSessions(ctx, user.ID))
+		log.Printf("Revoked all sessions of %s (%s)", user.Email, user.ID)
+
+	case "recovery-link":
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		expires := fs.String("expires", "", "link lifetime, e.g. 1h (default: Kratos setting)")
+		fs.Parse(args)
+		user := resolveUser(ctx, userSvc, singleArg(command, fs.Args()))
+		link, err := adminSvc.CreateRecoveryLink(ctx, user.ID, *expires)
+		exitOnError(err)
+		printJSON(link)
+
+	case "sessions":
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		all := fs.Bool("all", false, "include inactive sessions")
+		fs.Parse(args)
+		user := resolveUser(ctx, userSvc, singleArg(command, fs.Args()))
+		sessions, err := adminSvc.ListSessions(ctx, user.ID, !*all)
+		exitOnError(err)
+		printJSON(sessions)
+
+	case "grant-admin", "revoke-admin":
+		user := resolveUser(ctx, userSvc, singleArg(command, args))
+		updated, err := adminSvc.SetAdmin(ctx, user.ID, command == "grant-admin")
+		exitOnError(err)
+		printJSON(updated)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+// resolveUser accepts an identity ID or a login email.
+func resolveUser(ctx context.Context, userSvc *usersmanagement.UserService, ref string) *usersmanagement.User {
+	var (
+		user *usersmanagement.User
+		err  error
+	)
+	if strings.Contains(ref, "@") {
+		user, err = userSvc.GetUserByEmail(ctx, ref)
+	} else {
+		user, err = userSvc.GetUserByID(ctx, ref)
+	}
+	exitOnError(err)
+	return user
+}
+
+func singleArg(command string, args []string) string {
+	if len(args) != 1 {
+		log.Fatalf("%s expects exactly one identity ID or email", command)
+	}
+	return args[0]
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Error encoding output: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Command chat reads and writes room messages directly in the server database,
+// through the same chat service as the WebSocket and REST front-ends, so
+// membership, scope and validation rules apply unchanged.
+//
+// Usage (from the server directory):
+//
+//	go run ./cmd/chat -as <id> [-name <display name>] <command> [args]
+//
+// -as is the Kratos identity ID or service account ID (sa_...) to act as.
+// Service accounts act with all scopes. DB_PATH selects the database like it
+// does for the server (default ./keeper.db). Output is JSON on stdout, except
+// for transcripts exported as Markdown or HTML and iCalendar files.
+//
+// Changes are not pushed to clients connected to a running server; they see
+// them when they next load the room history.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	calendarsqlite "keeper/server/adapters/calendar/sqlite"
+	characterssqlite "keeper/server/adapters/characters/sqlite"
+	commandssqlite "keeper/server/adapters/commands/sqlite"
+	initiativesqlite "keeper/server/adapters/initiative/sqlite"
+	messagingsqlite "keeper/server/adapters/messaging/sqlite"
+	sessionssqlite "keeper/server/adapters/sessions/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+const usage = `Usage: chat -as <id> [-name <display name>] <command> [args]
+
+Commands:
+  rooms                         List the rooms of the principal
+  history <room> [-before id] [-limit n]
+                                Show room history
+  post <room> <text>            Post a message, or run a slash command like /roll 3d6
+  roll <room> <dice> [label]    Roll dice like 4d6kh3+2 and post the result
+  edit <message> <text>         Edit one of the principal's messages
+  delete <message>              Delete a message
+  reveal <message>              Show a whisper or hidden roll to the whole room
+  sessions <room>               List the game sessions of a room; start and end
+                                them with post <room> /session start|end
+  export <session> [-format markdown|html|json] [-in-character]
+                                Write the transcript of a session to stdout
+  events <room>                 List the upcoming events of a room; schedule
+                                them with post <room> /event add ...
+  calendar <room>               Write the calendar of a room to stdout as iCalendar
+
+Environment:
+  DB_PATH   Server database (default ./keeper.db)
+`
+
+// logPublisher logs events instead of broadcasting them; there are no
+// connected clients in this process.
+type logPublisher struct{}
+
+func (logPublisher) Publish(event models.Event) {
+	log.Printf("%s in room %d (not broadcast to running servers)", event.Type, event.RoomID)
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	as := flag.String("as", "", "Kratos identity ID or service account ID to act as (required)")
+	name := flag.String("name", "", "display name of new messages (default: the -as ID)")
+	flag.Parse()
+	if *as == "" || flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./keeper.db"
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		log.Fatalf("Error opening database %s: %v", dbPath, err)
+	}
+	defer db.Close()
+
+	messageRepo := messagingsqlite.NewSQLiteRepository(db)
+	roomRepo := messagingsqlite.NewSQLiteRoomRepository(db)
+	exitOnError(messageRepo.InitSchema())
+	exitOnError(roomRepo.InitRoomSchema())
+	accountRepo := authsqlite.NewSQLiteServiceAccountRepository(db)
+	commandRepo := commandssqlite.NewSQLiteCommandRepository(db)
+	exitOnError(accountRepo.InitServiceAccountSchema())
+	exitOnError(commandRepo.InitCommandSchema())
+	characterRepo := characterssqlite.NewSQLiteCharacterRepository(db)
+	exitOnError(characterRepo.InitCharacterSchema())
+	initiativeRepo := initiativesqlite.NewSQLiteInitiativeRepository(db)
+	exitOnError(initiativeRepo.InitInitiativeSchema())
+	sessionRepo := sessionssqlite.NewSQLiteSessionRepository(db)
+	exitOnError(sessionRepo.InitSessionSchema())
+	authz := services.NewRoomAuthorizer(roomRepo)
+	chatSvc := services.NewChatService(messageRepo, roomRepo, authz, logPublisher{})
+	chatSvc.SetCommands(services.NewCommandRegistry(commandRepo, accountRepo, authz))
+	characters := services.NewCharacterService(characterRepo, roomRepo, authz)
+	chatSvc.SetCharacters(characters)
+	initiative := services.NewInitiativeService(initiativeRepo, authz, logPublisher{})
+	initiative.SetCharacters(characters)
+	chatSvc.SetInitiative(initiative)
+	sessions := services.NewSessionService(sessionRepo, authz, chatSvc)
+	chatSvc.SetSessions(sessions)
+	calendarRepo := calendarsqlite.NewSQLiteCalendarRepository(db)
+	exitOnError(calendarRepo.InitCalendarSchema())
+	calendar := services.NewCalendarService(calendarRepo, authz, chatSvc)
+	chatSvc.SetCalendar(calendar)
+
+	principal := principalFor(*as, *name)
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "rooms":
+		rooms, err := chatSvc.ListRooms(principal)
+		exitOnError(err)
+		printJSON(rooms)
+
+	case "history":
+		if len(args) < 1 {
+			log.Fatal("Usage: chat history <room> [-before id] [-limit n]")
+		}
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		before := fs.Int64("before", 0, "only messages older than this message ID")
+		limit := fs.Int("limit", 0, "number of messages (at most 100)")
+		fs.Parse(args[1:])
+		messages, err := chatSvc.History(principal, ports.MessageQuery{RoomID: parseID(args[0]), BeforeID: *before, Limit: *limit})
+		exitOnError(err)
+		printJSON(messages)
+
+	case "post":
+		if len(args) < 2 {
+			log.Fatal("Usage: chat post <room> <text>")
+		}
+		msg, err := chatSvc.PostMessage(principal, parseID(args[0]), strings.Join(args[1:], " "))
+		exitOnError(err)
+		printJSON(msg)
+
+	case "roll":
+		if len(args) < 2 {
+			log.Fatal("Usage: chat roll <room> <dice> [label]")
+		}
+		msg, err := chatSvc.Roll(principal, ports.RollDraft{RoomID: parseID(args[0]), Dice: args[1], Label: strings.Join(args[2:], " ")})
+		exitOnError(err)
+		printJSON(msg)
+
+	case "edit":
+		if len(args) < 2 {
+			log.Fatal("Usage: chat edit <message> <text>")
+		}
+		msg, err := chatSvc.EditMessage(principal, 0, parseID(args[0]), strings.Join(args[1:], " "))
+		exitOnError(err)
+		printJSON(msg)
+
+	case "delete":
+		if len(args) != 1 {
+			log.Fatal("Usage: chat delete <message>")
+		}
+		exitOnError(chatSvc.DeleteMessage(principal, 0, parseID(args[0])))
+
+	case "reveal":
+		if len(args) != 1 {
+			log.Fatal("Usage: chat reveal <message>")
+		}
+		msg, err := chatSvc.RevealMessage(principal, 0, parseID(args[0]))
+		exitOnError(err)
+		printJSON(msg)
+
+	case "sessions":
+		if len(args) != 1 {
+			log.Fatal("Usage: chat sessions <room>")
+		}
+		list, err := sessions.ListSessions(principal, parseID(args[0]))
+		exitOnError(err)
+		printJSON(list)
+
+	case "export":
+		if len(args) < 1 {
+			log.Fatal("Usage: chat export <session> [-format markdown|html|json] [-in-character]")
+		}
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		format := fs.String("format", services.TranscriptMarkdown, "markdown, html or json")
+		inCharacter := fs.Bool("in-character", false, "leave out table talk")
+		fs.Parse(args[1:])
+		transcript, err := sessions.Transcript(principal, parseID(args[0]), *inCharacter)
+		exitOnError(err)
+		exitOnError(services.WriteTranscript(os.Stdout, *format, transcript))
+
+	case "events":
+		if len(args) != 1 {
+			log.Fatal("Usage: chat events <room>")
+		}
+		events, err := calendar.ListEvents(principal, parseID(args[0]))
+		exitOnError(err)
+		printJSON(events)
+
+	case "calendar":
+		if len(args) != 1 {
+			log.Fatal("Usage: chat calendar <room>")
+		}
+		room, events, err := calendar.Calendar(principal, parseID(args[0]))
+		exitOnError(err)
+		exitOnError(services.WriteICS(os.Stdout, room, events))
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// principalFor describes the identity the operator acts as.
+func principalFor(id, name string) *models.Principal {
+	if name == "" {
+		name = id
+	}
+	if strings.HasPrefix(id, services.ServiceAccountIDPrefix) {
+		return &models.Principal{ID: id, Type: models.AuthorTypeBot, DisplayName: name, Scopes: models.Scopes}
+	}
+	return &models.Principal{ID: id, Type: models.AuthorTypeUser, DisplayName: name}
+}
+
+func parseID(raw string) int64 {
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		log.Fatalf("Invalid ID %q", raw)
+	}
+	return id
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("Error encoding output: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+// Command migrate-users moves accounts from the legacy `users` table (bcrypt
+// password hashes from before the switch to Kratos) into Kratos identities.
+// The bcrypt hashes are imported, so users keep their passwords.
+//
+// For every legacy user it:
+//   - creates a Kratos identity, or links to an existing one with the same email,
+//   - records the legacy ID to identity ID mapping in legacy_user_migrations,
+//   - attributes the user's messages without an author ID to the identity.
+//
+// Each step is recorded, so the command can be re-run after a failure and
+// continues where it stopped.
+//
+// Usage (from the server directory):
+//
+//	go run ./cmd/migrate-users -email-domain example.com [-dry-run]
+//
+// A dry run works on a temporary copy of the database and leaves it as is.
+//
+// DB_PATH selects the database like it does for the server (default ./keeper.db).
+// KRATOS_ADMIN_URL and KRATOS_PUBLIC_URL select the Kratos instance
+// (default http://127.0.0.1:4434 and http://127.0.0.1:4433).
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	messagingsqlite "keeper/server/adapters/messaging/sqlite"
+	usersmanagement "keeper/server/users-management"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// kratosIdentities implements identityStore with the Kratos user and admin services.
+type kratosIdentities struct {
+	*usersmanagement.UserService
+	admin *usersmanagement.AdminService
+}
+
+func (k kratosIdentities) CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error) {
+	return k.admin.CreateUser(ctx, req)
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without changing anything")
+	emailDomain := flag.String("email-domain", "", "domain for the login email of usernames that are not emails")
+	flag.Parse()
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./keeper.db"
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		log.Fatalf("Error opening database at %s: %v", dbPath, err)
+	}
+	var db *sql.DB
+	var err error
+	if *dryRun {
+		var remove func()
+		db, remove, err = openDryRunCopy(dbPath)
+		if err != nil {
+			log.Fatalf("Error copying database at %s for the dry run: %v", dbPath, err)
+		}
+		defer remove()
+	} else {
+		db, err = sql.Open("sqlite3", dbPath)
+		if err != nil {
+			log.Fatalf("Error opening database at %s: %v", dbPath, err)
+		}
+		defer db.Close()
+	}
+
+	kratosClient, err := usersmanagement.NewKratosClient(
+		envOrDefault("KRATOS_ADMIN_URL", "http://127.0.0.1:4434"),
+		envOrDefault("KRATOS_PUBLIC_URL", "http://127.0.0.1:4433"),
+	)
+	if err != nil {
+		log.Fatalf("Error creating Kratos client: %v", err)
+	}
+	userSvc := usersmanagement.NewUserService(kratosClient)
+
+	m, err := newMigrator(db, kratosIdentities{UserService: userSvc, admin: usersmanagement.NewAdminService(kratosClient, userSvc)})
+	if err != nil {
+		log.Fatalf("Error initializing schema: %v", err)
+	}
+	m.emailDomain = *emailDomain
+	m.dryRun = *dryRun
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	r, err := m.run(ctx)
+	if r != nil {
+		log.Printf("Identities created: %d, linked to existing: %d, already migrated: %d, messages attributed: %d",
+			r.Created, r.Reused, r.AlreadyMigrated, r.MessagesRewritten)
+	}
+	if err != nil {
+		log.Fatalf("Migration stopped: %v (re-run to resume)", err)
+	}
+	if *dryRun {
+		log.Printf("Dry run complete on a copy; %s was not changed.", dbPath)
+		return
+	}
+	log.Println("Migration complete.")
+}
+
+// newMigrator prepares the schema (the messages table may still lack author
+// IDs, and the mapping table may not exist yet) and returns a migrator over db.
+func newMigrator(db *sql.DB, identities identityStore) (*migrator, error) {
+	messageRepo := messagingsqlite.NewSQLiteRepository(db)
+	if err := messageRepo.InitSchema(); err != nil {
+		return nil, err
+	}
+	migrationRepo := authsqlite.NewSQLiteMigrationRepository(db)
+	if err := migrationRepo.InitMigrationSchema(); err != nil {
+		return nil, err
+	}
+	return &migrator{
+		users:      authsqlite.NewSQLiteUserRepository(db),
+		migrations: migrationRepo,
+		messages:   messageRepo,
+		identities: identities,
+	}, nil
+}
+
+// openDryRunCopy opens the database at path read-only and copies it to a
+// temporary file, which it returns along with a function that deletes it.
+// Preparing the schema adds columns and tables, so a dry run works on the
+// copy and reports what the real run would do to the prepared schema.
+func openDryRunCopy(path string) (*sql.DB, func(), error) {
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer src.Close()
+	dir, err := os.MkdirTemp("", "migrate-users-")
+	if err != nil {
+		return nil, nil, err
+	}
+	copyPath := filepath.Join(dir, "keeper.db")
+	if _, err := src.Exec("VACUUM INTO ?", copyPath); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	db, err := sql.Open("sqlite3", copyPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
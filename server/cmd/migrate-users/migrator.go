@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
+)
+
+// identityStore finds and creates Kratos identities.
+type identityStore interface {
+	GetUserByEmail(ctx context.Context, email string) (*usersmanagement.User, error)
+	CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error)
+}
+
+// legacyMessages reassigns messages posted before identities existed.
+// Implemented by the messaging SQLite repository.
+type legacyMessages interface {
+	CountLegacyMessages(user string) (int64, error)
+	AssignLegacyMessages(user, userID string) (int64, error)
+}
+
+// migrator moves legacy users into Kratos. Progress is recorded per user in
+// the mapping table, so an interrupted run picks up where it stopped.
+type migrator struct {
+	users       ports.UserRepository
+	migrations  ports.LegacyUserMigrationRepository
+	messages    legacyMessages
+	identities  identityStore
+	emailDomain string
+	dryRun      bool
+}
+
+// report summarizes a migration run.
+type report struct {
+	Created           int
+	Reused            int
+	AlreadyMigrated   int
+	MessagesRewritten int64
+}
+
+func (m *migrator) run(ctx context.Context) (*report, error) {
+	legacyUsers, err := m.users.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("listing legacy users: %w", err)
+	}
+
+	r := &report{}
+	for _, u := range legacyUsers {
+		if err := m.migrateUser(ctx, u, r); err != nil {
+			return r, fmt.Errorf("migrating %s (legacy ID %d): %w", u.Username, u.ID, err)
+		}
+	}
+	return r, nil
+}
+
+func (m *migrator) migrateUser(ctx context.Context, u models.User, r *report) error {
+	migration, err := m.migrations.GetMigration(u.ID)
+	if err != nil {
+		return err
+	}
+
+	if migration == nil {
+		identityID, err := m.ensureIdentity(ctx, u, r)
+		if err != nil {
+			return err
+		}
+		if m.dryRun {
+			count, err := m.messages.CountLegacyMessages(u.Username)
+			if err != nil {
+				return err
+			}
+			log.Printf("[dry-run] Would attribute %d messages of %s to the new identity.", count, u.Username)
+			r.MessagesRewritten += count
+			return nil
+		}
+		migration = &ports.LegacyUserMigration{
+			LegacyUserID: u.ID,
+			Username:     u.Username,
+			IdentityID:   identityID,
+			MigratedAt:   time.Now().UTC(),
+		}
+		if err := m.migrations.SaveMigration(*migration); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("%s was already migrated to identity %s.", u.Username, migration.IdentityID)
+		r.AlreadyMigrated++
+	}
+
+	if migration.MessagesRewritten {
+		return nil
+	}
+	if m.dryRun {
+		count, err := m.messages.CountLegacyMessages(u.Username)
+		if err != nil {
+			return err
+		}
+		log.Printf("[dry-run] Would attribute %d messages of %s to identity %s.", count, u.Username, migration.IdentityID)
+		r.MessagesRewritten += count
+		return nil
+	}
+	count, err := m.messages.AssignLegacyMessages(u.Username, migration.IdentityID)
+	if err != nil {
+		return err
+	}
+	if err := m.migrations.MarkMessagesRewritten(u.ID, count); err != nil {
+		return err
+	}
+	log.Printf("Attributed %d messages of %s to identity %s.", count, u.Username, migration.IdentityID)
+	r.MessagesRewritten += count
+	return nil
+}
+
+// ensureIdentity returns the ID of the identity for the legacy user, creating
+// it with the imported password hash unless one with the same email exists.
+// In dry-run mode nothing is created and the returned ID is empty.
+func (m *migrator) ensureIdentity(ctx context.Context, u models.User, r *report) (string, error) {
+	email, err := m.emailFor(u.Username)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := m.identities.GetUserByEmail(ctx, email)
+	if err == nil {
+		log.Printf("Identity %s already exists with ID %s. Linking %s to it.", email, existing.ID, u.Username)
+		r.Reused++
+		return existing.ID, nil
+	}
+	if !errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+		return "", fmt.Errorf("looking up identity %s: %w", email, err)
+	}
+
+	req := usersmanagement.CreateUserRequest{Email: email, Nickname: u.Username}
+	if isBcryptHash(u.PasswordHash) {
+		req.PasswordHash = u.PasswordHash
+	} else {
+		log.Printf("%s has no bcrypt password hash; the user will need a recovery link to log in.", u.Username)
+	}
+
+	if m.dryRun {
+		log.Printf("[dry-run] Would create identity %s for %s (password imported: %t).", email, u.Username, req.PasswordHash != "")
+		r.Created++
+		return "", nil
+	}
+	created, err := m.identities.CreateUser(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("creating identity %s: %w", email, err)
+	}
+	log.Printf("Created identity %s (ID: %s) for %s.", email, created.ID, u.Username)
+	r.Created++
+	return created.ID, nil
+}
+
+// emailFor derives the login email of a legacy user. Usernames that already
+// look like an email are used as is; others get the configured domain.
+func (m *migrator) emailFor(username string) (string, error) {
+	if strings.Contains(username, "@") {
+		return strings.ToLower(username), nil
+	}
+	if m.emailDomain == "" {
+		return "", fmt.Errorf("username %q is not an email and no -email-domain was given", username)
+	}
+	return strings.ToLower(username) + "@" + m.emailDomain, nil
+}
+
+// isBcryptHash reports whether hash is in the modular crypt format used by
+// bcrypt ($2a$, $2b$ or $2y$), which Kratos can import.
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// fakeIdentities is an in-memory identityStore.
+type fakeIdentities struct {
+	byEmail  map[string]*usersmanagement.User
+	requests []usersmanagement.CreateUserRequest
+	failOn   string
+}
+
+func (f *fakeIdentities) GetUserByEmail(ctx context.Context, email string) (*usersmanagement.User, error) {
+	if u, ok := f.byEmail[email]; ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("no user with email %s: %w", email, usersmanagement.ErrIdentityNotFound)
+}
+
+func (f *fakeIdentities) CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error) {
+	if req.Email == f.failOn {
+		return nil, errors.New("kratos unavailable")
+	}
+	f.requests = append(f.requests, req)
+	u := &usersmanagement.User{ID: fmt.Sprintf("identity-%d", len(f.requests)), Email: req.Email}
+	f.byEmail[req.Email] = u
+	return u, nil
+}
+
+const legacyHash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+func setupLegacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1) // Each connection to :memory: is a separate database.
+
+	users := authsqlite.NewSQLiteUserRepository(db)
+	if err := users.InitUserSchema(); err != nil {
+		t.Fatalf("InitUserSchema() failed: %v", err)
+	}
+	for _, u := range []models.User{
+		{Username: "alice", PasswordHash: legacyHash},
+		{Username: "bob", PasswordHash: legacyHash},
+		{Username: "carol@example.org", PasswordHash: ""},
+	} {
+		if err := users.CreateUser(u); err != nil {
+			t.Fatalf("CreateUser(%s) failed: %v", u.Username, err)
+		}
+	}
+	// The original messages table, without room or author IDs.
+	_, err = db.Exec(`CREATE TABLE messages (id INTEGER PRIMARY KEY AUTOINCREMENT, user TEXT, text TEXT, timestamp DATETIME);
+		INSERT INTO messages (user, text, timestamp) VALUES
+			('Alice', 'hi', '2023-01-01 10:00:00'),
+			('alice', 'again', '2023-01-01 10:01:00'),
+			('Bob', 'hey', '2023-01-01 10:02:00'),
+			('Ghost', 'boo', '2023-01-01 10:03:00');`)
+	if err != nil {
+		t.Fatalf("Failed to create legacy messages: %v", err)
+	}
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB, identities *fakeIdentities) *migrator {
+	t.Helper()
+	m, err := newMigrator(db, identities)
+	if err != nil {
+		t.Fatalf("newMigrator() failed: %v", err)
+	}
+	m.emailDomain = "keeper.test"
+	return m
+}
+
+func messageAuthors(t *testing.T, db *sql.DB) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT text, user_id FROM messages")
+	if err != nil {
+		t.Fatalf("Failed to query messages: %v", err)
+	}
+	defer rows.Close()
+	authors := map[string]string{}
+	for rows.Next() {
+		var text, userID string
+		if err := rows.Scan(&text, &userID); err != nil {
+			t.Fatalf("Failed to scan message: %v", err)
+		}
+		authors[text] = userID
+	}
+	return authors
+}
+
+func TestMigrator_Run(t *testing.T) {
+	db := setupLegacyDB(t)
+	defer db.Close()
+	identities := &fakeIdentities{byEmail: map[string]*usersmanagement.User{
+		// Bob already registered with Kratos and must be linked, not recreated.
+		"bob@keeper.test": {ID: "existing-bob", Email: "bob@keeper.test"},
+	}}
+	m := newTestMigrator(t, db, identities)
+
+	r, err := m.run(context.Background())
+	if err != nil {
+		t.Fatalf("run() failed: %v", err)
+	}
+	if r.Created != 2 || r.Reused != 1 || r.MessagesRewritten != 3 {
+		t.Errorf("Unexpected report: %+v", r)
+	}
+
+	if len(identities.requests) != 2 {
+		t.Fatalf("Expected 2 identities to be created, got %d", len(identities.requests))
+	}
+	alice := identities.requests[0]
+	if alice.Email != "alice@keeper.test" || alice.Nickname != "alice" || alice.PasswordHash != legacyHash {
+		t.Errorf("Unexpected request for alice: %+v", alice)
+	}
+	carol := identities.requests[1]
+	if carol.Email != "carol@example.org" || carol.PasswordHash != "" {
+		t.Errorf("Expected carol to be created by email without a password, got %+v", carol)
+	}
+
+	authors := messageAuthors(t, db)
+	if authors["hi"] != "identity-1" || authors["again"] != "identity-1" || authors["hey"] != "existing-bob" || authors["boo"] != "" {
+		t.Errorf("Unexpected message authors: %+v", authors)
+	}
+
+	// A second run changes nothing.
+	r, err = m.run(context.Background())
+	if err != nil {
+		t.Fatalf("second run() failed: %v", err)
+	}
+	if r.Created != 0 || r.AlreadyMigrated != 3 || len(identities.requests) != 2 {
+		t.Errorf("Expected second run to be a no-op, got %+v", r)
+	}
+}
+
+func TestMigrator_Run_DryRun(t *testing.T) {
+	db := setupLegacyDB(t)
+	defer db.Close()
+	identities := &fakeIdentities{byEmail: map[string]*usersmanagement.User{}}
+	m := newTestMigrator(t, db, identities)
+	m.dryRun = true
+
+	r, err := m.run(context.Background())
+	if err != nil {
+		t.Fatalf("run() failed: %v", err)
+	}
+	if r.Created != 3 || r.MessagesRewritten != 3 {
+		t.Errorf("Unexpected dry-run report: %+v", r)
+	}
+	if len(identities.requests) != 0 {
+		t.Errorf("Expected no identities to be created in a dry run, got %d", len(identities.requests))
+	}
+	if migration, _ := m.migrations.GetMigration(1); migration != nil {
+		t.Errorf("Expected no mapping to be recorded in a dry run, got %+v", migration)
+	}
+	for text, userID := range messageAuthors(t, db) {
+		if userID != "" {
+			t.Errorf("Expected message %q to be untouched, got author %q", text, userID)
+		}
+	}
+}
+
+func TestOpenDryRunCopy_LeavesDatabaseUnchanged(t *testing.T) {
+	legacy := setupLegacyDB(t)
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	if _, err := legacy.Exec("VACUUM INTO ?", path); err != nil {
+		t.Fatalf("Failed to write the legacy database: %v", err)
+	}
+	legacy.Close()
+
+	db, remove, err := openDryRunCopy(path)
+	if err != nil {
+		t.Fatalf("openDryRunCopy() failed: %v", err)
+	}
+	m := newTestMigrator(t, db, &fakeIdentities{byEmail: map[string]*usersmanagement.User{}})
+	m.dryRun = true
+	if r, err := m.run(context.Background()); err != nil || r.Created != 3 || r.MessagesRewritten != 3 {
+		t.Errorf("Unexpected dry-run report: %+v (%v)", r, err)
+	}
+	remove()
+
+	original, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	defer original.Close()
+	var tables, columns int
+	original.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'legacy_user_migrations'").Scan(&tables)
+	original.QueryRow("SELECT COUNT(*) FROM pragma_table_info('messages') WHERE name = 'user_id'").Scan(&columns)
+	if tables != 0 || columns != 0 {
+		t.Errorf("Expected the schema to be untouched, got %d mapping tables and %d user_id columns", tables, columns)
+	}
+}
+
+func TestMigrator_Run_Resumes(t *testing.T) {
+	db := setupLegacyDB(t)
+	defer db.Close()
+	identities := &fakeIdentities{byEmail: map[string]*usersmanagement.User{}, failOn: "bob@keeper.test"}
+	m := newTestMigrator(t, db, identities)
+
+	if _, err := m.run(context.Background()); err == nil {
+		t.Fatal("Expected run() to stop when Kratos fails, got nil")
+	}
+	migration, err := m.migrations.GetMigration(1)
+	if err != nil || migration == nil || !migration.MessagesRewritten || migration.RewrittenMessageCount != 2 {
+		t.Fatalf("Expected alice to be fully migrated before the failure, got %+v (err %v)", migration, err)
+	}
+	if !migration.MigratedAt.Before(time.Now().Add(time.Second)) {
+		t.Errorf("Unexpected migration time %v", migration.MigratedAt)
+	}
+
+	identities.failOn = ""
+	r, err := m.run(context.Background())
+	if err != nil {
+		t.Fatalf("resumed run() failed: %v", err)
+	}
+	if r.AlreadyMigrated != 1 || r.Created != 2 || len(identities.requests) != 3 {
+		t.Errorf("Expected resumed run to create only bob and carol, got %+v", r)
+	}
+}
+
+func TestMigrator_EmailFor_RequiresDomain(t *testing.T) {
+	m := &migrator{}
+	if _, err := m.emailFor("alice"); err == nil {
+		t.Error("Expected error for a username without a domain, got nil")
+	}
+	if email, err := m.emailFor("Alice@Example.com"); err != nil || email != "alice@example.com" {
+		t.Errorf("Expected 'alice@example.com', got %q (err %v)", email, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fixtures.yaml
+var defaultFixtures []byte
+
+// Fixtures is the seed data: identities to provision in Kratos and rooms with
+// their members and messages. JSON files are accepted as well, since YAML is a
+// superset of JSON.
+type Fixtures struct {
+	Users []UserFixture `yaml:"users" json:"users"`
+	Rooms []RoomFixture `yaml:"rooms" json:"rooms"`
+}
+
+// UserFixture describes a Kratos identity. Key is how rooms and messages refer to it.
+type UserFixture struct {
+	Key       string `yaml:"key" json:"key"`
+	Email     string `yaml:"email" json:"email"`
+	Password  string `yaml:"password" json:"password"`
+	FirstName string `yaml:"first_name" json:"first_name"`
+	LastName  string `yaml:"last_name" json:"last_name"`
+	Nickname  string `yaml:"nickname" json:"nickname"`
+	Admin     bool   `yaml:"admin" json:"admin"`
+}
+
+// RoomFixture describes a room, its members (user keys) and messages.
+type RoomFixture struct {
+	Name     string           `yaml:"name" json:"name"`
+	Owner    string           `yaml:"owner" json:"owner"`
+	Members  []string         `yaml:"members" json:"members"`
+	Messages []MessageFixture `yaml:"messages" json:"messages"`
+}
+
+// MessageFixture is a message posted by the user with key From.
+type MessageFixture struct {
+	From string    `yaml:"from" json:"from"`
+	Text string    `yaml:"text" json:"text"`
+	At   time.Time `yaml:"at" json:"at"`
+}
+
+// loadFixtures reads fixtures from path, or the embedded defaults if path is empty.
+func loadFixtures(path string) (*Fixtures, error) {
+	data := defaultFixtures
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures %s: %w", path, err)
+		}
+	}
+
+	var fixtures Fixtures
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+	if err := fixtures.validate(); err != nil {
+		return nil, err
+	}
+	return &fixtures, nil
+}
+
+// validate checks that every referenced user key is defined.
+func (f *Fixtures) validate() error {
+	keys := make(map[string]bool, len(f.Users))
+	for _, u := range f.Users {
+		if u.Key == "" || u.Email == "" {
+			return fmt.Errorf("every user needs a key and an email")
+		}
+		if keys[u.Key] {
+			return fmt.Errorf("duplicate user key %q", u.Key)
+		}
+		keys[u.Key] = true
+	}
+	for _, r := range f.Rooms {
+		if r.Name == "" {
+			return fmt.Errorf("every room needs a name")
+		}
+		if !keys[r.Owner] {
+			return fmt.Errorf("room %q: unknown owner %q", r.Name, r.Owner)
+		}
+		for _, m := range r.Members {
+			if !keys[m] {
+				return fmt.Errorf("room %q: unknown member %q", r.Name, m)
+			}
+		}
+		for _, msg := range r.Messages {
+			if !keys[msg.From] {
+				return fmt.Errorf("room %q: message from unknown user %q", r.Name, msg.From)
+			}
+			if msg.At.IsZero() {
+				return fmt.Errorf("room %q: message %q has no timestamp", r.Name, msg.Text)
+			}
+		}
+	}
+	return nil
+}
@@ -1,48 +1,77 @@
+// Command seed provisions sample data for local development: Kratos
+// identities created through the admin API (looked up by email, so re-running
+// is safe), and rooms with members and messages attributed to those
+// identities in the server database.
+//
+// Usage (from the server directory):
+//
+//	go run ./cmd/seed [-fixtures path/to/fixtures.yaml]
+//
+// DB_PATH selects the database like it does for the server (default ./keeper.db).
+// KRATOS_ADMIN_URL and KRATOS_PUBLIC_URL select the Kratos instance
+// (default http://127.0.0.1:4434 and http://127.0.0.1:4433).
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
-	"path/filepath" // For path manipulation
+	"path/filepath"
+	"time"
+
+	messagingsqlite "keeper/server/adapters/messaging/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/models"
+	usersmanagement "keeper/server/users-management"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
-	"golang.org/x/crypto/bcrypt"    // For password hashing
-	// Assuming models are directly accessible if this cmd is within the server module context
-	// For simplicity, we'll define simplified User and Message structs here,
-	// or adjust import paths if running `go run` from server root makes `keeper/server/models` accessible.
-	// Let's try to use existing models by adjusting relative paths for `go run`.
-	// This might be tricky with `go run server/cmd/seed/main.go`.
-	// A better way is to make this a proper command that builds and runs from server root,
-	// or configure DB path via env var.
-	// For now, let's assume DB path is fixed relative to project root.
 )
 
-const dbPath = "./data/keeper.db" // Path relative to project root
+// identityStore finds and creates Kratos identities.
+type identityStore interface {
+	GetUserByEmail(ctx context.Context, email string) (*usersmanagement.User, error)
+	CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error)
+}
+
+// kratosIdentities implements identityStore with the Kratos user and admin services.
+type kratosIdentities struct {
+	*usersmanagement.UserService
+	admin *usersmanagement.AdminService
+}
 
-// Simplified User struct for seeding - ideally use models.User
-type SeedUser struct {
-	ID           int64
-	Username     string
-	PasswordHash string
+func (k kratosIdentities) CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error) {
+	return k.admin.CreateUser(ctx, req)
 }
 
-// Simplified Message struct for seeding - ideally use models.Message
-type SeedMessage struct {
-	ID        int64
-	UserID    int64  // Assuming we link messages to user IDs
-	User      string // Username, denormalized for simplicity in this example
-	Text      string
-	Timestamp string // Use string for simplicity, format "YYYY-MM-DD HH:MM:SS"
+// seeder applies fixtures idempotently.
+type seeder struct {
+	db         *sql.DB
+	identities identityStore
+	rooms      ports.RoomRepository
+	messages   ports.MessageRepository
 }
 
 func main() {
+	fixturesPath := flag.String("fixtures", "", "YAML or JSON fixture file (default: built-in sample data)")
+	flag.Parse()
+
 	log.Println("Seeding database...")
 
+	fixtures, err := loadFixtures(*fixturesPath)
+	if err != nil {
+		log.Fatalf("Error loading fixtures: %v", err)
+	}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./keeper.db"
+	}
 	// Ensure the data directory exists
-	dataDir := filepath.Dir(dbPath)
-	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
-		log.Printf("Data directory %s does not exist. Creating...", dataDir)
+	if dataDir := filepath.Dir(dbPath); dataDir != "." {
 		if err := os.MkdirAll(dataDir, 0755); err != nil {
 			log.Fatalf("Error creating data directory %s: %v", dataDir, err)
 		}
@@ -54,111 +83,154 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize schemas (taken from existing repository InitSchema methods)
-	// This makes the seeder idempotent regarding schema.
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS users (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE,
-		password_hash TEXT
-	);`)
+	kratosClient, err := usersmanagement.NewKratosClient(
+		envOrDefault("KRATOS_ADMIN_URL", "http://127.0.0.1:4434"),
+		envOrDefault("KRATOS_PUBLIC_URL", "http://127.0.0.1:4433"),
+	)
 	if err != nil {
-		log.Fatalf("Error creating users schema: %v", err)
+		log.Fatalf("Error creating Kratos client: %v", err)
 	}
+	userSvc := usersmanagement.NewUserService(kratosClient)
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS messages (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		user TEXT, 
-		text TEXT,
-		timestamp DATETIME
-	);`)
+	s, err := newSeeder(db, kratosIdentities{UserService: userSvc, admin: usersmanagement.NewAdminService(kratosClient, userSvc)})
 	if err != nil {
-		log.Fatalf("Error creating messages schema: %v", err)
+		log.Fatalf("Error initializing schema: %v", err)
 	}
 
-	log.Println("Schemas initialized/verified.")
-
-	// Seed Users
-	usersToSeed := []struct {
-		username string
-		password string
-	}{
-		{"Alice", "password123"},
-		{"Bob", "securePa$$"},
-		{"Charlie", "charliePass"},
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := s.seed(ctx, fixtures); err != nil {
+		log.Fatalf("Seeding failed: %v", err)
 	}
+	log.Println("Seeding complete.")
+}
 
-	var seededUsers []SeedUser
-
-	for _, u := range usersToSeed {
-		// Check if user already exists
-		var existingID int64
-		err := db.QueryRow("SELECT id FROM users WHERE username = ?", u.username).Scan(&existingID)
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("Error checking for user %s: %v. Skipping.", u.username, err)
-			continue
-		}
-		if err == nil { // User exists
-			log.Printf("User %s already exists with ID %d. Skipping.", u.username, existingID)
-			// Add to seededUsers so messages can still be created if desired
-			// Or fetch password hash if needed for other logic (not needed here)
-			seededUsers = append(seededUsers, SeedUser{ID: existingID, Username: u.username})
-			continue
-		}
+// newSeeder initializes the schema (taken from the repository InitSchema
+// methods) and returns a seeder writing to db.
+func newSeeder(db *sql.DB, identities identityStore) (*seeder, error) {
+	messageRepo := messagingsqlite.NewSQLiteRepository(db)
+	if err := messageRepo.InitSchema(); err != nil {
+		return nil, err
+	}
+	roomRepo := messagingsqlite.NewSQLiteRoomRepository(db)
+	if err := roomRepo.InitRoomSchema(); err != nil {
+		return nil, err
+	}
+	return &seeder{db: db, identities: identities, rooms: roomRepo, messages: messageRepo}, nil
+}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.password), bcrypt.DefaultCost)
+func (s *seeder) seed(ctx context.Context, fixtures *Fixtures) error {
+	users := make(map[string]*usersmanagement.User, len(fixtures.Users))
+	for _, u := range fixtures.Users {
+		user, err := s.ensureIdentity(ctx, u)
 		if err != nil {
-			log.Printf("Error hashing password for %s: %v. Skipping.", u.username, err)
-			continue
+			return err
 		}
+		users[u.Key] = user
+	}
 
-		res, err := db.Exec("INSERT INTO users (username, password_hash) VALUES (?, ?)", u.username, string(hashedPassword))
-		if err != nil {
-			log.Printf("Error inserting user %s: %v. Skipping.", u.username, err)
-			continue
+	for _, r := range fixtures.Rooms {
+		if err := s.seedRoom(r, users); err != nil {
+			return err
 		}
-		id, _ := res.LastInsertId()
-		log.Printf("Seeded user: %s (ID: %d)", u.username, id)
-		seededUsers = append(seededUsers, SeedUser{ID: id, Username: u.username, PasswordHash: string(hashedPassword)})
+	}
+	return nil
+}
+
+// ensureIdentity returns the identity with the fixture's email, creating it if needed.
+func (s *seeder) ensureIdentity(ctx context.Context, u UserFixture) (*usersmanagement.User, error) {
+	existing, err := s.identities.GetUserByEmail(ctx, u.Email)
+	if err == nil {
+		log.Printf("Identity %s already exists with ID %s. Skipping.", u.Email, existing.ID)
+		return existing, nil
+	}
+	if !errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+		return nil, fmt.Errorf("looking up identity %s: %w", u.Email, err)
 	}
 
-	if len(seededUsers) < 2 {
-		log.Println("Not enough users were successfully seeded/found to create messages.")
-		log.Println("Seeding complete.")
-		return
+	created, err := s.identities.CreateUser(ctx, usersmanagement.CreateUserRequest{
+		Email:     u.Email,
+		Password:  u.Password,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Nickname:  u.Nickname,
+		Admin:     u.Admin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating identity %s: %w", u.Email, err)
 	}
+	log.Printf("Seeded identity: %s (ID: %s)", u.Email, created.ID)
+	return created, nil
+}
 
-	// Seed Messages
-	messagesToSeed := []SeedMessage{
-		{User: seededUsers[0].Username, Text: "Hello Bob!", Timestamp: "2023-01-01 10:00:00"},
-		{User: seededUsers[1].Username, Text: "Hi Alice! How are you?", Timestamp: "2023-01-01 10:01:00"},
-		{User: seededUsers[0].Username, Text: "I'm good, thanks! Planning any TTRPG sessions?", Timestamp: "2023-01-01 10:02:00"},
-		{User: seededUsers[1].Username, Text: "Yes! This weekend. You in?", Timestamp: "2023-01-01 10:03:00"},
+func (s *seeder) seedRoom(r RoomFixture, users map[string]*usersmanagement.User) error {
+	owner := users[r.Owner]
+	room, err := s.rooms.GetRoomByName(r.Name)
+	if err != nil {
+		return fmt.Errorf("looking up room %s: %w", r.Name, err)
 	}
-	if len(seededUsers) > 2 { // Add messages from Charlie if available
-		messagesToSeed = append(messagesToSeed, SeedMessage{User: seededUsers[2].Username, Text: "Hey everyone, what's up?", Timestamp: "2023-01-01 10:00:30"})
-		messagesToSeed = append(messagesToSeed, SeedMessage{User: seededUsers[0].Username, Text: "Hey Charlie! Just chatting.", Timestamp: "2023-01-01 10:01:30"})
+	if room == nil {
+		room = &models.Room{Name: r.Name, CreatedBy: owner.ID, CreatedAt: time.Now().UTC()}
+		if err := s.rooms.CreateRoom(room); err != nil {
+			return fmt.Errorf("creating room %s: %w", r.Name, err)
+		}
+		log.Printf("Seeded room: %s (ID: %d)", room.Name, room.ID)
+	} else {
+		log.Printf("Room %s already exists with ID %d. Skipping creation.", room.Name, room.ID)
 	}
 
-	for _, m := range messagesToSeed {
-		// Basic check to avoid duplicate messages based on text and user (very simplistic)
-		var existingID int64
-		err := db.QueryRow("SELECT id FROM messages WHERE user = ? AND text = ? AND timestamp = ?", m.User, m.Text, m.Timestamp).Scan(&existingID)
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("Error checking for message from %s: %v. Skipping.", m.User, err)
-			continue
+	memberRoles := map[string]string{r.Owner: models.RoomRoleOwner}
+	for _, key := range r.Members {
+		if _, ok := memberRoles[key]; !ok {
+			memberRoles[key] = models.RoomRoleMember
 		}
-		if err == nil { // Message exists
-			log.Printf("Message from %s ('%s') already exists. Skipping.", m.User, m.Text)
-			continue
+	}
+	for key, role := range memberRoles {
+		err := s.rooms.AddMember(models.RoomMember{RoomID: room.ID, UserID: users[key].ID, Role: role, JoinedAt: room.CreatedAt})
+		if err != nil {
+			return fmt.Errorf("adding %s to room %s: %w", key, r.Name, err)
 		}
+	}
 
-		_, err = db.Exec("INSERT INTO messages (user, text, timestamp) VALUES (?, ?, ?)", m.User, m.Text, m.Timestamp)
+	for _, m := range r.Messages {
+		author := users[m.From]
+		exists, err := s.messageExists(room.ID, author.ID, m.Text, m.At.UTC())
 		if err != nil {
-			log.Printf("Error inserting message from %s: %v. Skipping.", m.User, err)
+			return fmt.Errorf("checking message from %s: %w", m.From, err)
+		}
+		if exists {
+			log.Printf("Message from %s ('%s') already exists. Skipping.", m.From, m.Text)
 			continue
 		}
-		log.Printf("Seeded message from %s: %s", m.User, m.Text)
+		msg := models.Message{
+			RoomID:    room.ID,
+			UserID:    author.ID,
+			User:      author.DisplayName(),
+			Text:      m.Text,
+			Timestamp: m.At.UTC(),
+		}
+		if err := s.messages.CreateMessage(&msg); err != nil {
+			return fmt.Errorf("inserting message from %s: %w", m.From, err)
+		}
+		log.Printf("Seeded message from %s: %s", m.From, m.Text)
 	}
+	return nil
+}
 
-	log.Println("Seeding complete.")
+// messageExists is a basic duplicate check on room, author, text and time.
+func (s *seeder) messageExists(roomID int64, userID, text string, at time.Time) (bool, error) {
+	var existingID int64
+	err := s.db.QueryRow("SELECT id FROM messages WHERE room_id = ? AND user_id = ? AND text = ? AND timestamp = ?",
+		roomID, userID, text, at).Scan(&existingID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func envOrDefault(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	usersmanagement "keeper/server/users-management"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// fakeIdentities is an in-memory identityStore.
+type fakeIdentities struct {
+	byEmail map[string]*usersmanagement.User
+	created int
+}
+
+func (f *fakeIdentities) GetUserByEmail(ctx context.Context, email string) (*usersmanagement.User, error) {
+	if u, ok := f.byEmail[email]; ok {
+		return u, nil
+	}
+	return nil, fmt.Errorf("no user with email %s: %w", email, usersmanagement.ErrIdentityNotFound)
+}
+
+func (f *fakeIdentities) CreateUser(ctx context.Context, req usersmanagement.CreateUserRequest) (*usersmanagement.User, error) {
+	f.created++
+	u := &usersmanagement.User{ID: fmt.Sprintf("identity-%d", f.created), Email: req.Email, FirstName: req.FirstName}
+	f.byEmail[req.Email] = u
+	return u, nil
+}
+
+func TestSeed_Idempotent(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // Each connection to :memory: is a separate database.
+
+	fixtures, err := loadFixtures("")
+	if err != nil {
+		t.Fatalf("Failed to load default fixtures: %v", err)
+	}
+	identities := &fakeIdentities{byEmail: map[string]*usersmanagement.User{
+		// Alice already exists in Kratos and must be reused, not recreated.
+		"alice@example.com": {ID: "existing-alice", Email: "alice@example.com", FirstName: "Alice"},
+	}}
+	s, err := newSeeder(db, identities)
+	if err != nil {
+		t.Fatalf("newSeeder() failed: %v", err)
+	}
+
+	for run := 0; run < 2; run++ {
+		if err := s.seed(context.Background(), fixtures); err != nil {
+			t.Fatalf("seed() run %d failed: %v", run, err)
+		}
+	}
+
+	if identities.created != 2 {
+		t.Errorf("Expected 2 identities to be created (Bob, Charlie), got %d", identities.created)
+	}
+	messages, err := s.messages.GetMessages()
+	if err != nil {
+		t.Fatalf("GetMessages() failed: %v", err)
+	}
+	if len(messages) != 6 {
+		t.Fatalf("Expected 6 messages after seeding twice, got %d", len(messages))
+	}
+	if messages[0].UserID != "existing-alice" || messages[0].User != "Alice" {
+		t.Errorf("Expected first message attributed to existing Alice identity, got %+v", messages[0])
+	}
+
+	room, err := s.rooms.GetRoomByName("general")
+	if err != nil || room == nil {
+		t.Fatalf("Expected room 'general', got %v (err %v)", room, err)
+	}
+	members, err := s.rooms.ListMembers(room.ID)
+	if err != nil {
+		t.Fatalf("ListMembers() failed: %v", err)
+	}
+	if len(members) != 3 {
+		t.Errorf("Expected 3 members, got %d", len(members))
+	}
+}
+
+func TestLoadFixtures_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	content := `{
+		"users": [{"key": "dm", "email": "dm@example.com"}],
+		"rooms": [{"name": "table", "owner": "dm", "messages": [{"from": "dm", "text": "Roll initiative", "at": "2024-05-01T19:00:00Z"}]}]
+	}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write fixtures: %v", err)
+	}
+
+	fixtures, err := loadFixtures(path)
+	if err != nil {
+		t.Fatalf("Expected JSON fixtures to load, got %v", err)
+	}
+	if len(fixtures.Rooms) != 1 || fixtures.Rooms[0].Messages[0].At.Hour() != 19 {
+		t.Errorf("Unexpected fixtures: %+v", fixtures)
+	}
+}
+
+func TestLoadFixtures_UnknownUser(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	content := "users:\n  - {key: a, email: a@example.com}\nrooms:\n  - {name: r, owner: ghost}\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write fixtures: %v", err)
+	}
+
+	if _, err := loadFixtures(path); err == nil {
+		t.Fatal("Expected error for a room owned by an unknown user, got nil")
+	}
+}
@@ -2,7 +2,8 @@ package ports
 
 import (
 	"context"
-	// "keeper/server/models" // Old model
+
+	"keeper/server/models"                           // Principals of API key requests
 	usersmanagement "keeper/server/users-management" // New model
 )
 
@@ -14,4 +15,7 @@ type AuthService interface {
 	// ValidateToken now validates a Kratos session token/cookie.
 	// It takes a context and returns the new usersmanagement.User.
 	ValidateToken(ctx context.Context, tokenString string) (*usersmanagement.User, error)
+
+	// AuthenticateAPIKey validates a service account API key and returns the bot principal.
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.Principal, error)
 }
@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Get for keys that hold no blob.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps the content of uploaded files. Keys are chosen by the
+// caller and are slash-separated paths such as "rooms/1/3f2a...".
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing any blob there.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the blob under key. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
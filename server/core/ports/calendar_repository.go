@@ -0,0 +1,37 @@
+package ports
+
+import (
+	"time"
+
+	"keeper/server/models"
+)
+
+// CalendarRepository defines the interface for scheduled events, their
+// reminders and the calendar feeds of rooms.
+type CalendarRepository interface {
+	// CreateEvent stores a new event and sets its ID.
+	CreateEvent(event *models.CalendarEvent) error
+	// GetEvent returns an event with its attendees, or (nil, nil) if it does not exist.
+	GetEvent(id int64) (*models.CalendarEvent, error)
+	// ListEvents returns the events of a room starting at or after from,
+	// soonest first, with their attendees.
+	ListEvents(roomID int64, from time.Time) ([]models.CalendarEvent, error)
+	// UpdateEvent saves the title, description, start, timezone, duration,
+	// reminders and update time of an event.
+	UpdateEvent(event *models.CalendarEvent) error
+	// DeleteEvent removes an event with its attendees and reminders.
+	DeleteEvent(id int64) error
+	// SaveAttendee creates or replaces the answer of a member.
+	SaveAttendee(eventID int64, attendee models.Attendee) error
+
+	// ScheduleReminders replaces the reminders of an event that have not been sent.
+	ScheduleReminders(eventID int64, dueAt []time.Time) error
+	// DueReminders returns up to limit unsent reminders due at or before now, oldest first.
+	DueReminders(now time.Time, limit int) ([]models.Reminder, error)
+	MarkReminderSent(id int64, sentAt time.Time) error
+
+	// SaveCalendarFeed creates or replaces the feed of a member of a room and sets its ID.
+	SaveCalendarFeed(feed *models.CalendarFeed) error
+	// GetCalendarFeedByPrefix returns (nil, nil) if no feed has the prefix.
+	GetCalendarFeedByPrefix(prefix string) (*models.CalendarFeed, error)
+}
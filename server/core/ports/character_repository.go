@@ -0,0 +1,17 @@
+package ports
+
+import "keeper/server/models"
+
+// CharacterRepository defines the interface for characters and their sheets.
+type CharacterRepository interface {
+	// CreateCharacter stores a new character and sets its ID. Names are
+	// unique within a room, ignoring case.
+	CreateCharacter(character *models.Character) error
+	// GetCharacter returns (nil, nil) if the character does not exist.
+	GetCharacter(id int64) (*models.Character, error)
+	// ListCharacters returns the characters of a room ordered by name.
+	ListCharacters(roomID int64) ([]models.Character, error)
+	// UpdateCharacter saves the name, avatar, sheet and update time of a character.
+	UpdateCharacter(character *models.Character) error
+	DeleteCharacter(id int64) error
+}
@@ -0,0 +1,84 @@
+package ports
+
+import (
+	"context"
+
+	"keeper/server/models"
+)
+
+// ChatService owns the room and message operations. The WebSocket, REST and
+// CLI front-ends only translate their input into these calls.
+type ChatService interface {
+	// ListRooms returns the rooms the principal is a member of.
+	ListRooms(p *models.Principal) ([]models.Room, error)
+	GetRoom(p *models.Principal, roomID int64) (*models.Room, error)
+	// CreateRoom creates a room owned by the principal.
+	CreateRoom(p *models.Principal, name string) (*models.Room, error)
+	ListMembers(p *models.Principal, roomID int64) ([]models.RoomMember, error)
+	// AddMember adds a user or service account to a room, or changes their role.
+	AddMember(p *models.Principal, roomID int64, userID, role string) (*models.RoomMember, error)
+	// SetTopic changes the topic of a room the principal owns.
+	SetTopic(p *models.Principal, roomID int64, topic string) (*models.Room, error)
+
+	// History returns a page of the room's messages the principal may see, in
+	// chronological order.
+	History(p *models.Principal, query MessageQuery) ([]models.Message, error)
+	PostMessage(p *models.Principal, roomID int64, text string) (*models.Message, error)
+	// SendMessage posts a draft, which may have attachments or files instead of text.
+	// Text starting with a slash runs a command instead; its result may be an
+	// ephemeral message that is only shown to the principal.
+	SendMessage(p *models.Principal, draft MessageDraft) (*models.Message, error)
+	// SendMessageContext is SendMessage cancelled with ctx, e.g. when the
+	// client goes away while a bot answers a command.
+	SendMessageContext(ctx context.Context, p *models.Principal, draft MessageDraft) (*models.Message, error)
+	// Roll rolls dice on the server and posts the result.
+	Roll(p *models.Principal, draft RollDraft) (*models.Message, error)
+	// EditMessage, DeleteMessage and RevealMessage check that the message
+	// belongs to roomID unless it is 0.
+	EditMessage(p *models.Principal, roomID, messageID int64, text string) (*models.Message, error)
+	DeleteMessage(p *models.Principal, roomID, messageID int64) error
+	// RevealMessage shows a whisper or hidden roll to the whole room.
+	RevealMessage(p *models.Principal, roomID, messageID int64) (*models.Message, error)
+	// Announce posts a message from the server itself, e.g. a reminder. It
+	// is not checked for commands.
+	Announce(roomID int64, text string) (*models.Message, error)
+}
+
+// MessageDraft is a message about to be posted.
+type MessageDraft struct {
+	RoomID      int64
+	Text        string
+	Format      string // One of the MessageFormat constants; "" is plain text
+	Kind        string // One of the MessageKind constants, or "" for plain messages
+	Attachments []models.Attachment
+	FileIDs     []int64      // Uploads of the author to the room, posted with the message
+	Roll        *models.Roll // Only set by ChatService.Roll; never taken from clients
+	VisibleTo   []string     // If set, only these room members and the author see the message
+	CharacterID int64        // Posts as this character of the room, which makes the message in character
+	InCharacter bool         // Part of the fiction, e.g. narration of the GM
+}
+
+// RollDraft is a dice roll about to be made. With a Skill it is a check
+// against a character's sheet: Dice may then only add bonus or penalty dice
+// to d100, and the skill is the label.
+type RollDraft struct {
+	RoomID      int64
+	Dice        string   // e.g. "4d6kh3+2"
+	Label       string   // What the roll is for; may be empty
+	VisibleTo   []string // As in MessageDraft, for hidden rolls
+	Skill       string   // A skill or characteristic, e.g. "Spot Hidden" or "POW"
+	CharacterID int64    // The character checking Skill, or 0 to go by Character
+	Character   string   // Name of the character, or "" for the principal's only one
+}
+
+// Authorizer decides whether a principal may act in a room.
+type Authorizer interface {
+	// RoomMember returns the principal's membership of a room, or an error if
+	// the room does not exist or the principal is not a member.
+	RoomMember(p *models.Principal, roomID int64) (*models.RoomMember, error)
+}
+
+// EventPublisher delivers room events to connected clients.
+type EventPublisher interface {
+	Publish(event models.Event)
+}
@@ -0,0 +1,20 @@
+package ports
+
+import "keeper/server/models"
+
+// CommandRepository defines the interface for slash commands registered by bots.
+type CommandRepository interface {
+	// CreateCommand stores a new command and sets its ID. Names are unique
+	// per service account.
+	CreateCommand(cmd *models.Command) error
+	// GetCommand returns (nil, nil) if the service account has no command
+	// with that name.
+	GetCommand(serviceAccountID, name string) (*models.Command, error)
+	// ListCommandsNamed returns the commands of every service account with
+	// that name, oldest first.
+	ListCommandsNamed(name string) ([]models.Command, error)
+	// ListCommands returns the commands of a service account, or all commands
+	// if serviceAccountID is empty, ordered by name.
+	ListCommands(serviceAccountID string) ([]models.Command, error)
+	DeleteCommand(id int64) error
+}
@@ -0,0 +1,17 @@
+package ports
+
+import "keeper/server/models"
+
+// FileRepository defines the interface for the metadata of uploaded files.
+// Their content lives in a BlobStore.
+type FileRepository interface {
+	// CreateFile stores a new file and sets its ID.
+	CreateFile(file *models.File) error
+	// GetFile returns (nil, nil) if the file does not exist.
+	GetFile(id int64) (*models.File, error)
+	// AttachFiles links files to the message they were posted with.
+	AttachFiles(messageID int64, ids []int64) error
+	// ListMessageFiles returns the files of a message, oldest first.
+	ListMessageFiles(messageID int64) ([]models.File, error)
+	DeleteFile(id int64) error
+}
@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+
+	"keeper/server/models"
+)
+
+// IdentityDirectory looks people up by their Kratos identity ID.
+type IdentityDirectory interface {
+	// LookupIdentity returns (nil, nil) if there is no such identity.
+	LookupIdentity(ctx context.Context, id string) (*models.Identity, error)
+	// LookupIdentities returns the identities with these IDs, by ID, from a
+	// single listing of the directory. IDs without an identity are left out.
+	LookupIdentities(ctx context.Context, ids []string) (map[string]*models.Identity, error)
+}
+
+// Presence tells whether a principal is connected right now.
+type Presence interface {
+	IsOnline(principalID string) bool
+}
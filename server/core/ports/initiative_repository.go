@@ -0,0 +1,22 @@
+package ports
+
+import "keeper/server/models"
+
+// InitiativeRepository defines the interface for the turn orders of rooms.
+type InitiativeRepository interface {
+	// GetInitiative returns the round and turn of a room's turn order,
+	// without combatants, or (nil, nil) if the room has none.
+	GetInitiative(roomID int64) (*models.Initiative, error)
+	// SaveInitiative creates or updates the round, turn and update time.
+	SaveInitiative(initiative *models.Initiative) error
+	// DeleteInitiative removes a room's turn order and all its combatants.
+	DeleteInitiative(roomID int64) error
+
+	// CreateCombatant stores a new combatant and sets its ID.
+	CreateCombatant(combatant *models.Combatant) error
+	// ListCombatants returns the combatants of a room in the order they were added.
+	ListCombatants(roomID int64) ([]models.Combatant, error)
+	// UpdateCombatant saves the initiative and roll of a combatant.
+	UpdateCombatant(combatant *models.Combatant) error
+	DeleteCombatant(id int64) error
+}
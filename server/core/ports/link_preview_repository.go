@@ -0,0 +1,20 @@
+package ports
+
+import (
+	"time"
+
+	"keeper/server/models"
+)
+
+// LinkPreviewRepository caches the previews of links, so that a link posted
+// again is not fetched again. Links without anything to show are cached as
+// empty previews.
+type LinkPreviewRepository interface {
+	// GetLinkPreview returns the cached preview of a URL and when it was
+	// fetched, or (nil, zero time, nil) if it is not cached.
+	GetLinkPreview(url string) (*models.LinkPreview, time.Time, error)
+	// SaveLinkPreview caches a preview, replacing an older one of its URL.
+	SaveLinkPreview(preview models.LinkPreview, fetchedAt time.Time) error
+	// DeleteLinkPreviewsBefore removes previews fetched before t and returns how many.
+	DeleteLinkPreviewsBefore(t time.Time) (int64, error)
+}
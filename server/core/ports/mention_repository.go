@@ -0,0 +1,34 @@
+package ports
+
+import (
+	"time"
+
+	"keeper/server/models"
+)
+
+// MentionQuery selects a page of a user's mentions, newest first unless
+// OldestFirst is set.
+type MentionQuery struct {
+	UserID      string
+	UnreadOnly  bool
+	BeforeID    int64 // Only mentions with a smaller ID; 0 for the newest
+	AfterID     int64 // Only mentions with a larger ID
+	OldestFirst bool  // Order by ascending ID, to page forward from AfterID
+	Limit       int   // At most MaxMessagePageSize; 0 for the maximum
+}
+
+// MentionRepository stores the mentions inbox of each user.
+type MentionRepository interface {
+	// CreateMention stores a mention and sets its ID. It returns false, and
+	// stores nothing, if the message already mentioned the user.
+	CreateMention(mention *models.Mention) (bool, error)
+	// ListMentions returns mentions without their messages.
+	ListMentions(query MentionQuery) ([]models.Mention, error)
+	// ListUnreadMentionUsers returns the IDs of the users who have unread
+	// mentions.
+	ListUnreadMentionUsers() ([]string, error)
+	// MarkMentionsRead marks mentions of the user as read at t, all unread
+	// ones if ids is empty, and returns how many changed.
+	MarkMentionsRead(userID string, ids []int64, t time.Time) (int64, error)
+	DeleteMessageMentions(messageID int64) error
+}
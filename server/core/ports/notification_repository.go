@@ -0,0 +1,31 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"keeper/server/models"
+)
+
+// DigestState is what the email digests of a user have covered so far.
+type DigestState struct {
+	UserID        string
+	LastMentionID int64     // The newest mention that was emailed or skipped
+	SentAt        time.Time // When the last digest was sent
+}
+
+// NotificationRepository stores notification preferences and the state of
+// email digests.
+type NotificationRepository interface {
+	// GetPreferences returns (nil, nil) if the user never saved any.
+	GetPreferences(userID string) (*models.NotificationPreferences, error)
+	SavePreferences(prefs models.NotificationPreferences) error
+	// GetDigestState returns (nil, nil) if the user never got a digest.
+	GetDigestState(userID string) (*DigestState, error)
+	SaveDigestState(state DigestState) error
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, email models.Email) error
+}
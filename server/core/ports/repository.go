@@ -5,5 +5,29 @@ import "keeper/server/models"
 // MessageRepository defines the interface for message persistence.
 type MessageRepository interface {
 	SaveMessage(msg models.Message) error
+	// CreateMessage saves a message and sets msg.ID to the generated ID.
+	CreateMessage(msg *models.Message) error
 	GetMessages() ([]models.Message, error)
+	// GetMessage returns (nil, nil) if the message does not exist.
+	GetMessage(id int64) (*models.Message, error)
+	// ListMessages returns a page of a room's history in chronological order.
+	ListMessages(query MessageQuery) ([]models.Message, error)
+	// UpdateMessage saves msg.Text, msg.HTML, msg.EditedAt, msg.VisibleTo and msg.RevealedAt.
+	UpdateMessage(msg *models.Message) error
+	// SetMessagePreviews replaces the link previews of a message.
+	SetMessagePreviews(id int64, previews []models.LinkPreview) error
+	DeleteMessage(id int64) error
+}
+
+// MaxMessagePageSize caps MessageQuery.Limit.
+const MaxMessagePageSize = 100
+
+// MessageQuery selects a page of room history.
+type MessageQuery struct {
+	RoomID      int64
+	BeforeID    int64  // Only messages with a smaller ID; 0 for the latest messages
+	AfterID     int64  // Only messages with a larger ID, e.g. those of a session
+	Limit       int    // At most MaxMessagePageSize; 0 for the maximum
+	Viewer      string // If set, only messages visible to this principal
+	InCharacter bool   // Only in-character messages, e.g. for session logs
 }
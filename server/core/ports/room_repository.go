@@ -0,0 +1,23 @@
+package ports
+
+import "keeper/server/models"
+
+// RoomRepository defines the interface for room and membership persistence.
+type RoomRepository interface {
+	// CreateRoom stores a new room and sets its ID.
+	CreateRoom(room *models.Room) error
+	// GetRoom returns (nil, nil) if the room does not exist.
+	GetRoom(id int64) (*models.Room, error)
+	// GetRoomByName returns (nil, nil) if no room has that name.
+	GetRoomByName(name string) (*models.Room, error)
+	// UpdateRoom saves the name and topic of an existing room.
+	UpdateRoom(room *models.Room) error
+	ListRooms() ([]models.Room, error)
+	ListRoomsForMember(userID string) ([]models.Room, error)
+
+	// AddMember adds a member, or updates the role of an existing one.
+	AddMember(member models.RoomMember) error
+	// GetMember returns (nil, nil) if the user is not a member of the room.
+	GetMember(roomID int64, userID string) (*models.RoomMember, error)
+	ListMembers(roomID int64) ([]models.RoomMember, error)
+}
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"time"
+
+	"keeper/server/models"
+)
+
+// ServiceAccountRepository defines the interface for service account and API key persistence.
+type ServiceAccountRepository interface {
+	CreateServiceAccount(account models.ServiceAccount) error
+	// GetServiceAccount returns (nil, nil) if the account does not exist.
+	GetServiceAccount(id string) (*models.ServiceAccount, error)
+	ListServiceAccounts() ([]models.ServiceAccount, error)
+	// SetServiceAccountDisabled disables the account at the given time, or re-enables it if nil.
+	SetServiceAccountDisabled(id string, disabledAt *time.Time) error
+
+	// CreateAPIKey stores a new key and sets key.ID.
+	CreateAPIKey(key *models.APIKey) error
+	// GetAPIKey returns (nil, nil) if the key does not exist.
+	GetAPIKey(id int64) (*models.APIKey, error)
+	// GetAPIKeyByPrefix returns (nil, nil) if no key has that prefix.
+	GetAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	ListAPIKeys(serviceAccountID string) ([]models.APIKey, error)
+	RevokeAPIKey(id int64, at time.Time) error
+	// ExpireAPIKey shortens the lifetime of a key, e.g. to let a rotated key overlap with its replacement.
+	ExpireAPIKey(id int64, at time.Time) error
+	TouchAPIKey(id int64, at time.Time) error
+}
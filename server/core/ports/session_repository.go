@@ -0,0 +1,15 @@
+package ports
+
+import "keeper/server/models"
+
+// SessionRepository defines the interface for the game sessions of rooms.
+type SessionRepository interface {
+	// CreateSession stores a new session and sets its ID.
+	CreateSession(session *models.Session) error
+	// GetSession returns (nil, nil) if the session does not exist.
+	GetSession(id int64) (*models.Session, error)
+	// ListSessions returns the sessions of a room, oldest first.
+	ListSessions(roomID int64) ([]models.Session, error)
+	// EndSession saves the end marker and time of a session.
+	EndSession(session *models.Session) error
+}
@@ -1,10 +1,34 @@
 package ports
 
-import "keeper/server/models"
+import (
+	"time"
+
+	"keeper/server/models"
+)
 
 // UserRepository defines the interface for user data persistence.
 type UserRepository interface {
 	CreateUser(user models.User) error
 	GetUserByUsername(username string) (*models.User, error)
 	GetUserByID(id int64) (*models.User, error)
+	// ListUsers returns all users ordered by ID.
+	ListUsers() ([]models.User, error)
+}
+
+// LegacyUserMigration records that a legacy user has been migrated to a Kratos identity.
+type LegacyUserMigration struct {
+	LegacyUserID          int64
+	Username              string
+	IdentityID            string
+	MigratedAt            time.Time
+	MessagesRewritten     bool
+	RewrittenMessageCount int64
+}
+
+// LegacyUserMigrationRepository tracks the progress of migrating legacy users to Kratos.
+type LegacyUserMigrationRepository interface {
+	// GetMigration returns (nil, nil) if the legacy user has not been migrated.
+	GetMigration(legacyUserID int64) (*LegacyUserMigration, error)
+	SaveMigration(m LegacyUserMigration) error
+	MarkMessagesRewritten(legacyUserID int64, count int64) error
 }
@@ -0,0 +1,49 @@
+package ports
+
+import (
+	"time"
+
+	"keeper/server/models"
+)
+
+// WebhookRepository defines the interface for outgoing webhooks and their delivery queue.
+type WebhookRepository interface {
+	// CreateWebhook stores a new webhook and sets its ID.
+	CreateWebhook(webhook *models.Webhook) error
+	// GetWebhook returns (nil, nil) if the webhook does not exist.
+	GetWebhook(id int64) (*models.Webhook, error)
+	ListWebhooks(roomID int64) ([]models.Webhook, error)
+	// DeleteWebhook deletes a webhook and its deliveries.
+	DeleteWebhook(id int64) error
+
+	// CreateDelivery queues a delivery and sets its ID.
+	CreateDelivery(delivery *models.WebhookDelivery) error
+	// GetDelivery returns (nil, nil) if the delivery does not exist.
+	GetDelivery(id int64) (*models.WebhookDelivery, error)
+	ListDeliveries(query DeliveryQuery) ([]models.WebhookDelivery, error)
+	// DueDeliveries returns up to limit pending deliveries due at or before now, oldest first.
+	DueDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	// UpdateDelivery saves the status, attempt and result fields of a delivery.
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+}
+
+// DeliveryQuery filters webhook deliveries. Zero values match everything.
+type DeliveryQuery struct {
+	WebhookID int64
+	Status    string
+	Limit     int // 0 for the default of 100
+}
+
+// IncomingWebhookRepository defines the interface for incoming webhooks of rooms.
+type IncomingWebhookRepository interface {
+	// CreateIncomingWebhook stores a new incoming webhook and sets its ID.
+	CreateIncomingWebhook(hook *models.IncomingWebhook) error
+	// GetIncomingWebhook returns (nil, nil) if the webhook does not exist.
+	GetIncomingWebhook(id int64) (*models.IncomingWebhook, error)
+	// GetIncomingWebhookByPrefix returns (nil, nil) if no webhook has the token prefix.
+	GetIncomingWebhookByPrefix(prefix string) (*models.IncomingWebhook, error)
+	ListIncomingWebhooks(roomID int64) ([]models.IncomingWebhook, error)
+	DeleteIncomingWebhook(id int64) error
+	// TouchIncomingWebhook records the last use of a webhook.
+	TouchIncomingWebhook(id int64, usedAt time.Time) error
+}
@@ -9,8 +9,8 @@ import (
 	// "github.com/golang-jwt/jwt/v5" // No longer generating JWTs here
 	// "golang.org/x/crypto/bcrypt" // No longer hashing passwords here
 	// "keeper/server/core/ports" // Old port no longer directly used by this service for user repo
+	"keeper/server/models"                           // Principals of service accounts
 	usersmanagement "keeper/server/users-management" // New user service
-	// "keeper/server/models" // Old user model no longer used here
 )
 
 // jwtExpiration defines the duration for which JWT tokens are valid.
@@ -38,7 +38,8 @@ var ErrInvalidToken = errors.New("invalid or expired session") // For Kratos ses
 // AuthServiceImpl implements the ports.AuthService interface.
 // The interface itself might need to be updated or re-evaluated later.
 type AuthServiceImpl struct {
-	userSvc *usersmanagement.UserService
+	userSvc         *usersmanagement.UserService
+	serviceAccounts *ServiceAccountService
 	// jwtSecret []byte // No longer needed
 }
 
@@ -46,13 +47,15 @@ type AuthServiceImpl struct {
 // var _ ports.AuthService = (*AuthServiceImpl)(nil) // Comment out if ports.AuthService changes significantly
 
 // NewAuthService creates a new instance of AuthServiceImpl.
-// It now takes the new UserService for Kratos integration.
-func NewAuthService(userSvc *usersmanagement.UserService /*, jwtSecret string - no longer needed */) *AuthServiceImpl {
+// It now takes the new UserService for Kratos integration, and the
+// ServiceAccountService that API keys are checked against (nil rejects all keys).
+func NewAuthService(userSvc *usersmanagement.UserService, serviceAccounts *ServiceAccountService /*, jwtSecret string - no longer needed */) *AuthServiceImpl {
 	if userSvc == nil {
 		log.Fatal("UserService cannot be nil in NewAuthService")
 	}
 	return &AuthServiceImpl{
-		userSvc: userSvc,
+		userSvc:         userSvc,
+		serviceAccounts: serviceAccounts,
 		// jwtSecret: []byte(jwtSecret), // No longer needed
 	}
 }
@@ -103,3 +106,16 @@ func (s *AuthServiceImpl) ValidateToken(ctx context.Context, sessionToken string
 	}
 	return user, nil
 }
+
+// AuthenticateAPIKey checks a service account API key.
+// Unknown, revoked and expired keys all map to ErrInvalidAPIKey.
+func (s *AuthServiceImpl) AuthenticateAPIKey(ctx context.Context, key string) (*models.Principal, error) {
+	if s.serviceAccounts == nil || key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	principal, err := s.serviceAccounts.AuthenticateAPIKey(ctx, key)
+	if err != nil && !errors.Is(err, ErrInvalidAPIKey) {
+		log.Printf("API key validation failed: %v", err)
+	}
+	return principal, err
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// registerBuiltinCommands adds the commands every room has.
+func registerBuiltinCommands(r *CommandRegistry) {
+	r.Register(Command{
+		Name:        "help",
+		Description: "List the commands of this room.",
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			commands, err := r.RoomCommands(ctx.Principal, ctx.RoomID)
+			if err != nil {
+				return nil, err
+			}
+			lines := make([]string, 0, len(commands))
+			for _, cmd := range commands {
+				lines = append(lines, strings.TrimSpace("/"+cmd.Name+" "+cmd.Usage)+" - "+cmd.Description)
+			}
+			return ctx.Reply("%s", strings.Join(lines, "\n"))
+		},
+	})
+	r.Register(Command{
+		Name:        "me",
+		Usage:       "<action>",
+		Description: "Describe what you do, e.g. /me opens the door.",
+		MinArgs:     1,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			return ctx.Post(ports.MessageDraft{Text: ctx.Input.Raw, Kind: models.MessageKindEmote})
+		},
+	})
+	r.Register(Command{
+		Name:        "as",
+		Usage:       "<character>: <message>",
+		Description: "Speak as one of your characters, e.g. /as Harvey: Who goes there?",
+		MinArgs:     1,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			name, text, ok := strings.Cut(ctx.Input.Raw, ":")
+			if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(text) == "" {
+				return nil, fmt.Errorf("%w: usage: /as <character>: <message>", ErrInvalidInput)
+			}
+			if ctx.Chat.sheets == nil {
+				return nil, fmt.Errorf("%w: characters are disabled", ErrInvalidInput)
+			}
+			character, err := ctx.Chat.sheets.FindCharacter(ctx.Principal, ctx.RoomID, name)
+			if err != nil {
+				return nil, err
+			}
+			return ctx.Post(ports.MessageDraft{Text: strings.TrimSpace(text), CharacterID: character.ID})
+		},
+	})
+	r.Register(Command{
+		Name:        "ic",
+		Usage:       "<narration>",
+		Description: "Post narration that is part of the story, e.g. /ic The lights go out.",
+		MinArgs:     1,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			return ctx.Post(ports.MessageDraft{Text: ctx.Input.Raw, InCharacter: true})
+		},
+	})
+	r.Register(Command{
+		Name:        "topic",
+		Usage:       "[topic]",
+		Description: "Show the room topic, or change it if you own the room.",
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			if ctx.Input.Raw == "" {
+				room, err := ctx.Chat.GetRoom(ctx.Principal, ctx.RoomID)
+				if err != nil {
+					return nil, err
+				}
+				if room.Topic == "" {
+					return ctx.Reply("This room has no topic.")
+				}
+				return ctx.Reply("Topic: %s", room.Topic)
+			}
+			room, err := ctx.Chat.SetTopic(ctx.Principal, ctx.RoomID, ctx.Input.Raw)
+			if err != nil {
+				return nil, err
+			}
+			return ctx.Reply("Topic changed to: %s", room.Topic)
+		},
+	})
+	r.Register(Command{
+		Name:        "invite",
+		Usage:       "<user-id> [owner|member]",
+		Description: "Add a user or service account to this room.",
+		MinArgs:     1,
+		OwnerOnly:   true,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			role := ""
+			if len(ctx.Input.Args) > 1 {
+				role = ctx.Input.Args[1]
+			}
+			member, err := ctx.Chat.AddMember(ctx.Principal, ctx.RoomID, ctx.Input.Args[0], role)
+			if err != nil {
+				return nil, err
+			}
+			return ctx.Reply("%s is now a %s of this room.", member.UserID, member.Role)
+		},
+	})
+	r.Register(Command{
+		Name:        "roll",
+		Usage:       "[dice] [label] | [character:] <skill> [b1|p1]",
+		Description: "Roll dice for everyone to see, e.g. /roll 4d6kh3 Strength, or check a skill of your character, e.g. /roll Spot Hidden. Rolls a d20 by default.",
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			return ctx.Chat.Roll(ctx.Principal, rollDraft(ctx, nil))
+		},
+	})
+	r.Register(Command{
+		Name:        "hroll",
+		Usage:       "[dice] [label] | [character:] <skill> [b1|p1]",
+		Description: "Roll dice that only you and the room owners see, until revealed.",
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			members, err := ctx.Chat.ListMembers(ctx.Principal, ctx.RoomID)
+			if err != nil {
+				return nil, err
+			}
+			visibleTo := []string{ctx.Principal.ID}
+			for _, m := range members {
+				if m.Role == models.RoomRoleOwner {
+					visibleTo = append(visibleTo, m.UserID)
+				}
+			}
+			return ctx.Chat.Roll(ctx.Principal, rollDraft(ctx, visibleTo))
+		},
+	})
+	r.Register(Command{
+		Name:        "init",
+		Usage:       "[add <name> [dice] | roll [name] | next | remove <name> | end]",
+		Description: "Show or change the turn order of a fight, e.g. /init add Cultist d20+2, /init roll, /init next.",
+		Run:         initiativeCommand,
+	})
+	r.Register(Command{
+		Name:        "session",
+		Usage:       "start [title] | end",
+		Description: "Start or end a game session. Members can export the transcript of a session.",
+		MinArgs:     1,
+		OwnerOnly:   true,
+		Run:         sessionCommand,
+	})
+	r.Register(Command{
+		Name:        "event",
+		Usage:       "[add <date> <time> [timezone] <title> | cancel <id>]",
+		Description: "List the scheduled sessions, or schedule one, e.g. /event add 2026-10-24 19:00 Europe/Berlin The Haunting.",
+		Run:         eventCommand,
+	})
+	r.Register(Command{
+		Name:        "rsvp",
+		Usage:       "<id> yes|no|maybe",
+		Description: "Answer whether you will attend a scheduled session.",
+		MinArgs:     2,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			if ctx.Chat.calendar == nil {
+				return nil, fmt.Errorf("%w: the calendar is disabled", ErrInvalidInput)
+			}
+			id, err := parseEventID(ctx.Input.Args[0])
+			if err != nil {
+				return nil, err
+			}
+			event, err := ctx.Chat.calendar.RSVP(ctx.Principal, id, ctx.Input.Args[1])
+			if err != nil {
+				return nil, err
+			}
+			return ctx.Reply("You answered %s to %s on %s.", strings.ToLower(ctx.Input.Args[1]), event.Title, eventTime(event))
+		},
+	})
+	r.Register(Command{
+		Name:        "whisper",
+		Usage:       "<user-id> <message>",
+		Description: "Send a message that only you and one member see, until revealed.",
+		MinArgs:     2,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			return ctx.Post(ports.MessageDraft{Text: strings.Join(ctx.Input.Args[1:], " "), VisibleTo: ctx.Input.Args[:1]})
+		},
+	})
+	r.Register(Command{
+		Name:        "reveal",
+		Usage:       "<message-id>",
+		Description: "Show one of your whispers or hidden rolls to the whole room. Owners can reveal any they see.",
+		MinArgs:     1,
+		Run: func(ctx *CommandContext) (*models.Message, error) {
+			id, err := strconv.ParseInt(strings.TrimPrefix(ctx.Input.Args[0], "#"), 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("%w: %q is not a message ID", ErrInvalidInput, ctx.Input.Args[0])
+			}
+			if _, err := ctx.Chat.RevealMessage(ctx.Principal, ctx.RoomID, id); err != nil {
+				return nil, err
+			}
+			return ctx.Reply("Message %d is now visible to everyone.", id)
+		},
+	})
+}
+
+// bonusDice matches the optional last argument of a skill check.
+var bonusDice = regexp.MustCompile(`^[bp][0-9]$`)
+
+// rollDraft reads the arguments of /roll and /hroll. Dice come first and
+// always contain a digit or "%", so arguments without one name a skill,
+// optionally after the character and a colon, and followed by bonus or
+// penalty dice. Without arguments a d20 is rolled.
+func rollDraft(ctx *CommandContext, visibleTo []string) ports.RollDraft {
+	draft := ports.RollDraft{RoomID: ctx.RoomID, Dice: "d20", VisibleTo: visibleTo}
+	args := ctx.Input.Args
+	if len(args) == 0 {
+		return draft
+	}
+	if strings.ContainsAny(args[0], "0123456789%") {
+		draft.Dice, draft.Label = args[0], strings.Join(args[1:], " ")
+		return draft
+	}
+
+	draft.Dice = "d100"
+	if last := strings.ToLower(args[len(args)-1]); len(args) > 1 && bonusDice.MatchString(last) {
+		draft.Dice += last
+		args = args[:len(args)-1]
+	}
+	draft.Skill = strings.Join(args, " ")
+	if character, skill, ok := strings.Cut(draft.Skill, ":"); ok {
+		draft.Character, draft.Skill = strings.TrimSpace(character), strings.TrimSpace(skill)
+	}
+	return draft
+}
+
+// initiativeCommand runs /init and replies with the turn order. Combatants
+// are named as in the turn order, or by "#id"; a name of one of the room's
+// characters adds that character.
+func initiativeCommand(ctx *CommandContext) (*models.Message, error) {
+	tracker := ctx.Chat.initiative
+	if tracker == nil {
+		return nil, fmt.Errorf("%w: initiative tracking is disabled", ErrInvalidInput)
+	}
+	var sub string
+	var args []string
+	if len(ctx.Input.Args) > 0 {
+		sub, args = strings.ToLower(ctx.Input.Args[0]), ctx.Input.Args[1:]
+	}
+
+	var initiative *models.Initiative
+	var err error
+	switch sub {
+	case "":
+		initiative, err = tracker.Initiative(ctx.Principal, ctx.RoomID)
+	case "add":
+		var draft CombatantDraft
+		if draft, err = combatantDraft(ctx, args); err == nil {
+			initiative, err = tracker.AddCombatant(ctx.Principal, ctx.RoomID, draft)
+		}
+	case "roll":
+		var id int64
+		if len(args) > 0 {
+			id, err = findCombatant(ctx, args)
+		}
+		if err == nil {
+			initiative, err = tracker.RollInitiative(ctx.Principal, ctx.RoomID, id)
+		}
+	case "next":
+		initiative, err = tracker.NextTurn(ctx.Principal, ctx.RoomID)
+	case "remove":
+		var id int64
+		if id, err = findCombatant(ctx, args); err == nil {
+			initiative, err = tracker.RemoveCombatant(ctx.Principal, ctx.RoomID, id)
+		}
+	case "end":
+		if err := tracker.EndCombat(ctx.Principal, ctx.RoomID); err != nil {
+			return nil, err
+		}
+		return ctx.Reply("The fight is over.")
+	default:
+		return nil, fmt.Errorf("%w: unknown /init action %q, try add, roll, next, remove or end", ErrInvalidInput, sub)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Reply("%s", describeInitiative(initiative))
+}
+
+// sessionCommand runs /session. The markers it posts are the answer, so the
+// reply only tells the owner how to go on.
+func sessionCommand(ctx *CommandContext) (*models.Message, error) {
+	sessions := ctx.Chat.sessions
+	if sessions == nil {
+		return nil, fmt.Errorf("%w: session logs are disabled", ErrInvalidInput)
+	}
+	switch sub := strings.ToLower(ctx.Input.Args[0]); sub {
+	case "start":
+		session, err := sessions.StartSession(ctx.Principal, ctx.RoomID, strings.Join(ctx.Input.Args[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Reply("%s has started. End it with /session end.", session.Title)
+	case "end":
+		session, err := sessions.EndSession(ctx.Principal, ctx.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Reply("%s has ended. Its transcript is session %d.", session.Title, session.ID)
+	default:
+		return nil, fmt.Errorf("%w: unknown /session action %q, try start or end", ErrInvalidInput, sub)
+	}
+}
+
+// eventCommand runs /event. Without a timezone, times are in UTC.
+func eventCommand(ctx *CommandContext) (*models.Message, error) {
+	calendar := ctx.Chat.calendar
+	if calendar == nil {
+		return nil, fmt.Errorf("%w: the calendar is disabled", ErrInvalidInput)
+	}
+	var sub string
+	var args []string
+	if len(ctx.Input.Args) > 0 {
+		sub, args = strings.ToLower(ctx.Input.Args[0]), ctx.Input.Args[1:]
+	}
+	switch sub {
+	case "":
+		events, err := calendar.ListEvents(ctx.Principal, ctx.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) == 0 {
+			return ctx.Reply("No sessions are scheduled. Schedule one with /event add 2026-10-24 19:00 Europe/Berlin The Haunting.")
+		}
+		lines := []string{"Scheduled sessions:"}
+		for i := range events {
+			coming := 0
+			for _, a := range events[i].Attendees {
+				if a.Response == models.RSVPYes {
+					coming++
+				}
+			}
+			lines = append(lines, fmt.Sprintf("#%d %s, %s (%d coming)", events[i].ID, events[i].Title, eventTime(&events[i]), coming))
+		}
+		return ctx.Reply("%s", strings.Join(lines, "\n"))
+	case "add":
+		if len(args) < 3 {
+			return nil, fmt.Errorf("%w: usage: /event add <date> <time> [timezone] <title>", ErrInvalidInput)
+		}
+		draft := EventDraft{Start: args[0] + " " + args[1]}
+		args = args[2:]
+		if len(args) > 1 && (strings.Contains(args[0], "/") || strings.EqualFold(args[0], "UTC")) {
+			draft.Timezone, args = args[0], args[1:]
+		}
+		draft.Title = strings.Join(args, " ")
+		if _, err := calendar.CreateEvent(ctx.Principal, ctx.RoomID, draft); err != nil {
+			return nil, err
+		}
+		return ctx.Reply("Scheduled %s.", draft.Title)
+	case "cancel":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: usage: /event cancel <id>", ErrInvalidInput)
+		}
+		id, err := parseEventID(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := calendar.DeleteEvent(ctx.Principal, id); err != nil {
+			return nil, err
+		}
+		return ctx.Reply("Event %d is cancelled.", id)
+	default:
+		return nil, fmt.Errorf("%w: unknown /event action %q, try add or cancel", ErrInvalidInput, sub)
+	}
+}
+
+// parseEventID reads an event ID, optionally written as "#3".
+func parseEventID(raw string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(raw, "#"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %q is not an event ID", ErrInvalidInput, raw)
+	}
+	return id, nil
+}
+
+// combatantDraft reads the arguments of /init add: a name, optionally
+// followed by dice such as d20+2.
+func combatantDraft(ctx *CommandContext, args []string) (CombatantDraft, error) {
+	var draft CombatantDraft
+	if last := len(args) - 1; last > 0 && strings.Contains(strings.ToLower(args[last]), "d") && strings.ContainsAny(args[last], "0123456789") {
+		draft.Dice, args = args[last], args[:last]
+	}
+	draft.Name = strings.Join(args, " ")
+	if draft.Name == "" {
+		return draft, fmt.Errorf("%w: usage: /init add <name> [dice]", ErrInvalidInput)
+	}
+	if ctx.Chat.sheets != nil {
+		character, err := ctx.Chat.sheets.FindCharacter(ctx.Principal, ctx.RoomID, draft.Name)
+		switch {
+		case err == nil:
+			draft.Name, draft.CharacterID = "", character.ID
+		case !errors.Is(err, ErrCharacterNotFound):
+			return draft, err
+		}
+	}
+	return draft, nil
+}
+
+// findCombatant returns the ID of the combatant named by args.
+func findCombatant(ctx *CommandContext, args []string) (int64, error) {
+	name := strings.Join(args, " ")
+	if name == "" {
+		return 0, fmt.Errorf("%w: name the combatant", ErrInvalidInput)
+	}
+	if id, err := strconv.ParseInt(strings.TrimPrefix(name, "#"), 10, 64); err == nil && strings.HasPrefix(name, "#") {
+		return id, nil
+	}
+	initiative, err := ctx.Chat.initiative.Initiative(ctx.Principal, ctx.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range initiative.Combatants {
+		if strings.EqualFold(c.Name, name) {
+			return c.ID, nil
+		}
+	}
+	return 0, ErrCombatantNotFound
+}
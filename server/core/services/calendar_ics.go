@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"keeper/server/models"
+)
+
+// ICSContentType is the content type of iCalendar feeds.
+const ICSContentType = "text/calendar; charset=utf-8"
+
+// icsTime is the UTC date-time format of iCalendar, e.g. 20261024T170000Z.
+const icsTime = "20060102T150405Z"
+
+// icsEscaper escapes TEXT values as RFC 5545 requires.
+var icsEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`, `,`, `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// WriteICS writes the events of a room as an iCalendar feed. Times are given
+// in UTC, which every calendar shows in its own timezone; the answers of
+// members are listed in the description.
+func WriteICS(w io.Writer, room string, events []models.CalendarEvent) error {
+	var b strings.Builder
+	line := func(name, value string) { writeICSLine(&b, name+":"+value) }
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Keeper//Keeper Chat//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", icsEscaper.Replace(room))
+	for _, event := range events {
+		stamp := event.CreatedAt
+		if event.UpdatedAt != nil {
+			stamp = *event.UpdatedAt
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("event-%d@keeper", event.ID))
+		line("DTSTAMP", stamp.UTC().Format(icsTime))
+		line("DTSTART", event.StartsAt.UTC().Format(icsTime))
+		if event.Duration > 0 {
+			line("DTEND", event.StartsAt.Add(time.Duration(event.Duration)*time.Minute).UTC().Format(icsTime))
+		}
+		line("SUMMARY", icsEscaper.Replace(event.Title))
+		if description := icsDescription(&event); description != "" {
+			line("DESCRIPTION", icsEscaper.Replace(description))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsDescription is the description of an event followed by who answered what.
+func icsDescription(event *models.CalendarEvent) string {
+	parts := []string{}
+	if event.Description != "" {
+		parts = append(parts, event.Description)
+	}
+	for _, response := range []string{models.RSVPYes, models.RSVPMaybe, models.RSVPNo} {
+		var names []string
+		for _, a := range event.Attendees {
+			if a.Response == response {
+				names = append(names, a.Name)
+			}
+		}
+		if len(names) > 0 {
+			parts = append(parts, response+": "+strings.Join(names, ", "))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// writeICSLine writes a content line, folded into lines of at most 75
+// octets without splitting UTF-8 sequences. Continuation lines start with a
+// space, which counts toward their length.
+func writeICSLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line, limit = line[cut:], 74
+	}
+	b.WriteString(line + "\r\n")
+}
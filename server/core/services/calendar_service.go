@@ -0,0 +1,491 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // Event timezones must resolve even where the system has no zoneinfo
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// CalendarFeedPrefix starts every calendar feed token.
+const CalendarFeedPrefix = "kcal_"
+
+// Limits of calendar events.
+const (
+	MaxEventTitleLength       = 128
+	MaxEventDescriptionLength = 2000
+	MaxEventDuration          = 24 * 60 // Minutes
+	MaxEventReminders         = 5
+	MaxReminderOffset         = 30 * 24 * 60 // Minutes
+)
+
+// DefaultReminders are the reminder offsets of events created without any,
+// in minutes before the start: a day and an hour.
+var DefaultReminders = []int{24 * 60, 60}
+
+const (
+	reminderBatchSize = 50
+	// calendarFeedHistory is how long events stay in calendar feeds after they start.
+	calendarFeedHistory = 90 * 24 * time.Hour
+)
+
+// startLayouts are the local times accepted for the start of an event.
+var startLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05"}
+
+// Errors returned for calendar events and feeds.
+var (
+	ErrEventNotFound       = errors.New("event not found")
+	ErrInvalidFeedToken    = errors.New("invalid calendar feed token")
+	errEventAlreadyStarted = errors.New("the event has already started")
+)
+
+// EventDraft is a calendar event about to be scheduled or changed.
+type EventDraft struct {
+	Title       string
+	Description string
+	Start       string // Local time in Timezone, e.g. "2026-10-24 19:00", or RFC 3339 with an offset
+	Timezone    string // IANA name; "" for UTC
+	Duration    int    // Minutes; 0 if open-ended
+	Reminders   []int  // Minutes before the start; nil for the defaults
+}
+
+// CalendarService schedules game sessions in rooms, collects the answers of
+// members and reminds the room before a session starts. Members schedule
+// events; their creator and the room owners change or cancel them.
+// Announcements and reminders are posted by the server through the
+// ChatService.
+type CalendarService struct {
+	repo      ports.CalendarRepository
+	authz     ports.Authorizer
+	chat      ports.ChatService
+	reminders []int
+	now       func() time.Time
+}
+
+// NewCalendarService creates a new CalendarService.
+func NewCalendarService(repo ports.CalendarRepository, authz ports.Authorizer, chat ports.ChatService) *CalendarService {
+	if repo == nil || authz == nil || chat == nil {
+		log.Fatal("CalendarRepository, Authorizer and ChatService cannot be nil in NewCalendarService")
+	}
+	return &CalendarService{repo: repo, authz: authz, chat: chat, reminders: DefaultReminders, now: time.Now}
+}
+
+// SetDefaultReminders replaces the reminder offsets of events created
+// without any, in minutes before the start.
+func (s *CalendarService) SetDefaultReminders(minutes []int) {
+	s.reminders = minutes
+}
+
+// ListEvents returns the events of a room that have not started, soonest first.
+func (s *CalendarService) ListEvents(p *models.Principal, roomID int64) ([]models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListEvents(roomID, s.now().UTC())
+}
+
+// GetEvent returns an event of a room the principal is a member of.
+func (s *CalendarService) GetEvent(p *models.Principal, id int64) (*models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	event, _, err := s.event(p, id)
+	return event, err
+}
+
+// CreateEvent schedules an event in a room and announces it there.
+func (s *CalendarService) CreateEvent(p *models.Principal, roomID int64, draft EventDraft) (*models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	event := &models.CalendarEvent{RoomID: roomID, CreatedBy: p.ID, CreatedAt: now}
+	if draft.Reminders == nil {
+		draft.Reminders = s.reminders
+	}
+	if err := applyEventDraft(event, draft, now); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateEvent(event); err != nil {
+		return nil, fmt.Errorf("creating event in room %d: %w", roomID, err)
+	}
+	if err := s.schedule(event, now); err != nil {
+		return nil, err
+	}
+	event.Attendees = []models.Attendee{}
+	s.announce(event, fmt.Sprintf("%s scheduled %s for %s (event %d). Answer with /rsvp %d yes, no or maybe.",
+		p.DisplayName, event.Title, eventTime(event), event.ID, event.ID))
+	return event, nil
+}
+
+// UpdateEvent replaces the details of an event that has not started. A new
+// start time is announced, and the reminders are scheduled again.
+func (s *CalendarService) UpdateEvent(p *models.Principal, id int64, draft EventDraft) (*models.CalendarEvent, error) {
+	event, err := s.editableEvent(p, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	start := event.StartsAt
+	if draft.Reminders == nil {
+		draft.Reminders = event.Reminders
+	}
+	if err := applyEventDraft(event, draft, now); err != nil {
+		return nil, err
+	}
+	event.UpdatedAt = &now
+	if err := s.repo.UpdateEvent(event); err != nil {
+		return nil, fmt.Errorf("updating event %d: %w", id, err)
+	}
+	if err := s.schedule(event, now); err != nil {
+		return nil, err
+	}
+	if !event.StartsAt.Equal(start) {
+		s.announce(event, fmt.Sprintf("%s moved %s to %s.", p.DisplayName, event.Title, eventTime(event)))
+	}
+	return event, nil
+}
+
+// DeleteEvent cancels an event and announces it if it had not started.
+func (s *CalendarService) DeleteEvent(p *models.Principal, id int64) error {
+	event, err := s.editableEvent(p, id)
+	if err != nil && !errors.Is(err, errEventAlreadyStarted) {
+		return err
+	}
+	if err := s.repo.DeleteEvent(id); err != nil {
+		return fmt.Errorf("deleting event %d: %w", id, err)
+	}
+	if event.StartsAt.After(s.now()) {
+		s.announce(event, fmt.Sprintf("%s cancelled %s on %s.", p.DisplayName, event.Title, eventTime(event)))
+	}
+	return nil
+}
+
+// RSVP records whether the principal will attend an event.
+func (s *CalendarService) RSVP(p *models.Principal, id int64, response string) (*models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != models.RSVPYes && response != models.RSVPNo && response != models.RSVPMaybe {
+		return nil, fmt.Errorf("%w: answer yes, no or maybe", ErrInvalidInput)
+	}
+	event, _, err := s.event(p, id)
+	if err != nil {
+		return nil, err
+	}
+	attendee := models.Attendee{UserID: p.ID, Name: p.DisplayName, Response: response, RespondedAt: s.now().UTC()}
+	if err := s.repo.SaveAttendee(id, attendee); err != nil {
+		return nil, fmt.Errorf("saving answer to event %d: %w", id, err)
+	}
+	i := slices.IndexFunc(event.Attendees, func(a models.Attendee) bool { return a.UserID == p.ID })
+	if i < 0 {
+		event.Attendees = append(event.Attendees, attendee)
+	} else {
+		event.Attendees[i] = attendee
+	}
+	return event, nil
+}
+
+// IssueCalendarFeed creates a secret feed of a room's calendar for the
+// principal, replacing their previous one. The returned token is part of the
+// feed URL and is not shown again. Only people can have feeds.
+func (s *CalendarService) IssueCalendarFeed(p *models.Principal, roomID int64) (string, error) {
+	if p.IsBot() || p.IsWebhook() {
+		return "", fmt.Errorf("%w: only people can subscribe to calendars", ErrForbidden)
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return "", err
+	}
+	prefix, err := randomHex(6)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+	feed := &models.CalendarFeed{RoomID: roomID, UserID: p.ID, Prefix: prefix, Hash: hashSecret(secret), CreatedAt: s.now().UTC()}
+	if err := s.repo.SaveCalendarFeed(feed); err != nil {
+		return "", fmt.Errorf("saving calendar feed of room %d: %w", roomID, err)
+	}
+	return CalendarFeedPrefix + prefix + "_" + secret, nil
+}
+
+// Calendar returns the name of a room and its events for an iCalendar feed,
+// including those that started in the last 90 days.
+func (s *CalendarService) Calendar(p *models.Principal, roomID int64) (string, []models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return "", nil, err
+	}
+	room, err := s.chat.GetRoom(p, roomID)
+	if err != nil {
+		return "", nil, err
+	}
+	events, err := s.repo.ListEvents(roomID, s.now().UTC().Add(-calendarFeedHistory))
+	if err != nil {
+		return "", nil, fmt.Errorf("listing events of room %d: %w", roomID, err)
+	}
+	return room.Name, events, nil
+}
+
+// FeedCalendar authenticates a calendar feed token and returns the calendar
+// of its room, as long as its owner is still a member.
+func (s *CalendarService) FeedCalendar(token string) (string, []models.CalendarEvent, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(token, CalendarFeedPrefix), "_")
+	if !strings.HasPrefix(token, CalendarFeedPrefix) || !ok || prefix == "" || secret == "" {
+		return "", nil, ErrInvalidFeedToken
+	}
+	feed, err := s.repo.GetCalendarFeedByPrefix(prefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("looking up calendar feed: %w", err)
+	}
+	if feed == nil || !secretMatches(feed.Hash, secret) {
+		return "", nil, ErrInvalidFeedToken
+	}
+	name, events, err := s.Calendar(&models.Principal{ID: feed.UserID, Type: models.AuthorTypeUser}, feed.RoomID)
+	if errors.Is(err, ErrNotRoomMember) || errors.Is(err, ErrRoomNotFound) {
+		return "", nil, ErrInvalidFeedToken
+	}
+	return name, events, err
+}
+
+// Run posts due reminders every interval until ctx is cancelled.
+func (s *CalendarService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.RemindDue(ctx); err != nil {
+			log.Printf("Error posting event reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RemindDue posts the reminders that are due and returns how many were
+// posted. Reminders of events that have started by now, e.g. while the
+// server was down, are dropped.
+func (s *CalendarService) RemindDue(ctx context.Context) (int, error) {
+	posted := 0
+	for ctx.Err() == nil {
+		now := s.now().UTC()
+		due, err := s.repo.DueReminders(now, reminderBatchSize)
+		if err != nil {
+			return posted, fmt.Errorf("loading due reminders: %w", err)
+		}
+		for _, reminder := range due {
+			event, err := s.repo.GetEvent(reminder.EventID)
+			if err != nil {
+				return posted, fmt.Errorf("looking up event %d: %w", reminder.EventID, err)
+			}
+			if event != nil && event.StartsAt.After(now) {
+				if _, err := s.chat.Announce(event.RoomID, reminderText(event, now)); err != nil {
+					if !errors.Is(err, ErrRoomNotFound) {
+						return posted, err
+					}
+					log.Printf("Dropping reminder %d of event %d: %v", reminder.ID, event.ID, err)
+				} else {
+					posted++
+				}
+			}
+			if err := s.repo.MarkReminderSent(reminder.ID, now); err != nil {
+				return posted, fmt.Errorf("marking reminder %d as sent: %w", reminder.ID, err)
+			}
+		}
+		if len(due) < reminderBatchSize {
+			break
+		}
+	}
+	return posted, nil
+}
+
+// event returns an event of a room the principal is a member of, with the
+// principal's membership.
+func (s *CalendarService) event(p *models.Principal, id int64) (*models.CalendarEvent, *models.RoomMember, error) {
+	event, err := s.repo.GetEvent(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("looking up event %d: %w", id, err)
+	}
+	if event == nil {
+		return nil, nil, ErrEventNotFound
+	}
+	member, err := s.authz.RoomMember(p, event.RoomID)
+	if errors.Is(err, ErrNotRoomMember) {
+		return nil, nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return event, member, nil
+}
+
+// editableEvent returns an event the principal created, or of a room they
+// own. It fails with errEventAlreadyStarted, along with the event, once
+// the event has started.
+func (s *CalendarService) editableEvent(p *models.Principal, id int64) (*models.CalendarEvent, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	event, member, err := s.event(p, id)
+	if err != nil {
+		return nil, err
+	}
+	if event.CreatedBy != p.ID && member.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only its creator and room owners can change an event", ErrForbidden)
+	}
+	if !event.StartsAt.After(s.now()) {
+		return event, fmt.Errorf("%w: %w", ErrInvalidInput, errEventAlreadyStarted)
+	}
+	return event, nil
+}
+
+// schedule replaces the unsent reminders of an event with those still ahead.
+func (s *CalendarService) schedule(event *models.CalendarEvent, now time.Time) error {
+	var due []time.Time
+	for _, minutes := range event.Reminders {
+		if at := event.StartsAt.Add(-time.Duration(minutes) * time.Minute); at.After(now) {
+			due = append(due, at)
+		}
+	}
+	if err := s.repo.ScheduleReminders(event.ID, due); err != nil {
+		return fmt.Errorf("scheduling reminders of event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// announce posts a message about an event to its room. The event is saved
+// already, so failures are only logged.
+func (s *CalendarService) announce(event *models.CalendarEvent, text string) {
+	if _, err := s.chat.Announce(event.RoomID, text); err != nil {
+		log.Printf("Failed to announce event %d in room %d: %v", event.ID, event.RoomID, err)
+	}
+}
+
+// applyEventDraft validates a draft and copies it onto event. The start
+// must lie ahead of now.
+func applyEventDraft(event *models.CalendarEvent, draft EventDraft, now time.Time) error {
+	title := strings.Join(strings.Fields(draft.Title), " ")
+	if title == "" || len(title) > MaxEventTitleLength {
+		return fmt.Errorf("%w: title must be 1 to %d characters", ErrInvalidInput, MaxEventTitleLength)
+	}
+	description := strings.TrimSpace(draft.Description)
+	if len(description) > MaxEventDescriptionLength {
+		return fmt.Errorf("%w: description exceeds %d bytes", ErrInvalidInput, MaxEventDescriptionLength)
+	}
+	timezone := strings.TrimSpace(draft.Timezone)
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		return fmt.Errorf("%w: unknown timezone %q, use an IANA name like Europe/Berlin", ErrInvalidInput, timezone)
+	}
+	start, err := parseEventStart(strings.TrimSpace(draft.Start), loc)
+	if err != nil {
+		return err
+	}
+	if !start.After(now) {
+		return fmt.Errorf("%w: the start must be in the future", ErrInvalidInput)
+	}
+	if draft.Duration < 0 || draft.Duration > MaxEventDuration {
+		return fmt.Errorf("%w: duration must be 0 to %d minutes", ErrInvalidInput, MaxEventDuration)
+	}
+	if len(draft.Reminders) > MaxEventReminders {
+		return fmt.Errorf("%w: an event can have at most %d reminders", ErrInvalidInput, MaxEventReminders)
+	}
+	reminders := []int{}
+	for _, minutes := range draft.Reminders {
+		if minutes < 1 || minutes > MaxReminderOffset {
+			return fmt.Errorf("%w: reminders must be 1 to %d minutes before the start", ErrInvalidInput, MaxReminderOffset)
+		}
+		if !slices.Contains(reminders, minutes) {
+			reminders = append(reminders, minutes)
+		}
+	}
+	slices.SortFunc(reminders, func(a, b int) int { return b - a })
+
+	event.Title, event.Description, event.Timezone = title, description, timezone
+	event.StartsAt, event.Duration, event.Reminders = start.UTC(), draft.Duration, reminders
+	return nil
+}
+
+// parseEventStart reads an RFC 3339 time, or a local time in loc.
+func parseEventStart(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	for _, layout := range startLayouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: start must be a time like 2026-10-24 19:00", ErrInvalidInput)
+}
+
+// eventTime shows the start of an event in its timezone, e.g. "Sat 24 Oct at 19:00 CEST".
+func eventTime(event *models.CalendarEvent) string {
+	loc, err := time.LoadLocation(event.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return event.StartsAt.In(loc).Format("Mon 2 Jan at 15:04 MST")
+}
+
+// reminderText is the message reminding a room of an event, with who is coming.
+func reminderText(event *models.CalendarEvent, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Reminder: %s starts in %s, on %s.", event.Title, untilText(event.StartsAt.Sub(now)), eventTime(event))
+	var yes, maybe []string
+	for _, a := range event.Attendees {
+		switch a.Response {
+		case models.RSVPYes:
+			yes = append(yes, a.Name)
+		case models.RSVPMaybe:
+			maybe = append(maybe, a.Name)
+		}
+	}
+	if len(yes) > 0 {
+		b.WriteString(" Coming: " + strings.Join(yes, ", ") + ".")
+	}
+	if len(maybe) > 0 {
+		b.WriteString(" Maybe: " + strings.Join(maybe, ", ") + ".")
+	}
+	return b.String()
+}
+
+// untilText rounds a duration to days, hours or minutes, e.g. "1 hour".
+func untilText(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	switch {
+	case minutes >= 24*60:
+		return plural((minutes+12*60)/(24*60), "day")
+	case minutes >= 60:
+		return plural((minutes+30)/60, "hour")
+	default:
+		return plural(max(minutes, 1), "minute")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
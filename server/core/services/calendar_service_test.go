@@ -0,0 +1,221 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	calendarsqlite "keeper/server/adapters/calendar/sqlite"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func newTestCalendarService(t *testing.T, now *time.Time) (*services.ChatService, *services.CalendarService, *fakePublisher) {
+	t.Helper()
+	chat, _, rooms, publisher := newTestCommandRegistry(t)
+	db := newTestDB(t)
+	calendarRepo := calendarsqlite.NewSQLiteCalendarRepository(db)
+	if err := calendarRepo.InitCalendarSchema(); err != nil {
+		t.Fatalf("InitCalendarSchema() failed: %v", err)
+	}
+	calendar := services.NewCalendarService(calendarRepo, services.NewRoomAuthorizer(rooms), chat)
+	calendar.SetClock(func() time.Time { return *now })
+	chat.SetCalendar(calendar)
+	return chat, calendar, publisher
+}
+
+// lastText returns the text of the last message published to the whole room.
+func lastText(publisher *fakePublisher) string {
+	for i := len(publisher.events) - 1; i >= 0; i-- {
+		if msg := publisher.events[i].Message; msg != nil && !msg.Ephemeral {
+			return msg.Text
+		}
+	}
+	return ""
+}
+
+func TestCalendarService_ScheduleAndRSVP(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	chat, calendar, publisher := newTestCalendarService(t, &now)
+
+	reply, err := chat.PostMessage(member, 1, "/event add 2026-10-24 19:00 Europe/Berlin The Haunting")
+	if err != nil || !reply.Ephemeral {
+		t.Fatalf("Expected an ephemeral reply to /event add, got %+v, %v", reply, err)
+	}
+	if text := lastText(publisher); !strings.Contains(text, "Member scheduled The Haunting for Sat 24 Oct at 19:00 CEST") {
+		t.Errorf("Expected the event to be announced, got %q", text)
+	}
+	events, err := calendar.ListEvents(owner, 1)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Expected one upcoming event, got %+v, %v", events, err)
+	}
+	event := events[0]
+	if !event.StartsAt.Equal(time.Date(2026, 10, 24, 17, 0, 0, 0, time.UTC)) || event.Timezone != "Europe/Berlin" || len(event.Reminders) != 2 {
+		t.Errorf("Expected 19:00 in Berlin with the default reminders, got %+v", event)
+	}
+	if _, err := calendar.ListEvents(hermit, 1); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Expected ErrNotRoomMember for a non-member, got %v", err)
+	}
+	if _, err := calendar.GetEvent(hermit, event.ID); !errors.Is(err, services.ErrEventNotFound) {
+		t.Errorf("Expected ErrEventNotFound for a non-member, got %v", err)
+	}
+
+	if _, err := chat.PostMessage(owner, 1, "/rsvp 1 yes"); err != nil {
+		t.Fatalf("/rsvp failed: %v", err)
+	}
+	if _, err := calendar.RSVP(member, event.ID, "sure"); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown answer, got %v", err)
+	}
+	if _, err := calendar.RSVP(member, event.ID, "no"); err != nil {
+		t.Fatalf("RSVP() failed: %v", err)
+	}
+	updated, err := calendar.RSVP(member, event.ID, "Maybe")
+	if err != nil {
+		t.Fatalf("RSVP() failed: %v", err)
+	}
+	if len(updated.Attendees) != 2 || updated.Attendees[0].Name != "Owner" || updated.Attendees[1].Response != models.RSVPMaybe {
+		t.Errorf("Expected the owner coming and the member's latest answer, got %+v", updated.Attendees)
+	}
+
+	if _, err := calendar.UpdateEvent(hermit, event.ID, services.EventDraft{Title: "Mine", Start: "2026-10-25 19:00"}); !errors.Is(err, services.ErrEventNotFound) {
+		t.Errorf("Expected ErrEventNotFound for a non-member, got %v", err)
+	}
+	if _, err := calendar.CreateEvent(owner, 1, services.EventDraft{Title: "Yesterday", Start: "2026-10-19 19:00"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a start in the past, got %v", err)
+	}
+	if _, err := calendar.CreateEvent(owner, 1, services.EventDraft{Title: "Nowhere", Start: "2026-10-25 19:00", Timezone: "Mars/Olympus"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown timezone, got %v", err)
+	}
+	other, err := calendar.CreateEvent(owner, 1, services.EventDraft{Title: "One-shot", Start: "2026-10-31T18:00:00Z", Reminders: []int{}})
+	if err != nil {
+		t.Fatalf("CreateEvent() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "/event cancel 2"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a member cancelling the owner's event, got %v", err)
+	}
+	if err := calendar.DeleteEvent(owner, other.ID); err != nil {
+		t.Fatalf("DeleteEvent() failed: %v", err)
+	}
+	if text := lastText(publisher); !strings.HasPrefix(text, "Owner cancelled One-shot") {
+		t.Errorf("Expected the cancellation to be announced, got %q", text)
+	}
+}
+
+func TestCalendarService_RemindDue(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, calendar, publisher := newTestCalendarService(t, &now)
+	event, err := calendar.CreateEvent(owner, 1, services.EventDraft{Title: "The Haunting", Start: "2026-10-24 19:00", Timezone: "Europe/Berlin"})
+	if err != nil {
+		t.Fatalf("CreateEvent() failed: %v", err)
+	}
+	if _, err := calendar.RSVP(member, event.ID, "yes"); err != nil {
+		t.Fatalf("RSVP() failed: %v", err)
+	}
+	ctx := context.Background()
+	if posted, err := calendar.RemindDue(ctx); err != nil || posted != 0 {
+		t.Errorf("Expected no reminders yet, got %d, %v", posted, err)
+	}
+
+	now = time.Date(2026, 10, 23, 17, 0, 30, 0, time.UTC)
+	if posted, err := calendar.RemindDue(ctx); err != nil || posted != 1 {
+		t.Fatalf("Expected the reminder a day ahead, got %d, %v", posted, err)
+	}
+	if text := lastText(publisher); text != "Reminder: The Haunting starts in 1 day, on Sat 24 Oct at 19:00 CEST. Coming: Member." {
+		t.Errorf("Unexpected reminder %q", text)
+	}
+	if posted, err := calendar.RemindDue(ctx); err != nil || posted != 0 {
+		t.Errorf("Expected each reminder to be posted once, got %d, %v", posted, err)
+	}
+
+	// Moving the event schedules its reminders again.
+	if _, err := calendar.UpdateEvent(owner, event.ID, services.EventDraft{Title: "The Haunting", Start: "2026-10-25 19:00", Timezone: "Europe/Berlin"}); err != nil {
+		t.Fatalf("UpdateEvent() failed: %v", err)
+	}
+	if text := lastText(publisher); text != "Owner moved The Haunting to Sun 25 Oct at 19:00 CET." {
+		t.Errorf("Expected the new start to be announced, got %q", text)
+	}
+
+	// Reminders missed while the event started are dropped.
+	now = time.Date(2026, 10, 25, 18, 30, 0, 0, time.UTC)
+	if posted, err := calendar.RemindDue(ctx); err != nil || posted != 0 {
+		t.Errorf("Expected reminders of a started event to be dropped, got %d, %v", posted, err)
+	}
+	if _, err := calendar.UpdateEvent(owner, event.ID, services.EventDraft{Title: "Later", Start: "2026-11-01 19:00"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a started event, got %v", err)
+	}
+}
+
+func TestCalendarService_Feed(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, calendar, _ := newTestCalendarService(t, &now)
+	if _, err := calendar.CreateEvent(owner, 1, services.EventDraft{Title: "The Haunting; part 2", Start: "2026-10-24 19:00", Timezone: "Europe/Berlin", Duration: 240}); err != nil {
+		t.Fatalf("CreateEvent() failed: %v", err)
+	}
+	if _, err := calendar.IssueCalendarFeed(bot, 1); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a bot, got %v", err)
+	}
+	token, err := calendar.IssueCalendarFeed(member, 1)
+	if err != nil || !strings.HasPrefix(token, services.CalendarFeedPrefix) {
+		t.Fatalf("Expected a feed token, got %q, %v", token, err)
+	}
+	if _, _, err := calendar.FeedCalendar(token + "x"); !errors.Is(err, services.ErrInvalidFeedToken) {
+		t.Errorf("Expected ErrInvalidFeedToken for a wrong secret, got %v", err)
+	}
+	room, events, err := calendar.FeedCalendar(token)
+	if err != nil || room != "table" || len(events) != 1 {
+		t.Fatalf("Expected the calendar of the table, got %q, %+v, %v", room, events, err)
+	}
+
+	// A new feed replaces the old one.
+	if _, err := calendar.IssueCalendarFeed(member, 1); err != nil {
+		t.Fatalf("IssueCalendarFeed() failed: %v", err)
+	}
+	if _, _, err := calendar.FeedCalendar(token); !errors.Is(err, services.ErrInvalidFeedToken) {
+		t.Errorf("Expected the old feed to stop working, got %v", err)
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	start := time.Date(2026, 10, 24, 17, 0, 0, 0, time.UTC)
+	events := []models.CalendarEvent{{
+		ID:          7,
+		RoomID:      1,
+		Title:       "The Haunting; part 2, again",
+		Description: "Bring dice.\n" + strings.Repeat("Ü", 60),
+		StartsAt:    start,
+		Timezone:    "Europe/Berlin",
+		Duration:    240,
+		CreatedAt:   start.Add(-72 * time.Hour),
+		Attendees:   []models.Attendee{{Name: "Alice", Response: models.RSVPYes}, {Name: "Bob", Response: models.RSVPMaybe}},
+	}}
+	var b strings.Builder
+	if err := services.WriteICS(&b, "table", events); err != nil {
+		t.Fatalf("WriteICS() failed: %v", err)
+	}
+	ics := b.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:table\r\n",
+		"UID:event-7@keeper\r\n",
+		"DTSTART:20261024T170000Z\r\n",
+		"DTEND:20261024T210000Z\r\n",
+		`SUMMARY:The Haunting\; part 2\, again` + "\r\n",
+		`DESCRIPTION:Bring dice.\n`,
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in the calendar:\n%s", want, ics)
+		}
+	}
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, `\n\nyes: Alice\n\nmaybe: Bob`+"\r\n") {
+		t.Errorf("Expected the answers in the description:\n%s", unfolded)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 || !strings.ContainsRune(line, ':') && !strings.HasPrefix(line, " ") {
+			t.Errorf("Badly folded line %q", line)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// MaxCharacterNameLength bounds character names, in bytes.
+const MaxCharacterNameLength = 64
+
+// maxAvatarURLLength bounds avatar URLs of characters, in bytes.
+const maxAvatarURLLength = 2048
+
+// Errors returned by CharacterService.
+var (
+	ErrCharacterNotFound = errors.New("character not found")
+	ErrCharacterExists   = errors.New("a character with that name already exists in this room")
+	ErrTemplateNotFound  = errors.New("character template not found")
+)
+
+// CharacterDraft is a character about to be created or changed. Updates
+// ignore OwnerID and Template.
+type CharacterDraft struct {
+	OwnerID   string // The player; defaults to the principal. Only room owners may create characters for others.
+	Name      string
+	AvatarURL string // An http or https image URL, or ""
+	Template  string // Defaults to models.CharacterTemplateCoC7
+	Sheet     json.RawMessage
+}
+
+// CharacterService manages the characters of rooms. Room members can read
+// every sheet of their room; the owner of a character and the room's owners
+// (the GMs) can change it.
+type CharacterService struct {
+	repo  ports.CharacterRepository
+	rooms ports.RoomRepository
+	authz ports.Authorizer
+	now   func() time.Time
+}
+
+// NewCharacterService creates a new CharacterService.
+func NewCharacterService(repo ports.CharacterRepository, rooms ports.RoomRepository, authz ports.Authorizer) *CharacterService {
+	if repo == nil || rooms == nil || authz == nil {
+		log.Fatal("CharacterRepository, RoomRepository and Authorizer cannot be nil in NewCharacterService")
+	}
+	return &CharacterService{repo: repo, rooms: rooms, authz: authz, now: time.Now}
+}
+
+// Template returns the JSON schema of a character sheet template.
+func (s *CharacterService) Template(name string) (json.RawMessage, error) {
+	t, ok := sheetTemplates[name]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	return t.source, nil
+}
+
+// ListCharacters returns the characters of a room the principal is a member of.
+func (s *CharacterService) ListCharacters(p *models.Principal, roomID int64) ([]models.Character, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListCharacters(roomID)
+}
+
+// GetCharacter returns a character of a room the principal is a member of.
+func (s *CharacterService) GetCharacter(p *models.Principal, id int64) (*models.Character, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	character, _, err := s.getCharacter(p, id)
+	return character, err
+}
+
+// CreateCharacter adds a character to a room. Characters belong to people,
+// so bots cannot create them.
+func (s *CharacterService) CreateCharacter(p *models.Principal, roomID int64, draft CharacterDraft) (*models.Character, error) {
+	if p.IsBot() || p.IsWebhook() {
+		return nil, fmt.Errorf("%w: only people can create characters", ErrForbidden)
+	}
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	ownerID := strings.TrimSpace(draft.OwnerID)
+	if ownerID == "" {
+		ownerID = p.ID
+	}
+	if ownerID != p.ID {
+		if member.Role != models.RoomRoleOwner {
+			return nil, fmt.Errorf("%w: only room owners can create characters for others", ErrForbidden)
+		}
+		owner, err := s.rooms.GetMember(roomID, ownerID)
+		if err != nil {
+			return nil, fmt.Errorf("looking up membership of %s in room %d: %w", ownerID, roomID, err)
+		}
+		if owner == nil {
+			return nil, fmt.Errorf("%w: %s is not a member of this room", ErrInvalidInput, ownerID)
+		}
+	}
+	templateName := draft.Template
+	if templateName == "" {
+		templateName = models.CharacterTemplateCoC7
+	}
+	template, ok := sheetTemplates[templateName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown template %q, use one of %s", ErrInvalidInput, templateName, strings.Join(SheetTemplates(), ", "))
+	}
+	name, err := s.checkName(roomID, 0, draft.Name)
+	if err != nil {
+		return nil, err
+	}
+	avatarURL, err := checkAvatarURL(draft.AvatarURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := template.validate(draft.Sheet); err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	character := &models.Character{
+		RoomID:    roomID,
+		OwnerID:   ownerID,
+		Name:      name,
+		AvatarURL: avatarURL,
+		Template:  templateName,
+		Sheet:     draft.Sheet,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateCharacter(character); err != nil {
+		return nil, fmt.Errorf("creating character %s: %w", name, err)
+	}
+	return character, nil
+}
+
+// UpdateCharacter replaces the name, avatar and sheet of a character the
+// principal owns, or of any character in a room the principal owns. Messages
+// already posted as the character keep its old name and avatar.
+func (s *CharacterService) UpdateCharacter(p *models.Principal, id int64, draft CharacterDraft) (*models.Character, error) {
+	character, err := s.editableCharacter(p, id)
+	if err != nil {
+		return nil, err
+	}
+	name, err := s.checkName(character.RoomID, character.ID, draft.Name)
+	if err != nil {
+		return nil, err
+	}
+	avatarURL, err := checkAvatarURL(draft.AvatarURL)
+	if err != nil {
+		return nil, err
+	}
+	template, ok := sheetTemplates[character.Template]
+	if !ok {
+		return nil, fmt.Errorf("%w: template %q is no longer supported", ErrInvalidInput, character.Template)
+	}
+	if err := template.validate(draft.Sheet); err != nil {
+		return nil, err
+	}
+
+	character.Name = name
+	character.AvatarURL = avatarURL
+	character.Sheet = draft.Sheet
+	character.UpdatedAt = s.now().UTC()
+	if err := s.repo.UpdateCharacter(character); err != nil {
+		return nil, fmt.Errorf("updating character %d: %w", id, err)
+	}
+	return character, nil
+}
+
+// DeleteCharacter deletes a character the principal owns, or any character in
+// a room the principal owns.
+func (s *CharacterService) DeleteCharacter(p *models.Principal, id int64) error {
+	if _, err := s.editableCharacter(p, id); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteCharacter(id); err != nil {
+		return fmt.Errorf("deleting character %d: %w", id, err)
+	}
+	return nil
+}
+
+// Skill finds the value a check of skill is rolled against. characterID, or
+// else name, picks one of the room's characters that the principal may play:
+// their own, or any if they own the room. With neither, the principal must
+// have exactly one character in the room. It returns the character, the
+// skill as written on the sheet and its value.
+func (s *CharacterService) Skill(p *models.Principal, roomID, characterID int64, name, skill string) (*models.Character, string, int, error) {
+	if strings.TrimSpace(skill) == "" {
+		return nil, "", 0, fmt.Errorf("%w: name the skill to roll, e.g. Spot Hidden", ErrInvalidInput)
+	}
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	characters, err := s.repo.ListCharacters(roomID)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("listing characters of room %d: %w", roomID, err)
+	}
+	var character *models.Character
+	var own []string
+	for i, c := range characters {
+		switch {
+		case characterID != 0 && c.ID == characterID, characterID == 0 && name != "" && strings.EqualFold(c.Name, strings.TrimSpace(name)):
+			if err := canPlay(p, member, &c); err != nil {
+				return nil, "", 0, err
+			}
+			character = &characters[i]
+		case characterID == 0 && name == "" && c.OwnerID == p.ID:
+			own = append(own, c.Name)
+			character = &characters[i]
+		}
+	}
+	if len(own) > 1 {
+		return nil, "", 0, fmt.Errorf("%w: you play %s here, name one like \"%s: %s\"", ErrInvalidInput, strings.Join(own, ", "), own[0], skill)
+	}
+	if character == nil {
+		if characterID != 0 || name != "" {
+			return nil, "", 0, ErrCharacterNotFound
+		}
+		return nil, "", 0, fmt.Errorf("%w: you have no character in this room", ErrInvalidInput)
+	}
+
+	values, err := sheetTemplates[character.Template].values(character.Sheet)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	key, value, ok := lookupValue(values, skill)
+	if !ok {
+		return nil, "", 0, fmt.Errorf("%w: %s has no skill %q", ErrInvalidInput, character.Name, skill)
+	}
+	return character, key, value, nil
+}
+
+// Speaker returns a character of the room that the principal may post as:
+// their own, or any if they own the room.
+func (s *CharacterService) Speaker(p *models.Principal, roomID, characterID int64) (*models.Character, error) {
+	character, member, err := s.getCharacter(p, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if character.RoomID != roomID {
+		return nil, ErrCharacterNotFound
+	}
+	if err := canPlay(p, member, character); err != nil {
+		return nil, err
+	}
+	return character, nil
+}
+
+// FindCharacter returns the character of a room with the given name, ignoring case.
+func (s *CharacterService) FindCharacter(p *models.Principal, roomID int64, name string) (*models.Character, error) {
+	characters, err := s.ListCharacters(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range characters {
+		if strings.EqualFold(c.Name, strings.Join(strings.Fields(name), " ")) {
+			return &characters[i], nil
+		}
+	}
+	return nil, ErrCharacterNotFound
+}
+
+// canPlay checks that the principal may speak and roll as a character: the
+// player, or the GM.
+func canPlay(p *models.Principal, member *models.RoomMember, character *models.Character) error {
+	if character.OwnerID != p.ID && member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: %s belongs to someone else", ErrForbidden, character.Name)
+	}
+	return nil
+}
+
+// getCharacter loads a character and the principal's membership of its room.
+// Characters of other rooms are reported as not found.
+func (s *CharacterService) getCharacter(p *models.Principal, id int64) (*models.Character, *models.RoomMember, error) {
+	character, err := s.repo.GetCharacter(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("looking up character %d: %w", id, err)
+	}
+	if character == nil {
+		return nil, nil, ErrCharacterNotFound
+	}
+	member, err := s.authz.RoomMember(p, character.RoomID)
+	if errors.Is(err, ErrNotRoomMember) {
+		return nil, nil, ErrCharacterNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return character, member, nil
+}
+
+// editableCharacter loads a character the principal may change.
+func (s *CharacterService) editableCharacter(p *models.Principal, id int64) (*models.Character, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	character, member, err := s.getCharacter(p, id)
+	if err != nil {
+		return nil, err
+	}
+	if character.OwnerID != p.ID && member.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only the player or a room owner can change a character", ErrForbidden)
+	}
+	return character, nil
+}
+
+// checkAvatarURL trims an avatar URL and checks that it is an absolute http
+// or https URL, or empty.
+func checkAvatarURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(rawURL) > maxAvatarURLLength {
+		return "", fmt.Errorf("%w: avatar_url must be an absolute http or https URL of at most %d bytes", ErrInvalidInput, maxAvatarURLLength)
+	}
+	return u.String(), nil
+}
+
+// checkName trims a character name and checks that no other character of the
+// room has it. exceptID is the character being renamed, or 0.
+func (s *CharacterService) checkName(roomID, exceptID int64, name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || len(name) > MaxCharacterNameLength {
+		return "", fmt.Errorf("%w: character name must be 1 to %d characters", ErrInvalidInput, MaxCharacterNameLength)
+	}
+	if strings.Contains(name, ":") {
+		return "", fmt.Errorf("%w: character names cannot contain colons", ErrInvalidInput)
+	}
+	characters, err := s.repo.ListCharacters(roomID)
+	if err != nil {
+		return "", fmt.Errorf("listing characters of room %d: %w", roomID, err)
+	}
+	for _, c := range characters {
+		if c.ID != exceptID && strings.EqualFold(c.Name, name) {
+			return "", ErrCharacterExists
+		}
+	}
+	return name, nil
+}
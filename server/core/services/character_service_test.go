@@ -0,0 +1,237 @@
+package services_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	characterssqlite "keeper/server/adapters/characters/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// harvey is a valid coc7 sheet.
+const harvey = `{
+	"occupation": "Journalist",
+	"characteristics": {"STR": 45, "CON": 50, "SIZ": 60, "DEX": 55, "APP": 50, "INT": 80, "POW": 65, "EDU": 85},
+	"sanity": {"current": 63, "max": 99},
+	"luck": 40,
+	"skills": {"Spot Hidden": 60, "Library Use": 70, "Cthulhu Mythos": 0}
+}`
+
+func newTestCharacterService(t *testing.T) (*services.ChatService, *services.CharacterService) {
+	t.Helper()
+	chat, _, rooms, _ := newTestCommandRegistry(t)
+	db := newTestDB(t)
+	repo := characterssqlite.NewSQLiteCharacterRepository(db)
+	if err := repo.InitCharacterSchema(); err != nil {
+		t.Fatalf("InitCharacterSchema() failed: %v", err)
+	}
+	characters := services.NewCharacterService(repo, rooms, services.NewRoomAuthorizer(rooms))
+	chat.SetCharacters(characters)
+	return chat, characters
+}
+
+func TestCharacterService_CreateCharacter(t *testing.T) {
+	_, characters := newTestCharacterService(t)
+
+	character, err := characters.CreateCharacter(member, 1, services.CharacterDraft{Name: " Harvey  Walters ", Sheet: json.RawMessage(harvey)})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+	if character.ID == 0 || character.Name != "Harvey Walters" || character.OwnerID != member.ID || character.Template != models.CharacterTemplateCoC7 {
+		t.Errorf("Expected a coc7 character of the member, got %+v", character)
+	}
+	if list, err := characters.ListCharacters(owner, 1); err != nil || len(list) != 1 {
+		t.Errorf("Expected the owner to see the character, got %+v, %v", list, err)
+	}
+	if _, err := characters.GetCharacter(hermit, character.ID); !errors.Is(err, services.ErrCharacterNotFound) {
+		t.Errorf("Expected ErrCharacterNotFound for a non-member, got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		draft     services.CharacterDraft
+		want      error
+		detail    string
+	}{
+		{"duplicate name", owner, services.CharacterDraft{Name: "harvey walters", Sheet: json.RawMessage(harvey)}, services.ErrCharacterExists, ""},
+		{"unknown template", member, services.CharacterDraft{Name: "Ann", Template: "dnd5e", Sheet: json.RawMessage(harvey)}, services.ErrInvalidInput, "unknown template"},
+		{"missing characteristics", member, services.CharacterDraft{Name: "Ann", Sheet: json.RawMessage(`{"skills": {}}`)}, services.ErrInvalidInput, "characteristics"},
+		{"skill out of range", member, services.CharacterDraft{Name: "Ann", Sheet: json.RawMessage(strings.Replace(harvey, `"Spot Hidden": 60`, `"Spot Hidden": 160`, 1))}, services.ErrInvalidInput, "/skills/Spot Hidden"},
+		{"unknown field", member, services.CharacterDraft{Name: "Ann", Sheet: json.RawMessage(strings.Replace(harvey, `"luck"`, `"karma"`, 1))}, services.ErrInvalidInput, "karma"},
+		{"not JSON", member, services.CharacterDraft{Name: "Ann", Sheet: json.RawMessage(`{`)}, services.ErrInvalidInput, ""},
+		{"colon in name", member, services.CharacterDraft{Name: "Dr: Ann", Sheet: json.RawMessage(harvey)}, services.ErrInvalidInput, ""},
+		{"for someone else", member, services.CharacterDraft{OwnerID: owner.ID, Name: "Ann", Sheet: json.RawMessage(harvey)}, services.ErrForbidden, ""},
+		{"for a non-member", owner, services.CharacterDraft{OwnerID: hermit.ID, Name: "Ann", Sheet: json.RawMessage(harvey)}, services.ErrInvalidInput, ""},
+		{"bot", diceBot, services.CharacterDraft{Name: "Ann", Sheet: json.RawMessage(harvey)}, services.ErrForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := characters.CreateCharacter(tt.principal, 1, tt.draft)
+			if !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.detail) {
+				t.Errorf("Expected %v mentioning %q, got %v", tt.want, tt.detail, err)
+			}
+		})
+	}
+
+	npc, err := characters.CreateCharacter(owner, 1, services.CharacterDraft{OwnerID: member.ID, Name: "Ann", Sheet: json.RawMessage(harvey)})
+	if err != nil || npc.OwnerID != member.ID {
+		t.Errorf("Expected the owner to create a character for the member, got %+v, %v", npc, err)
+	}
+}
+
+func TestCharacterService_UpdateAndDelete(t *testing.T) {
+	_, characters := newTestCharacterService(t)
+	npc, err := characters.CreateCharacter(owner, 1, services.CharacterDraft{Name: "Nyarlathotep", Sheet: json.RawMessage(harvey)})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+
+	if _, err := characters.UpdateCharacter(member, npc.ID, services.CharacterDraft{Name: "Mine now", Sheet: json.RawMessage(harvey)}); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a player edits the GM's character, got %v", err)
+	}
+	updated, err := characters.UpdateCharacter(owner, npc.ID, services.CharacterDraft{
+		Name:      "The Black Pharaoh",
+		AvatarURL: "https://example.com/pharaoh.png",
+		Sheet:     json.RawMessage(strings.Replace(harvey, `"luck": 40`, `"luck": 99`, 1)),
+	})
+	if err != nil || updated.Name != "The Black Pharaoh" || updated.AvatarURL != "https://example.com/pharaoh.png" || !strings.Contains(string(updated.Sheet), `"luck": 99`) {
+		t.Fatalf("Expected the character to be updated, got %+v, %v", updated, err)
+	}
+	if _, err := characters.UpdateCharacter(owner, npc.ID, services.CharacterDraft{Name: "The Black Pharaoh", Sheet: json.RawMessage(`{"skills": {}}`)}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an invalid sheet, got %v", err)
+	}
+
+	if err := characters.DeleteCharacter(member, npc.ID); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a player deletes the GM's character, got %v", err)
+	}
+	if err := characters.DeleteCharacter(owner, npc.ID); err != nil {
+		t.Fatalf("DeleteCharacter() failed: %v", err)
+	}
+	if _, err := characters.GetCharacter(owner, npc.ID); !errors.Is(err, services.ErrCharacterNotFound) {
+		t.Errorf("Expected the character to be gone, got %v", err)
+	}
+}
+
+func TestChatService_Roll_Skill(t *testing.T) {
+	chat, characters := newTestCharacterService(t)
+	if _, err := characters.CreateCharacter(member, 1, services.CharacterDraft{Name: "Harvey Walters", Sheet: json.RawMessage(harvey)}); err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+	chat.SetDice(sequence(t, 23, 1, 1, 5, 7))
+
+	msg, err := chat.Roll(member, ports.RollDraft{RoomID: 1, Skill: "spot  hidden"})
+	if err != nil {
+		t.Fatalf("Roll() failed: %v", err)
+	}
+	check := msg.Roll.Check
+	if check == nil || check.Character != "Harvey Walters" || check.Target != 60 || check.Level != models.CheckHard || msg.Roll.Label != "Spot Hidden" {
+		t.Errorf("Expected a hard success against Spot Hidden 60, got %+v", msg.Roll)
+	}
+	if want := "rolled d100 for Spot Hidden (Harvey Walters): [23] = 23 against 60, hard success"; msg.Text != want {
+		t.Errorf("Expected %q, got %q", want, msg.Text)
+	}
+	if msg.Character == nil || msg.Character.Name != "Harvey Walters" || !msg.InCharacter {
+		t.Errorf("Expected the check to be made in character, got %+v", msg)
+	}
+
+	msg, err = chat.PostMessage(member, 1, "/roll Harvey Walters: POW p1")
+	if err != nil || msg.Roll.Check == nil || msg.Roll.Total != 100 || msg.Roll.Check.Level != models.CheckFumble {
+		t.Errorf("Expected a fumbled POW check with a penalty die, got %+v, %v", msg, err)
+	}
+	msg, err = chat.PostMessage(member, 1, "/roll Sanity")
+	if err != nil || msg.Roll.Check == nil || msg.Roll.Check.Target != 63 || msg.Roll.Check.Level != models.CheckExtreme {
+		t.Errorf("Expected an extreme success against Sanity 63, got %+v, %v", msg, err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		text      string
+		want      error
+	}{
+		{"unknown skill", member, "/roll Astrology", services.ErrInvalidInput},
+		{"no character", owner, "/roll Spot Hidden", services.ErrInvalidInput},
+		{"unknown character", member, "/roll Ann: Spot Hidden", services.ErrCharacterNotFound},
+		{"someone else's character", diceBot, "/roll Harvey Walters: Spot Hidden", services.ErrForbidden},
+		{"too many bonus dice", member, "/roll Spot Hidden b3", services.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := chat.PostMessage(tt.principal, 1, tt.text); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, err := chat.Roll(member, ports.RollDraft{RoomID: 1, Skill: "Spot Hidden", Dice: "2d6"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput checking a skill with 2d6, got %v", err)
+	}
+}
+
+func TestChatService_InCharacter(t *testing.T) {
+	chat, characters := newTestCharacterService(t)
+	harveyWalters, err := characters.CreateCharacter(member, 1, services.CharacterDraft{
+		Name:      "Harvey Walters",
+		AvatarURL: "https://example.com/harvey.png",
+		Sheet:     json.RawMessage(harvey),
+	})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+
+	cultist, err := characters.CreateCharacter(owner, 1, services.CharacterDraft{Name: "Cultist", Sheet: json.RawMessage(harvey)})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+
+	msg, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "Who goes there?", CharacterID: harveyWalters.ID})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	want := models.Speaker{ID: harveyWalters.ID, Name: "Harvey Walters", AvatarURL: "https://example.com/harvey.png"}
+	if msg.Character == nil || *msg.Character != want || !msg.InCharacter || msg.User != member.DisplayName {
+		t.Errorf("Expected the member to speak as %+v, got %+v", want, msg)
+	}
+	if msg, err := chat.PostMessage(owner, 1, "/as harvey walters: Nobody, sir."); err != nil || msg.Character == nil || msg.Character.ID != harveyWalters.ID {
+		t.Errorf("Expected the GM to speak as any character, got %+v, %v", msg, err)
+	}
+	if msg, err := chat.PostMessage(owner, 1, "/ic The lights go out."); err != nil || !msg.InCharacter || msg.Character != nil {
+		t.Errorf("Expected in-character narration, got %+v, %v", msg, err)
+	}
+	if _, err := chat.PostMessage(member, 1, "brb, pizza"); err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		draft     ports.MessageDraft
+		want      error
+	}{
+		{"someone else's character", member, ports.MessageDraft{RoomID: 1, Text: "Boo", CharacterID: cultist.ID}, services.ErrForbidden},
+		{"someone else's character by name", member, ports.MessageDraft{RoomID: 1, Text: "/as Cultist: Boo"}, services.ErrForbidden},
+		{"character of another room", owner, ports.MessageDraft{RoomID: 2, Text: "Boo", CharacterID: harveyWalters.ID}, services.ErrCharacterNotFound},
+		{"unknown character", member, ports.MessageDraft{RoomID: 1, Text: "Boo", CharacterID: 42}, services.ErrCharacterNotFound},
+		{"unknown name", member, ports.MessageDraft{RoomID: 1, Text: "/as Ann: Boo"}, services.ErrCharacterNotFound},
+		{"no name", member, ports.MessageDraft{RoomID: 1, Text: "/as Boo"}, services.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := chat.SendMessage(tt.principal, tt.draft); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	history, err := chat.History(member, ports.MessageQuery{RoomID: 1, InCharacter: true})
+	if err != nil || len(history) != 3 {
+		t.Fatalf("Expected the three in-character messages, got %+v, %v", history, err)
+	}
+	if all, err := chat.History(member, ports.MessageQuery{RoomID: 1}); err != nil || len(all) != 4 {
+		t.Errorf("Expected table talk in the full history, got %+v, %v", all, err)
+	}
+}
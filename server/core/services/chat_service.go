@@ -0,0 +1,673 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// MaxMessageLength bounds the text of a single message, in bytes.
+const MaxMessageLength = 4000
+
+// MaxRoomNameLength bounds room names, in bytes.
+const MaxRoomNameLength = 64
+
+// MaxTopicLength bounds room topics, in bytes.
+const MaxTopicLength = 256
+
+// MaxAttachments bounds the attachments of a single message.
+const MaxAttachments = 10
+
+// maxAttachmentTitleLength bounds attachment titles, in bytes.
+const maxAttachmentTitleLength = 256
+
+// MaxVisibleTo bounds the principals a whisper or hidden roll is shown to.
+const MaxVisibleTo = 20
+
+// Errors returned by ChatService. Errors wrapping ErrForbidden and
+// ErrInvalidInput carry a client-facing detail after the sentinel text.
+var (
+	ErrRoomNotFound    = errors.New("room not found")
+	ErrRoomExists      = errors.New("a room with that name already exists")
+	ErrMessageNotFound = errors.New("message not found")
+	ErrNotRoomMember   = errors.New("not a member of this room")
+	ErrForbidden       = errors.New("not allowed")
+	ErrInvalidInput    = errors.New("invalid input")
+)
+
+// ChatService implements ports.ChatService. Changes are published as room
+// events, so every front-end sees the same broadcasts.
+type ChatService struct {
+	messages   ports.MessageRepository
+	rooms      ports.RoomRepository
+	authz      ports.Authorizer
+	events     ports.EventPublisher
+	commands   *CommandRegistry   // nil if slash commands are disabled
+	sheets     *CharacterService  // nil if skill checks are disabled
+	initiative *InitiativeService // nil if /init is disabled
+	sessions   *SessionService    // nil if /session is disabled
+	calendar   *CalendarService   // nil if /event and /rsvp are disabled
+	files      *FileService       // nil if uploads are disabled
+	dice       *DiceRoller
+	now        func() time.Time
+}
+
+// NewChatService creates a new ChatService.
+func NewChatService(messages ports.MessageRepository, rooms ports.RoomRepository, authz ports.Authorizer, events ports.EventPublisher) *ChatService {
+	if messages == nil || rooms == nil || authz == nil || events == nil {
+		log.Fatal("Repositories, authorizer and publisher cannot be nil in NewChatService")
+	}
+	return &ChatService{messages: messages, rooms: rooms, authz: authz, events: events, dice: NewDiceRoller(), now: time.Now}
+}
+
+// SetCommands enables slash commands. Messages starting with "/" are run by
+// the registry instead of being posted; "//" posts a literal slash.
+func (s *ChatService) SetCommands(commands *CommandRegistry) {
+	s.commands = commands
+}
+
+// SetCharacters enables rolls against the skills on character sheets.
+func (s *ChatService) SetCharacters(characters *CharacterService) {
+	s.sheets = characters
+}
+
+// SetInitiative enables /init, which shows and changes the turn order of a fight.
+func (s *ChatService) SetInitiative(initiative *InitiativeService) {
+	s.initiative = initiative
+}
+
+// SetSessions enables /session, which starts and ends game sessions.
+func (s *ChatService) SetSessions(sessions *SessionService) {
+	s.sessions = sessions
+}
+
+// SetCalendar enables /event and /rsvp, which schedule game sessions and answer invitations.
+func (s *ChatService) SetCalendar(calendar *CalendarService) {
+	s.calendar = calendar
+}
+
+// SetFiles enables posting uploaded files with messages.
+func (s *ChatService) SetFiles(files *FileService) {
+	s.files = files
+}
+
+// RequireScope fails with ErrForbidden if a bot's API key lacks scope.
+func RequireScope(p *models.Principal, scope string) error {
+	if !p.Can(scope) {
+		return fmt.Errorf("%w: API key lacks the %s scope", ErrForbidden, scope)
+	}
+	return nil
+}
+
+// ListRooms returns the rooms the principal is a member of.
+func (s *ChatService) ListRooms(p *models.Principal) ([]models.Room, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	return s.rooms.ListRoomsForMember(p.ID)
+}
+
+// GetRoom returns a room the principal is a member of.
+func (s *ChatService) GetRoom(p *models.Principal, roomID int64) (*models.Room, error) {
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.rooms.GetRoom(roomID)
+}
+
+// CreateRoom creates a room owned by the principal. Only people can create rooms.
+func (s *ChatService) CreateRoom(p *models.Principal, name string) (*models.Room, error) {
+	if p.IsBot() || p.IsWebhook() {
+		return nil, fmt.Errorf("%w: only people can create rooms", ErrForbidden)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxRoomNameLength {
+		return nil, fmt.Errorf("%w: room name must be 1 to %d characters", ErrInvalidInput, MaxRoomNameLength)
+	}
+	existing, err := s.rooms.GetRoomByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("looking up room %s: %w", name, err)
+	}
+	if existing != nil {
+		return nil, ErrRoomExists
+	}
+
+	room := &models.Room{Name: name, CreatedBy: p.ID, CreatedAt: s.now().UTC()}
+	if err := s.rooms.CreateRoom(room); err != nil {
+		return nil, fmt.Errorf("creating room %s: %w", name, err)
+	}
+	err = s.rooms.AddMember(models.RoomMember{RoomID: room.ID, UserID: p.ID, Role: models.RoomRoleOwner, JoinedAt: room.CreatedAt})
+	if err != nil {
+		return nil, fmt.Errorf("adding owner to room %s: %w", name, err)
+	}
+	return room, nil
+}
+
+// ListMembers returns the members of a room the principal is a member of.
+func (s *ChatService) ListMembers(p *models.Principal, roomID int64) ([]models.RoomMember, error) {
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.rooms.ListMembers(roomID)
+}
+
+// AddMember adds a user or service account to a room, or changes their role.
+// Only owners can add members. New members are published as member.joined.
+func (s *ChatService) AddMember(p *models.Principal, roomID int64, userID, role string) (*models.RoomMember, error) {
+	self, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if self.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only room owners can add members", ErrForbidden)
+	}
+	if role == "" {
+		role = models.RoomRoleMember
+	}
+	if role != models.RoomRoleOwner && role != models.RoomRoleMember {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidInput, role)
+	}
+	if strings.TrimSpace(userID) == "" {
+		return nil, fmt.Errorf("%w: user_id is required", ErrInvalidInput)
+	}
+
+	existing, err := s.rooms.GetMember(roomID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up membership of %s in room %d: %w", userID, roomID, err)
+	}
+	if err := s.rooms.AddMember(models.RoomMember{RoomID: roomID, UserID: userID, Role: role, JoinedAt: s.now().UTC()}); err != nil {
+		return nil, fmt.Errorf("adding %s to room %d: %w", userID, roomID, err)
+	}
+	member, err := s.rooms.GetMember(roomID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		s.events.Publish(models.Event{Type: models.EventMemberJoined, RoomID: roomID, Member: member})
+	}
+	return member, nil
+}
+
+// History returns a page of a room's messages, leaving out whispers and
+// hidden rolls the principal may not see.
+func (s *ChatService) History(p *models.Principal, query ports.MessageQuery) ([]models.Message, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, query.RoomID); err != nil {
+		return nil, err
+	}
+	query.Viewer = p.ID
+	return s.messages.ListMessages(query)
+}
+
+// PostMessage stores a message from the principal and broadcasts it to the room.
+func (s *ChatService) PostMessage(p *models.Principal, roomID int64, text string) (*models.Message, error) {
+	return s.SendMessage(p, ports.MessageDraft{RoomID: roomID, Text: text})
+}
+
+// SendMessage stores a message with optional attachments and files and
+// broadcasts it to the room. The text may be empty if there are attachments
+// or files. If slash commands are enabled, text starting with "/" is run as a
+// command instead, unless files are posted with it.
+func (s *ChatService) SendMessage(p *models.Principal, draft ports.MessageDraft) (*models.Message, error) {
+	return s.SendMessageContext(context.Background(), p, draft)
+}
+
+// SendMessageContext is SendMessage with a context; cancelling it cancels a
+// command that is forwarded to a bot.
+func (s *ChatService) SendMessageContext(ctx context.Context, p *models.Principal, draft ports.MessageDraft) (*models.Message, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	if s.commands != nil && !p.IsWebhook() && len(draft.FileIDs) == 0 {
+		if input, ok := ParseCommand(draft.Text); ok {
+			return s.commands.Execute(ctx, s, p, draft.RoomID, input)
+		}
+		if text := strings.TrimSpace(draft.Text); strings.HasPrefix(text, "//") {
+			draft.Text = text[1:]
+		}
+	}
+	return s.post(p, draft)
+}
+
+// Roll rolls dice for the principal and posts the result with its Roll, so
+// clients can show every die and nobody can fake a result. A roll with
+// VisibleTo is hidden until revealed.
+func (s *ChatService) Roll(p *models.Principal, draft ports.RollDraft) (*models.Message, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, draft.RoomID); err != nil {
+		return nil, err
+	}
+	var roll *models.Roll
+	var err error
+	if draft.Skill != "" || draft.Character != "" || draft.CharacterID != 0 {
+		roll, err = s.check(p, draft)
+	} else {
+		roll, err = s.dice.Roll(draft.Dice, draft.Label)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgDraft := ports.MessageDraft{
+		RoomID:    draft.RoomID,
+		Text:      describeRoll(roll),
+		Kind:      models.MessageKindRoll,
+		Roll:      roll,
+		VisibleTo: draft.VisibleTo,
+	}
+	if roll.Check != nil {
+		msgDraft.CharacterID = roll.Check.CharacterID
+	}
+	return s.post(p, msgDraft)
+}
+
+// check rolls against a skill of a character the principal plays.
+func (s *ChatService) check(p *models.Principal, draft ports.RollDraft) (*models.Roll, error) {
+	if s.sheets == nil {
+		return nil, fmt.Errorf("%w: character sheets are disabled, so skills cannot be rolled", ErrInvalidInput)
+	}
+	character, skill, target, err := s.sheets.Skill(p, draft.RoomID, draft.CharacterID, draft.Character, draft.Skill)
+	if err != nil {
+		return nil, err
+	}
+	dice := draft.Dice
+	if dice == "" {
+		dice = "d100"
+	}
+	roll, err := s.dice.Check(dice, skill, target)
+	if err != nil {
+		return nil, err
+	}
+	roll.Check.CharacterID, roll.Check.Character = character.ID, character.Name
+	return roll, nil
+}
+
+// post validates, stores and broadcasts a message without looking for commands.
+func (s *ChatService) post(p *models.Principal, draft ports.MessageDraft) (*models.Message, error) {
+	text, attachments, err := validateContent(draft.Text, draft.Attachments, len(draft.FileIDs) > 0)
+	if err != nil {
+		return nil, err
+	}
+	format, err := validateFormat(draft.Format)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, draft.RoomID); err != nil {
+		return nil, err
+	}
+	files, err := s.claimFiles(p, draft)
+	if err != nil {
+		return nil, err
+	}
+	visibleTo, err := s.visibility(p, draft.RoomID, draft.VisibleTo)
+	if err != nil {
+		return nil, err
+	}
+	speaker, err := s.speaker(p, draft.RoomID, draft.CharacterID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &models.Message{
+		RoomID:      draft.RoomID,
+		UserID:      p.ID,
+		User:        p.DisplayName,
+		AuthorType:  p.Type,
+		Kind:        draft.Kind,
+		Text:        text,
+		Format:      format,
+		HTML:        messageHTML(format, text),
+		Attachments: attachments,
+		Files:       files,
+		Roll:        draft.Roll,
+		Character:   speaker,
+		InCharacter: draft.InCharacter || speaker != nil,
+		VisibleTo:   visibleTo,
+		Timestamp:   s.now().UTC(),
+	}
+	if err := s.messages.CreateMessage(msg); err != nil {
+		return nil, fmt.Errorf("saving message from %s: %w", p.ID, err)
+	}
+	if len(files) > 0 {
+		if err := s.files.attach(msg); err != nil {
+			return nil, err
+		}
+	}
+	s.events.Publish(messageEvent(models.EventMessageCreated, msg))
+	return msg, nil
+}
+
+// claimFiles returns the files a draft is posted with.
+func (s *ChatService) claimFiles(p *models.Principal, draft ports.MessageDraft) ([]models.File, error) {
+	if len(draft.FileIDs) == 0 {
+		return nil, nil
+	}
+	if s.files == nil {
+		return nil, fmt.Errorf("%w: uploads are disabled", ErrInvalidInput)
+	}
+	return s.files.claim(p, draft.RoomID, draft.FileIDs)
+}
+
+// speaker returns the character a message is posted as, or nil for none.
+func (s *ChatService) speaker(p *models.Principal, roomID, characterID int64) (*models.Speaker, error) {
+	if characterID == 0 {
+		return nil, nil
+	}
+	if s.sheets == nil {
+		return nil, fmt.Errorf("%w: characters are disabled", ErrInvalidInput)
+	}
+	character, err := s.sheets.Speaker(p, roomID, characterID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Speaker{ID: character.ID, Name: character.Name, AvatarURL: character.AvatarURL}, nil
+}
+
+// visibility checks that everyone a message is shown to is a member of the
+// room and adds the author. It returns nil for messages visible to everyone.
+func (s *ChatService) visibility(p *models.Principal, roomID int64, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > MaxVisibleTo {
+		return nil, fmt.Errorf("%w: a message can be shown to at most %d members", ErrInvalidInput, MaxVisibleTo)
+	}
+	visible := []string{p.ID}
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || slices.Contains(visible, id) {
+			continue
+		}
+		member, err := s.rooms.GetMember(roomID, id)
+		if err != nil {
+			return nil, fmt.Errorf("looking up membership of %s in room %d: %w", id, roomID, err)
+		}
+		if member == nil {
+			return nil, fmt.Errorf("%w: %s is not a member of this room", ErrInvalidInput, id)
+		}
+		visible = append(visible, id)
+	}
+	return visible, nil
+}
+
+// messageEvent builds the event of a message change, addressed to the
+// principals who may see the message.
+func messageEvent(eventType string, msg *models.Message) models.Event {
+	return models.Event{Type: eventType, RoomID: msg.RoomID, Message: msg, Recipients: msg.VisibleTo}
+}
+
+// Announce stores a message from the server itself and broadcasts it to the room.
+func (s *ChatService) Announce(roomID int64, text string) (*models.Message, error) {
+	text, _, err := validateContent(text, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	room, err := s.rooms.GetRoom(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up room %d: %w", roomID, err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	msg := &models.Message{
+		RoomID:     roomID,
+		User:       "Keeper",
+		AuthorType: models.AuthorTypeSystem,
+		Text:       text,
+		Timestamp:  s.now().UTC(),
+	}
+	if err := s.messages.CreateMessage(msg); err != nil {
+		return nil, fmt.Errorf("saving announcement in room %d: %w", roomID, err)
+	}
+	s.events.Publish(messageEvent(models.EventMessageCreated, msg))
+	return msg, nil
+}
+
+// whisper shows a message to the recipient only. It is not stored. A nil
+// author means the server itself.
+func (s *ChatService) whisper(recipient, author *models.Principal, roomID int64, text string, attachments []models.Attachment) *models.Message {
+	msg := &models.Message{
+		RoomID:      roomID,
+		User:        "Keeper",
+		AuthorType:  models.AuthorTypeSystem,
+		Text:        text,
+		Attachments: attachments,
+		Timestamp:   s.now().UTC(),
+		Ephemeral:   true,
+	}
+	if author != nil {
+		msg.UserID, msg.User, msg.AuthorType = author.ID, author.DisplayName, author.Type
+	}
+	s.events.Publish(models.Event{Type: models.EventMessageEphemeral, RoomID: roomID, Message: msg, Recipients: []string{recipient.ID}})
+	return msg
+}
+
+// SetTopic changes the topic of a room and publishes room.updated. Only
+// owners can change the topic.
+func (s *ChatService) SetTopic(p *models.Principal, roomID int64, topic string) (*models.Room, error) {
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only room owners can change the topic", ErrForbidden)
+	}
+	topic = strings.TrimSpace(topic)
+	if len(topic) > MaxTopicLength {
+		return nil, fmt.Errorf("%w: topic exceeds %d bytes", ErrInvalidInput, MaxTopicLength)
+	}
+	room, err := s.rooms.GetRoom(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up room %d: %w", roomID, err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	room.Topic = topic
+	if err := s.rooms.UpdateRoom(room); err != nil {
+		return nil, fmt.Errorf("updating room %d: %w", roomID, err)
+	}
+	s.events.Publish(models.Event{Type: models.EventRoomUpdated, RoomID: roomID, Room: room})
+	return room, nil
+}
+
+// EditMessage replaces the text of one of the principal's own messages.
+func (s *ChatService) EditMessage(p *models.Principal, roomID, messageID int64, text string) (*models.Message, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	text, err := validateMessageText(text)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.getMessage(p, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.UserID != p.ID {
+		return nil, fmt.Errorf("%w: only the author can edit a message", ErrForbidden)
+	}
+	if msg.Roll != nil {
+		return nil, fmt.Errorf("%w: rolls cannot be edited", ErrForbidden)
+	}
+	if _, err := s.authz.RoomMember(p, msg.RoomID); err != nil {
+		return nil, err
+	}
+
+	editedAt := s.now().UTC()
+	msg.Text = text
+	msg.HTML = messageHTML(msg.Format, text)
+	msg.EditedAt = &editedAt
+	if err := s.messages.UpdateMessage(msg); err != nil {
+		return nil, fmt.Errorf("updating message %d: %w", messageID, err)
+	}
+	s.events.Publish(messageEvent(models.EventMessageUpdated, msg))
+	return msg, nil
+}
+
+// DeleteMessage deletes a message. Authors can delete their own messages and
+// room owners any message in their room.
+func (s *ChatService) DeleteMessage(p *models.Principal, roomID, messageID int64) error {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return err
+	}
+	msg, err := s.getMessage(p, roomID, messageID)
+	if err != nil {
+		return err
+	}
+	member, err := s.authz.RoomMember(p, msg.RoomID)
+	if err != nil {
+		return err
+	}
+	if msg.UserID != p.ID && member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: only the author or a room owner can delete a message", ErrForbidden)
+	}
+
+	if err := s.messages.DeleteMessage(messageID); err != nil {
+		return fmt.Errorf("deleting message %d: %w", messageID, err)
+	}
+	if len(msg.Files) > 0 && s.files != nil {
+		s.files.deleteMessageFiles(messageID)
+	}
+	s.events.Publish(models.Event{Type: models.EventMessageDeleted, RoomID: msg.RoomID, MessageID: messageID, Recipients: msg.VisibleTo})
+	return nil
+}
+
+// RevealMessage shows a whisper or hidden roll to the whole room and
+// publishes message.revealed. The author and room owners who can see the
+// message may reveal it.
+func (s *ChatService) RevealMessage(p *models.Principal, roomID, messageID int64) (*models.Message, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	msg, err := s.getMessage(p, roomID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.authz.RoomMember(p, msg.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.UserID != p.ID && member.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only the author or a room owner can reveal a message", ErrForbidden)
+	}
+	if len(msg.VisibleTo) == 0 {
+		return nil, fmt.Errorf("%w: the message is already visible to everyone", ErrInvalidInput)
+	}
+
+	revealedAt := s.now().UTC()
+	msg.VisibleTo = nil
+	msg.RevealedAt = &revealedAt
+	if err := s.messages.UpdateMessage(msg); err != nil {
+		return nil, fmt.Errorf("revealing message %d: %w", messageID, err)
+	}
+	s.events.Publish(messageEvent(models.EventMessageRevealed, msg))
+	return msg, nil
+}
+
+// getMessage loads a message the principal may see, checking that it belongs
+// to roomID unless that is 0. Hidden messages are reported as not found.
+func (s *ChatService) getMessage(p *models.Principal, roomID, messageID int64) (*models.Message, error) {
+	msg, err := s.messages.GetMessage(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up message %d: %w", messageID, err)
+	}
+	if msg == nil || (roomID != 0 && msg.RoomID != roomID) || !msg.IsVisibleTo(p.ID) {
+		return nil, ErrMessageNotFound
+	}
+	return msg, nil
+}
+
+// validateContent checks the text and attachments of a message. The text may
+// only be empty if there are attachments or files.
+func validateContent(text string, attachments []models.Attachment, withFiles bool) (string, []models.Attachment, error) {
+	attachments, err := validateAttachments(attachments)
+	if err != nil {
+		return "", nil, err
+	}
+	text = strings.TrimSpace(text)
+	if text != "" || (len(attachments) == 0 && !withFiles) {
+		if text, err = validateMessageText(text); err != nil {
+			return "", nil, err
+		}
+	}
+	return text, attachments, nil
+}
+
+// validateAttachments trims the attachments and checks their sizes, links and colors.
+func validateAttachments(attachments []models.Attachment) ([]models.Attachment, error) {
+	if len(attachments) > MaxAttachments {
+		return nil, fmt.Errorf("%w: a message can have at most %d attachments", ErrInvalidInput, MaxAttachments)
+	}
+	var valid []models.Attachment
+	for i, a := range attachments {
+		a = models.Attachment{
+			Title: strings.TrimSpace(a.Title),
+			URL:   strings.TrimSpace(a.URL),
+			Text:  strings.TrimSpace(a.Text),
+			Color: strings.TrimSpace(a.Color),
+		}
+		if a.Title == "" && a.Text == "" {
+			return nil, fmt.Errorf("%w: attachment %d needs a title or text", ErrInvalidInput, i+1)
+		}
+		if len(a.Title) > maxAttachmentTitleLength || len(a.Text) > MaxMessageLength {
+			return nil, fmt.Errorf("%w: attachment %d is too long", ErrInvalidInput, i+1)
+		}
+		if a.URL != "" {
+			link, err := url.Parse(a.URL)
+			if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+				return nil, fmt.Errorf("%w: attachment %d url must be an absolute http or https URL", ErrInvalidInput, i+1)
+			}
+		}
+		if a.Color != "" && !hexColor.MatchString(a.Color) {
+			return nil, fmt.Errorf("%w: attachment %d color must look like #1f883d", ErrInvalidInput, i+1)
+		}
+		valid = append(valid, a)
+	}
+	return valid, nil
+}
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// validateFormat checks the format of a message. Plain text is stored as "".
+func validateFormat(format string) (string, error) {
+	switch format {
+	case "", models.MessageFormatPlain:
+		return "", nil
+	case models.MessageFormatMarkdown:
+		return format, nil
+	}
+	return "", fmt.Errorf("%w: format must be plain or markdown", ErrInvalidInput)
+}
+
+// messageHTML renders the text of a message in its format. Only Markdown
+// has HTML.
+func messageHTML(format, text string) string {
+	if format != models.MessageFormatMarkdown || text == "" {
+		return ""
+	}
+	return RenderMarkdown(text)
+}
+
+func validateMessageText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("%w: message text is required", ErrInvalidInput)
+	}
+	if len(text) > MaxMessageLength {
+		return "", fmt.Errorf("%w: message text exceeds %d bytes", ErrInvalidInput, MaxMessageLength)
+	}
+	return text, nil
+}
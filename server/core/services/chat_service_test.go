@@ -0,0 +1,481 @@
+package services_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// fakeMessages is an in-memory ports.MessageRepository.
+type fakeMessages struct {
+	messages map[int64]*models.Message
+	nextID   int64
+}
+
+func (f *fakeMessages) SaveMessage(msg models.Message) error { return f.CreateMessage(&msg) }
+
+func (f *fakeMessages) CreateMessage(msg *models.Message) error {
+	f.nextID++
+	msg.ID = f.nextID
+	stored := *msg
+	f.messages[msg.ID] = &stored
+	return nil
+}
+
+func (f *fakeMessages) GetMessages() ([]models.Message, error) {
+	return f.ListMessages(ports.MessageQuery{})
+}
+
+func (f *fakeMessages) GetMessage(id int64) (*models.Message, error) {
+	msg, ok := f.messages[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *msg
+	return &copied, nil
+}
+
+func (f *fakeMessages) ListMessages(query ports.MessageQuery) ([]models.Message, error) {
+	var out []models.Message
+	for id := int64(1); id <= f.nextID; id++ {
+		msg, ok := f.messages[id]
+		if ok && (query.RoomID == 0 || msg.RoomID == query.RoomID) && (query.Viewer == "" || msg.IsVisibleTo(query.Viewer)) &&
+			(!query.InCharacter || msg.InCharacter) && (query.BeforeID == 0 || id < query.BeforeID) && id > query.AfterID {
+			out = append(out, *msg)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeMessages) UpdateMessage(msg *models.Message) error {
+	stored := *msg
+	f.messages[msg.ID] = &stored
+	return nil
+}
+
+func (f *fakeMessages) SetMessagePreviews(id int64, previews []models.LinkPreview) error {
+	if msg, ok := f.messages[id]; ok {
+		msg.Previews = previews
+	}
+	return nil
+}
+
+func (f *fakeMessages) DeleteMessage(id int64) error {
+	delete(f.messages, id)
+	return nil
+}
+
+// fakeRooms is an in-memory ports.RoomRepository.
+type fakeRooms struct {
+	rooms   []models.Room
+	members []models.RoomMember
+}
+
+func (f *fakeRooms) CreateRoom(room *models.Room) error {
+	room.ID = int64(len(f.rooms) + 1)
+	f.rooms = append(f.rooms, *room)
+	return nil
+}
+
+func (f *fakeRooms) GetRoom(id int64) (*models.Room, error) {
+	for _, room := range f.rooms {
+		if room.ID == id {
+			return &room, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRooms) GetRoomByName(name string) (*models.Room, error) {
+	for _, room := range f.rooms {
+		if room.Name == name {
+			return &room, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRooms) UpdateRoom(room *models.Room) error {
+	for i := range f.rooms {
+		if f.rooms[i].ID == room.ID {
+			f.rooms[i] = *room
+		}
+	}
+	return nil
+}
+
+func (f *fakeRooms) ListRooms() ([]models.Room, error) { return f.rooms, nil }
+
+func (f *fakeRooms) ListRoomsForMember(userID string) ([]models.Room, error) {
+	var out []models.Room
+	for _, m := range f.members {
+		if m.UserID == userID {
+			room, _ := f.GetRoom(m.RoomID)
+			out = append(out, *room)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRooms) AddMember(member models.RoomMember) error {
+	for i, m := range f.members {
+		if m.RoomID == member.RoomID && m.UserID == member.UserID {
+			f.members[i].Role = member.Role
+			return nil
+		}
+	}
+	f.members = append(f.members, member)
+	return nil
+}
+
+func (f *fakeRooms) GetMember(roomID int64, userID string) (*models.RoomMember, error) {
+	for _, m := range f.members {
+		if m.RoomID == roomID && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRooms) ListMembers(roomID int64) ([]models.RoomMember, error) {
+	var out []models.RoomMember
+	for _, m := range f.members {
+		if m.RoomID == roomID {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// fakeAuthorizer grants fixed roles in room 1, which is the only room.
+type fakeAuthorizer struct {
+	roles map[string]string // principal ID -> role
+}
+
+func (f *fakeAuthorizer) RoomMember(p *models.Principal, roomID int64) (*models.RoomMember, error) {
+	if roomID != 1 {
+		return nil, services.ErrRoomNotFound
+	}
+	role, ok := f.roles[p.ID]
+	if !ok {
+		return nil, services.ErrNotRoomMember
+	}
+	return &models.RoomMember{RoomID: roomID, UserID: p.ID, Role: role}, nil
+}
+
+// fakePublisher records published events.
+type fakePublisher struct {
+	events []models.Event
+}
+
+func (f *fakePublisher) Publish(event models.Event) {
+	f.events = append(f.events, event)
+}
+
+var (
+	owner  = &models.Principal{ID: "owner-id", Type: models.AuthorTypeUser, DisplayName: "Owner"}
+	member = &models.Principal{ID: "member-id", Type: models.AuthorTypeUser, DisplayName: "Member"}
+	bot    = &models.Principal{ID: "sa_bot", Type: models.AuthorTypeBot, DisplayName: "bot", Scopes: []string{models.ScopeMessagesRead}}
+	hermit = &models.Principal{ID: "hermit-id", Type: models.AuthorTypeUser, DisplayName: "Hermit"}
+)
+
+func newTestChatService() (*services.ChatService, *fakeMessages, *fakePublisher) {
+	messages := &fakeMessages{messages: map[int64]*models.Message{}}
+	authz := &fakeAuthorizer{roles: map[string]string{
+		owner.ID:  models.RoomRoleOwner,
+		member.ID: models.RoomRoleMember,
+		bot.ID:    models.RoomRoleMember,
+	}}
+	publisher := &fakePublisher{}
+	return services.NewChatService(messages, &fakeRooms{}, authz, publisher), messages, publisher
+}
+
+func TestChatService_PostMessage_PublishesEvent(t *testing.T) {
+	svc, messages, publisher := newTestChatService()
+
+	msg, err := svc.PostMessage(member, 1, "  Hello  ")
+	if err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+	if msg.Text != "Hello" || msg.UserID != member.ID || msg.AuthorType != models.AuthorTypeUser {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+	if stored, _ := messages.GetMessage(msg.ID); stored == nil {
+		t.Error("Expected the message to be stored")
+	}
+	if len(publisher.events) != 1 || publisher.events[0].Type != models.EventMessageCreated || publisher.events[0].Message.ID != msg.ID {
+		t.Errorf("Expected one message.created event, got %+v", publisher.events)
+	}
+}
+
+func TestChatService_PostMessage_Rejected(t *testing.T) {
+	svc, _, publisher := newTestChatService()
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		roomID    int64
+		text      string
+		want      error
+	}{
+		{"empty text", member, 1, "   ", services.ErrInvalidInput},
+		{"text too long", member, 1, strings.Repeat("x", services.MaxMessageLength+1), services.ErrInvalidInput},
+		{"not a member", hermit, 1, "hi", services.ErrNotRoomMember},
+		{"missing room", member, 2, "hi", services.ErrRoomNotFound},
+		{"bot without write scope", bot, 1, "hi", services.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.PostMessage(tt.principal, tt.roomID, tt.text); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no events for rejected messages, got %+v", publisher.events)
+	}
+}
+
+func TestChatService_EditMessage_OnlyAuthor(t *testing.T) {
+	svc, _, publisher := newTestChatService()
+	msg, err := svc.PostMessage(member, 1, "typo")
+	if err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+
+	if _, err := svc.EditMessage(owner, 1, msg.ID, "fixed"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when the owner edits someone else's message, got %v", err)
+	}
+	if _, err := svc.EditMessage(member, 2, msg.ID, "fixed"); !errors.Is(err, services.ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound for a message of another room, got %v", err)
+	}
+
+	edited, err := svc.EditMessage(member, 0, msg.ID, "fixed")
+	if err != nil {
+		t.Fatalf("EditMessage() failed: %v", err)
+	}
+	if edited.Text != "fixed" || edited.EditedAt == nil {
+		t.Errorf("Expected edited text and timestamp, got %+v", edited)
+	}
+	last := publisher.events[len(publisher.events)-1]
+	if last.Type != models.EventMessageUpdated || last.Message.Text != "fixed" {
+		t.Errorf("Expected message.updated, got %+v", last)
+	}
+}
+
+func TestChatService_SendMessage_Markdown(t *testing.T) {
+	svc, messages, publisher := newTestChatService()
+
+	msg, err := svc.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "**Run!** <script>", Format: models.MessageFormatMarkdown})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if msg.Format != models.MessageFormatMarkdown || msg.HTML != "<p><strong>Run!</strong> &lt;script&gt;</p>" || messages.messages[msg.ID].HTML != msg.HTML {
+		t.Errorf("Expected rendered and stored HTML, got %+v", msg)
+	}
+	edited, err := svc.EditMessage(member, 1, msg.ID, "*Hide.*")
+	if err != nil {
+		t.Fatalf("EditMessage() failed: %v", err)
+	}
+	if edited.HTML != "<p><em>Hide.</em></p>" || publisher.events[len(publisher.events)-1].Message.HTML != edited.HTML {
+		t.Errorf("Expected the edit to be rendered again, got %+v", edited)
+	}
+
+	plain, err := svc.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "**as is**", Format: models.MessageFormatPlain})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if plain.Format != "" || plain.HTML != "" {
+		t.Errorf("Expected plain text without HTML, got %+v", plain)
+	}
+	if _, err := svc.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "<b>hi</b>", Format: "html"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown format, got %v", err)
+	}
+}
+
+func TestChatService_Roll_CannotBeEdited(t *testing.T) {
+	svc, messages, publisher := newTestChatService()
+	svc.SetDice(func(sides int) int { return 3 })
+
+	msg, err := svc.Roll(member, ports.RollDraft{RoomID: 1, Dice: "2d6+1", Label: "Dodge"})
+	if err != nil {
+		t.Fatalf("Roll() failed: %v", err)
+	}
+	if msg.Kind != models.MessageKindRoll || msg.Roll == nil || msg.Roll.Total != 7 || messages.messages[msg.ID].Roll != msg.Roll {
+		t.Errorf("Expected a stored roll totalling 7, got %+v", msg)
+	}
+	if last := publisher.events[len(publisher.events)-1]; last.Message.Roll == nil {
+		t.Errorf("Expected the roll to be broadcast, got %+v", last)
+	}
+	if _, err := svc.EditMessage(member, 1, msg.ID, "rolled 2d6+1: [6, 6] + 1 = 13"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when editing a roll, got %v", err)
+	}
+	if _, err := svc.Roll(hermit, ports.RollDraft{RoomID: 1, Dice: "d20"}); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Expected ErrNotRoomMember, got %v", err)
+	}
+}
+
+func TestChatService_Whispers(t *testing.T) {
+	chat, _, _, publisher := newTestCommandRegistry(t)
+	// The dice bot is the third member of room 1, left out of the whisper.
+	bystander := &models.Principal{ID: diceBot.ID, Type: models.AuthorTypeBot, Scopes: []string{models.ScopeMessagesRead, models.ScopeMessagesWrite}}
+
+	whisper, err := chat.SendMessage(owner, ports.MessageDraft{RoomID: 1, Text: "You hear scratching behind the wall.", VisibleTo: []string{member.ID}})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if !reflect.DeepEqual(whisper.VisibleTo, []string{owner.ID, member.ID}) {
+		t.Errorf("Expected the whisper to be visible to the owner and member, got %v", whisper.VisibleTo)
+	}
+	if last := publisher.events[len(publisher.events)-1]; !reflect.DeepEqual(last.Recipients, whisper.VisibleTo) {
+		t.Errorf("Expected message.created for the owner and member only, got %+v", last)
+	}
+	if _, err := chat.SendMessage(owner, ports.MessageDraft{RoomID: 1, Text: "psst", VisibleTo: []string{hermit.ID}}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a whisper to a non-member, got %v", err)
+	}
+
+	for p, want := range map[*models.Principal]int{owner: 1, member: 1, bystander: 0} {
+		history, err := chat.History(p, ports.MessageQuery{RoomID: 1})
+		if err != nil || len(history) != want {
+			t.Errorf("Expected %s to see %d messages, got %+v, %v", p.ID, want, history, err)
+		}
+	}
+	if _, err := chat.EditMessage(bystander, 1, whisper.ID, "peek"); !errors.Is(err, services.ErrMessageNotFound) {
+		t.Errorf("Expected the whisper to be hidden from the bystander, got %v", err)
+	}
+	if _, err := chat.RevealMessage(member, 1, whisper.ID); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a recipient reveals someone else's whisper, got %v", err)
+	}
+
+	revealed, err := chat.RevealMessage(owner, 1, whisper.ID)
+	if err != nil {
+		t.Fatalf("RevealMessage() failed: %v", err)
+	}
+	if revealed.VisibleTo != nil || revealed.RevealedAt == nil {
+		t.Errorf("Expected the whisper to be public, got %+v", revealed)
+	}
+	if last := publisher.events[len(publisher.events)-1]; last.Type != models.EventMessageRevealed || last.Recipients != nil {
+		t.Errorf("Expected message.revealed for the whole room, got %+v", last)
+	}
+	if history, _ := chat.History(bystander, ports.MessageQuery{RoomID: 1}); len(history) != 1 {
+		t.Errorf("Expected the bystander to see the revealed whisper, got %+v", history)
+	}
+	if _, err := chat.RevealMessage(owner, 1, whisper.ID); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput when revealing twice, got %v", err)
+	}
+}
+
+func TestChatService_DeleteMessage_AuthorOrOwner(t *testing.T) {
+	svc, messages, publisher := newTestChatService()
+	first, _ := svc.PostMessage(member, 1, "one")
+	second, _ := svc.PostMessage(owner, 1, "two")
+
+	if err := svc.DeleteMessage(member, 1, second.ID); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a member deletes the owner's message, got %v", err)
+	}
+	if err := svc.DeleteMessage(owner, 1, first.ID); err != nil {
+		t.Fatalf("Expected the owner to delete any message, got %v", err)
+	}
+	if err := svc.DeleteMessage(owner, 1, first.ID); !errors.Is(err, services.ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound deleting twice, got %v", err)
+	}
+	if stored, _ := messages.GetMessage(first.ID); stored != nil {
+		t.Error("Expected the message to be deleted")
+	}
+	last := publisher.events[len(publisher.events)-1]
+	if last.Type != models.EventMessageDeleted || last.MessageID != first.ID {
+		t.Errorf("Expected message.deleted, got %+v", last)
+	}
+}
+
+func TestChatService_History_RequiresMembershipAndScope(t *testing.T) {
+	svc, _, _ := newTestChatService()
+	svc.PostMessage(member, 1, "hello")
+
+	history, err := svc.History(bot, ports.MessageQuery{RoomID: 1})
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected the bot to read one message, got %v, %v", history, err)
+	}
+	if _, err := svc.History(hermit, ports.MessageQuery{RoomID: 1}); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Expected ErrNotRoomMember, got %v", err)
+	}
+	writeOnly := &models.Principal{ID: bot.ID, Type: models.AuthorTypeBot, Scopes: []string{models.ScopeMessagesWrite}}
+	if _, err := svc.History(writeOnly, ports.MessageQuery{RoomID: 1}); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without messages:read, got %v", err)
+	}
+}
+
+func TestChatService_ListRooms_RequiresScope(t *testing.T) {
+	svc, _, _ := newTestChatService()
+
+	if _, err := svc.ListRooms(bot); err != nil {
+		t.Fatalf("Expected a bot with messages:read to list its rooms, got %v", err)
+	}
+	writeOnly := &models.Principal{ID: bot.ID, Type: models.AuthorTypeBot, Scopes: []string{models.ScopeMessagesWrite}}
+	if _, err := svc.ListRooms(writeOnly); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without messages:read, got %v", err)
+	}
+}
+
+func TestChatService_CreateRoom(t *testing.T) {
+	svc, _, _ := newTestChatService()
+
+	room, err := svc.CreateRoom(owner, " table ")
+	if err != nil {
+		t.Fatalf("CreateRoom() failed: %v", err)
+	}
+	if room.Name != "table" || room.CreatedBy != owner.ID {
+		t.Errorf("Unexpected room: %+v", room)
+	}
+	if _, err := svc.CreateRoom(member, "table"); !errors.Is(err, services.ErrRoomExists) {
+		t.Errorf("Expected ErrRoomExists, got %v", err)
+	}
+	if _, err := svc.CreateRoom(bot, "bots"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for service accounts, got %v", err)
+	}
+}
+
+func TestChatService_AddMember_PublishesJoinOnce(t *testing.T) {
+	svc, _, publisher := newTestChatService()
+
+	if _, err := svc.AddMember(member, 1, "new-id", ""); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a member adds members, got %v", err)
+	}
+	if _, err := svc.AddMember(owner, 1, "new-id", ""); err != nil {
+		t.Fatalf("AddMember() failed: %v", err)
+	}
+	if _, err := svc.AddMember(owner, 1, "new-id", models.RoomRoleOwner); err != nil {
+		t.Fatalf("AddMember() to change the role failed: %v", err)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].Type != models.EventMemberJoined || publisher.events[0].Member.UserID != "new-id" {
+		t.Errorf("Expected a single member.joined event, got %+v", publisher.events)
+	}
+}
+
+func TestChatService_SendMessage_Attachments(t *testing.T) {
+	svc, _, _ := newTestChatService()
+
+	msg, err := svc.SendMessage(member, ports.MessageDraft{
+		RoomID:      1,
+		Attachments: []models.Attachment{{Title: " Build #42 ", URL: "https://ci.example.com/42", Color: "#1f883d"}},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if msg.Text != "" || len(msg.Attachments) != 1 || msg.Attachments[0].Title != "Build #42" {
+		t.Errorf("Expected a message with one trimmed attachment, got %+v", msg)
+	}
+
+	tooMany := make([]models.Attachment, services.MaxAttachments+1)
+	for i := range tooMany {
+		tooMany[i].Title = "x"
+	}
+	if _, err := svc.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "hi", Attachments: tooMany}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for too many attachments, got %v", err)
+	}
+}
@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// EventCommandInvoked is the X-Keeper-Event header of requests to bot commands.
+const EventCommandInvoked = "command.invoked"
+
+const (
+	commandTimeout          = 5 * time.Second
+	maxCommandResponseBytes = 64 << 10
+	maxCommandTextLength    = 256 // Usage and description, in bytes
+)
+
+// Errors returned when bots manage their commands.
+var (
+	ErrCommandExists   = errors.New("a command with that name already exists")
+	ErrCommandNotFound = errors.New("command not found")
+)
+
+// commandName is the syntax of command names, after lower-casing.
+var commandName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// CommandInput is a parsed slash command.
+type CommandInput struct {
+	Name string   // Lower case, without the slash
+	Args []string // Words of the arguments; double quotes group words
+	Raw  string   // The arguments as typed, trimmed
+}
+
+// ParseCommand parses text of the form "/name args...". It reports false for
+// text that is not a command, such as "//" escapes or paths like "/usr/bin".
+func ParseCommand(text string) (CommandInput, bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") || strings.HasPrefix(text, "//") {
+		return CommandInput{}, false
+	}
+	name, raw := text[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, raw = name[:i], strings.TrimSpace(name[i:])
+	}
+	name = strings.ToLower(name)
+	if !commandName.MatchString(name) {
+		return CommandInput{}, false
+	}
+	return CommandInput{Name: name, Args: splitArgs(raw), Raw: raw}, true
+}
+
+// splitArgs splits s on white space, keeping words in double quotes together.
+// An unterminated quote extends to the end.
+func splitArgs(s string) []string {
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args
+}
+
+// CommandContext is what a built-in command runs with.
+type CommandContext struct {
+	Context   context.Context // Cancelled when the caller goes away
+	Chat      *ChatService
+	Principal *models.Principal
+	Member    *models.RoomMember // The principal's membership of the room
+	RoomID    int64
+	Input     CommandInput
+}
+
+// Post posts a message to the room as the principal. The text is not
+// checked for commands again.
+func (c *CommandContext) Post(draft ports.MessageDraft) (*models.Message, error) {
+	draft.RoomID = c.RoomID
+	return c.Chat.post(c.Principal, draft)
+}
+
+// Reply shows a message from the server to the principal only.
+func (c *CommandContext) Reply(format string, args ...interface{}) (*models.Message, error) {
+	return c.Chat.whisper(c.Principal, nil, c.RoomID, fmt.Sprintf(format, args...), nil), nil
+}
+
+// Command is a built-in slash command. Run returns the posted message, or an
+// ephemeral one from Reply.
+type Command struct {
+	Name        string
+	Usage       string // Arguments, e.g. "<user-id> [owner|member]"
+	Description string
+	MinArgs     int
+	OwnerOnly   bool
+	Run         func(ctx *CommandContext) (*models.Message, error)
+}
+
+// CommandInvocation is the JSON body POSTed to the URL of a bot command. It is
+// signed like an outgoing webhook, with the command's secret.
+type CommandInvocation struct {
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+	Text      string    `json:"text"` // The arguments as typed
+	RoomID    int64     `json:"room_id"`
+	UserID    string    `json:"user_id"`
+	User      string    `json:"user"`
+	InvokedAt time.Time `json:"invoked_at"`
+}
+
+// CommandResponse is the optional JSON answer of a bot command. It is posted
+// to the room as the bot, or only shown to the invoker if Ephemeral is set.
+type CommandResponse struct {
+	Text        string              `json:"text"`
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+	Ephemeral   bool                `json:"ephemeral,omitempty"`
+}
+
+// CommandRegistry runs slash commands: built-in ones added with Register, and
+// commands that bots registered over the API, which are forwarded to the
+// bot's URL in rooms the bot is a member of. Bots name their commands
+// independently; if several bots in a room register a name, the command
+// registered first is run. Like webhooks, bot URLs are only connected to at
+// public addresses.
+type CommandRegistry struct {
+	repo     ports.CommandRepository
+	accounts ports.ServiceAccountRepository
+	authz    ports.Authorizer
+	builtins map[string]Command
+	client   *http.Client
+	guard    *addressGuard
+	now      func() time.Time
+}
+
+// NewCommandRegistry creates a CommandRegistry with the built-in commands.
+func NewCommandRegistry(repo ports.CommandRepository, accounts ports.ServiceAccountRepository, authz ports.Authorizer) *CommandRegistry {
+	if repo == nil || accounts == nil || authz == nil {
+		log.Fatal("CommandRepository, ServiceAccountRepository and Authorizer cannot be nil in NewCommandRegistry")
+	}
+	guard := &addressGuard{}
+	r := &CommandRegistry{
+		repo:     repo,
+		accounts: accounts,
+		authz:    authz,
+		builtins: map[string]Command{},
+		client:   newGuardedClient(guard, commandTimeout, 0),
+		guard:    guard,
+		now:      time.Now,
+	}
+	registerBuiltinCommands(r)
+	return r
+}
+
+// SetAllowedNetworks lets bot commands be forwarded to these networks even
+// though they are not public, e.g. bots running next to the server.
+func (r *CommandRegistry) SetAllowedNetworks(networks []netip.Prefix) {
+	r.guard.allowed = networks
+}
+
+// Register adds a built-in command. Invalid or duplicate names are fatal.
+func (r *CommandRegistry) Register(cmd Command) {
+	if !commandName.MatchString(cmd.Name) || cmd.Run == nil {
+		log.Fatalf("Invalid built-in command /%s", cmd.Name)
+	}
+	if _, ok := r.builtins[cmd.Name]; ok {
+		log.Fatalf("Built-in command /%s registered twice", cmd.Name)
+	}
+	r.builtins[cmd.Name] = cmd
+}
+
+// Execute runs a command for the principal in a room. Cancelling ctx
+// cancels a request to the command's bot.
+func (r *CommandRegistry) Execute(ctx context.Context, chat *ChatService, p *models.Principal, roomID int64, input CommandInput) (*models.Message, error) {
+	member, err := r.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	cctx := &CommandContext{Context: ctx, Chat: chat, Principal: p, Member: member, RoomID: roomID, Input: input}
+
+	if cmd, ok := r.builtins[input.Name]; ok {
+		if cmd.OwnerOnly && member.Role != models.RoomRoleOwner {
+			return nil, fmt.Errorf("%w: /%s is for room owners", ErrForbidden, cmd.Name)
+		}
+		if len(input.Args) < cmd.MinArgs {
+			return nil, fmt.Errorf("%w: usage: /%s %s", ErrInvalidInput, cmd.Name, cmd.Usage)
+		}
+		return cmd.Run(cctx)
+	}
+	cmd, bot, err := r.roomBotCommand(input.Name, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if cmd == nil {
+		return nil, fmt.Errorf("%w: unknown command /%s, /help lists the commands of this room", ErrInvalidInput, input.Name)
+	}
+	return r.invoke(cctx, cmd, bot)
+}
+
+// RoomCommands returns the commands available in a room the principal is a
+// member of, ordered by name. URLs of bot commands are left out.
+func (r *CommandRegistry) RoomCommands(p *models.Principal, roomID int64) ([]models.Command, error) {
+	if _, err := r.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	commands := []models.Command{}
+	for _, cmd := range r.builtins {
+		commands = append(commands, models.Command{Name: cmd.Name, Usage: cmd.Usage, Description: cmd.Description})
+	}
+	registered, err := r.repo.ListCommands("")
+	if err != nil {
+		return nil, fmt.Errorf("listing commands: %w", err)
+	}
+	for i, cmd := range registered {
+		if i > 0 && registered[i-1].Name == cmd.Name {
+			continue // roomBotCommand looked at every command with this name
+		}
+		if roomCmd, _, err := r.roomBotCommand(cmd.Name, roomID); err != nil {
+			return nil, err
+		} else if roomCmd != nil {
+			roomCmd.URL = ""
+			commands = append(commands, *roomCmd)
+		}
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands, nil
+}
+
+// roomBotCommand returns the oldest registered command with that name whose
+// bot is an enabled member of the room, and the bot, or nils if there is none.
+func (r *CommandRegistry) roomBotCommand(name string, roomID int64) (*models.Command, *models.Principal, error) {
+	registered, err := r.repo.ListCommandsNamed(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("looking up command /%s: %w", name, err)
+	}
+	for i := range registered {
+		cmd := &registered[i]
+		account, err := r.accounts.GetServiceAccount(cmd.ServiceAccountID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("looking up service account %s: %w", cmd.ServiceAccountID, err)
+		}
+		if account == nil || account.DisabledAt != nil {
+			continue
+		}
+		bot := &models.Principal{ID: account.ID, Type: models.AuthorTypeBot, DisplayName: account.Name, Scopes: []string{models.ScopeMessagesWrite}}
+		if _, err := r.authz.RoomMember(bot, roomID); errors.Is(err, ErrNotRoomMember) {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		return cmd, bot, nil
+	}
+	return nil, nil, nil
+}
+
+// invoke forwards a command to its bot and posts or whispers the answer.
+// Failures of the bot are reported to the invoker only.
+func (r *CommandRegistry) invoke(ctx *CommandContext, cmd *models.Command, bot *models.Principal) (*models.Message, error) {
+	now := r.now().UTC()
+	body, err := json.Marshal(CommandInvocation{
+		Command:   cmd.Name,
+		Args:      append([]string{}, ctx.Input.Args...), // [] rather than null
+		Text:      ctx.Input.Raw,
+		RoomID:    ctx.RoomID,
+		UserID:    ctx.Principal.ID,
+		User:      ctx.Principal.DisplayName,
+		InvokedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding invocation of /%s: %w", cmd.Name, err)
+	}
+	req, err := http.NewRequestWithContext(ctx.Context, http.MethodPost, cmd.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("building request for /%s: %w", cmd.Name, err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Keeper-Commands/1")
+	req.Header.Set(WebhookEventHeader, EventCommandInvoked)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(cmd.Secret, timestamp, body))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		log.Printf("Command /%s of %s failed: %v", cmd.Name, cmd.ServiceAccountID, err)
+		return ctx.Reply("/%s did not respond, try again later.", cmd.Name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Command /%s of %s answered %s", cmd.Name, cmd.ServiceAccountID, resp.Status)
+		return ctx.Reply("/%s failed, try again later.", cmd.Name)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCommandResponseBytes))
+	if err != nil {
+		log.Printf("Reading the answer of /%s failed: %v", cmd.Name, err)
+		return ctx.Reply("/%s failed, try again later.", cmd.Name)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ctx.Reply("/%s %s", cmd.Name, ctx.Input.Raw) // The bot answers later, if at all
+	}
+	var answer CommandResponse
+	if err := json.Unmarshal(data, &answer); err != nil {
+		log.Printf("Command /%s of %s returned invalid JSON: %v", cmd.Name, cmd.ServiceAccountID, err)
+		return ctx.Reply("/%s returned an invalid answer.", cmd.Name)
+	}
+
+	if answer.Ephemeral {
+		text, attachments, err := validateContent(answer.Text, answer.Attachments, false)
+		if err != nil {
+			return nil, err
+		}
+		return ctx.Chat.whisper(ctx.Principal, bot, ctx.RoomID, text, attachments), nil
+	}
+	return ctx.Chat.post(bot, ports.MessageDraft{RoomID: ctx.RoomID, Text: answer.Text, Attachments: answer.Attachments})
+}
+
+// requireCommandBot fails unless the principal is a bot allowed to register commands.
+func requireCommandBot(p *models.Principal) error {
+	if !p.IsBot() {
+		return fmt.Errorf("%w: only service accounts can register commands", ErrForbidden)
+	}
+	return RequireScope(p, models.ScopeCommandsRegister)
+}
+
+// RegisterBotCommand registers a command of the principal's service account
+// for the rooms it is a member of. Other bots may use the same name.
+// Invocations are POSTed to rawURL, signed with the returned secret, which is
+// not shown again.
+func (r *CommandRegistry) RegisterBotCommand(p *models.Principal, name, usage, description, rawURL string) (*models.Command, string, error) {
+	if err := requireCommandBot(p); err != nil {
+		return nil, "", err
+	}
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "/"))
+	if !commandName.MatchString(name) {
+		return nil, "", fmt.Errorf("%w: name must be a letter followed by up to 31 letters, digits, - or _", ErrInvalidInput)
+	}
+	usage, description = strings.TrimSpace(usage), strings.TrimSpace(description)
+	if len(usage) > maxCommandTextLength || len(description) > maxCommandTextLength {
+		return nil, "", fmt.Errorf("%w: usage and description must be at most %d bytes", ErrInvalidInput, maxCommandTextLength)
+	}
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, "", fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidInput)
+	}
+	if _, ok := r.builtins[name]; ok {
+		return nil, "", ErrCommandExists
+	}
+	existing, err := r.repo.GetCommand(p.ID, name)
+	if err != nil {
+		return nil, "", fmt.Errorf("looking up command /%s: %w", name, err)
+	}
+	if existing != nil {
+		return nil, "", ErrCommandExists
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cmd := &models.Command{
+		Name:             name,
+		Usage:            usage,
+		Description:      description,
+		ServiceAccountID: p.ID,
+		URL:              target.String(),
+		Secret:           webhookSecretPrefix + secret,
+		CreatedAt:        r.now().UTC(),
+	}
+	if err := r.repo.CreateCommand(cmd); err != nil {
+		return nil, "", fmt.Errorf("creating command /%s: %w", name, err)
+	}
+	return cmd, cmd.Secret, nil
+}
+
+// ListBotCommands returns the commands of the principal's service account.
+func (r *CommandRegistry) ListBotCommands(p *models.Principal) ([]models.Command, error) {
+	if err := requireCommandBot(p); err != nil {
+		return nil, err
+	}
+	return r.repo.ListCommands(p.ID)
+}
+
+// DeleteBotCommand deletes a command of the principal's service account.
+func (r *CommandRegistry) DeleteBotCommand(p *models.Principal, name string) error {
+	if err := requireCommandBot(p); err != nil {
+		return err
+	}
+	cmd, err := r.repo.GetCommand(p.ID, strings.ToLower(name))
+	if err != nil {
+		return fmt.Errorf("looking up command /%s: %w", name, err)
+	}
+	if cmd == nil {
+		return ErrCommandNotFound
+	}
+	if err := r.repo.DeleteCommand(cmd.ID); err != nil {
+		return fmt.Errorf("deleting command /%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	commandssqlite "keeper/server/adapters/commands/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// diceBot may register commands and is a member of room 1.
+var diceBot = &models.Principal{ID: "sa_dice", Type: models.AuthorTypeBot, DisplayName: "dice-bot", Scopes: []string{models.ScopeCommandsRegister}}
+
+// mapBot may register commands and is not a member of any room.
+var mapBot = &models.Principal{ID: "sa_map", Type: models.AuthorTypeBot, DisplayName: "map-bot", Scopes: []string{models.ScopeCommandsRegister}}
+
+func newTestCommandRegistry(t *testing.T) (*services.ChatService, *services.CommandRegistry, *fakeRooms, *fakePublisher) {
+	t.Helper()
+	db := newTestDB(t)
+
+	accounts := authsqlite.NewSQLiteServiceAccountRepository(db)
+	if err := accounts.InitServiceAccountSchema(); err != nil {
+		t.Fatalf("InitServiceAccountSchema() failed: %v", err)
+	}
+	for _, bot := range []*models.Principal{diceBot, mapBot} {
+		if err := accounts.CreateServiceAccount(models.ServiceAccount{ID: bot.ID, Name: bot.DisplayName, CreatedAt: time.Now().UTC()}); err != nil {
+			t.Fatalf("CreateServiceAccount() failed: %v", err)
+		}
+	}
+	commands := commandssqlite.NewSQLiteCommandRepository(db)
+	if err := commands.InitCommandSchema(); err != nil {
+		t.Fatalf("InitCommandSchema() failed: %v", err)
+	}
+
+	rooms := &fakeRooms{
+		rooms: []models.Room{{ID: 1, Name: "table"}, {ID: 2, Name: "other"}},
+		members: []models.RoomMember{
+			{RoomID: 1, UserID: owner.ID, Role: models.RoomRoleOwner},
+			{RoomID: 1, UserID: member.ID, Role: models.RoomRoleMember},
+			{RoomID: 1, UserID: diceBot.ID, Role: models.RoomRoleMember},
+			{RoomID: 2, UserID: owner.ID, Role: models.RoomRoleOwner},
+		},
+	}
+	authz := services.NewRoomAuthorizer(rooms)
+	publisher := &fakePublisher{}
+	chat := services.NewChatService(&fakeMessages{messages: map[int64]*models.Message{}}, rooms, authz, publisher)
+	registry := services.NewCommandRegistry(commands, accounts, authz)
+	registry.SetAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}) // Bots are local test servers
+	chat.SetCommands(registry)
+	return chat, registry, rooms, publisher
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+		want services.CommandInput
+	}{
+		{"/roll 3d6", true, services.CommandInput{Name: "roll", Args: []string{"3d6"}, Raw: "3d6"}},
+		{"  /ME  opens  the door ", true, services.CommandInput{Name: "me", Args: []string{"opens", "the", "door"}, Raw: "opens  the door"}},
+		{`/invite "Mary Jane" owner`, true, services.CommandInput{Name: "invite", Args: []string{"Mary Jane", "owner"}, Raw: `"Mary Jane" owner`}},
+		{"/help", true, services.CommandInput{Name: "help"}},
+		{"//roll", false, services.CommandInput{}},
+		{"/usr/bin is a path", false, services.CommandInput{}},
+		{"/ spaced", false, services.CommandInput{}},
+		{"hello /roll", false, services.CommandInput{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := services.ParseCommand(tt.text)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCommand(%q) = %+v, %v; want %+v, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCommandRegistry_BuiltinCommands(t *testing.T) {
+	chat, _, rooms, publisher := newTestCommandRegistry(t)
+	chat.SetDice(func(sides int) int { return sides })
+
+	emote, err := chat.PostMessage(member, 1, "/me opens the door")
+	if err != nil || emote.Kind != models.MessageKindEmote || emote.Text != "opens the door" || emote.ID == 0 {
+		t.Errorf("Expected a stored emote, got %+v, %v", emote, err)
+	}
+	rolled, err := chat.PostMessage(member, 1, "/roll 2d6-1 Climb")
+	if err != nil || rolled.Text != "rolled 2d6-1 for Climb: [6, 6] - 1 = 11" || rolled.Roll == nil || rolled.Roll.Total != 11 {
+		t.Errorf("Expected a public roll, got %+v, %v", rolled, err)
+	}
+	literal, err := chat.PostMessage(member, 1, "//me is not a command")
+	if err != nil || literal.Text != "/me is not a command" || literal.Kind != "" {
+		t.Errorf("Expected an escaped slash to be posted as text, got %+v, %v", literal, err)
+	}
+
+	if _, err := chat.PostMessage(member, 1, "/topic Session 12"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when a member sets the topic, got %v", err)
+	}
+	if _, err := chat.PostMessage(owner, 1, "/topic Session 12"); err != nil {
+		t.Fatalf("Setting the topic failed: %v", err)
+	}
+	if rooms.rooms[0].Topic != "Session 12" {
+		t.Errorf("Expected the topic to be saved, got %+v", rooms.rooms[0])
+	}
+	last := publisher.events[len(publisher.events)-2]
+	if last.Type != models.EventRoomUpdated || last.Room.Topic != "Session 12" {
+		t.Errorf("Expected room.updated before the reply, got %+v", last)
+	}
+
+	reply, err := chat.PostMessage(member, 1, "/topic")
+	if err != nil || !reply.Ephemeral || reply.Text != "Topic: Session 12" || reply.AuthorType != models.AuthorTypeSystem {
+		t.Errorf("Expected an ephemeral reply with the topic, got %+v, %v", reply, err)
+	}
+	event := publisher.events[len(publisher.events)-1]
+	if event.Type != models.EventMessageEphemeral || !reflect.DeepEqual(event.Recipients, []string{member.ID}) {
+		t.Errorf("Expected the reply to be sent to the member only, got %+v", event)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		text      string
+		want      error
+	}{
+		{"unknown command", member, "/teleport", services.ErrInvalidInput},
+		{"missing arguments", member, "/me", services.ErrInvalidInput},
+		{"owner only", member, "/invite new-id", services.ErrForbidden},
+		{"bad dice", member, "/roll 1000d6", services.ErrInvalidInput},
+		{"not a member", hermit, "/help", services.ErrNotRoomMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := chat.PostMessage(tt.principal, 1, tt.text); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if reply, err := chat.PostMessage(owner, 1, "/invite new-id"); err != nil || !reply.Ephemeral {
+		t.Errorf("Expected an ephemeral confirmation, got %+v, %v", reply, err)
+	}
+	if m, _ := rooms.GetMember(1, "new-id"); m == nil {
+		t.Error("Expected /invite to add the member")
+	}
+}
+
+func TestCommandRegistry_HiddenRolls(t *testing.T) {
+	chat, _, _, publisher := newTestCommandRegistry(t)
+	chat.SetDice(func(sides int) int { return 1 })
+
+	hidden, err := chat.PostMessage(member, 1, "/hroll d100 Sanity")
+	if err != nil || hidden.Roll == nil || !reflect.DeepEqual(hidden.VisibleTo, []string{member.ID, owner.ID}) {
+		t.Fatalf("Expected a roll for the member and the owner, got %+v, %v", hidden, err)
+	}
+	whisper, err := chat.PostMessage(owner, 1, "/whisper "+member.ID+" The door is locked from the inside.")
+	if err != nil || whisper.Text != "The door is locked from the inside." || !reflect.DeepEqual(whisper.VisibleTo, []string{owner.ID, member.ID}) {
+		t.Fatalf("Expected a whisper to the member, got %+v, %v", whisper, err)
+	}
+	if _, err := chat.PostMessage(owner, 1, "/whisper "+hermit.ID+" hello"); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a whisper to a non-member, got %v", err)
+	}
+
+	reply, err := chat.PostMessage(member, 1, fmt.Sprintf("/reveal #%d", hidden.ID))
+	if err != nil || !reply.Ephemeral {
+		t.Fatalf("Expected an ephemeral confirmation, got %+v, %v", reply, err)
+	}
+	revealed := publisher.events[len(publisher.events)-2]
+	if revealed.Type != models.EventMessageRevealed || revealed.Message.ID != hidden.ID || revealed.Recipients != nil {
+		t.Errorf("Expected message.revealed for the whole room, got %+v", revealed)
+	}
+	if _, err := chat.PostMessage(member, 1, fmt.Sprintf("/reveal %d", whisper.ID)); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when revealing the owner's whisper, got %v", err)
+	}
+}
+
+func TestCommandRegistry_BotCommands(t *testing.T) {
+	chat, registry, _, publisher := newTestCommandRegistry(t)
+	var invocation services.CommandInvocation
+	var signature string
+	answer := services.CommandResponse{Text: "The Old Ones stir."}
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&invocation)
+		signature = r.Header.Get(services.WebhookSignatureHeader)
+		json.NewEncoder(w).Encode(answer)
+	}))
+	defer bot.Close()
+
+	if _, _, err := registry.RegisterBotCommand(owner, "omen", "", "", bot.URL); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for people, got %v", err)
+	}
+	if _, _, err := registry.RegisterBotCommand(diceBot, "roll", "", "", bot.URL); !errors.Is(err, services.ErrCommandExists) {
+		t.Errorf("Expected ErrCommandExists for a built-in name, got %v", err)
+	}
+	cmd, secret, err := registry.RegisterBotCommand(diceBot, "/Omen", "[question]", "Ask the stars.", bot.URL)
+	if err != nil {
+		t.Fatalf("RegisterBotCommand() failed: %v", err)
+	}
+	if cmd.Name != "omen" || secret == "" {
+		t.Errorf("Unexpected command %+v", cmd)
+	}
+
+	msg, err := chat.PostMessage(member, 1, `/omen "will we survive?"`)
+	if err != nil {
+		t.Fatalf("Running the bot command failed: %v", err)
+	}
+	if msg.UserID != diceBot.ID || msg.AuthorType != models.AuthorTypeBot || msg.Text != answer.Text || msg.Ephemeral {
+		t.Errorf("Expected the answer to be posted as the bot, got %+v", msg)
+	}
+	if invocation.Command != "omen" || invocation.UserID != member.ID || len(invocation.Args) != 1 || invocation.Args[0] != "will we survive?" {
+		t.Errorf("Unexpected invocation %+v", invocation)
+	}
+	if signature == "" {
+		t.Error("Expected the invocation to be signed")
+	}
+
+	answer.Ephemeral = true
+	msg, err = chat.PostMessage(member, 1, "/omen")
+	if err != nil || !msg.Ephemeral || msg.User != diceBot.DisplayName {
+		t.Errorf("Expected an ephemeral answer from the bot, got %+v, %v", msg, err)
+	}
+	if last := publisher.events[len(publisher.events)-1]; !reflect.DeepEqual(last.Recipients, []string{member.ID}) {
+		t.Errorf("Expected the answer to go to the member only, got %+v", last)
+	}
+
+	if _, err := chat.PostMessage(owner, 2, "/omen"); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected the command to be unknown where the bot is not a member, got %v", err)
+	}
+	available, err := registry.RoomCommands(member, 1)
+	if err != nil || len(available) != 15 {
+		t.Fatalf("Expected the built-in commands and /omen, got %+v, %v", available, err)
+	}
+
+	if err := registry.DeleteBotCommand(diceBot, "omen"); err != nil {
+		t.Fatalf("DeleteBotCommand() failed: %v", err)
+	}
+	if err := registry.DeleteBotCommand(diceBot, "omen"); !errors.Is(err, services.ErrCommandNotFound) {
+		t.Errorf("Expected ErrCommandNotFound, got %v", err)
+	}
+}
+
+func TestCommandRegistry_BotCommandsAreScopedToTheirRooms(t *testing.T) {
+	chat, registry, rooms, _ := newTestCommandRegistry(t)
+	answering := func(text string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(services.CommandResponse{Text: text})
+		}))
+	}
+	dice, maps := answering("from dice-bot"), answering("from map-bot")
+	defer dice.Close()
+	defer maps.Close()
+
+	if _, _, err := registry.RegisterBotCommand(diceBot, "omen", "", "", dice.URL); err != nil {
+		t.Fatalf("RegisterBotCommand() failed: %v", err)
+	}
+	if _, _, err := registry.RegisterBotCommand(diceBot, "omen", "", "", dice.URL); !errors.Is(err, services.ErrCommandExists) {
+		t.Errorf("Expected ErrCommandExists for a bot's own name, got %v", err)
+	}
+	if _, _, err := registry.RegisterBotCommand(mapBot, "omen", "", "", maps.URL); err != nil {
+		t.Fatalf("Expected another bot to register the same name, got %v", err)
+	}
+	rooms.members = append(rooms.members, models.RoomMember{RoomID: 2, UserID: mapBot.ID, Role: models.RoomRoleMember})
+
+	if msg, err := chat.PostMessage(member, 1, "/omen"); err != nil || msg.UserID != diceBot.ID || msg.Text != "from dice-bot" {
+		t.Errorf("Expected dice-bot to answer in room 1, got %+v, %v", msg, err)
+	}
+	if msg, err := chat.PostMessage(owner, 2, "/omen"); err != nil || msg.UserID != mapBot.ID || msg.Text != "from map-bot" {
+		t.Errorf("Expected map-bot to answer in room 2, got %+v, %v", msg, err)
+	}
+
+	// In a room with both bots, the command registered first is run.
+	rooms.members = append(rooms.members, models.RoomMember{RoomID: 1, UserID: mapBot.ID, Role: models.RoomRoleMember})
+	if msg, err := chat.PostMessage(member, 1, "/omen"); err != nil || msg.UserID != diceBot.ID {
+		t.Errorf("Expected dice-bot to keep answering in room 1, got %+v, %v", msg, err)
+	}
+	available, err := registry.RoomCommands(member, 1)
+	if err != nil || len(available) != 15 {
+		t.Errorf("Expected the built-in commands and one /omen, got %+v, %v", available, err)
+	}
+
+	if err := registry.DeleteBotCommand(mapBot, "omen"); err != nil {
+		t.Fatalf("DeleteBotCommand() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(owner, 2, "/omen"); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected /omen to be gone from room 2, got %v", err)
+	}
+	if msg, err := chat.PostMessage(member, 1, "/omen"); err != nil || msg.UserID != diceBot.ID {
+		t.Errorf("Expected dice-bot's /omen to remain, got %+v, %v", msg, err)
+	}
+}
+
+func TestCommandRegistry_BotFailureIsReportedToInvoker(t *testing.T) {
+	chat, registry, _, _ := newTestCommandRegistry(t)
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer bot.Close()
+	if _, _, err := registry.RegisterBotCommand(diceBot, "omen", "", "", bot.URL); err != nil {
+		t.Fatalf("RegisterBotCommand() failed: %v", err)
+	}
+
+	msg, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "/omen"})
+	if err != nil || !msg.Ephemeral || msg.AuthorType != models.AuthorTypeSystem {
+		t.Errorf("Expected an ephemeral error reply, got %+v, %v", msg, err)
+	}
+}
+
+func TestCommandRegistry_BotRequestsAreGuarded(t *testing.T) {
+	chat, registry, _, _ := newTestCommandRegistry(t)
+	reached, done := make(chan struct{}, 1), make(chan struct{})
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached <- struct{}{}
+		<-done // Answers too slowly
+	}))
+	defer bot.Close()
+	defer close(done)
+	if _, _, err := registry.RegisterBotCommand(diceBot, "omen", "", "", bot.URL); err != nil {
+		t.Fatalf("RegisterBotCommand() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-reached
+		cancel()
+	}()
+	start := time.Now()
+	msg, err := chat.SendMessageContext(ctx, member, ports.MessageDraft{RoomID: 1, Text: "/omen"})
+	if err != nil || !msg.Ephemeral || msg.AuthorType != models.AuthorTypeSystem {
+		t.Errorf("Expected an ephemeral error reply, got %+v, %v", msg, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to end with its context, took %v", elapsed)
+	}
+
+	registry.SetAllowedNetworks(nil)
+	msg, err = chat.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "/omen"})
+	if err != nil || !msg.Ephemeral || msg.AuthorType != models.AuthorTypeSystem {
+		t.Errorf("Expected an ephemeral error reply, got %+v, %v", msg, err)
+	}
+	select {
+	case <-reached:
+		t.Error("Expected no request to reach a bot at a loopback address")
+	default:
+	}
+}
@@ -0,0 +1,486 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"keeper/server/models"
+)
+
+// Limits of dice expressions.
+const (
+	MaxDiceExpressionLength = 100
+	maxRollLabelLength      = 100
+	maxRollTerms            = 10
+	maxRollDice             = 100 // Dice named in one expression, not counting explosions
+	maxRollSides            = 1000
+	maxRollConstant         = 10000
+	maxRollExplosions       = 100 // Extra dice added by exploding dice in one roll
+	maxBonusDice            = 2   // Call of Cthulhu allows two bonus or penalty dice
+)
+
+// DiceRoller evaluates dice expressions in the usual tabletop notation:
+//
+//	d20, 3d6+2, 2d8-1d4   sums of dice and constants
+//	4d6kh3, 2d20kl1       keep the highest or lowest n dice (k is kh)
+//	4d6dl1, 3d6dh1        drop the lowest or highest n dice
+//	3d6!                  exploding dice: a die showing its maximum adds another die
+//	d%, d100              percentile dice
+//	d100b1, d%p2          Call of Cthulhu bonus and penalty dice
+//
+// Dice are rolled with crypto/rand, so results are fair and unpredictable.
+type DiceRoller struct {
+	die func(sides int) int
+}
+
+// NewDiceRoller creates a DiceRoller backed by crypto/rand.
+func NewDiceRoller() *DiceRoller {
+	return &DiceRoller{die: cryptoDie}
+}
+
+// cryptoDie returns a uniformly random number from 1 to sides.
+func cryptoDie(sides int) int {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(sides)))
+	if err != nil {
+		panic(fmt.Sprintf("reading random numbers: %v", err)) // crypto/rand does not fail on supported platforms
+	}
+	return int(n.Int64()) + 1
+}
+
+// diceTerm is a parsed summand of a dice expression.
+type diceTerm struct {
+	negative bool
+	constant int    // Value of a term without dice
+	count    int    // Number of dice; 0 for constants
+	sides    int    // Sides of each die
+	keep     string // "kh", "kl", "dh", "dl" or ""
+	keepN    int
+	explode  bool
+	bonus    int // Bonus dice of a percentile roll, or penalty dice if negative
+}
+
+// notation formats the term without its sign.
+func (t diceTerm) notation() string {
+	if t.count == 0 {
+		return strconv.Itoa(t.constant)
+	}
+	var b strings.Builder
+	if t.count > 1 {
+		b.WriteString(strconv.Itoa(t.count))
+	}
+	b.WriteString("d" + strconv.Itoa(t.sides))
+	if t.explode {
+		b.WriteString("!")
+	}
+	if t.keep != "" {
+		b.WriteString(t.keep + strconv.Itoa(t.keepN))
+	}
+	if t.bonus > 0 {
+		b.WriteString("b" + strconv.Itoa(t.bonus))
+	} else if t.bonus < 0 {
+		b.WriteString("p" + strconv.Itoa(-t.bonus))
+	}
+	return b.String()
+}
+
+// parseDice parses a dice expression. Spaces and case are ignored.
+func parseDice(expr string) ([]diceTerm, error) {
+	s := strings.ToLower(strings.Join(strings.Fields(expr), ""))
+	if s == "" {
+		return nil, fmt.Errorf("%w: nothing to roll, try 3d6+2", ErrInvalidInput)
+	}
+	if len(s) > MaxDiceExpressionLength {
+		return nil, fmt.Errorf("%w: dice expression exceeds %d characters", ErrInvalidInput, MaxDiceExpressionLength)
+	}
+
+	var terms []diceTerm
+	dice, hasDice := 0, false
+	for i := 0; i < len(s); {
+		var t diceTerm
+		if s[i] == '+' || s[i] == '-' {
+			t.negative = s[i] == '-'
+			i++
+		} else if len(terms) > 0 {
+			return nil, fmt.Errorf("%w: expected + or - at %q", ErrInvalidInput, s[i:])
+		}
+		n, next := readNumber(s, i)
+		i = next
+		if i >= len(s) || s[i] != 'd' {
+			if n < 0 {
+				return nil, fmt.Errorf("%w: cannot roll %q, try 3d6+2", ErrInvalidInput, expr)
+			}
+			if n > maxRollConstant {
+				return nil, fmt.Errorf("%w: constants must be at most %d", ErrInvalidInput, maxRollConstant)
+			}
+			t.constant = n
+			terms = append(terms, t)
+			continue
+		}
+
+		t.count = n
+		if n < 0 {
+			t.count = 1
+		}
+		i++ // The d
+		if i < len(s) && s[i] == '%' {
+			t.sides = 100
+			i++
+		} else if t.sides, i = readNumber(s, i); t.sides < 0 {
+			return nil, fmt.Errorf("%w: missing number of sides in %q", ErrInvalidInput, expr)
+		}
+		var err error
+		if i, err = parseModifiers(s, i, &t); err != nil {
+			return nil, err
+		}
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+		dice += t.count
+		hasDice = true
+		terms = append(terms, t)
+	}
+
+	if !hasDice {
+		return nil, fmt.Errorf("%w: nothing to roll, try 3d6+2", ErrInvalidInput)
+	}
+	if len(terms) > maxRollTerms {
+		return nil, fmt.Errorf("%w: at most %d terms per roll", ErrInvalidInput, maxRollTerms)
+	}
+	if dice > maxRollDice {
+		return nil, fmt.Errorf("%w: at most %d dice per roll", ErrInvalidInput, maxRollDice)
+	}
+	return terms, nil
+}
+
+// parseModifiers reads the keep, drop, explode, bonus and penalty modifiers
+// following a die, up to the next term. It returns the index after them.
+func parseModifiers(s string, i int, t *diceTerm) (int, error) {
+	seen := map[byte]bool{}
+	for i < len(s) && s[i] != '+' && s[i] != '-' {
+		c := s[i]
+		if seen[c] {
+			return 0, fmt.Errorf("%w: modifier %q given twice", ErrInvalidInput, c)
+		}
+		seen[c] = true
+		i++
+		switch c {
+		case '!':
+			t.explode = true
+			continue
+		case 'k':
+			t.keep = "kh"
+			if i < len(s) && (s[i] == 'h' || s[i] == 'l') {
+				t.keep = "k" + string(s[i])
+				i++
+			}
+		case 'd':
+			if i >= len(s) || (s[i] != 'h' && s[i] != 'l') {
+				return 0, fmt.Errorf("%w: use dh or dl to drop dice", ErrInvalidInput)
+			}
+			t.keep = "d" + string(s[i])
+			i++
+		case 'b', 'p':
+		default:
+			return 0, fmt.Errorf("%w: unknown dice modifier %q", ErrInvalidInput, s[i-1:])
+		}
+		if c == 'k' || c == 'd' {
+			if seen['k'] && seen['d'] {
+				return 0, fmt.Errorf("%w: either keep or drop dice, not both", ErrInvalidInput)
+			}
+		}
+
+		n, next := readNumber(s, i)
+		i = next
+		if n < 0 {
+			n = 1
+		}
+		switch c {
+		case 'k', 'd':
+			t.keepN = n
+		case 'b':
+			t.bonus = n
+		case 'p':
+			t.bonus = -n
+		}
+		if seen['b'] && seen['p'] {
+			return 0, fmt.Errorf("%w: bonus and penalty dice cancel out, roll the difference", ErrInvalidInput)
+		}
+	}
+	return i, nil
+}
+
+// validate checks the limits of a dice term.
+func (t diceTerm) validate() error {
+	if t.count < 1 || t.sides < 2 || t.sides > maxRollSides {
+		return fmt.Errorf("%w: roll 1 to %d dice with 2 to %d sides", ErrInvalidInput, maxRollDice, maxRollSides)
+	}
+	switch t.keep {
+	case "kh", "kl":
+		if t.keepN < 1 || t.keepN > t.count {
+			return fmt.Errorf("%w: can keep 1 to %d of %s", ErrInvalidInput, t.count, t.notation())
+		}
+	case "dh", "dl":
+		if t.keepN < 1 || t.keepN >= t.count {
+			return fmt.Errorf("%w: can drop 1 to %d of %s", ErrInvalidInput, t.count-1, t.notation())
+		}
+	}
+	if t.bonus != 0 {
+		if t.count != 1 || t.sides != 100 || t.explode || t.keep != "" {
+			return fmt.Errorf("%w: bonus and penalty dice only apply to a single d100", ErrInvalidInput)
+		}
+		if t.bonus > maxBonusDice || t.bonus < -maxBonusDice {
+			return fmt.Errorf("%w: at most %d bonus or penalty dice", ErrInvalidInput, maxBonusDice)
+		}
+	}
+	return nil
+}
+
+// readNumber reads the decimal number at s[i:], returning -1 if there is
+// none, and the index after it. Numbers too large for any limit return a
+// value above the limits rather than overflowing.
+func readNumber(s string, i int) (int, int) {
+	start := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == start {
+		return -1, i
+	}
+	if i-start > 6 {
+		return 1_000_000, i
+	}
+	n, _ := strconv.Atoi(s[start:i])
+	return n, i
+}
+
+// Roll evaluates a dice expression. The label says what the roll is for and
+// may be empty.
+func (d *DiceRoller) Roll(expression, label string) (*models.Roll, error) {
+	terms, err := parseDice(expression)
+	if err != nil {
+		return nil, err
+	}
+	label = strings.TrimSpace(label)
+	if len(label) > maxRollLabelLength {
+		return nil, fmt.Errorf("%w: roll label exceeds %d bytes", ErrInvalidInput, maxRollLabelLength)
+	}
+
+	roll := &models.Roll{Label: label}
+	explosions := 0
+	var notation strings.Builder
+	for i, t := range terms {
+		if t.negative {
+			notation.WriteString("-")
+		} else if i > 0 {
+			notation.WriteString("+")
+		}
+		notation.WriteString(t.notation())
+
+		term := models.RollTerm{Notation: t.notation(), Negative: t.negative, Sides: t.sides}
+		switch {
+		case t.count == 0:
+			term.Value = t.constant
+		case t.bonus != 0:
+			term.Dice, term.Value = d.rollPercentile(t.bonus)
+		default:
+			term.Dice, term.Value = d.rollDice(t, &explosions)
+		}
+		if t.negative {
+			term.Value = -term.Value
+		}
+		roll.Total += term.Value
+		roll.Terms = append(roll.Terms, term)
+	}
+	roll.Expression = notation.String()
+	return roll, nil
+}
+
+// Check rolls percentile dice against a target value and rates the result
+// by the Call of Cthulhu success levels. The expression must be a single
+// d100, optionally with bonus or penalty dice; the skill is the label.
+func (d *DiceRoller) Check(expression, skill string, target int) (*models.Roll, error) {
+	terms, err := parseDice(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) != 1 || terms[0].negative || terms[0].count != 1 || terms[0].sides != 100 || terms[0].keep != "" || terms[0].explode {
+		return nil, fmt.Errorf("%w: skill checks roll d100, with b or p for bonus or penalty dice", ErrInvalidInput)
+	}
+	roll, err := d.Roll(expression, skill)
+	if err != nil {
+		return nil, err
+	}
+	roll.Check = &models.RollCheck{Target: target, Level: successLevel(roll.Total, target)}
+	return roll, nil
+}
+
+// successLevel rates a percentile result against a target value.
+func successLevel(result, target int) string {
+	switch {
+	case result == 1:
+		return models.CheckCritical
+	case result == 100 || (target < 50 && result >= 96):
+		return models.CheckFumble
+	case result <= target/5:
+		return models.CheckExtreme
+	case result <= target/2:
+		return models.CheckHard
+	case result <= target:
+		return models.CheckRegular
+	default:
+		return models.CheckFailure
+	}
+}
+
+// checkLevelText describes success levels in roll messages.
+var checkLevelText = map[string]string{
+	models.CheckCritical: "critical success",
+	models.CheckExtreme:  "extreme success",
+	models.CheckHard:     "hard success",
+	models.CheckRegular:  "regular success",
+	models.CheckFailure:  "failure",
+	models.CheckFumble:   "fumble",
+}
+
+// rollDice rolls a group of dice, adding dice for explosions and marking
+// those dropped by keep or drop modifiers. It returns the dice and the sum
+// of those counted.
+func (d *DiceRoller) rollDice(t diceTerm, explosions *int) ([]models.Die, int) {
+	dice := make([]models.Die, 0, t.count)
+	for i := 0; i < t.count; i++ {
+		dice = append(dice, models.Die{Result: d.die(t.sides)})
+	}
+	if t.explode {
+		for i := 0; i < len(dice) && *explosions < maxRollExplosions; i++ {
+			if dice[i].Result == t.sides {
+				dice[i].Exploded = true
+				dice = append(dice, models.Die{Result: d.die(t.sides)})
+				*explosions++
+			}
+		}
+	}
+	switch t.keep {
+	case "kh":
+		dropDice(dice, len(dice)-t.keepN, false)
+	case "kl":
+		dropDice(dice, len(dice)-t.keepN, true)
+	case "dh":
+		dropDice(dice, t.keepN, true)
+	case "dl":
+		dropDice(dice, t.keepN, false)
+	}
+
+	sum := 0
+	for _, die := range dice {
+		if !die.Dropped {
+			sum += die.Result
+		}
+	}
+	return dice, sum
+}
+
+// dropDice marks the n highest or lowest dice as dropped. Of equal dice, the
+// ones rolled first are dropped first.
+func dropDice(dice []models.Die, n int, highest bool) {
+	order := make([]int, len(dice))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		if highest {
+			return dice[order[a]].Result > dice[order[b]].Result
+		}
+		return dice[order[a]].Result < dice[order[b]].Result
+	})
+	for _, i := range order[:n] {
+		dice[i].Dropped = true
+	}
+}
+
+// rollPercentile rolls a d100 with Call of Cthulhu bonus (bonus > 0) or
+// penalty (bonus < 0) dice: one units die and one tens die per bonus or
+// penalty die extra. The tens die giving the best result for a bonus, or the
+// worst for a penalty, counts; 00 with a units 0 is 100.
+func (d *DiceRoller) rollPercentile(bonus int) ([]models.Die, int) {
+	extra := bonus
+	if extra < 0 {
+		extra = -extra
+	}
+	units := d.die(10) - 1
+	dice := make([]models.Die, 0, extra+2)
+	kept, value := -1, 0
+	for i := 0; i <= extra; i++ {
+		tens := (d.die(10) - 1) * 10
+		dice = append(dice, models.Die{Result: tens, Tens: true, Dropped: true})
+		v := tens + units
+		if v == 0 {
+			v = 100
+		}
+		if kept < 0 || (bonus > 0 && v < value) || (bonus < 0 && v > value) {
+			kept, value = i, v
+		}
+	}
+	dice[kept].Dropped = false
+	dice = append(dice, models.Die{Result: units})
+	return dice, value
+}
+
+// describeRoll renders a roll as the text of its message, e.g.
+// "rolled 4d6kh3+2 for Strength: [6, 5, 3, (1)] + 2 = 16".
+func describeRoll(roll *models.Roll) string {
+	var b strings.Builder
+	b.WriteString("rolled " + roll.Expression)
+	if roll.Label != "" {
+		b.WriteString(" for " + roll.Label)
+	}
+	if roll.Check != nil && roll.Check.Character != "" {
+		b.WriteString(" (" + roll.Check.Character + ")")
+	}
+	b.WriteString(":")
+	for i, term := range roll.Terms {
+		switch {
+		case term.Negative:
+			b.WriteString(" - ")
+		case i > 0:
+			b.WriteString(" + ")
+		default:
+			b.WriteString(" ")
+		}
+		if len(term.Dice) == 0 {
+			b.WriteString(term.Notation)
+			continue
+		}
+		var tens, dice []string
+		for _, die := range term.Dice {
+			s := strconv.Itoa(die.Result)
+			if die.Tens && die.Result == 0 {
+				s = "00"
+			}
+			if die.Exploded {
+				s += "!"
+			}
+			if die.Dropped {
+				s = "(" + s + ")"
+			}
+			if die.Tens {
+				tens = append(tens, s)
+			} else {
+				dice = append(dice, s)
+			}
+		}
+		if len(tens) > 0 {
+			b.WriteString("[tens " + strings.Join(tens, ", ") + "; units " + strings.Join(dice, ", ") + "]")
+		} else {
+			b.WriteString("[" + strings.Join(dice, ", ") + "]")
+		}
+	}
+	b.WriteString(" = " + strconv.Itoa(roll.Total))
+	if roll.Check != nil {
+		b.WriteString(" against " + strconv.Itoa(roll.Check.Target) + ", " + checkLevelText[roll.Check.Level])
+	}
+	return b.String()
+}
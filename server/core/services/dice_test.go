@@ -0,0 +1,121 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// sequence returns a die that yields results in order. Percentile rolls with
+// bonus or penalty dice roll the units die first.
+func sequence(t *testing.T, results ...int) func(sides int) int {
+	return func(sides int) int {
+		if len(results) == 0 {
+			t.Fatal("Rolled more dice than expected")
+		}
+		n := results[0]
+		results = results[1:]
+		if n < 1 || n > sides {
+			t.Fatalf("Test result %d does not fit a d%d", n, sides)
+		}
+		return n
+	}
+}
+
+func TestDiceRoller_Roll(t *testing.T) {
+	tests := []struct {
+		expr    string
+		results []int
+		total   int
+		text    string
+	}{
+		{"d20", []int{14}, 14, "rolled d20: [14] = 14"},
+		{"2d6 - 1", []int{3, 5}, 7, "rolled 2d6-1: [3, 5] - 1 = 7"},
+		{"2D8+1d4+3", []int{8, 2, 4}, 17, "rolled 2d8+d4+3: [8, 2] + [4] + 3 = 17"},
+		{"4d6kh3", []int{2, 6, 1, 5}, 13, "rolled 4d6kh3: [2, 6, (1), 5] = 13"},
+		{"4d6k3", []int{2, 6, 1, 5}, 13, "rolled 4d6kh3: [2, 6, (1), 5] = 13"},
+		{"2d20kl1", []int{17, 4}, 4, "rolled 2d20kl1: [(17), 4] = 4"},
+		{"4d6dl1", []int{3, 3, 4, 6}, 13, "rolled 4d6dl1: [(3), 3, 4, 6] = 13"},
+		{"3d6dh1", []int{6, 2, 6}, 8, "rolled 3d6dh1: [(6), 2, 6] = 8"},
+		{"3d6!", []int{6, 2, 4, 6, 1}, 19, "rolled 3d6!: [6!, 2, 4, 6!, 1] = 19"},
+		{"d%", []int{42}, 42, "rolled d100: [42] = 42"},
+		{"d100b1", []int{4, 7, 3}, 23, "rolled d100b1: [tens (60), 20; units 3] = 23"},
+		{"d%p2", []int{4, 7, 3, 9}, 83, "rolled d100p2: [tens (60), (20), 80; units 3] = 83"},
+		{"d100b1", []int{1, 1, 10}, 90, "rolled d100b1: [tens (00), 90; units 0] = 90"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			roll, err := services.NewTestDiceRoller(sequence(t, tt.results...)).Roll(tt.expr, "")
+			if err != nil {
+				t.Fatalf("Roll(%q) failed: %v", tt.expr, err)
+			}
+			if roll.Total != tt.total {
+				t.Errorf("Expected a total of %d, got %d", tt.total, roll.Total)
+			}
+			if text := services.DescribeRoll(roll); text != tt.text {
+				t.Errorf("Expected %q, got %q", tt.text, text)
+			}
+		})
+	}
+}
+
+func TestDiceRoller_Roll_Invalid(t *testing.T) {
+	roller := services.NewDiceRoller()
+	for _, expr := range []string{"", "5", "d", "d1", "3x6", "2d6+", "101d6", "60d6+60d6", "d1001", "4d6kh5", "4d6dl4", "4d6kh3dl1", "d6b1", "2d100b1", "d100b3", "d100b1p1", "d6!!", "d20d"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := roller.Roll(expr, ""); !errors.Is(err, services.ErrInvalidInput) {
+				t.Errorf("Expected ErrInvalidInput, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDiceRoller_Roll_IsWithinRange(t *testing.T) {
+	roller := services.NewDiceRoller()
+	seen := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		roll, err := roller.Roll("d6", "")
+		if err != nil {
+			t.Fatalf("Roll() failed: %v", err)
+		}
+		if roll.Total < 1 || roll.Total > 6 {
+			t.Fatalf("Expected 1 to 6, got %d", roll.Total)
+		}
+		seen[roll.Total] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("Expected every face in 1000 rolls, got %v", seen)
+	}
+}
+
+func TestDiceRoller_Check(t *testing.T) {
+	tests := []struct {
+		result, target int
+		level          string
+	}{
+		{1, 5, models.CheckCritical},
+		{10, 50, models.CheckExtreme},
+		{11, 50, models.CheckHard},
+		{25, 50, models.CheckHard},
+		{50, 50, models.CheckRegular},
+		{51, 50, models.CheckFailure},
+		{95, 40, models.CheckFailure},
+		{96, 40, models.CheckFumble},
+		{99, 99, models.CheckRegular},
+		{100, 99, models.CheckFumble},
+	}
+	for _, tt := range tests {
+		roll, err := services.NewTestDiceRoller(sequence(t, tt.result)).Check("d100", "Spot Hidden", tt.target)
+		if err != nil {
+			t.Fatalf("Check() failed: %v", err)
+		}
+		if roll.Check.Level != tt.level {
+			t.Errorf("Expected %d against %d to be %s, got %s", tt.result, tt.target, tt.level, roll.Check.Level)
+		}
+	}
+	if _, err := services.NewDiceRoller().Check("d20", "Spot Hidden", 50); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput checking with a d20, got %v", err)
+	}
+}
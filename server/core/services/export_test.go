@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+	"time"
+)
+
+// SetClock replaces the clock of a WebhookService in tests.
+func (s *WebhookService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetClock replaces the clock of an IncomingWebhookService and its rate limiter in tests.
+func (s *IncomingWebhookService) SetClock(now func() time.Time) {
+	s.now = now
+	s.limiter.now = now
+}
+
+// SetDice replaces the die of a ChatService in tests.
+func (s *ChatService) SetDice(die func(sides int) int) {
+	s.dice.die = die
+}
+
+// SetDice replaces the die of an InitiativeService in tests.
+func (s *InitiativeService) SetDice(die func(sides int) int) {
+	s.dice.die = die
+}
+
+// NewTestDiceRoller creates a DiceRoller that rolls with die.
+func NewTestDiceRoller(die func(sides int) int) *DiceRoller {
+	return &DiceRoller{die: die}
+}
+
+// DescribeRoll exposes describeRoll to tests.
+var DescribeRoll = describeRoll
+
+// SetClock replaces the clock of a CalendarService in tests.
+func (s *CalendarService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetClock replaces the clock of a FileService in tests.
+func (s *FileService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetClock replaces the clock of an UnfurlService in tests.
+func (s *UnfurlService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetTimeout shortens how long an UnfurlService waits for a link in tests.
+func (s *UnfurlService) SetTimeout(timeout time.Duration) {
+	s.client.Timeout = timeout
+}
+
+// AllowsAddress exposes allowAddress to tests.
+func (s *UnfurlService) AllowsAddress(addr string) bool {
+	return s.guard.allowAddress(netip.MustParseAddr(addr))
+}
+
+// SetClock replaces the clock of a MentionService in tests.
+func (s *MentionService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetClock replaces the clock of a NotificationService in tests.
+func (s *NotificationService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// RecordQueued handles the queued message events, as Run would.
+func (s *MentionService) RecordQueued() {
+	for len(s.queue) > 0 {
+		s.handle(context.Background(), <-s.queue)
+	}
+}
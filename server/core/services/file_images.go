@@ -0,0 +1,429 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Registers GIF for image.Decode
+	"image/jpeg"
+	"image/png"
+
+	"keeper/server/models"
+)
+
+// MaxImagePixels is the largest image that can be uploaded, so that a small
+// file cannot decompress into gigabytes.
+const MaxImagePixels = 50_000_000
+
+// ThumbnailSize is a size of thumbnails, by the width and height they fit in.
+type ThumbnailSize struct {
+	Name string
+	Max  int
+}
+
+// ThumbnailSizes are the thumbnails made of images larger than them, from
+// smallest to largest.
+var ThumbnailSizes = []ThumbnailSize{
+	{models.ThumbnailSmall, 160},
+	{models.ThumbnailMedium, 480},
+	{models.ThumbnailLarge, 1280},
+}
+
+// Quality of re-encoded JPEGs: turned photos and thumbnails.
+const (
+	jpegQuality      = 90
+	thumbnailQuality = 80
+)
+
+// preparedImage is an upload with its metadata removed and its thumbnails.
+type preparedImage struct {
+	content    []byte
+	width      int
+	height     int
+	thumbnails []preparedThumbnail
+}
+
+type preparedThumbnail struct {
+	models.Thumbnail
+	content []byte
+}
+
+// errDamagedImage is reported for images that cannot be parsed.
+var errDamagedImage = fmt.Errorf("%w: the image is damaged", ErrUnsupportedFileType)
+
+// prepareImage removes the metadata of an image that may give away more than
+// the picture, such as where a photo was taken, and makes its thumbnails.
+// Photos turned with an EXIF orientation are turned for real before it is
+// removed. WebP images are stripped but not decoded, so they get no
+// thumbnails.
+func prepareImage(content []byte, contentType string) (*preparedImage, error) {
+	switch contentType {
+	case "image/jpeg":
+		return prepareJPEG(content)
+	case "image/png":
+		return prepareDecodable(stripPNG(content))
+	case "image/gif":
+		return prepareDecodable(content) // GIF has no EXIF
+	case "image/webp":
+		return prepareWebP(content)
+	default:
+		return nil, fmt.Errorf("%w: %s is not an image", ErrUnsupportedFileType, contentType)
+	}
+}
+
+// checkPixels refuses images too large to decode safely.
+func checkPixels(width, height int) error {
+	if width <= 0 || height <= 0 {
+		return errDamagedImage
+	}
+	if int64(width)*int64(height) > MaxImagePixels {
+		return fmt.Errorf("%w: images can be at most %d megapixels", ErrFileTooLarge, MaxImagePixels/1_000_000)
+	}
+	return nil
+}
+
+// prepareJPEG strips the APP1 (EXIF and XMP), APP13 (IPTC) and comment
+// segments of a JPEG without re-encoding it, unless it has to be turned.
+func prepareJPEG(content []byte) (*preparedImage, error) {
+	stripped, orientation, err := stripJPEG(content)
+	if err != nil {
+		return nil, err
+	}
+	if orientation <= 1 || orientation > 8 {
+		return prepareDecodable(stripped)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, errDamagedImage
+	}
+	if err := checkPixels(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return nil, errDamagedImage
+	}
+	upright := orient(toRGBA(img), orientation)
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, upright, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, fmt.Errorf("encoding turned photo: %w", err)
+	}
+	return withThumbnails(out.Bytes(), upright, "image/jpeg")
+}
+
+// prepareDecodable reads the size of a PNG, GIF or JPEG without metadata and
+// makes its thumbnails.
+func prepareDecodable(content []byte) (*preparedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, errDamagedImage
+	}
+	if err := checkPixels(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+	if config.Width <= ThumbnailSizes[0].Max && config.Height <= ThumbnailSizes[0].Max {
+		return &preparedImage{content: content, width: config.Width, height: config.Height}, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, errDamagedImage
+	}
+	thumbnailType := "image/png" // Keeps transparency
+	if format == "jpeg" {
+		thumbnailType = "image/jpeg"
+	}
+	return withThumbnails(content, toRGBA(img), thumbnailType)
+}
+
+// withThumbnails makes the thumbnails of an image smaller than it.
+func withThumbnails(content []byte, img *image.RGBA, contentType string) (*preparedImage, error) {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	prepared := &preparedImage{content: content, width: width, height: height}
+	for _, size := range ThumbnailSizes {
+		if width <= size.Max && height <= size.Max {
+			break
+		}
+		thumbWidth, thumbHeight := fit(width, height, size.Max)
+		thumb := scaleDown(img, thumbWidth, thumbHeight)
+		var out bytes.Buffer
+		var err error
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&out, thumb, &jpeg.Options{Quality: thumbnailQuality})
+		} else {
+			err = png.Encode(&out, thumb)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encoding %s thumbnail: %w", size.Name, err)
+		}
+		prepared.thumbnails = append(prepared.thumbnails, preparedThumbnail{
+			Thumbnail: models.Thumbnail{Name: size.Name, Width: thumbWidth, Height: thumbHeight, ContentType: contentType, Size: int64(out.Len())},
+			content:   out.Bytes(),
+		})
+	}
+	return prepared, nil
+}
+
+// fit scales width and height down to fit in a box of side by side pixels,
+// keeping the aspect ratio.
+func fit(width, height, side int) (int, int) {
+	if width >= height {
+		return side, max(1, (height*side+width/2)/width)
+	}
+	return max(1, (width*side+height/2)/height), side
+}
+
+// toRGBA converts an image to RGBA at the origin, which draw does quickly
+// for the types the decoders return.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// scaleDown shrinks an image by averaging the pixels each target pixel
+// covers. RGBA is premultiplied, so transparent pixels do not darken edges.
+func scaleDown(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, (y+1)*srcHeight/height
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, (x+1)*srcWidth/width
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient turns an image the way its EXIF orientation (2 to 8) says it should
+// be shown.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for dy := 0; dy < dstHeight; dy++ {
+		for dx := 0; dx < dstWidth; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored
+				sx, sy = width-1-dx, dy
+			case 3: // Upside down
+				sx, sy = width-1-dx, height-1-dy
+			case 4: // Mirrored upside down
+				sx, sy = dx, height-1-dy
+			case 5: // Mirrored and turned left
+				sx, sy = dy, dx
+			case 6: // Turned left, so turn right
+				sx, sy = dy, height-1-dx
+			case 7: // Mirrored and turned right
+				sx, sy = width-1-dy, height-1-dx
+			case 8: // Turned right, so turn left
+				sx, sy = width-1-dy, dx
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
+
+// stripJPEG removes the segments of a JPEG that hold metadata, and returns
+// the EXIF orientation found in them (0 if none). ICC profiles and the
+// segments needed to decode the image are kept.
+func stripJPEG(content []byte) ([]byte, int, error) {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return nil, 0, errDamagedImage
+	}
+	out := make([]byte, 0, len(content))
+	out = append(out, 0xFF, 0xD8)
+	orientation := 0
+	i := 2
+	for {
+		if i >= len(content) || content[i] != 0xFF {
+			return nil, 0, errDamagedImage
+		}
+		for i < len(content) && content[i] == 0xFF { // Fill bytes
+			i++
+		}
+		if i >= len(content) {
+			return nil, 0, errDamagedImage
+		}
+		marker := content[i]
+		i++
+		switch {
+		case marker == 0xD9: // End of image
+			return append(out, 0xFF, marker), orientation, nil
+		case marker == 0xDA: // Start of scan: the rest is image data
+			return append(append(out, 0xFF, marker), content[i:]...), orientation, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // No length
+			out = append(out, 0xFF, marker)
+			continue
+		}
+		if i+2 > len(content) {
+			return nil, 0, errDamagedImage
+		}
+		length := int(binary.BigEndian.Uint16(content[i:]))
+		if length < 2 || i+length > len(content) {
+			return nil, 0, errDamagedImage
+		}
+		segment := content[i+2 : i+length]
+		switch marker {
+		case 0xE1: // EXIF or XMP
+			if o := exifOrientation(segment); o != 0 {
+				orientation = o
+			}
+		case 0xED, 0xFE: // IPTC, comments
+		default:
+			out = append(append(out, 0xFF, marker), content[i:i+length]...)
+		}
+		i += length
+	}
+}
+
+// exifOrientation reads the orientation tag from the first IFD of an APP1
+// segment, or returns 0.
+func exifOrientation(segment []byte) int {
+	if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := segment[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 { // Orientation, a SHORT
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// pngMetadataChunks are the chunks stripPNG drops.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG removes the text, EXIF and time chunks of a PNG. Broken files are
+// returned as they are, for the decoder to refuse.
+func stripPNG(content []byte) []byte {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(content, []byte(signature)) {
+		return content
+	}
+	out := make([]byte, 0, len(content))
+	out = append(out, signature...)
+	for i := len(signature); i < len(content); {
+		if i+8 > len(content) {
+			return content
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(content[i:]))
+		if end > len(content) || end < i {
+			return content
+		}
+		if !pngMetadataChunks[string(content[i+4:i+8])] {
+			out = append(out, content[i:end]...)
+		}
+		i = end
+	}
+	return out
+}
+
+// prepareWebP removes the EXIF and XMP chunks of a WebP image and reads its
+// size from the header.
+func prepareWebP(content []byte) (*preparedImage, error) {
+	if len(content) < 12 || string(content[:4]) != "RIFF" || string(content[8:12]) != "WEBP" {
+		return nil, errDamagedImage
+	}
+	out := make([]byte, 0, len(content))
+	out = append(out, content[:12]...)
+	width, height := 0, 0
+	for i := 12; i < len(content); {
+		if i+8 > len(content) {
+			return nil, errDamagedImage
+		}
+		fourCC := string(content[i : i+4])
+		size := int(binary.LittleEndian.Uint32(content[i+4:]))
+		end := i + 8 + size + size%2 // Chunks are padded to an even size
+		if end > len(content) || end < i {
+			return nil, errDamagedImage
+		}
+		data := content[i+8 : i+8+size]
+		switch fourCC {
+		case "EXIF", "XMP ":
+			i = end
+			continue
+		case "VP8X":
+			if len(data) < 10 {
+				return nil, errDamagedImage
+			}
+			width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+			height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+		case "VP8 ":
+			if width == 0 && len(data) >= 10 {
+				width = int(binary.LittleEndian.Uint16(data[6:]) & 0x3FFF)
+				height = int(binary.LittleEndian.Uint16(data[8:]) & 0x3FFF)
+			}
+		case "VP8L":
+			if width == 0 && len(data) >= 5 {
+				bits := binary.LittleEndian.Uint32(data[1:])
+				width = int(bits&0x3FFF) + 1
+				height = int(bits>>14&0x3FFF) + 1
+			}
+		}
+		start := len(out)
+		out = append(out, content[i:end]...)
+		if fourCC == "VP8X" {
+			out[start+8] &^= 0x08 | 0x04 // No EXIF or XMP any more
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	if err := checkPixels(width, height); err != nil {
+		return nil, err
+	}
+	return &preparedImage{content: out, width: width, height: height}, nil
+}
@@ -0,0 +1,198 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// photo is a JPEG of width by height pixels whose left half is black and
+// right half white, with EXIF saying how it is turned, GPS details and a
+// comment.
+func photo(t *testing.T, width, height, orientation int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.Gray{Y: uint8(255 * (2 * x / width))})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Encoding photo failed: %v", err)
+	}
+	// Big-endian TIFF with one IFD holding the orientation.
+	var exif bytes.Buffer
+	exif.WriteString("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	binary.Write(&exif, binary.BigEndian, []uint16{1, 0x0112, 3})
+	binary.Write(&exif, binary.BigEndian, uint32(1))
+	binary.Write(&exif, binary.BigEndian, []uint16{uint16(orientation), 0})
+	binary.Write(&exif, binary.BigEndian, uint32(0))
+	exif.WriteString("GPSLatitude 51.4779 N")
+	segment := func(marker byte, data []byte) []byte {
+		return append([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+	}
+	content := encoded.Bytes()
+	var out bytes.Buffer
+	out.Write(content[:2])
+	out.Write(segment(0xE1, exif.Bytes()))
+	out.Write(segment(0xFE, []byte("Taken at 12 Elm Street")))
+	out.Write(content[2:])
+	return out.String()
+}
+
+// pngChunk encodes a PNG chunk with its CRC.
+func pngChunk(kind string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(append(chunk, kind...), data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestFileService_StripsPhotos(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, files, _ := newTestFileService(t, &now)
+	ctx := context.Background()
+
+	file, err := files.Upload(ctx, member, 1, "IMG_0042.jpg", strings.NewReader(photo(t, 600, 400, 6)))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	if file.ContentType != "image/jpeg" || file.Width != 400 || file.Height != 600 {
+		t.Errorf("Expected an upright 400x600 photo, got %+v", file)
+	}
+	_, body, err := files.Open(ctx, member, file.ID, "")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	content := readFile(t, body)
+	if strings.Contains(content, "Exif") || strings.Contains(content, "GPS") || strings.Contains(content, "Elm Street") {
+		t.Error("Expected the EXIF and comment to be removed")
+	}
+	if int64(len(content)) != file.Size {
+		t.Errorf("Expected the size of the stripped photo, got %d for %d bytes", file.Size, len(content))
+	}
+	img, err := jpeg.Decode(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Decoding the stored photo failed: %v", err)
+	}
+	// Turned right, the white half of the photo is at the bottom.
+	if bounds := img.Bounds(); bounds.Dx() != 400 || bounds.Dy() != 600 {
+		t.Errorf("Expected the stored photo to be 400x600, got %v", bounds)
+	}
+	if top, bottom := color.GrayModel.Convert(img.At(200, 100)).(color.Gray), color.GrayModel.Convert(img.At(200, 500)).(color.Gray); top.Y > 50 || bottom.Y < 200 {
+		t.Errorf("Expected black on top and white at the bottom, got %v and %v", top, bottom)
+	}
+
+	if len(file.Thumbnails) != 2 {
+		t.Fatalf("Expected small and medium thumbnails, got %+v", file.Thumbnails)
+	}
+	small := file.Thumbnail(models.ThumbnailSmall)
+	if small == nil || small.Width != 107 || small.Height != 160 || small.ContentType != "image/jpeg" || small.URL != services.ThumbnailURL(file.ID, "small") {
+		t.Errorf("Unexpected small thumbnail %+v", small)
+	}
+	if medium := file.Thumbnail(models.ThumbnailMedium); medium == nil || medium.Width != 320 || medium.Height != 480 {
+		t.Errorf("Unexpected medium thumbnail %+v", medium)
+	}
+	thumb, body, err := files.Open(ctx, member, file.ID, models.ThumbnailSmall)
+	if err != nil {
+		t.Fatalf("Open() of the small thumbnail failed: %v", err)
+	}
+	config, err := jpeg.DecodeConfig(strings.NewReader(readFile(t, body)))
+	if err != nil || config.Width != 107 || config.Height != 160 || thumb.Name != "IMG_0042-small.jpg" || thumb.Size != small.Size {
+		t.Errorf("Unexpected small thumbnail %+v: %+v, %v", thumb, config, err)
+	}
+	original, body, err := files.Open(ctx, member, file.ID, models.ThumbnailLarge)
+	if err != nil {
+		t.Fatalf("Open() of a thumbnail larger than the photo failed: %v", err)
+	}
+	if readFile(t, body) != content || original.Size != file.Size {
+		t.Errorf("Expected the photo itself in place of a larger thumbnail, got %+v", original)
+	}
+	if _, _, err := files.Open(ctx, member, file.ID, "huge"); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for an unknown thumbnail, got %v", err)
+	}
+}
+
+func TestFileService_StripsPNGAndWebP(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, files, _ := newTestFileService(t, &now)
+	ctx := context.Background()
+
+	// A transparent PNG with a text chunk before its image data.
+	encoded := []byte(encodePNG(image.NewNRGBA(image.Rect(0, 0, 200, 100))))
+	tagged := append(append(append([]byte{}, encoded[:33]...), pngChunk("tEXt", []byte("Location\x00Arkham"))...), encoded[33:]...)
+	file, err := files.Upload(ctx, member, 1, "token.png", bytes.NewReader(tagged))
+	if err != nil {
+		t.Fatalf("Upload() of a PNG failed: %v", err)
+	}
+	_, body, err := files.Open(ctx, member, file.ID, "")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	if content := readFile(t, body); content != string(encoded) {
+		t.Errorf("Expected only the text chunk to be removed, got %d bytes for %d", len(content), len(encoded))
+	}
+	if file.Width != 200 || file.Height != 100 || len(file.Thumbnails) != 1 || file.Thumbnails[0].ContentType != "image/png" || file.Thumbnails[0].Height != 80 {
+		t.Errorf("Expected a 200x100 PNG with a small PNG thumbnail, got %+v", file)
+	}
+
+	// An extended WebP of 640x480 with EXIF, whose image data is not checked.
+	vp8x := []byte{0x08 | 0x10, 0, 0, 0, 0x7F, 0x02, 0, 0xDF, 0x01, 0}
+	var webp bytes.Buffer
+	webp.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range []struct {
+		kind string
+		data []byte
+	}{{"VP8X", vp8x}, {"VP8L", []byte{0x2F, 0, 0, 0, 0}}, {"EXIF", []byte("GPSLatitude")}} {
+		webp.WriteString(chunk.kind)
+		binary.Write(&webp, binary.LittleEndian, uint32(len(chunk.data)))
+		webp.Write(chunk.data)
+		if len(chunk.data)%2 == 1 {
+			webp.WriteByte(0)
+		}
+	}
+	file, err = files.Upload(ctx, member, 1, "scene.webp", &webp)
+	if err != nil {
+		t.Fatalf("Upload() of a WebP failed: %v", err)
+	}
+	if file.Width != 640 || file.Height != 480 || len(file.Thumbnails) != 0 {
+		t.Errorf("Expected a 640x480 WebP without thumbnails, got %+v", file)
+	}
+	_, body, err = files.Open(ctx, member, file.ID, "")
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	content := readFile(t, body)
+	if strings.Contains(content, "EXIF") || content[20]&0x08 != 0 || binary.LittleEndian.Uint32([]byte(content[4:])) != uint32(len(content)-8) {
+		t.Errorf("Expected the EXIF chunk and flag to be removed, got %q", content)
+	}
+}
+
+func TestFileService_RefusesBadImages(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, files, _ := newTestFileService(t, &now)
+
+	// A PNG header claiming 20000x20000 pixels.
+	header := binary.BigEndian.AppendUint32(nil, 20000)
+	header = binary.BigEndian.AppendUint32(header, 20000)
+	header = append(header, 8, 6, 0, 0, 0)
+	bomb := "\x89PNG\r\n\x1a\n" + string(pngChunk("IHDR", header))
+	if _, err := files.Upload(context.Background(), member, 1, "bomb.png", strings.NewReader(bomb)); !errors.Is(err, services.ErrFileTooLarge) {
+		t.Errorf("Expected ErrFileTooLarge for 400 megapixels, got %v", err)
+	}
+	truncated := photo(t, 600, 400, 1)[:300]
+	if _, err := files.Upload(context.Background(), member, 1, "broken.jpg", strings.NewReader(truncated)); !errors.Is(err, services.ErrUnsupportedFileType) {
+		t.Errorf("Expected ErrUnsupportedFileType for a broken photo, got %v", err)
+	}
+}
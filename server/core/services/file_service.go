@@ -0,0 +1,409 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Limits of uploaded files.
+const (
+	DefaultMaxFileSize = 10 << 20 // Bytes
+	MaxMessageFiles    = 10
+	MaxFileNameLength  = 255
+)
+
+// FileURLTTL is how long signed download URLs stay valid.
+const FileURLTTL = time.Hour
+
+// FileTypes are the content types that can be uploaded. Types are detected
+// from the content, so a renamed executable is refused.
+var FileTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"}
+
+// Errors returned for uploaded files.
+var (
+	ErrFileNotFound        = errors.New("file not found")
+	ErrFileTooLarge        = errors.New("file too large")
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+)
+
+// FileService keeps the files members upload to rooms. Content goes to a
+// ports.BlobStore and metadata to a ports.FileRepository. A file is private
+// to its uploader until posted with a message; after that, whoever can see
+// the message can download it, so files of whispers stay hidden.
+type FileService struct {
+	repo     ports.FileRepository
+	blobs    ports.BlobStore
+	messages ports.MessageRepository
+	authz    ports.Authorizer
+	maxSize  int64
+	secret   []byte // Signs download URLs
+	now      func() time.Time
+}
+
+// NewFileService creates a FileService. Download URLs are signed with a
+// random secret until SetURLSecret is called, so they break on restart.
+func NewFileService(repo ports.FileRepository, blobs ports.BlobStore, messages ports.MessageRepository, authz ports.Authorizer) *FileService {
+	if repo == nil || blobs == nil || messages == nil || authz == nil {
+		log.Fatal("FileRepository, BlobStore, MessageRepository and Authorizer cannot be nil in NewFileService")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Failed to generate file URL secret: %v", err)
+	}
+	return &FileService{repo: repo, blobs: blobs, messages: messages, authz: authz, maxSize: DefaultMaxFileSize, secret: secret, now: time.Now}
+}
+
+// SetMaxSize replaces the largest upload allowed, in bytes.
+func (s *FileService) SetMaxSize(bytes int64) {
+	s.maxSize = bytes
+}
+
+// MaxSize returns the largest upload allowed, in bytes.
+func (s *FileService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// SetURLSecret replaces the key signing download URLs, so that they stay
+// valid across restarts and servers.
+func (s *FileService) SetURLSecret(secret []byte) {
+	s.secret = secret
+}
+
+// Upload stores a file for the principal in a room. It is not shown to
+// anyone until posted with SendMessage.
+func (s *FileService) Upload(ctx context.Context, p *models.Principal, roomID int64, name string, body io.Reader) (*models.File, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(io.LimitReader(body, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading upload: %w", err)
+	}
+	if int64(len(content)) > s.maxSize {
+		return nil, fmt.Errorf("%w: files can be at most %d bytes", ErrFileTooLarge, s.maxSize)
+	}
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidInput)
+	}
+	contentType, err := detectFileType(content)
+	if err != nil {
+		return nil, err
+	}
+	var prepared *preparedImage
+	if strings.HasPrefix(contentType, "image/") {
+		if prepared, err = prepareImage(content, contentType); err != nil {
+			return nil, err
+		}
+		content = prepared.content
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	file := &models.File{
+		RoomID:      roomID,
+		UploadedBy:  p.ID,
+		Name:        cleanFileName(name),
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		Key:         fmt.Sprintf("rooms/%d/%s", roomID, id),
+		CreatedAt:   s.now().UTC(),
+	}
+	if err := s.blobs.Put(ctx, file.Key, bytes.NewReader(content), file.Size, file.ContentType); err != nil {
+		return nil, fmt.Errorf("storing upload to room %d: %w", roomID, err)
+	}
+	if prepared != nil {
+		file.Width, file.Height = prepared.width, prepared.height
+		for _, thumb := range prepared.thumbnails {
+			file.Thumbnails = append(file.Thumbnails, thumb.Thumbnail)
+			if err := s.blobs.Put(ctx, thumbnailKey(file.Key, thumb.Name), bytes.NewReader(thumb.content), thumb.Size, thumb.ContentType); err != nil {
+				s.deleteBlobs(file)
+				return nil, fmt.Errorf("storing %s thumbnail of upload to room %d: %w", thumb.Name, roomID, err)
+			}
+		}
+	}
+	if err := s.repo.CreateFile(file); err != nil {
+		s.deleteBlobs(file)
+		return nil, fmt.Errorf("saving upload to room %d: %w", roomID, err)
+	}
+	setFileURLs(file)
+	return file, nil
+}
+
+// GetFile returns the metadata of a file the principal may download.
+func (s *FileService) GetFile(p *models.Principal, id int64) (*models.File, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	return s.file(p, id)
+}
+
+// Open returns a file the principal may download with its content, which the
+// caller closes. With the name of a thumbnail, it returns the thumbnail
+// instead, described as a file; images smaller than the thumbnail size are
+// returned as they are.
+func (s *FileService) Open(ctx context.Context, p *models.Principal, id int64, thumbnail string) (*models.File, io.ReadCloser, error) {
+	file, err := s.GetFile(p, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.open(ctx, file, thumbnail)
+}
+
+// SignedURL returns a download path of a file that works without
+// credentials until it expires, e.g. for an <img> on another origin.
+func (s *FileService) SignedURL(p *models.Principal, id int64) (string, time.Time, error) {
+	file, err := s.GetFile(p, id)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := s.now().Add(FileURLTTL).Truncate(time.Second).UTC()
+	return fmt.Sprintf("%s?expires=%d&signature=%s", FileURL(file.ID), expires.Unix(), s.sign(file.ID, expires.Unix())), expires, nil
+}
+
+// OpenSigned checks the expiry and signature of a signed URL and returns the
+// file or thumbnail with its content, like Open. Bad and expired signatures
+// are reported as ErrFileNotFound.
+func (s *FileService) OpenSigned(ctx context.Context, id int64, expires, signature, thumbnail string) (*models.File, io.ReadCloser, error) {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > unix || !hmac.Equal([]byte(signature), []byte(s.sign(id, unix))) {
+		return nil, nil, ErrFileNotFound
+	}
+	file, err := s.repo.GetFile(id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("looking up file %d: %w", id, err)
+	}
+	if file == nil {
+		return nil, nil, ErrFileNotFound
+	}
+	setFileURLs(file)
+	return s.open(ctx, file, thumbnail)
+}
+
+// FileURL is the download path of a file.
+func FileURL(id int64) string {
+	return fmt.Sprintf("/api/v1/files/%d/content", id)
+}
+
+// ThumbnailURL is the download path of a thumbnail of a file.
+func ThumbnailURL(id int64, name string) string {
+	return FileURL(id) + "?thumbnail=" + name
+}
+
+// setFileURLs sets the download paths of a file and its thumbnails.
+func setFileURLs(file *models.File) {
+	file.URL = FileURL(file.ID)
+	for i := range file.Thumbnails {
+		file.Thumbnails[i].URL = ThumbnailURL(file.ID, file.Thumbnails[i].Name)
+	}
+}
+
+// thumbnailKey is the blob store key of a thumbnail of the file with key.
+func thumbnailKey(key, name string) string {
+	return key + "-" + name
+}
+
+// file returns a file the principal may see: one they uploaded that has not
+// been posted, or one of a message they can see. Others are reported as not
+// found.
+func (s *FileService) file(p *models.Principal, id int64) (*models.File, error) {
+	file, err := s.repo.GetFile(id)
+	if err != nil {
+		return nil, fmt.Errorf("looking up file %d: %w", id, err)
+	}
+	if file == nil {
+		return nil, ErrFileNotFound
+	}
+	if _, err := s.authz.RoomMember(p, file.RoomID); err != nil {
+		if errors.Is(err, ErrNotRoomMember) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	if file.MessageID == 0 {
+		if file.UploadedBy != p.ID {
+			return nil, ErrFileNotFound
+		}
+	} else {
+		msg, err := s.messages.GetMessage(file.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("looking up message %d: %w", file.MessageID, err)
+		}
+		if msg == nil || !msg.IsVisibleTo(p.ID) {
+			return nil, ErrFileNotFound
+		}
+	}
+	setFileURLs(file)
+	return file, nil
+}
+
+func (s *FileService) open(ctx context.Context, file *models.File, thumbnail string) (*models.File, io.ReadCloser, error) {
+	if thumbnail != "" {
+		if !slices.ContainsFunc(ThumbnailSizes, func(size ThumbnailSize) bool { return size.Name == thumbnail }) {
+			return nil, nil, fmt.Errorf("%w: no %s thumbnail", ErrFileNotFound, thumbnail)
+		}
+		if thumb := file.Thumbnail(thumbnail); thumb != nil {
+			ext := ".png"
+			if thumb.ContentType == "image/jpeg" {
+				ext = ".jpg"
+			}
+			file = &models.File{
+				ID:          file.ID,
+				RoomID:      file.RoomID,
+				MessageID:   file.MessageID,
+				UploadedBy:  file.UploadedBy,
+				Name:        strings.TrimSuffix(file.Name, path.Ext(file.Name)) + "-" + thumb.Name + ext,
+				ContentType: thumb.ContentType,
+				Size:        thumb.Size,
+				URL:         thumb.URL,
+				Width:       thumb.Width,
+				Height:      thumb.Height,
+				Key:         thumbnailKey(file.Key, thumb.Name),
+				CreatedAt:   file.CreatedAt,
+			}
+		}
+	}
+	body, err := s.blobs.Get(ctx, file.Key)
+	if errors.Is(err, ports.ErrBlobNotFound) {
+		log.Printf("Content of file %d is missing from the blob store", file.ID)
+		return nil, nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening file %d: %w", file.ID, err)
+	}
+	return file, body, nil
+}
+
+// claim returns the files a message is about to be posted with. They must
+// be unposted uploads of the principal to the room.
+func (s *FileService) claim(p *models.Principal, roomID int64, ids []int64) ([]models.File, error) {
+	if len(ids) > MaxMessageFiles {
+		return nil, fmt.Errorf("%w: a message can have at most %d files", ErrInvalidInput, MaxMessageFiles)
+	}
+	files := make([]models.File, 0, len(ids))
+	for i, id := range ids {
+		if slices.Contains(ids[:i], id) {
+			return nil, fmt.Errorf("%w: file %d is listed twice", ErrInvalidInput, id)
+		}
+		file, err := s.repo.GetFile(id)
+		if err != nil {
+			return nil, fmt.Errorf("looking up file %d: %w", id, err)
+		}
+		if file == nil || file.RoomID != roomID || file.UploadedBy != p.ID || file.MessageID != 0 {
+			return nil, fmt.Errorf("%w: file %d is not an unposted upload of yours to this room", ErrInvalidInput, id)
+		}
+		setFileURLs(file)
+		files = append(files, *file)
+	}
+	return files, nil
+}
+
+// attach links the files of a stored message to it.
+func (s *FileService) attach(msg *models.Message) error {
+	ids := make([]int64, len(msg.Files))
+	for i := range msg.Files {
+		msg.Files[i].MessageID = msg.ID
+		ids[i] = msg.Files[i].ID
+	}
+	if err := s.repo.AttachFiles(msg.ID, ids); err != nil {
+		return fmt.Errorf("attaching files to message %d: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// deleteMessageFiles removes the files of a deleted message. The message is
+// gone already, so failures are only logged.
+func (s *FileService) deleteMessageFiles(messageID int64) {
+	files, err := s.repo.ListMessageFiles(messageID)
+	if err != nil {
+		log.Printf("Failed to list files of deleted message %d: %v", messageID, err)
+		return
+	}
+	for _, file := range files {
+		s.deleteBlobs(&file)
+		if err := s.repo.DeleteFile(file.ID); err != nil {
+			log.Printf("Failed to delete file %d: %v", file.ID, err)
+		}
+	}
+}
+
+// deleteBlobs removes the content of a file and its thumbnails from the blob
+// store, logging failures.
+func (s *FileService) deleteBlobs(file *models.File) {
+	keys := []string{file.Key}
+	for _, thumb := range file.Thumbnails {
+		keys = append(keys, thumbnailKey(file.Key, thumb.Name))
+	}
+	for _, key := range keys {
+		if err := s.blobs.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// sign computes the signature of a download URL.
+func (s *FileService) sign(id, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// detectFileType sniffs the content type of an upload and checks that it
+// may be uploaded. Text is always served as UTF-8.
+func detectFileType(content []byte) (string, error) {
+	detected := http.DetectContentType(content)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil || !slices.Contains(FileTypes, mediaType) {
+		return "", fmt.Errorf("%w: %s files cannot be uploaded; use %s", ErrUnsupportedFileType, detected, strings.Join(FileTypes, ", "))
+	}
+	if mediaType == "text/plain" {
+		if !utf8.Valid(content) {
+			return "", fmt.Errorf("%w: text files must be UTF-8", ErrUnsupportedFileType)
+		}
+		return "text/plain; charset=utf-8", nil
+	}
+	return mediaType, nil
+}
+
+// cleanFileName keeps the base name of an uploaded file without control
+// characters, shortened to MaxFileNameLength bytes.
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name))
+	for len(name) > MaxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "upload"
+	}
+	return name
+}
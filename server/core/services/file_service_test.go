@@ -0,0 +1,241 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/server/adapters/blobs/local"
+	filessqlite "keeper/server/adapters/files/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// smallPNG is a 2x2 PNG, too small for thumbnails.
+var smallPNG = encodePNG(image.NewRGBA(image.Rect(0, 0, 2, 2)))
+
+func encodePNG(img image.Image) string {
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.String()
+}
+
+func newTestFileService(t *testing.T, now *time.Time) (*services.ChatService, *services.FileService, *local.Store) {
+	t.Helper()
+	db := newTestDB(t)
+	repo := filessqlite.NewSQLiteFileRepository(db)
+	if err := repo.InitFileSchema(); err != nil {
+		t.Fatalf("InitFileSchema() failed: %v", err)
+	}
+	blobs, err := local.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() failed: %v", err)
+	}
+	messages := &fakeMessages{messages: map[int64]*models.Message{}}
+	authz := &fakeAuthorizer{roles: map[string]string{
+		owner.ID:  models.RoomRoleOwner,
+		member.ID: models.RoomRoleMember,
+		bot.ID:    models.RoomRoleMember,
+	}}
+	rooms := &fakeRooms{
+		rooms: []models.Room{{ID: 1, Name: "table"}},
+		members: []models.RoomMember{
+			{RoomID: 1, UserID: owner.ID, Role: models.RoomRoleOwner},
+			{RoomID: 1, UserID: member.ID, Role: models.RoomRoleMember},
+			{RoomID: 1, UserID: bot.ID, Role: models.RoomRoleMember},
+		},
+	}
+	chat := services.NewChatService(messages, rooms, authz, &fakePublisher{})
+	files := services.NewFileService(repo, blobs, messages, authz)
+	files.SetClock(func() time.Time { return *now })
+	chat.SetFiles(files)
+	return chat, files, blobs
+}
+
+func readFile(t *testing.T, body io.ReadCloser) string {
+	t.Helper()
+	defer body.Close()
+	content, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Reading file failed: %v", err)
+	}
+	return string(content)
+}
+
+func TestFileService_Upload(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, files, _ := newTestFileService(t, &now)
+	files.SetMaxSize(1024)
+
+	file, err := files.Upload(context.Background(), member, 1, `C:\maps\crypt.png`, strings.NewReader(smallPNG))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	if file.Name != "crypt.png" || file.ContentType != "image/png" || file.Size != int64(len(smallPNG)) || file.URL != services.FileURL(file.ID) || file.MessageID != 0 {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	text, err := files.Upload(context.Background(), member, 1, "notes.txt", strings.NewReader("Ghoul tunnels under the church"))
+	if err != nil || text.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected a UTF-8 text file, got %+v, %v", text, err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		roomID    int64
+		body      string
+		want      error
+	}{
+		{"too large", member, 1, strings.Repeat("a", 1025), services.ErrFileTooLarge},
+		{"empty", member, 1, "", services.ErrInvalidInput},
+		{"executable", member, 1, "MZ\x90\x00\x03\x00\x00\x00", services.ErrUnsupportedFileType},
+		{"html", member, 1, "<html><script>alert(1)</script>", services.ErrUnsupportedFileType},
+		{"not utf-8", member, 1, "caf\xe9", services.ErrUnsupportedFileType},
+		{"read-only bot", bot, 1, smallPNG, services.ErrForbidden},
+		{"non-member", hermit, 1, smallPNG, services.ErrNotRoomMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := files.Upload(context.Background(), tt.principal, tt.roomID, "upload", strings.NewReader(tt.body)); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFileService_PostAndDownload(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	chat, files, _ := newTestFileService(t, &now)
+	ctx := context.Background()
+
+	file, err := files.Upload(ctx, member, 1, "crypt.png", strings.NewReader(smallPNG))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	if _, err := files.GetFile(owner, file.ID); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected an unposted file to be private to its uploader, got %v", err)
+	}
+	if _, err := chat.SendMessage(owner, ports.MessageDraft{RoomID: 1, FileIDs: []int64{file.ID}}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput when posting someone else's upload, got %v", err)
+	}
+	if _, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, FileIDs: []int64{file.ID, file.ID}}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a file listed twice, got %v", err)
+	}
+
+	msg, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, FileIDs: []int64{file.ID}})
+	if err != nil {
+		t.Fatalf("SendMessage() with a file failed: %v", err)
+	}
+	if len(msg.Files) != 1 || msg.Files[0].ID != file.ID || msg.Files[0].MessageID != msg.ID || msg.Files[0].URL == "" {
+		t.Errorf("Expected the file on the message, got %+v", msg.Files)
+	}
+	if _, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "again", FileIDs: []int64{file.ID}}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput when posting a file twice, got %v", err)
+	}
+
+	posted, body, err := files.Open(ctx, owner, file.ID, "")
+	if err != nil {
+		t.Fatalf("Open() of a posted file failed: %v", err)
+	}
+	if posted.MessageID != msg.ID || readFile(t, body) != smallPNG {
+		t.Errorf("Unexpected posted file %+v", posted)
+	}
+	if _, _, err := files.Open(ctx, hermit, file.ID, ""); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound for a non-member, got %v", err)
+	}
+}
+
+func TestFileService_WhisperedFiles(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	chat, files, _ := newTestFileService(t, &now)
+
+	file, err := files.Upload(context.Background(), owner, 1, "handout.pdf", strings.NewReader("%PDF-1.7\n"))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	if _, err := chat.SendMessage(owner, ports.MessageDraft{RoomID: 1, Text: "For your eyes only", FileIDs: []int64{file.ID}, VisibleTo: []string{member.ID}}); err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if _, err := files.GetFile(member, file.ID); err != nil {
+		t.Errorf("Expected the recipient to see the file, got %v", err)
+	}
+	if _, err := files.GetFile(bot, file.ID); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected a file of a whisper to be hidden from others, got %v", err)
+	}
+}
+
+func TestFileService_SignedURL(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	_, files, _ := newTestFileService(t, &now)
+	ctx := context.Background()
+
+	file, err := files.Upload(ctx, member, 1, "crypt.png", strings.NewReader(smallPNG))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	if _, _, err := files.SignedURL(owner, file.ID); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected ErrFileNotFound when linking a file one cannot see, got %v", err)
+	}
+	link, expires, err := files.SignedURL(member, file.ID)
+	if err != nil {
+		t.Fatalf("SignedURL() failed: %v", err)
+	}
+	if !expires.Equal(now.Add(services.FileURLTTL)) {
+		t.Errorf("Expected the link to expire in an hour, got %v", expires)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Path != services.FileURL(file.ID) {
+		t.Fatalf("Unexpected link %q", link)
+	}
+	query := parsed.Query()
+
+	_, body, err := files.OpenSigned(ctx, file.ID, query.Get("expires"), query.Get("signature"), "")
+	if err != nil {
+		t.Fatalf("OpenSigned() failed: %v", err)
+	}
+	if readFile(t, body) != smallPNG {
+		t.Error("Expected the content of the file")
+	}
+	if _, _, err := files.OpenSigned(ctx, file.ID+1, query.Get("expires"), query.Get("signature"), ""); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected a signature to be bound to its file, got %v", err)
+	}
+	if _, _, err := files.OpenSigned(ctx, file.ID, "9999999999", query.Get("signature"), ""); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected a changed expiry to be refused, got %v", err)
+	}
+	now = now.Add(services.FileURLTTL + time.Second)
+	if _, _, err := files.OpenSigned(ctx, file.ID, query.Get("expires"), query.Get("signature"), ""); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected an expired link to be refused, got %v", err)
+	}
+}
+
+func TestFileService_DeleteMessage(t *testing.T) {
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	chat, files, blobs := newTestFileService(t, &now)
+	ctx := context.Background()
+
+	file, err := files.Upload(ctx, member, 1, "crypt.png", strings.NewReader(smallPNG))
+	if err != nil {
+		t.Fatalf("Upload() failed: %v", err)
+	}
+	msg, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, FileIDs: []int64{file.ID}})
+	if err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	if err := chat.DeleteMessage(member, 1, msg.ID); err != nil {
+		t.Fatalf("DeleteMessage() failed: %v", err)
+	}
+	if _, err := files.GetFile(member, file.ID); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("Expected the file to be deleted with its message, got %v", err)
+	}
+	if _, err := blobs.Get(ctx, file.Key); !errors.Is(err, ports.ErrBlobNotFound) {
+		t.Errorf("Expected nothing left in the store, got %v", err)
+	}
+}
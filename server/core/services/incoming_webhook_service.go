@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// IncomingWebhookPrefix starts every incoming webhook token.
+const IncomingWebhookPrefix = "khk_"
+
+// Rate limit of each incoming webhook: bursts of IncomingWebhookBurst
+// messages, then one every IncomingWebhookInterval.
+const (
+	IncomingWebhookBurst    = 10
+	IncomingWebhookInterval = 2 * time.Second
+)
+
+// maxWebhookNameLength bounds webhook names and username overrides, in bytes.
+const maxWebhookNameLength = 64
+
+// ErrInvalidWebhookToken is returned when an incoming webhook token is malformed or unknown.
+var ErrInvalidWebhookToken = errors.New("invalid webhook token")
+
+// ErrRateLimited is wrapped by RateLimitError.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitError is returned when a caller sends too many requests.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v, retry in %v", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// IncomingMessage is the JSON body posted to an incoming webhook. Text may
+// be empty if there are attachments.
+type IncomingMessage struct {
+	Text        string              `json:"text"`
+	Format      string              `json:"format,omitempty"`   // "plain" (the default) or "markdown"
+	Username    string              `json:"username,omitempty"` // Overrides the webhook name on this message
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+}
+
+// IncomingWebhookService manages incoming webhooks of rooms and posts their
+// messages through the ChatService, so they are stored and broadcast like
+// any other message.
+type IncomingWebhookService struct {
+	repo    ports.IncomingWebhookRepository
+	authz   ports.Authorizer
+	chat    ports.ChatService
+	limiter *RateLimiter
+	now     func() time.Time
+}
+
+// NewIncomingWebhookService creates a new IncomingWebhookService.
+func NewIncomingWebhookService(repo ports.IncomingWebhookRepository, authz ports.Authorizer, chat ports.ChatService) *IncomingWebhookService {
+	if repo == nil || authz == nil || chat == nil {
+		log.Fatal("IncomingWebhookRepository, Authorizer and ChatService cannot be nil in NewIncomingWebhookService")
+	}
+	return &IncomingWebhookService{
+		repo:    repo,
+		authz:   authz,
+		chat:    chat,
+		limiter: NewRateLimiter(IncomingWebhookInterval, IncomingWebhookBurst),
+		now:     time.Now,
+	}
+}
+
+// requireOwner fails unless the principal owns the room.
+func (s *IncomingWebhookService) requireOwner(p *models.Principal, roomID int64) error {
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: only room owners can manage webhooks", ErrForbidden)
+	}
+	return nil
+}
+
+// CreateIncomingWebhook creates an incoming webhook posting to a room as name.
+// The returned token is part of the webhook URL and is not shown again.
+func (s *IncomingWebhookService) CreateIncomingWebhook(p *models.Principal, roomID int64, name string) (*models.IncomingWebhook, string, error) {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return nil, "", err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxWebhookNameLength {
+		return nil, "", fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidInput, maxWebhookNameLength)
+	}
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return nil, "", err
+	}
+
+	hook := &models.IncomingWebhook{
+		RoomID:    roomID,
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hashSecret(secret),
+		CreatedBy: p.ID,
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.repo.CreateIncomingWebhook(hook); err != nil {
+		return nil, "", fmt.Errorf("creating incoming webhook for room %d: %w", roomID, err)
+	}
+	return hook, IncomingWebhookPrefix + prefix + "_" + secret, nil
+}
+
+// ListIncomingWebhooks returns the incoming webhooks of a room the principal owns.
+func (s *IncomingWebhookService) ListIncomingWebhooks(p *models.Principal, roomID int64) ([]models.IncomingWebhook, error) {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListIncomingWebhooks(roomID)
+}
+
+// DeleteIncomingWebhook deletes an incoming webhook of a room the principal
+// owns. Messages it posted are kept.
+func (s *IncomingWebhookService) DeleteIncomingWebhook(p *models.Principal, roomID, hookID int64) error {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return err
+	}
+	hook, err := s.repo.GetIncomingWebhook(hookID)
+	if err != nil {
+		return fmt.Errorf("looking up incoming webhook %d: %w", hookID, err)
+	}
+	if hook == nil || hook.RoomID != roomID {
+		return ErrWebhookNotFound
+	}
+	if err := s.repo.DeleteIncomingWebhook(hookID); err != nil {
+		return fmt.Errorf("deleting incoming webhook %d: %w", hookID, err)
+	}
+	return nil
+}
+
+// Post authenticates a webhook token and posts the message to the webhook's
+// room. Each webhook is rate-limited; the limit is checked before the token
+// so that guessing is throttled too.
+func (s *IncomingWebhookService) Post(token string, in IncomingMessage) (*models.Message, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(token, IncomingWebhookPrefix), "_")
+	if !strings.HasPrefix(token, IncomingWebhookPrefix) || !ok || prefix == "" || secret == "" {
+		return nil, ErrInvalidWebhookToken
+	}
+	if allowed, retryAfter := s.limiter.Allow(prefix); !allowed {
+		return nil, &RateLimitError{RetryAfter: retryAfter}
+	}
+
+	hook, err := s.repo.GetIncomingWebhookByPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("looking up incoming webhook: %w", err)
+	}
+	if hook == nil || !secretMatches(hook.Hash, secret) {
+		return nil, ErrInvalidWebhookToken
+	}
+
+	name := strings.TrimSpace(in.Username)
+	if len(name) > maxWebhookNameLength {
+		return nil, fmt.Errorf("%w: username exceeds %d bytes", ErrInvalidInput, maxWebhookNameLength)
+	}
+	if name == "" {
+		name = hook.Name
+	}
+	principal := &models.Principal{
+		ID:          hook.PrincipalID(),
+		Type:        models.AuthorTypeWebhook,
+		DisplayName: name,
+		Scopes:      []string{models.ScopeMessagesWrite},
+		RoomID:      hook.RoomID,
+	}
+	msg, err := s.chat.SendMessage(principal, ports.MessageDraft{RoomID: hook.RoomID, Text: in.Text, Format: in.Format, Attachments: in.Attachments})
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	if hook.LastUsedAt == nil || now.Sub(*hook.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repo.TouchIncomingWebhook(hook.ID, now); err != nil {
+			log.Printf("Failed to record use of incoming webhook %d: %v", hook.ID, err) // Not fatal for the request
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,155 @@
+package services_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	webhookssqlite "keeper/server/adapters/webhooks/sqlite"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func newTestIncomingWebhookService(t *testing.T) (*services.IncomingWebhookService, *fakeMessages, *fakePublisher, *testClock) {
+	t.Helper()
+	db := newTestDB(t)
+
+	repo := webhookssqlite.NewSQLiteWebhookRepository(db)
+	if err := repo.InitWebhookSchema(); err != nil {
+		t.Fatalf("InitWebhookSchema() failed: %v", err)
+	}
+	rooms := &fakeRooms{
+		rooms: []models.Room{{ID: 1, Name: "table"}, {ID: 2, Name: "other"}},
+		members: []models.RoomMember{
+			{RoomID: 1, UserID: owner.ID, Role: models.RoomRoleOwner},
+			{RoomID: 1, UserID: member.ID, Role: models.RoomRoleMember},
+		},
+	}
+	authz := services.NewRoomAuthorizer(rooms)
+	messages := &fakeMessages{messages: map[int64]*models.Message{}}
+	publisher := &fakePublisher{}
+	chat := services.NewChatService(messages, rooms, authz, publisher)
+
+	svc := services.NewIncomingWebhookService(repo, authz, chat)
+	clock := &testClock{now: time.Date(2026, 5, 1, 20, 0, 0, 0, time.UTC)}
+	svc.SetClock(clock.Now)
+	return svc, messages, publisher, clock
+}
+
+func TestIncomingWebhookService_Post_BroadcastsAsWebhook(t *testing.T) {
+	svc, messages, publisher, _ := newTestIncomingWebhookService(t)
+	hook, token, err := svc.CreateIncomingWebhook(owner, 1, " CI ")
+	if err != nil {
+		t.Fatalf("CreateIncomingWebhook() failed: %v", err)
+	}
+	if hook.Name != "CI" || hook.Prefix == "" || len(hook.Hash) != 64 || strings.Contains(token, hook.Hash) {
+		t.Errorf("Unexpected webhook: %+v", hook)
+	}
+
+	msg, err := svc.Post(token, services.IncomingMessage{
+		Username:    "nightly",
+		Attachments: []models.Attachment{{Title: "Build #42 passed", URL: "https://ci.example.com/42"}},
+	})
+	if err != nil {
+		t.Fatalf("Post() failed: %v", err)
+	}
+	if msg.AuthorType != models.AuthorTypeWebhook || msg.User != "nightly" || msg.UserID != hook.PrincipalID() || msg.RoomID != 1 {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+	if stored, _ := messages.GetMessage(msg.ID); stored == nil || len(stored.Attachments) != 1 {
+		t.Errorf("Expected the message to be stored with its attachment, got %+v", stored)
+	}
+	if len(publisher.events) != 1 || publisher.events[0].Type != models.EventMessageCreated {
+		t.Errorf("Expected one message.created event, got %+v", publisher.events)
+	}
+
+	msg, err = svc.Post(token, services.IncomingMessage{Text: "deploy finished"})
+	if err != nil || msg.User != "CI" {
+		t.Errorf("Expected the webhook name without an override, got %+v, %v", msg, err)
+	}
+	hooks, _ := svc.ListIncomingWebhooks(owner, 1)
+	if len(hooks) != 1 || hooks[0].LastUsedAt == nil {
+		t.Errorf("Expected the use to be recorded, got %+v", hooks)
+	}
+}
+
+func TestIncomingWebhookService_Post_Rejected(t *testing.T) {
+	svc, _, publisher, _ := newTestIncomingWebhookService(t)
+	hook, token, err := svc.CreateIncomingWebhook(owner, 1, "CI")
+	if err != nil {
+		t.Fatalf("CreateIncomingWebhook() failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		in    services.IncomingMessage
+		want  error
+	}{
+		{"malformed token", "nope", services.IncomingMessage{Text: "hi"}, services.ErrInvalidWebhookToken},
+		{"wrong secret", services.IncomingWebhookPrefix + hook.Prefix + "_wrong", services.IncomingMessage{Text: "hi"}, services.ErrInvalidWebhookToken},
+		{"empty message", token, services.IncomingMessage{}, services.ErrInvalidInput},
+		{"attachment without content", token, services.IncomingMessage{Attachments: []models.Attachment{{URL: "https://example.com"}}}, services.ErrInvalidInput},
+		{"javascript link", token, services.IncomingMessage{Attachments: []models.Attachment{{Title: "x", URL: "javascript:alert(1)"}}}, services.ErrInvalidInput},
+		{"bad color", token, services.IncomingMessage{Attachments: []models.Attachment{{Title: "x", Color: "red"}}}, services.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Post(tt.token, tt.in); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if len(publisher.events) != 0 {
+		t.Errorf("Expected no events for rejected messages, got %+v", publisher.events)
+	}
+}
+
+func TestIncomingWebhookService_Post_RateLimited(t *testing.T) {
+	svc, _, _, clock := newTestIncomingWebhookService(t)
+	_, token, err := svc.CreateIncomingWebhook(owner, 1, "CI")
+	if err != nil {
+		t.Fatalf("CreateIncomingWebhook() failed: %v", err)
+	}
+
+	for i := 0; i < services.IncomingWebhookBurst; i++ {
+		if _, err := svc.Post(token, services.IncomingMessage{Text: "ping"}); err != nil {
+			t.Fatalf("Post() %d failed: %v", i+1, err)
+		}
+	}
+	_, err = svc.Post(token, services.IncomingMessage{Text: "ping"})
+	var limited *services.RateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, services.ErrRateLimited) || limited.RetryAfter != services.IncomingWebhookInterval {
+		t.Fatalf("Expected a rate limit error after the burst, got %v", err)
+	}
+
+	clock.Advance(services.IncomingWebhookInterval)
+	if _, err := svc.Post(token, services.IncomingMessage{Text: "ping"}); err != nil {
+		t.Errorf("Expected a message to be allowed after the interval, got %v", err)
+	}
+}
+
+func TestIncomingWebhookService_Manage_OwnersOnly(t *testing.T) {
+	svc, _, _, _ := newTestIncomingWebhookService(t)
+
+	if _, _, err := svc.CreateIncomingWebhook(member, 1, "CI"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for members, got %v", err)
+	}
+	if _, _, err := svc.CreateIncomingWebhook(owner, 1, ""); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput without a name, got %v", err)
+	}
+	hook, token, err := svc.CreateIncomingWebhook(owner, 1, "CI")
+	if err != nil {
+		t.Fatalf("CreateIncomingWebhook() failed: %v", err)
+	}
+	if err := svc.DeleteIncomingWebhook(owner, 1, hook.ID+1); !errors.Is(err, services.ErrWebhookNotFound) {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	if err := svc.DeleteIncomingWebhook(owner, 1, hook.ID); err != nil {
+		t.Fatalf("DeleteIncomingWebhook() failed: %v", err)
+	}
+	if _, err := svc.Post(token, services.IncomingMessage{Text: "hi"}); !errors.Is(err, services.ErrInvalidWebhookToken) {
+		t.Errorf("Expected a deleted webhook's token to be rejected, got %v", err)
+	}
+}
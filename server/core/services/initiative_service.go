@@ -0,0 +1,355 @@
+package services
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// MaxCombatants bounds the combatants of a room's turn order.
+const MaxCombatants = 50
+
+// defaultInitiativeDice is rolled for combatants added without dice.
+const defaultInitiativeDice = "d20"
+
+// ErrCombatantNotFound is returned for combatants that do not exist or
+// belong to another room.
+var ErrCombatantNotFound = errors.New("combatant not found")
+
+// CombatantDraft is a combatant about to join a fight.
+type CombatantDraft struct {
+	Name        string // Defaults to the name of the character
+	CharacterID int64  // A character of the room the principal may play, or 0
+	// Dice are rolled for initiative. Without dice or a fixed Initiative,
+	// coc7 characters act in DEX order and everyone else rolls a d20.
+	Dice       string
+	Initiative *int
+}
+
+// InitiativeService keeps the turn order of fights in rooms. Members add
+// combatants and roll for them; room owners (the GMs) can act for everyone.
+// Every change is published whole as initiative.updated.
+type InitiativeService struct {
+	repo       ports.InitiativeRepository
+	authz      ports.Authorizer
+	events     ports.EventPublisher
+	characters *CharacterService // nil if combatants cannot be characters
+	dice       *DiceRoller
+	now        func() time.Time
+	mu         sync.Mutex // Serializes changes, so that turns are not skipped
+}
+
+// NewInitiativeService creates a new InitiativeService.
+func NewInitiativeService(repo ports.InitiativeRepository, authz ports.Authorizer, events ports.EventPublisher) *InitiativeService {
+	if repo == nil || authz == nil || events == nil {
+		log.Fatal("InitiativeRepository, Authorizer and EventPublisher cannot be nil in NewInitiativeService")
+	}
+	return &InitiativeService{repo: repo, authz: authz, events: events, dice: NewDiceRoller(), now: time.Now}
+}
+
+// SetCharacters lets characters of the room join fights.
+func (s *InitiativeService) SetCharacters(characters *CharacterService) {
+	s.characters = characters
+}
+
+// Initiative returns the turn order of a room. It has no combatants if
+// nobody is fighting.
+func (s *InitiativeService) Initiative(p *models.Principal, roomID int64) (*models.Initiative, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.load(roomID)
+}
+
+// AddCombatant adds a combatant to the turn order of a room. Characters
+// must be ones the principal may play.
+func (s *InitiativeService) AddCombatant(p *models.Principal, roomID int64, draft CombatantDraft) (*models.Initiative, error) {
+	combatant := models.Combatant{RoomID: roomID, OwnerID: p.ID, Initiative: draft.Initiative}
+	if draft.Dice != "" {
+		if _, err := parseDice(draft.Dice); err != nil {
+			return nil, err
+		}
+		combatant.Dice = strings.ToLower(strings.Join(strings.Fields(draft.Dice), ""))
+	}
+	if draft.CharacterID != 0 {
+		if err := s.joinAs(p, roomID, draft.CharacterID, &combatant); err != nil {
+			return nil, err
+		}
+	}
+	if name := strings.Join(strings.Fields(draft.Name), " "); name != "" {
+		combatant.Name = name
+	}
+	if combatant.Name == "" || len(combatant.Name) > MaxCharacterNameLength {
+		return nil, fmt.Errorf("%w: combatant name must be 1 to %d bytes", ErrInvalidInput, MaxCharacterNameLength)
+	}
+	if combatant.Dice == "" && combatant.Initiative == nil {
+		combatant.Dice = defaultInitiativeDice
+	}
+
+	return s.change(p, roomID, func(member *models.RoomMember, initiative *models.Initiative) error {
+		if len(initiative.Combatants) >= MaxCombatants {
+			return fmt.Errorf("%w: a fight can have at most %d combatants", ErrInvalidInput, MaxCombatants)
+		}
+		combatant.CreatedAt = s.now().UTC()
+		if err := s.repo.CreateCombatant(&combatant); err != nil {
+			return fmt.Errorf("adding combatant %s to room %d: %w", combatant.Name, roomID, err)
+		}
+		initiative.Combatants = append(initiative.Combatants, combatant)
+		return nil
+	})
+}
+
+// joinAs makes a combatant the given character. Without dice or a fixed
+// initiative, a character with a DEX characteristic acts in DEX order.
+func (s *InitiativeService) joinAs(p *models.Principal, roomID, characterID int64, combatant *models.Combatant) error {
+	if s.characters == nil {
+		return fmt.Errorf("%w: characters are disabled", ErrInvalidInput)
+	}
+	character, err := s.characters.Speaker(p, roomID, characterID)
+	if err != nil {
+		return err
+	}
+	combatant.CharacterID, combatant.Name = character.ID, character.Name
+	if combatant.Dice != "" || combatant.Initiative != nil {
+		return nil
+	}
+	_, _, dex, err := s.characters.Skill(p, roomID, character.ID, "", "DEX")
+	switch {
+	case err == nil:
+		combatant.Initiative = &dex
+	case !errors.Is(err, ErrInvalidInput):
+		return err
+	}
+	return nil
+}
+
+// RemoveCombatant takes a combatant out of the fight. If it was their turn,
+// the next combatant's turn begins.
+func (s *InitiativeService) RemoveCombatant(p *models.Principal, roomID, combatantID int64) (*models.Initiative, error) {
+	return s.change(p, roomID, func(member *models.RoomMember, initiative *models.Initiative) error {
+		i := slices.IndexFunc(initiative.Combatants, func(c models.Combatant) bool { return c.ID == combatantID })
+		if i < 0 {
+			return ErrCombatantNotFound
+		}
+		if err := canControl(p, member, &initiative.Combatants[i]); err != nil {
+			return err
+		}
+		if initiative.TurnID == combatantID {
+			advance(initiative)
+		}
+		if err := s.repo.DeleteCombatant(combatantID); err != nil {
+			return fmt.Errorf("removing combatant %d: %w", combatantID, err)
+		}
+		initiative.Combatants = slices.Delete(initiative.Combatants, i, i+1)
+		if len(initiative.Combatants) == 0 {
+			initiative.Round, initiative.TurnID = 0, 0
+		}
+		return nil
+	})
+}
+
+// RollInitiative rolls the dice of a combatant, or with combatantID 0, of
+// every combatant the principal controls that has not rolled yet.
+func (s *InitiativeService) RollInitiative(p *models.Principal, roomID, combatantID int64) (*models.Initiative, error) {
+	return s.change(p, roomID, func(member *models.RoomMember, initiative *models.Initiative) error {
+		rolled := 0
+		for i := range initiative.Combatants {
+			c := &initiative.Combatants[i]
+			switch {
+			case combatantID != 0 && c.ID != combatantID:
+				continue
+			case combatantID == 0 && (c.Initiative != nil || c.Dice == "" || canControl(p, member, c) != nil):
+				continue
+			}
+			if err := canControl(p, member, c); err != nil {
+				return err
+			}
+			if c.Dice == "" {
+				return fmt.Errorf("%w: %s acts on a fixed initiative", ErrInvalidInput, c.Name)
+			}
+			roll, err := s.dice.Roll(c.Dice, "Initiative")
+			if err != nil {
+				return err
+			}
+			total := roll.Total
+			c.Initiative, c.Roll = &total, roll
+			if err := s.repo.UpdateCombatant(c); err != nil {
+				return fmt.Errorf("saving initiative of combatant %d: %w", c.ID, err)
+			}
+			rolled++
+		}
+		switch {
+		case combatantID != 0 && rolled == 0:
+			return ErrCombatantNotFound
+		case rolled == 0:
+			return fmt.Errorf("%w: everyone you control has rolled already", ErrInvalidInput)
+		}
+		return nil
+	})
+}
+
+// NextTurn ends the current turn and begins the next combatant's, starting
+// a new round after the last one. The first call starts round 1. Room owners
+// and whoever controls the current combatant may end a turn.
+func (s *InitiativeService) NextTurn(p *models.Principal, roomID int64) (*models.Initiative, error) {
+	return s.change(p, roomID, func(member *models.RoomMember, initiative *models.Initiative) error {
+		if len(initiative.Combatants) == 0 {
+			return fmt.Errorf("%w: nobody is fighting, add combatants first", ErrInvalidInput)
+		}
+		if member.Role != models.RoomRoleOwner {
+			i := slices.IndexFunc(initiative.Combatants, func(c models.Combatant) bool { return c.ID == initiative.TurnID })
+			if i < 0 || initiative.Combatants[i].OwnerID != p.ID {
+				return fmt.Errorf("%w: only room owners and the combatant whose turn it is can end a turn", ErrForbidden)
+			}
+		}
+		advance(initiative)
+		return nil
+	})
+}
+
+// EndCombat removes the turn order of a room. Only owners can end a fight.
+func (s *InitiativeService) EndCombat(p *models.Principal, roomID int64) error {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return err
+	}
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: only room owners can end a fight", ErrForbidden)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.repo.DeleteInitiative(roomID); err != nil {
+		return fmt.Errorf("ending the fight in room %d: %w", roomID, err)
+	}
+	initiative := &models.Initiative{RoomID: roomID, Combatants: []models.Combatant{}, UpdatedAt: s.now().UTC()}
+	s.events.Publish(models.Event{Type: models.EventInitiativeUpdated, RoomID: roomID, Initiative: initiative})
+	return nil
+}
+
+// change applies fn to the turn order of a room under the lock, then saves
+// and publishes the result. fn stores changes to combatants itself.
+func (s *InitiativeService) change(p *models.Principal, roomID int64, fn func(member *models.RoomMember, initiative *models.Initiative) error) (*models.Initiative, error) {
+	if err := RequireScope(p, models.ScopeMessagesWrite); err != nil {
+		return nil, err
+	}
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	initiative, err := s.load(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(member, initiative); err != nil {
+		return nil, err
+	}
+	sortCombatants(initiative.Combatants)
+	initiative.UpdatedAt = s.now().UTC()
+	if err := s.repo.SaveInitiative(initiative); err != nil {
+		return nil, fmt.Errorf("saving initiative of room %d: %w", roomID, err)
+	}
+	s.events.Publish(models.Event{Type: models.EventInitiativeUpdated, RoomID: roomID, Initiative: initiative})
+	return initiative, nil
+}
+
+// load reads the turn order of a room with its combatants in turn order.
+func (s *InitiativeService) load(roomID int64) (*models.Initiative, error) {
+	initiative, err := s.repo.GetInitiative(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up initiative of room %d: %w", roomID, err)
+	}
+	if initiative == nil {
+		initiative = &models.Initiative{RoomID: roomID}
+	}
+	combatants, err := s.repo.ListCombatants(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("listing combatants of room %d: %w", roomID, err)
+	}
+	sortCombatants(combatants)
+	initiative.Combatants = combatants
+	return initiative, nil
+}
+
+// canControl checks that the principal may roll for or remove a combatant:
+// whoever added it, or a room owner.
+func canControl(p *models.Principal, member *models.RoomMember, combatant *models.Combatant) error {
+	if combatant.OwnerID != p.ID && member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: %s is not yours to control", ErrForbidden, combatant.Name)
+	}
+	return nil
+}
+
+// advance passes the turn to the next combatant in order. After the last
+// one, or before the first turn, a new round begins with the first.
+func advance(initiative *models.Initiative) {
+	next := 0
+	for i, c := range initiative.Combatants {
+		if c.ID == initiative.TurnID {
+			next = i + 1
+		}
+	}
+	if initiative.Round == 0 || next >= len(initiative.Combatants) {
+		initiative.Round++
+		next = 0
+	}
+	initiative.TurnID = initiative.Combatants[next].ID
+}
+
+// sortCombatants puts combatants in turn order: highest initiative first,
+// those yet to roll last, and ties in the order they joined.
+func sortCombatants(combatants []models.Combatant) {
+	slices.SortFunc(combatants, func(a, b models.Combatant) int {
+		switch {
+		case a.Initiative == nil && b.Initiative == nil:
+		case a.Initiative == nil:
+			return 1
+		case b.Initiative == nil:
+			return -1
+		case *a.Initiative != *b.Initiative:
+			return cmp.Compare(*b.Initiative, *a.Initiative)
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+// describeInitiative renders a turn order as text, marking whose turn it is.
+func describeInitiative(initiative *models.Initiative) string {
+	if len(initiative.Combatants) == 0 {
+		return "Nobody is fighting. Add combatants with /init add <name> [dice]."
+	}
+	var b strings.Builder
+	if initiative.Round == 0 {
+		b.WriteString("Not started; /init next begins round 1.")
+	} else {
+		fmt.Fprintf(&b, "Round %d:", initiative.Round)
+	}
+	for _, c := range initiative.Combatants {
+		marker, value := "  ", "?"
+		if c.ID == initiative.TurnID {
+			marker = "> "
+		}
+		if c.Initiative != nil {
+			value = fmt.Sprint(*c.Initiative)
+		}
+		fmt.Fprintf(&b, "\n%s%s %s (#%d)", marker, value, c.Name, c.ID)
+	}
+	return b.String()
+}
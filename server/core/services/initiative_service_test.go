@@ -0,0 +1,173 @@
+package services_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	characterssqlite "keeper/server/adapters/characters/sqlite"
+	initiativesqlite "keeper/server/adapters/initiative/sqlite"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func newTestInitiativeService(t *testing.T) (*services.ChatService, *services.InitiativeService, *services.CharacterService, *fakePublisher) {
+	t.Helper()
+	chat, _, rooms, publisher := newTestCommandRegistry(t)
+	db := newTestDB(t)
+	characterRepo := characterssqlite.NewSQLiteCharacterRepository(db)
+	if err := characterRepo.InitCharacterSchema(); err != nil {
+		t.Fatalf("InitCharacterSchema() failed: %v", err)
+	}
+	initiativeRepo := initiativesqlite.NewSQLiteInitiativeRepository(db)
+	if err := initiativeRepo.InitInitiativeSchema(); err != nil {
+		t.Fatalf("InitInitiativeSchema() failed: %v", err)
+	}
+	authz := services.NewRoomAuthorizer(rooms)
+	characters := services.NewCharacterService(characterRepo, rooms, authz)
+	chat.SetCharacters(characters)
+	initiative := services.NewInitiativeService(initiativeRepo, authz, publisher)
+	initiative.SetCharacters(characters)
+	chat.SetInitiative(initiative)
+	return chat, initiative, characters, publisher
+}
+
+// turnOrder lists the names of the combatants in turn order, marking whose turn it is.
+func turnOrder(initiative *models.Initiative) string {
+	names := make([]string, 0, len(initiative.Combatants))
+	for _, c := range initiative.Combatants {
+		if c.ID == initiative.TurnID {
+			names = append(names, ">"+c.Name)
+		} else {
+			names = append(names, c.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func TestInitiativeService_Turns(t *testing.T) {
+	chat, initiative, characters, publisher := newTestInitiativeService(t)
+	harveyWalters, err := characters.CreateCharacter(member, 1, services.CharacterDraft{Name: "Harvey Walters", Sheet: json.RawMessage(harvey)})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+
+	state, err := initiative.AddCombatant(member, 1, services.CombatantDraft{CharacterID: harveyWalters.ID})
+	if err != nil {
+		t.Fatalf("AddCombatant() failed: %v", err)
+	}
+	harveyInit := state.Combatants[0]
+	if harveyInit.Name != "Harvey Walters" || harveyInit.Initiative == nil || *harveyInit.Initiative != 55 || harveyInit.Dice != "" {
+		t.Errorf("Expected Harvey to act on his DEX of 55, got %+v", harveyInit)
+	}
+	if _, err := initiative.AddCombatant(owner, 1, services.CombatantDraft{Name: "Cultist", Dice: "D20 + 2"}); err != nil {
+		t.Fatalf("AddCombatant() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(owner, 1, "/init add Dog"); err != nil {
+		t.Fatalf("/init add failed: %v", err)
+	}
+
+	if _, err := initiative.RollInitiative(member, 1, 0); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput with nobody left to roll for, got %v", err)
+	}
+	initiative.SetDice(sequence(t, 15, 20))
+	state, err = initiative.RollInitiative(owner, 1, 0)
+	if err != nil {
+		t.Fatalf("RollInitiative() failed: %v", err)
+	}
+	if got := turnOrder(state); got != "Harvey Walters, Dog, Cultist" || state.Round != 0 {
+		t.Errorf("Expected Harvey (55), Dog (20) and Cultist (17) before round 1, got %q in round %d", got, state.Round)
+	}
+	if cultist := state.Combatants[2]; cultist.Dice != "d20+2" || cultist.Roll == nil || cultist.Roll.Total != 17 {
+		t.Errorf("Expected the cultist's roll, got %+v", cultist)
+	}
+
+	steps := []struct {
+		principal *models.Principal
+		want      string
+		round     int
+		err       error
+	}{
+		{member, "", 0, services.ErrForbidden},
+		{owner, ">Harvey Walters, Dog, Cultist", 1, nil},
+		{member, "Harvey Walters, >Dog, Cultist", 1, nil},
+		{member, "", 0, services.ErrForbidden},
+		{owner, "Harvey Walters, Dog, >Cultist", 1, nil},
+		{owner, ">Harvey Walters, Dog, Cultist", 2, nil},
+	}
+	for i, step := range steps {
+		state, err := initiative.NextTurn(step.principal, 1)
+		if !errors.Is(err, step.err) {
+			t.Fatalf("Step %d: expected %v, got %v", i, step.err, err)
+		}
+		if err == nil && (turnOrder(state) != step.want || state.Round != step.round) {
+			t.Errorf("Step %d: expected %q in round %d, got %q in round %d", i, step.want, step.round, turnOrder(state), state.Round)
+		}
+	}
+
+	if _, err := chat.PostMessage(member, 1, "/init remove Cultist"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden removing the GM's combatant, got %v", err)
+	}
+	state, err = initiative.RemoveCombatant(member, 1, harveyInit.ID)
+	if err != nil || turnOrder(state) != ">Dog, Cultist" || state.Round != 2 {
+		t.Errorf("Expected the dog's turn after removing Harvey, got %+v, %v", state, err)
+	}
+	last := publisher.events[len(publisher.events)-1]
+	if last.Type != models.EventInitiativeUpdated || last.Initiative == nil || turnOrder(last.Initiative) != ">Dog, Cultist" {
+		t.Errorf("Expected the turn order to be published, got %+v", last)
+	}
+
+	reply, err := chat.PostMessage(member, 1, "/init")
+	if err != nil || !reply.Ephemeral || !strings.Contains(reply.Text, "Round 2:\n> 20 Dog") {
+		t.Errorf("Expected the turn order with the dog's turn marked, got %+v, %v", reply, err)
+	}
+	if _, err := initiative.Initiative(hermit, 1); !errors.Is(err, services.ErrNotRoomMember) {
+		t.Errorf("Expected ErrNotRoomMember for a non-member, got %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "/init end"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden ending the fight as a player, got %v", err)
+	}
+	if err := initiative.EndCombat(owner, 1); err != nil {
+		t.Fatalf("EndCombat() failed: %v", err)
+	}
+	if state, err := initiative.Initiative(member, 1); err != nil || len(state.Combatants) != 0 || state.Round != 0 {
+		t.Errorf("Expected no fight after it ended, got %+v, %v", state, err)
+	}
+}
+
+func TestInitiativeService_AddCombatant_Invalid(t *testing.T) {
+	chat, initiative, characters, _ := newTestInitiativeService(t)
+	npc, err := characters.CreateCharacter(owner, 1, services.CharacterDraft{Name: "Cultist", Sheet: json.RawMessage(harvey)})
+	if err != nil {
+		t.Fatalf("CreateCharacter() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		roomID    int64
+		draft     services.CombatantDraft
+		want      error
+	}{
+		{"no name", member, 1, services.CombatantDraft{}, services.ErrInvalidInput},
+		{"bad dice", member, 1, services.CombatantDraft{Name: "Dog", Dice: "d0"}, services.ErrInvalidInput},
+		{"someone else's character", member, 1, services.CombatantDraft{CharacterID: npc.ID}, services.ErrForbidden},
+		{"character of another room", owner, 2, services.CombatantDraft{CharacterID: npc.ID}, services.ErrCharacterNotFound},
+		{"non-member", hermit, 1, services.CombatantDraft{Name: "Dog"}, services.ErrNotRoomMember},
+		{"bot without write scope", diceBot, 1, services.CombatantDraft{Name: "Dog"}, services.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := initiative.AddCombatant(tt.principal, tt.roomID, tt.draft); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, err := chat.PostMessage(member, 1, "/init roll Nobody"); !errors.Is(err, services.ErrCombatantNotFound) {
+		t.Errorf("Expected ErrCombatantNotFound, got %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "/init next"); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput with nobody fighting, got %v", err)
+	}
+}
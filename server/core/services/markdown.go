@@ -0,0 +1,446 @@
+package services
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxMarkdownNesting limits how deep quotes, lists, emphasis and links nest.
+// Deeper markup is shown as text.
+const maxMarkdownNesting = 8
+
+// autolinkPattern matches a bare link at the start of text, like linkPattern.
+var autolinkPattern = regexp.MustCompile(`(?i)^https?://[^\s<>"'` + "`" + `]+`)
+
+// codeLanguagePattern is what the info string of a code block may name.
+var codeLanguagePattern = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+
+// RenderMarkdown turns the Markdown of a message into HTML, so that every
+// client shows it the same way. It supports what chat needs: paragraphs with
+// line breaks, headings, emphasis (*em*, **strong**, ~~del~~), code spans and
+// fenced code blocks, links and bare URLs, block quotes, lists and rules.
+//
+// The HTML is built from these elements alone, so it is safe to show as is:
+// HTML in the text is escaped, and links must be http, https or mailto.
+func RenderMarkdown(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var out strings.Builder
+	renderBlocks(&out, lines, 0)
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// renderBlocks renders lines as a sequence of blocks.
+func renderBlocks(out *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := strings.TrimLeft(lines[i], " ")
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case codeFence(line) != "":
+			i = renderCodeBlock(out, lines, i)
+		case headingLevel(line) > 0:
+			level := headingLevel(line)
+			title := strings.TrimRight(strings.TrimSpace(line[level:]), "#")
+			tag := "h" + strconv.Itoa(level)
+			out.WriteString("<" + tag + ">" + renderInline(strings.TrimSpace(title), depth) + "</" + tag + ">\n")
+			i++
+		case isRule(line):
+			out.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(line, ">") && depth < maxMarkdownNesting:
+			var quoted []string
+			for ; i < len(lines); i++ {
+				line := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(line, ">") {
+					break
+				}
+				quoted = append(quoted, strings.TrimPrefix(line[1:], " "))
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted, depth+1)
+			out.WriteString("</blockquote>\n")
+		case isListItem(line) && depth < maxMarkdownNesting:
+			i = renderList(out, lines, i, depth)
+		default:
+			start := i
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !startsBlock(lines[i]); i++ {
+			}
+			out.WriteString("<p>" + renderInline(strings.Join(lines[start:i], "\n"), depth) + "</p>\n")
+		}
+	}
+}
+
+// startsBlock reports whether a line starts a block other than a paragraph,
+// which ends the paragraph before it.
+func startsBlock(line string) bool {
+	line = strings.TrimLeft(line, " ")
+	return codeFence(line) != "" || headingLevel(line) > 0 || isRule(line) || strings.HasPrefix(line, ">") || isListItem(line)
+}
+
+// codeFence returns the fence a line opens a code block with, like ``` or
+// ~~~~, or "" if it does not.
+func codeFence(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := countRun(line, line[0])
+	if n < 3 || (line[0] == '`' && strings.Contains(line[n:], "`")) {
+		return ""
+	}
+	return line[:n]
+}
+
+// renderCodeBlock renders the fenced code block starting at lines[i] and
+// returns the index of the line after it. Blocks that are not closed run
+// to the end of the message.
+func renderCodeBlock(out *strings.Builder, lines []string, i int) int {
+	indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+	open := lines[i][indent:]
+	fence := codeFence(open)
+	class := ""
+	if info := strings.Fields(open[len(fence):]); len(info) > 0 && codeLanguagePattern.MatchString(info[0]) {
+		class = ` class="language-` + html.EscapeString(info[0]) + `"`
+	}
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := strings.TrimLeft(lines[i], " ")
+		if countRun(line, fence[0]) >= len(fence) && strings.TrimSpace(strings.TrimLeft(line, fence[:1])) == "" {
+			i++
+			break
+		}
+		strip := min(indent, len(lines[i])-len(line))
+		code = append(code, lines[i][strip:])
+	}
+	out.WriteString("<pre><code" + class + ">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+	return i
+}
+
+// headingLevel returns the level of an ATX heading like "## Clues", or 0.
+func headingLevel(line string) int {
+	n := countRun(line, '#')
+	if n == 0 || n > 6 || (n < len(line) && line[n] != ' ' && line[n] != '\t') {
+		return 0
+	}
+	return n
+}
+
+// isRule reports whether a line is a thematic break such as --- or * * *.
+func isRule(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.IndexByte("-*_", line[0]) < 0 {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case line[0]:
+			n++
+		case ' ', '\t':
+		default:
+			return false
+		}
+	}
+	return n >= 3
+}
+
+// listMarker parses the marker of a list item: "-", "*" or "+" for bullets,
+// or a number followed by "." or ")". It returns the number of an ordered
+// item and the width of the marker including the space after it.
+func listMarker(line string) (ordered bool, number int, width int, ok bool) {
+	if len(line) >= 2 && strings.IndexByte("-*+", line[0]) >= 0 && line[1] == ' ' {
+		return false, 0, 2, true
+	}
+	digits := 0
+	for digits < len(line) && digits < 9 && line[digits] >= '0' && line[digits] <= '9' {
+		digits++
+	}
+	if digits == 0 || digits+1 >= len(line) || (line[digits] != '.' && line[digits] != ')') || line[digits+1] != ' ' {
+		return false, 0, 0, false
+	}
+	number, _ = strconv.Atoi(line[:digits])
+	return true, number, digits + 2, true
+}
+
+func isListItem(line string) bool {
+	_, _, _, ok := listMarker(line)
+	return ok
+}
+
+// renderList renders the list starting at lines[i] and returns the index of
+// the line after it. Lines indented past the marker belong to the item
+// above, so lists nest. A blank line ends the list.
+func renderList(out *strings.Builder, lines []string, i, depth int) int {
+	indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+	ordered, number, _, _ := listMarker(lines[i][indent:])
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	if ordered && number != 1 {
+		out.WriteString(`<ol start="` + strconv.Itoa(number) + `">` + "\n")
+	} else {
+		out.WriteString("<" + tag + ">\n")
+	}
+	for i < len(lines) {
+		line := strings.TrimLeft(lines[i], " ")
+		itemOrdered, _, width, ok := listMarker(line)
+		if !ok || itemOrdered != ordered || isRule(line) || len(lines[i])-len(line) != indent {
+			break
+		}
+		item := []string{line[width:]}
+		for i++; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+			nested := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+			if nested <= indent {
+				break
+			}
+			item = append(item, lines[i][min(nested, indent+width):])
+		}
+		// The text of the item is shown inline, and blocks after it, such
+		// as a nested list, below it.
+		text := 0
+		if !startsBlock(item[0]) {
+			for text = 1; text < len(item) && !startsBlock(item[text]); text++ {
+			}
+		}
+		out.WriteString("<li>" + renderInline(strings.Join(item[:text], "\n"), depth+1))
+		if text < len(item) {
+			out.WriteString("\n")
+			renderBlocks(out, item[text:], depth+1)
+		}
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderInline renders the spans of a block of text.
+func renderInline(text string, depth int) string {
+	var out strings.Builder
+	inline(&out, text, depth, false)
+	return out.String()
+}
+
+// inline renders emphasis, code, links and line breaks in s. Links are not
+// made inside links.
+func inline(out *strings.Builder, s string, depth int, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			out.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '\n':
+			out.WriteString("<br>\n")
+			i++
+			continue
+		case c == '`':
+			run := countRun(s[i:], '`')
+			if end := findRun(s[i+run:], '`', run); end >= 0 {
+				code := strings.ReplaceAll(s[i+run:i+run+end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+					code = code[1 : len(code)-1]
+				}
+				out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += 2*run + end
+				continue
+			}
+			out.WriteString(s[i : i+run])
+			i += run
+			continue
+		case c == '[' && !inLink && depth < maxMarkdownNesting:
+			if label, dest, n, ok := parseLink(s[i:]); ok {
+				if href := safeHref(dest); href != "" {
+					out.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">`)
+					inline(out, label, depth+1, true)
+					out.WriteString("</a>")
+					i += n
+					continue
+				}
+			}
+		case c == '*' || c == '_' || c == '~':
+			run := countRun(s[i:], c)
+			if depth < maxMarkdownNesting {
+				if n, ok := emphasis(out, s, i, depth, inLink); ok {
+					i += n
+					continue
+				}
+			}
+			out.WriteString(s[i : i+run])
+			i += run
+			continue
+		case (c == 'h' || c == 'H') && !inLink && (i == 0 || !isAlphanumeric(s[i-1])):
+			if match := autolinkPattern.FindString(s[i:]); match != "" {
+				if link := trimLink(match); safeHref(link) != "" {
+					escaped := html.EscapeString(link)
+					out.WriteString(`<a href="` + escaped + `" rel="nofollow noopener noreferrer">` + escaped + "</a>")
+					i += len(link)
+					continue
+				}
+			}
+		}
+		j := i + 1
+		for j < len(s) && strings.IndexByte("\\\n`[*_~hH", s[j]) < 0 {
+			j++
+		}
+		out.WriteString(html.EscapeString(s[i:j]))
+		i = j
+	}
+}
+
+// emphasis renders the span delimited by *, **, _, __ or ~~ at s[i] and
+// returns how much of s it took. Delimiters must hug the text they
+// enclose, and underscores inside words, as in snake_case, are text.
+func emphasis(out *strings.Builder, s string, i, depth int, inLink bool) (int, bool) {
+	c := s[i]
+	run := countRun(s[i:], c)
+	size, tag := 1, "em"
+	switch {
+	case c == '~' && run == 2:
+		size, tag = 2, "del"
+	case c == '~':
+		return 0, false
+	case run == 2:
+		size, tag = 2, "strong"
+	case run != 1:
+		return 0, false
+	}
+	if c == '_' && i > 0 && isAlphanumeric(s[i-1]) {
+		return 0, false
+	}
+	rest := s[i+size:]
+	if rest == "" || isWhitespace(rest[0]) {
+		return 0, false
+	}
+	for k := 0; k < len(rest); {
+		if rest[k] == '`' {
+			// Delimiters in code spans do not count.
+			n := countRun(rest[k:], '`')
+			if end := findRun(rest[k+n:], '`', n); end >= 0 {
+				k += 2*n + end
+			} else {
+				k += n
+			}
+			continue
+		}
+		if rest[k] != c {
+			k++
+			continue
+		}
+		n := countRun(rest[k:], c)
+		after := k + n
+		if n == size && k > 0 && !isWhitespace(rest[k-1]) && (c != '_' || after == len(rest) || !isAlphanumeric(rest[after])) {
+			out.WriteString("<" + tag + ">")
+			inline(out, rest[:k], depth+1, inLink)
+			out.WriteString("</" + tag + ">")
+			return 2*size + k, true
+		}
+		k = after
+	}
+	return 0, false
+}
+
+// parseLink parses an inline link like [text](https://example.com) at the
+// start of s. It returns the text, the destination and the length of the
+// link.
+func parseLink(s string) (label, dest string, n int, ok bool) {
+	depth := 0
+	end := -1
+	for i := 0; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				end = i
+			}
+		case '\n':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				return "", "", 0, false
+			}
+		}
+	}
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", 0, false
+	}
+	parens := 0
+	for i := end + 2; i < len(s); i++ {
+		switch {
+		case isWhitespace(s[i]):
+			return "", "", 0, false
+		case s[i] == '(':
+			parens++
+		case s[i] == ')' && parens > 0:
+			parens--
+		case s[i] == ')':
+			dest = strings.TrimSuffix(strings.TrimPrefix(s[end+2:i], "<"), ">")
+			return s[1:end], dest, i + 1, dest != ""
+		}
+	}
+	return "", "", 0, false
+}
+
+// safeHref returns the link if it may be followed from a message: http and
+// https links with a host, and mailto links.
+func safeHref(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return ""
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return ""
+		}
+	default:
+		return ""
+	}
+	return link
+}
+
+// countRun returns how many times c repeats at the start of s.
+func countRun(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// findRun returns the index of the first run of exactly n c's in s, or -1.
+func findRun(s string, c byte, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != c {
+			i++
+			continue
+		}
+		run := countRun(s[i:], c)
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+func isASCIIPunct(c byte) bool {
+	return c >= '!' && c <= '/' || c >= ':' && c <= '@' || c >= '[' && c <= '`' || c >= '{' && c <= '~'
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
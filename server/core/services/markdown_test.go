@@ -0,0 +1,60 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+
+	"keeper/server/core/services"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"paragraphs and line breaks", "The door creaks.\nSomething moves.\n\nRoll Listen.", "<p>The door creaks.<br>\nSomething moves.</p>\n<p>Roll Listen.</p>"},
+		{"emphasis", "**bold**, *em*, _em_, __strong__ and ~~gone~~", "<p><strong>bold</strong>, <em>em</em>, <em>em</em>, <strong>strong</strong> and <del>gone</del></p>"},
+		{"nested emphasis", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>"},
+		{"not emphasis", "snake_case_name, 2 * 3 * 4, **open and * alone", "<p>snake_case_name, 2 * 3 * 4, **open and * alone</p>"},
+		{"code span", "Use `/roll 1d6 *2*` or `` a`b ``", "<p>Use <code>/roll 1d6 *2*</code> or <code>a`b</code></p>"},
+		{"escapes", `\*not em\* and \<b>`, "<p>*not em* and &lt;b&gt;</p>"},
+		{"heading", "## The Dunwich Horror ##", "<h2>The Dunwich Horror</h2>"},
+		{"not a heading", "#hashtag", "<p>#hashtag</p>"},
+		{"code block", "```go\nfmt.Println(\"<hi>\")\n\n```\nafter", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n<p>after</p>"},
+		{"unclosed code block", "~~~\n*x*", "<pre><code>*x*</code></pre>"},
+		{"bad language", "```\"><script>\nx\n```", "<pre><code>x</code></pre>"},
+		{"lists", "Bring:\n- a lamp\n- *rope*\n  - 50 feet\n\n3. first\n4. second", "<p>Bring:</p>\n<ul>\n<li>a lamp</li>\n<li><em>rope</em>\n<ul>\n<li>50 feet</li>\n</ul>\n</li>\n</ul>\n<ol start=\"3\">\n<li>first</li>\n<li>second</li>\n</ol>"},
+		{"quote", "> It is not dead\n> which can eternal lie\n\nrule:\n\n---", "<blockquote>\n<p>It is not dead<br>\nwhich can eternal lie</p>\n</blockquote>\n<p>rule:</p>\n<hr>"},
+		{"links", "[the wiki](https://example.com/a_(b)) and https://example.org/x.", `<p><a href="https://example.com/a_(b)" rel="nofollow noopener noreferrer">the wiki</a> and <a href="https://example.org/x" rel="nofollow noopener noreferrer">https://example.org/x</a>.</p>`},
+		{"mail link", "[mail me](mailto:keeper@example.com)", `<p><a href="mailto:keeper@example.com" rel="nofollow noopener noreferrer">mail me</a></p>`},
+		{"no links in links", "[see https://a.example](https://b.example)", `<p><a href="https://b.example" rel="nofollow noopener noreferrer">see https://a.example</a></p>`},
+	}
+	for _, tt := range tests {
+		if got := services.RenderMarkdown(tt.text); got != tt.want {
+			t.Errorf("%s: RenderMarkdown(%q) =\n%s\nwant\n%s", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdown_IsSafe(t *testing.T) {
+	for _, text := range []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](JavaScript:alert(1))`,
+		`[click](data:text/html;base64,PHNjcmlwdD4=)`,
+		`[x](https://example.com/"onmouseover="alert(1))`,
+		`https://example.com/"><script>alert(1)</script>`,
+		"**<svg onload=alert(1)>**\n- <iframe>\n> <style>",
+		"```\n</code></pre><script>alert(1)</script>\n```",
+		strings.Repeat(">", 500) + " deep",
+		strings.Repeat("[", 500) + "x" + strings.Repeat("](https://a.example)", 500),
+		strings.Repeat("**", 500),
+	} {
+		got := services.RenderMarkdown(text)
+		for _, bad := range []string{"<script", "<img", "<svg", "<iframe", "<style", `href="javascript`, `href="JavaScript`, `href="data`, `"onmouseover`} {
+			if strings.Contains(got, bad) {
+				t.Errorf("RenderMarkdown(%q) contains %q:\n%s", text, bad, got)
+			}
+		}
+	}
+}
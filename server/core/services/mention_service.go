@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+const (
+	mentionQueueSize     = 1024
+	mentionLookupTimeout = 5 * time.Second
+)
+
+// mentionPattern finds @name in text. The @ must not follow a letter, digit
+// or dot, so email addresses are not mentions. Punctuation at the end of a
+// name is trimmed by ParseMentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\pL\pN_.@])@([\pL\pN][\pL\pN._-]*)`)
+
+// ParseMentions returns the names mentioned in text, once each, and whether
+// it mentions @room or @here.
+func ParseMentions(text string) (names []string, room, here bool) {
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(match[1], "._-")
+		switch strings.ToLower(name) {
+		case "room":
+			room = true
+		case "here":
+			here = true
+		default:
+			if !slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) }) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, room, here
+}
+
+// MentionService keeps the mentions inbox of every user. It is an event
+// publisher: created, edited, revealed and deleted messages are queued, and
+// Run records their mentions, publishing each new one as mention.created to
+// the mentioned user alone, wherever they are. Mentions of deleted messages
+// are forgotten.
+//
+// Names are resolved against the members of the room who can see the
+// message, by nickname, first name, display name, the local part of their
+// email address or identity ID, from one listing of the directory. Whispers mention everyone they are shown to
+// directly, as their direct messages; hidden rolls do not. Authors do not
+// mention themselves, and service accounts are never mentioned.
+type MentionService struct {
+	repo      ports.MentionRepository
+	rooms     ports.RoomRepository
+	messages  ports.MessageRepository
+	directory ports.IdentityDirectory
+	presence  ports.Presence
+	events    ports.EventPublisher
+	queue     chan models.Event
+	now       func() time.Time
+}
+
+// NewMentionService creates a MentionService. Mention notifications are
+// published to events, which must not include the service itself.
+func NewMentionService(repo ports.MentionRepository, rooms ports.RoomRepository, messages ports.MessageRepository, directory ports.IdentityDirectory, presence ports.Presence, events ports.EventPublisher) *MentionService {
+	if repo == nil || rooms == nil || messages == nil || directory == nil || presence == nil || events == nil {
+		log.Fatal("MentionService requires repositories, a directory, presence and an event publisher")
+	}
+	return &MentionService{
+		repo:      repo,
+		rooms:     rooms,
+		messages:  messages,
+		directory: directory,
+		presence:  presence,
+		events:    events,
+		queue:     make(chan models.Event, mentionQueueSize),
+		now:       time.Now,
+	}
+}
+
+// Publish implements ports.EventPublisher. It queues message events for
+// Run, so that posting does not wait for the directory. A full queue drops
+// the event.
+func (s *MentionService) Publish(event models.Event) {
+	switch event.Type {
+	case models.EventMessageCreated, models.EventMessageUpdated, models.EventMessageRevealed:
+		if event.Message == nil || event.Message.ID == 0 || event.Message.Ephemeral {
+			return
+		}
+		msg := *event.Message // The publisher may reuse its copy
+		event.Message = &msg
+		event.MessageID = msg.ID
+	case models.EventMessageDeleted:
+	default:
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		log.Printf("Mention queue is full; skipping %s of message %d", event.Type, event.MessageID)
+	}
+}
+
+// Run records and forgets the mentions of queued messages, in the order
+// they were published, until ctx is done.
+func (s *MentionService) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-s.queue:
+			s.handle(ctx, event)
+		}
+	}
+}
+
+// handle records or forgets the mentions of a queued message event.
+func (s *MentionService) handle(ctx context.Context, event models.Event) {
+	if event.Type == models.EventMessageDeleted {
+		if err := s.repo.DeleteMessageMentions(event.MessageID); err != nil {
+			log.Printf("Error forgetting mentions of message %d: %v", event.MessageID, err)
+		}
+		return
+	}
+	if err := s.Record(ctx, event.Message); err != nil {
+		log.Printf("Error recording mentions of message %d: %v", event.MessageID, err)
+	}
+}
+
+// Record stores the mentions of a message that are new and notifies the
+// mentioned users. Recording the same message again, e.g. after an edit,
+// only adds the users it did not mention before.
+func (s *MentionService) Record(ctx context.Context, msg *models.Message) error {
+	names, room, here := ParseMentions(msg.Text)
+	whisper := len(msg.VisibleTo) > 0 && msg.Kind != models.MessageKindRoll
+	if len(names) == 0 && !room && !here && !whisper {
+		return nil
+	}
+	members, err := s.rooms.ListMembers(msg.RoomID)
+	if err != nil {
+		return fmt.Errorf("listing members of room %d: %w", msg.RoomID, err)
+	}
+	var identities map[string]*models.Identity
+	if len(names) > 0 && !whisper {
+		ids := make([]string, 0, len(members))
+		for _, member := range members {
+			ids = append(ids, member.UserID)
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, mentionLookupTimeout)
+		identities, err = s.directory.LookupIdentities(lookupCtx, ids)
+		cancel()
+		if err != nil {
+			// @room and @here still work.
+			log.Printf("Error looking up members of room %d for mentions: %v", msg.RoomID, err)
+		}
+	}
+
+	kinds := map[string]string{}
+	for _, member := range members {
+		id := member.UserID
+		if id == msg.UserID || strings.HasPrefix(id, ServiceAccountIDPrefix) || !msg.IsVisibleTo(id) {
+			continue
+		}
+		if whisper {
+			kinds[id] = models.MentionDirect
+			continue
+		}
+		if identity := identities[id]; identity != nil && mentionsIdentity(names, identity) {
+			kinds[id] = models.MentionUser
+			continue
+		}
+		switch {
+		case room:
+			kinds[id] = models.MentionRoom
+		case here && s.presence.IsOnline(id):
+			kinds[id] = models.MentionHere
+		}
+	}
+
+	ids := make([]string, 0, len(kinds))
+	for id := range kinds {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	now := s.now().UTC()
+	for _, id := range ids {
+		mention := models.Mention{UserID: id, RoomID: msg.RoomID, MessageID: msg.ID, Kind: kinds[id], CreatedAt: now}
+		created, err := s.repo.CreateMention(&mention)
+		if err != nil {
+			return fmt.Errorf("saving mention of %s: %w", id, err)
+		}
+		if !created {
+			continue
+		}
+		mention.Message = msg
+		s.events.Publish(models.Event{
+			Type:       models.EventMentionCreated,
+			RoomID:     msg.RoomID,
+			Mention:    &mention,
+			Recipients: []string{id},
+			Personal:   true,
+		})
+	}
+	return nil
+}
+
+// mentionsIdentity reports whether any of names refers to the identity.
+func mentionsIdentity(names []string, identity *models.Identity) bool {
+	local, _, _ := strings.Cut(identity.Email, "@")
+	handles := []string{
+		identity.ID,
+		identity.Nickname,
+		identity.FirstName,
+		strings.ReplaceAll(identity.DisplayName, " ", ""),
+		local,
+	}
+	for _, name := range names {
+		for _, handle := range handles {
+			if handle != "" && strings.EqualFold(name, handle) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Inbox returns a page of the principal's mentions, newest first, with
+// their messages, and how many of their mentions are unread. Mentions of
+// messages they can no longer see, or in rooms they have left, are skipped
+// and not counted.
+func (s *MentionService) Inbox(p *models.Principal, query ports.MentionQuery) ([]models.Mention, int, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, 0, err
+	}
+	query.UserID = p.ID
+	mentions, err := s.repo.ListMentions(query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("listing mentions of %s: %w", p.ID, err)
+	}
+
+	inbox := make([]models.Mention, 0, len(mentions))
+	memberOf := map[int64]bool{}
+	for _, mention := range mentions {
+		visible, err := s.loadVisible(p, &mention, memberOf)
+		if err != nil {
+			return nil, 0, err
+		}
+		if visible {
+			inbox = append(inbox, mention)
+		}
+	}
+
+	unread, err := s.countUnread(p, memberOf)
+	if err != nil {
+		return nil, 0, err
+	}
+	return inbox, unread, nil
+}
+
+// MarkRead marks the given mentions of the principal as read, or all of
+// them if ids is empty, and returns how many are still unread, counted
+// like Inbox does.
+func (s *MentionService) MarkRead(p *models.Principal, ids []int64) (int, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return 0, err
+	}
+	if len(ids) > ports.MaxMessagePageSize {
+		return 0, fmt.Errorf("%w: at most %d mentions can be marked at once", ErrInvalidInput, ports.MaxMessagePageSize)
+	}
+	if _, err := s.repo.MarkMentionsRead(p.ID, ids, s.now().UTC()); err != nil {
+		return 0, fmt.Errorf("marking mentions of %s as read: %w", p.ID, err)
+	}
+	return s.countUnread(p, map[int64]bool{})
+}
+
+// countUnread counts the unread mentions of the principal that Inbox lists.
+func (s *MentionService) countUnread(p *models.Principal, memberOf map[int64]bool) (int, error) {
+	unread := 0
+	query := ports.MentionQuery{UserID: p.ID, UnreadOnly: true, OldestFirst: true}
+	for {
+		page, err := s.repo.ListMentions(query)
+		if err != nil {
+			return 0, fmt.Errorf("counting mentions of %s: %w", p.ID, err)
+		}
+		for i := range page {
+			visible, err := s.loadVisible(p, &page[i], memberOf)
+			if err != nil {
+				return 0, err
+			}
+			if visible {
+				unread++
+			}
+		}
+		if len(page) < ports.MaxMessagePageSize {
+			return unread, nil
+		}
+		query.AfterID = page[len(page)-1].ID
+	}
+}
+
+// loadVisible sets the message of a mention and reports whether the
+// principal is still a member of its room and can see the message.
+// Memberships are cached in memberOf.
+func (s *MentionService) loadVisible(p *models.Principal, mention *models.Mention, memberOf map[int64]bool) (bool, error) {
+	member, checked := memberOf[mention.RoomID]
+	if !checked {
+		m, err := s.rooms.GetMember(mention.RoomID, p.ID)
+		if err != nil {
+			return false, fmt.Errorf("checking membership of room %d: %w", mention.RoomID, err)
+		}
+		member = m != nil
+		memberOf[mention.RoomID] = member
+	}
+	if !member {
+		return false, nil
+	}
+	msg, err := s.messages.GetMessage(mention.MessageID)
+	if err != nil {
+		return false, fmt.Errorf("loading message %d: %w", mention.MessageID, err)
+	}
+	if msg == nil || !msg.IsVisibleTo(p.ID) {
+		return false, nil
+	}
+	mention.Message = msg
+	return true, nil
+}
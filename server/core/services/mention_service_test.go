@@ -0,0 +1,296 @@
+package services_test
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// fakeMentions is an in-memory ports.MentionRepository.
+type fakeMentions struct {
+	mentions []models.Mention
+}
+
+func (f *fakeMentions) CreateMention(mention *models.Mention) (bool, error) {
+	for _, m := range f.mentions {
+		if m.MessageID == mention.MessageID && m.UserID == mention.UserID {
+			return false, nil
+		}
+	}
+	mention.ID = int64(len(f.mentions) + 1)
+	f.mentions = append(f.mentions, *mention)
+	return true, nil
+}
+
+func (f *fakeMentions) ListMentions(query ports.MentionQuery) ([]models.Mention, error) {
+	limit := query.Limit
+	if limit <= 0 || limit > ports.MaxMessagePageSize {
+		limit = ports.MaxMessagePageSize
+	}
+	var out []models.Mention
+	for i := range f.mentions {
+		if !query.OldestFirst {
+			i = len(f.mentions) - 1 - i
+		}
+		m := f.mentions[i]
+		if m.UserID == query.UserID && (!query.UnreadOnly || m.ReadAt == nil) && (query.BeforeID == 0 || m.ID < query.BeforeID) && m.ID > query.AfterID {
+			out = append(out, m)
+		}
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeMentions) ListUnreadMentionUsers() ([]string, error) {
+	var users []string
+	for _, m := range f.mentions {
+		if m.ReadAt == nil && !slices.Contains(users, m.UserID) {
+			users = append(users, m.UserID)
+		}
+	}
+	slices.Sort(users)
+	return users, nil
+}
+
+func (f *fakeMentions) MarkMentionsRead(userID string, ids []int64, t time.Time) (int64, error) {
+	var n int64
+	for i, m := range f.mentions {
+		if m.UserID == userID && m.ReadAt == nil && (len(ids) == 0 || slices.Contains(ids, m.ID)) {
+			f.mentions[i].ReadAt = &t
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeMentions) DeleteMessageMentions(messageID int64) error {
+	f.mentions = slices.DeleteFunc(f.mentions, func(m models.Mention) bool { return m.MessageID == messageID })
+	return nil
+}
+
+// fakeDirectory knows a fixed set of identities.
+type fakeDirectory map[string]*models.Identity
+
+func (f fakeDirectory) LookupIdentity(ctx context.Context, id string) (*models.Identity, error) {
+	return f[id], nil
+}
+
+func (f fakeDirectory) LookupIdentities(ctx context.Context, ids []string) (map[string]*models.Identity, error) {
+	found := map[string]*models.Identity{}
+	for _, id := range ids {
+		if identity, ok := f[id]; ok {
+			found[id] = identity
+		}
+	}
+	return found, nil
+}
+
+// fakePresence reports the listed principals as online.
+type fakePresence []string
+
+func (f fakePresence) IsOnline(principalID string) bool { return slices.Contains(f, principalID) }
+
+// newTestMentionService watches room 1, whose members are owner, member,
+// hermit and bot. Only member is online.
+func newTestMentionService() (*services.MentionService, *fakeMentions, *fakeMessages, *fakePublisher) {
+	repo := &fakeMentions{}
+	messages := &fakeMessages{messages: map[int64]*models.Message{}}
+	rooms := &fakeRooms{members: []models.RoomMember{
+		{RoomID: 1, UserID: owner.ID, Role: models.RoomRoleOwner},
+		{RoomID: 1, UserID: member.ID, Role: models.RoomRoleMember},
+		{RoomID: 1, UserID: hermit.ID, Role: models.RoomRoleMember},
+		{RoomID: 1, UserID: bot.ID, Role: models.RoomRoleMember},
+	}}
+	directory := fakeDirectory{
+		owner.ID:  {ID: owner.ID, DisplayName: "Keeper", Nickname: "Keeper", FirstName: "Howard", Email: "hpl@example.com"},
+		member.ID: {ID: member.ID, DisplayName: "Annie Wilkes", FirstName: "Annie", Email: "annie@example.com"},
+		hermit.ID: {ID: hermit.ID, DisplayName: "hermit@example.com", Email: "hermit@example.com"},
+	}
+	publisher := &fakePublisher{}
+	svc := services.NewMentionService(repo, rooms, messages, directory, fakePresence{member.ID}, publisher)
+	return svc, repo, messages, publisher
+}
+
+// post stores a message, publishes it to the service as created and records
+// its mentions.
+func post(svc *services.MentionService, messages *fakeMessages, msg models.Message) *models.Message {
+	msg.RoomID = 1
+	messages.CreateMessage(&msg)
+	svc.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 1, Message: &msg})
+	svc.RecordQueued()
+	return &msg
+}
+
+func mentionedUsers(repo *fakeMentions) map[string]string {
+	users := map[string]string{}
+	for _, m := range repo.mentions {
+		users[m.UserID] = m.Kind
+	}
+	return users
+}
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text       string
+		names      []string
+		room, here bool
+	}{
+		{"@Keeper, what do I see?", []string{"Keeper"}, false, false},
+		{"(@annie) and @annie. @ANNIE!", []string{"annie"}, false, false},
+		{"@room get ready, @here too", nil, true, true},
+		{"@Here", nil, false, true},
+		{"mail hpl@example.com or @hpl.", []string{"hpl"}, false, false},
+		{"@ alone, @@twice, a@b", nil, false, false},
+		{"@anne-marie_ @o.neil", []string{"anne-marie", "o.neil"}, false, false},
+	}
+	for _, tt := range tests {
+		names, room, here := services.ParseMentions(tt.text)
+		if !reflect.DeepEqual(names, tt.names) || room != tt.room || here != tt.here {
+			t.Errorf("ParseMentions(%q) = %q, %v, %v; want %q, %v, %v", tt.text, names, room, here, tt.names, tt.room, tt.here)
+		}
+	}
+}
+
+func TestMentionService_MentionsByName(t *testing.T) {
+	svc, repo, messages, publisher := newTestMentionService()
+
+	msg := post(svc, messages, models.Message{UserID: member.ID, Text: "@keeper @hermit and @annie, but not @sa_bot or @stranger"})
+
+	want := map[string]string{owner.ID: models.MentionUser, hermit.ID: models.MentionUser}
+	if got := mentionedUsers(repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the owner and hermit to be mentioned, got %v", got)
+	}
+	if len(publisher.events) != 2 {
+		t.Fatalf("Expected two mention.created events, got %+v", publisher.events)
+	}
+	event := publisher.events[0]
+	if event.Type != models.EventMentionCreated || !event.Personal || !reflect.DeepEqual(event.Recipients, []string{hermit.ID}) ||
+		event.Mention.UserID != hermit.ID || event.Mention.Message.ID != msg.ID {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+}
+
+func TestMentionService_RoomAndHere(t *testing.T) {
+	svc, repo, messages, _ := newTestMentionService()
+
+	post(svc, messages, models.Message{UserID: owner.ID, Text: "@here roll Spot Hidden"})
+	if got := mentionedUsers(repo); !reflect.DeepEqual(got, map[string]string{member.ID: models.MentionHere}) {
+		t.Errorf("Expected @here to mention the online member only, got %v", got)
+	}
+
+	repo.mentions = nil
+	post(svc, messages, models.Message{UserID: owner.ID, Text: "@room and @Annie: session on Friday"})
+	want := map[string]string{member.ID: models.MentionUser, hermit.ID: models.MentionRoom}
+	if got := mentionedUsers(repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected @room to mention every member but the author and bots, got %v", got)
+	}
+}
+
+func TestMentionService_Whispers(t *testing.T) {
+	svc, repo, messages, _ := newTestMentionService()
+
+	post(svc, messages, models.Message{UserID: owner.ID, Text: "@room psst", VisibleTo: []string{owner.ID, member.ID}})
+
+	if got := mentionedUsers(repo); !reflect.DeepEqual(got, map[string]string{member.ID: models.MentionDirect}) {
+		t.Errorf("Expected only those who see the whisper to be mentioned directly, got %v", got)
+	}
+
+	repo.mentions = nil
+	post(svc, messages, models.Message{UserID: member.ID, Kind: models.MessageKindRoll, Text: "rolled 1d100", VisibleTo: []string{member.ID, owner.ID}})
+	if len(repo.mentions) != 0 {
+		t.Errorf("Expected hidden rolls not to mention anyone, got %+v", repo.mentions)
+	}
+}
+
+func TestMentionService_EditsAndDeletes(t *testing.T) {
+	svc, repo, messages, publisher := newTestMentionService()
+	msg := post(svc, messages, models.Message{UserID: owner.ID, Text: "@annie look"})
+
+	msg.Text = "@annie and @hermit look"
+	svc.Publish(models.Event{Type: models.EventMessageUpdated, RoomID: 1, Message: msg})
+	svc.RecordQueued()
+	if len(repo.mentions) != 2 || len(publisher.events) != 2 || publisher.events[1].Mention.UserID != hermit.ID {
+		t.Errorf("Expected the edit to notify hermit only, got %+v", publisher.events)
+	}
+
+	svc.Publish(models.Event{Type: models.EventMessageDeleted, RoomID: 1, MessageID: msg.ID})
+	if len(repo.mentions) != 2 {
+		t.Errorf("Expected mentions to be forgotten by Run, not Publish, got %+v", repo.mentions)
+	}
+	svc.RecordQueued()
+	if len(repo.mentions) != 0 {
+		t.Errorf("Expected the mentions of the deleted message to be removed, got %+v", repo.mentions)
+	}
+}
+
+func TestMentionService_Inbox(t *testing.T) {
+	svc, repo, messages, _ := newTestMentionService()
+	first := post(svc, messages, models.Message{UserID: owner.ID, Text: "@annie one"})
+	second := post(svc, messages, models.Message{UserID: owner.ID, Text: "@annie two"})
+	post(svc, messages, models.Message{UserID: owner.ID, Text: "@annie three"})
+	messages.DeleteMessage(3) // Without telling the service
+
+	inbox, unread, err := svc.Inbox(member, ports.MentionQuery{})
+	if err != nil {
+		t.Fatalf("Inbox() failed: %v", err)
+	}
+	if len(inbox) != 2 || inbox[0].Message.ID != second.ID || inbox[1].Message.ID != first.ID || unread != 2 {
+		t.Fatalf("Expected the two remaining mentions, newest first, and 2 unread, got %+v (%d unread)", inbox, unread)
+	}
+
+	unread, err = svc.MarkRead(member, []int64{inbox[1].ID})
+	if err != nil || unread != 1 {
+		t.Errorf("MarkRead() = %d, %v; want 1 unread", unread, err)
+	}
+	inbox, _, _ = svc.Inbox(member, ports.MentionQuery{UnreadOnly: true})
+	if len(inbox) != 1 || inbox[0].Message.ID != second.ID {
+		t.Errorf("Expected only the second mention to be unread, got %+v", inbox)
+	}
+	if unread, err := svc.MarkRead(member, nil); err != nil || unread != 0 {
+		t.Errorf("MarkRead(nil) = %d, %v; want 0 unread", unread, err)
+	}
+	if inbox, _, _ := svc.Inbox(owner, ports.MentionQuery{}); len(inbox) != 0 {
+		t.Errorf("Expected the owner's inbox to be empty, got %+v", inbox)
+	}
+	if len(repo.mentions) != 3 {
+		t.Errorf("Expected marking as read to keep the mentions, got %+v", repo.mentions)
+	}
+}
+
+func TestMentionService_Inbox_CountsOnlyListedMentions(t *testing.T) {
+	f := newDigestFixture() // Also tracks room members
+	f.post("@annie one")
+	f.post("@annie two")
+	members := f.rooms.members
+	f.rooms.members = slices.DeleteFunc(slices.Clone(members), func(m models.RoomMember) bool { return m.UserID == member.ID })
+
+	inbox, unread, err := f.mentions.Inbox(member, ports.MentionQuery{})
+	if err != nil || len(inbox) != 0 || unread != 0 {
+		t.Errorf("Expected no mentions and none unread after leaving the room, got %+v (%d unread), %v", inbox, unread, err)
+	}
+	if unread, err := f.mentions.MarkRead(member, []int64{1}); err != nil || unread != 0 {
+		t.Errorf("MarkRead() = %d, %v; want 0 unread after leaving the room", unread, err)
+	}
+
+	f.rooms.members = members
+	if inbox, unread, err := f.mentions.Inbox(member, ports.MentionQuery{}); err != nil || len(inbox) != 2 || unread != 1 {
+		t.Errorf("Expected both mentions, one unread, after rejoining, got %+v (%d unread), %v", inbox, unread, err)
+	}
+}
+
+func TestMentionService_Inbox_RequiresScope(t *testing.T) {
+	svc, _, _, _ := newTestMentionService()
+	writer := &models.Principal{ID: "sa_writer", Type: models.AuthorTypeBot, Scopes: []string{models.ScopeMessagesWrite}}
+
+	if _, _, err := svc.Inbox(writer, ports.MentionQuery{}); err == nil {
+		t.Error("Expected an error without the messages:read scope")
+	}
+}
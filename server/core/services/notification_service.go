@@ -0,0 +1,332 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// DigestDelay is how long a mention stays unread before it is emailed, so
+// that people who are away for a moment do not get mail.
+const DigestDelay = 15 * time.Minute
+
+const (
+	maxDigestMessages = 20  // Listed in one email; the rest are counted
+	maxDigestText     = 300 // Runes of each message
+)
+
+// digestIntervals is how long users wait between digests, by preference.
+var digestIntervals = map[string]time.Duration{
+	models.DigestHourly: time.Hour,
+	models.DigestDaily:  24 * time.Hour,
+}
+
+// NotificationService keeps the notification preferences of users and
+// emails them digests of the mentions and direct messages they missed.
+//
+// A digest lists the mentions that are still unread after DigestDelay and
+// were not in an earlier digest, and is only sent to users who are offline,
+// at most once per interval of their preference. Digests are sent once a
+// mailer is set.
+type NotificationService struct {
+	repo      ports.NotificationRepository
+	mentions  ports.MentionRepository
+	rooms     ports.RoomRepository
+	messages  ports.MessageRepository
+	directory ports.IdentityDirectory
+	presence  ports.Presence
+	mailer    ports.Mailer
+	now       func() time.Time
+}
+
+// NewNotificationService creates a NotificationService.
+func NewNotificationService(repo ports.NotificationRepository, mentions ports.MentionRepository, rooms ports.RoomRepository, messages ports.MessageRepository, directory ports.IdentityDirectory, presence ports.Presence) *NotificationService {
+	if repo == nil || mentions == nil || rooms == nil || messages == nil || directory == nil || presence == nil {
+		log.Fatal("NotificationService requires repositories, a directory and presence")
+	}
+	return &NotificationService{
+		repo:      repo,
+		mentions:  mentions,
+		rooms:     rooms,
+		messages:  messages,
+		directory: directory,
+		presence:  presence,
+		now:       time.Now,
+	}
+}
+
+// SetMailer enables email digests.
+func (s *NotificationService) SetMailer(mailer ports.Mailer) {
+	s.mailer = mailer
+}
+
+// Preferences returns the notification preferences of a user, or the
+// defaults if they never chose.
+func (s *NotificationService) Preferences(p *models.Principal) (*models.NotificationPreferences, error) {
+	if p.Type != models.AuthorTypeUser {
+		return nil, fmt.Errorf("%w: only users get notifications", ErrForbidden)
+	}
+	return s.preferences(p.ID)
+}
+
+// SetPreferences replaces the notification preferences of a user.
+func (s *NotificationService) SetPreferences(p *models.Principal, prefs models.NotificationPreferences) (*models.NotificationPreferences, error) {
+	if p.Type != models.AuthorTypeUser {
+		return nil, fmt.Errorf("%w: only users get notifications", ErrForbidden)
+	}
+	if _, ok := digestIntervals[prefs.EmailDigest]; !ok && prefs.EmailDigest != models.DigestOff {
+		return nil, fmt.Errorf("%w: email_digest must be off, hourly or daily", ErrInvalidInput)
+	}
+	now := s.now().UTC()
+	prefs.UserID = p.ID
+	prefs.UpdatedAt = &now
+	if err := s.repo.SavePreferences(prefs); err != nil {
+		return nil, fmt.Errorf("saving notification preferences of %s: %w", p.ID, err)
+	}
+	return &prefs, nil
+}
+
+func (s *NotificationService) preferences(userID string) (*models.NotificationPreferences, error) {
+	prefs, err := s.repo.GetPreferences(userID)
+	if err != nil {
+		return nil, fmt.Errorf("loading notification preferences of %s: %w", userID, err)
+	}
+	if prefs == nil {
+		defaults := models.DefaultNotificationPreferences(userID)
+		prefs = &defaults
+	}
+	return prefs, nil
+}
+
+// Run sends due digests every interval until ctx is cancelled.
+func (s *NotificationService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.SendDigests(ctx); err != nil {
+			log.Printf("Error sending email digests: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDigests emails the users whose digests are due and returns how many
+// were sent. A user whose digest fails is tried again next time.
+func (s *NotificationService) SendDigests(ctx context.Context) (int, error) {
+	if s.mailer == nil {
+		return 0, nil
+	}
+	users, err := s.mentions.ListUnreadMentionUsers()
+	if err != nil {
+		return 0, fmt.Errorf("listing users with unread mentions: %w", err)
+	}
+	sent := 0
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		ok, err := s.sendDigest(ctx, userID)
+		if err != nil {
+			log.Printf("Error sending the email digest of %s: %v", userID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// digestEntry is a message listed in a digest.
+type digestEntry struct {
+	roomID  int64
+	room    string
+	direct  bool
+	message *models.Message
+}
+
+// sendDigest emails one user their digest if it is due and has anything in
+// it, and reports whether it did.
+func (s *NotificationService) sendDigest(ctx context.Context, userID string) (bool, error) {
+	if s.presence.IsOnline(userID) {
+		return false, nil
+	}
+	prefs, err := s.preferences(userID)
+	if err != nil {
+		return false, err
+	}
+	interval, ok := digestIntervals[prefs.EmailDigest]
+	if !ok || (!prefs.Mentions && !prefs.DirectMessages) {
+		return false, nil
+	}
+	state, err := s.repo.GetDigestState(userID)
+	if err != nil {
+		return false, fmt.Errorf("loading digest state: %w", err)
+	}
+	if state == nil {
+		state = &ports.DigestState{UserID: userID}
+	}
+	now := s.now().UTC()
+	if now.Sub(state.SentAt) < interval {
+		return false, nil
+	}
+
+	cutoff := now.Add(-DigestDelay)
+	lastID := state.LastMentionID
+	rooms := map[int64]string{} // Names of the rooms the user is still in
+	var entries []digestEntry
+pages:
+	for {
+		page, err := s.mentions.ListMentions(ports.MentionQuery{UserID: userID, UnreadOnly: true, AfterID: lastID, OldestFirst: true})
+		if err != nil {
+			return false, fmt.Errorf("listing unread mentions: %w", err)
+		}
+		for _, mention := range page {
+			if mention.CreatedAt.After(cutoff) {
+				break pages // This and the newer ones wait for the next digest
+			}
+			lastID = mention.ID
+			direct := mention.Kind == models.MentionDirect
+			if (direct && !prefs.DirectMessages) || (!direct && !prefs.Mentions) {
+				continue
+			}
+			room, err := s.roomName(rooms, mention.RoomID, userID)
+			if err != nil {
+				return false, err
+			}
+			msg, err := s.messages.GetMessage(mention.MessageID)
+			if err != nil {
+				return false, fmt.Errorf("loading message %d: %w", mention.MessageID, err)
+			}
+			if room == "" || msg == nil || !msg.IsVisibleTo(userID) {
+				continue
+			}
+			entries = append(entries, digestEntry{roomID: mention.RoomID, room: room, direct: direct, message: msg})
+		}
+		if len(page) < ports.MaxMessagePageSize {
+			break
+		}
+	}
+	if lastID == state.LastMentionID {
+		return false, nil
+	}
+	state.LastMentionID = lastID
+	if len(entries) == 0 {
+		// Nothing to send, but the mentions that were looked at need not be again.
+		return false, s.repo.SaveDigestState(*state)
+	}
+
+	identity, err := s.directory.LookupIdentity(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("looking up %s: %w", userID, err)
+	}
+	if identity == nil || identity.Email == "" {
+		return false, s.repo.SaveDigestState(*state)
+	}
+	if err := s.mailer.Send(ctx, digestEmail(identity, entries, prefs.EmailDigest)); err != nil {
+		return false, fmt.Errorf("sending to %s: %w", identity.Email, err)
+	}
+	state.SentAt = now
+	if err := s.repo.SaveDigestState(*state); err != nil {
+		return true, fmt.Errorf("saving digest state: %w", err)
+	}
+	return true, nil
+}
+
+// roomName returns the name of a room, or "" if the user is no longer a
+// member. Names are cached in names.
+func (s *NotificationService) roomName(names map[int64]string, roomID int64, userID string) (string, error) {
+	if name, ok := names[roomID]; ok {
+		return name, nil
+	}
+	member, err := s.rooms.GetMember(roomID, userID)
+	if err != nil {
+		return "", fmt.Errorf("checking membership of room %d: %w", roomID, err)
+	}
+	name := ""
+	if member != nil {
+		room, err := s.rooms.GetRoom(roomID)
+		if err != nil {
+			return "", fmt.Errorf("loading room %d: %w", roomID, err)
+		}
+		if room != nil {
+			name = room.Name
+		}
+	}
+	names[roomID] = name
+	return name, nil
+}
+
+// digestEmail writes the digest of entries, oldest first, grouped by room.
+func digestEmail(identity *models.Identity, entries []digestEntry, frequency string) models.Email {
+	mentions, direct := 0, 0
+	for _, entry := range entries {
+		if entry.direct {
+			direct++
+		} else {
+			mentions++
+		}
+	}
+	var missed []string
+	if mentions > 0 {
+		missed = append(missed, plural(mentions, "mention"))
+	}
+	if direct > 0 {
+		missed = append(missed, plural(direct, "direct message"))
+	}
+	summary := strings.Join(missed, " and ")
+
+	var b strings.Builder
+	name := identity.DisplayName
+	if name == identity.Email {
+		name = ""
+	}
+	greeting := name
+	if greeting == "" {
+		greeting = "there"
+	}
+	fmt.Fprintf(&b, "Hi %s,\n\nwhile you were away, you got %s in Keeper Chat:\n", greeting, summary)
+	var rooms []int64
+	byRoom := map[int64][]digestEntry{} // By ID, as rooms may share a name
+	for _, entry := range entries[:min(len(entries), maxDigestMessages)] {
+		if _, ok := byRoom[entry.roomID]; !ok {
+			rooms = append(rooms, entry.roomID)
+		}
+		byRoom[entry.roomID] = append(byRoom[entry.roomID], entry)
+	}
+	for _, roomID := range rooms {
+		fmt.Fprintf(&b, "\n#%s\n", byRoom[roomID][0].room)
+		for _, entry := range byRoom[roomID] {
+			msg := entry.message
+			verb := ""
+			if entry.direct {
+				verb = " whispered"
+			}
+			fmt.Fprintf(&b, "  %s%s at %s: %s\n", msg.User, verb, msg.Timestamp.UTC().Format("Jan 2 15:04 MST"), clipText(msg.Text, maxDigestText))
+		}
+	}
+	if more := len(entries) - maxDigestMessages; more > 0 {
+		fmt.Fprintf(&b, "\n...and %d more.\n", more)
+	}
+	cadence := "an hour"
+	if frequency == models.DigestDaily {
+		cadence = "a day"
+	}
+	fmt.Fprintf(&b, "\nYou get these emails at most once %s while you are offline. Change that, or turn them off, in your notification preferences.\n", cadence)
+
+	return models.Email{
+		To:      identity.Email,
+		ToName:  name,
+		Subject: "You missed " + summary + " in Keeper Chat",
+		Text:    b.String(),
+	}
+}
@@ -0,0 +1,262 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// fakeNotifications is an in-memory ports.NotificationRepository.
+type fakeNotifications struct {
+	prefs  map[string]models.NotificationPreferences
+	states map[string]ports.DigestState
+}
+
+func (f *fakeNotifications) GetPreferences(userID string) (*models.NotificationPreferences, error) {
+	if prefs, ok := f.prefs[userID]; ok {
+		return &prefs, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeNotifications) SavePreferences(prefs models.NotificationPreferences) error {
+	f.prefs[prefs.UserID] = prefs
+	return nil
+}
+
+func (f *fakeNotifications) GetDigestState(userID string) (*ports.DigestState, error) {
+	if state, ok := f.states[userID]; ok {
+		return &state, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeNotifications) SaveDigestState(state ports.DigestState) error {
+	f.states[state.UserID] = state
+	return nil
+}
+
+// fakeMailer keeps the emails it is asked to send.
+type fakeMailer struct {
+	emails []models.Email
+}
+
+func (f *fakeMailer) Send(ctx context.Context, email models.Email) error {
+	f.emails = append(f.emails, email)
+	return nil
+}
+
+// digestFixture records mentions, by default in room 1, "table", and sends
+// their digests. Nobody is online until added to online.
+type digestFixture struct {
+	notifications *services.NotificationService
+	mentions      *services.MentionService
+	messages      *fakeMessages
+	repo          *fakeNotifications
+	mailer        *fakeMailer
+	rooms         *fakeRooms
+	online        fakePresence
+	now           time.Time
+}
+
+func newDigestFixture() *digestFixture {
+	f := &digestFixture{
+		messages: &fakeMessages{messages: map[int64]*models.Message{}},
+		repo:     &fakeNotifications{prefs: map[string]models.NotificationPreferences{}, states: map[string]ports.DigestState{}},
+		mailer:   &fakeMailer{},
+		now:      time.Date(2026, 10, 18, 19, 0, 0, 0, time.UTC),
+	}
+	f.rooms = &fakeRooms{
+		rooms: []models.Room{{ID: 1, Name: "table"}},
+		members: []models.RoomMember{
+			{RoomID: 1, UserID: owner.ID, Role: models.RoomRoleOwner},
+			{RoomID: 1, UserID: member.ID, Role: models.RoomRoleMember},
+			{RoomID: 1, UserID: hermit.ID, Role: models.RoomRoleMember},
+		},
+	}
+	directory := fakeDirectory{
+		owner.ID:  {ID: owner.ID, DisplayName: "Keeper", Nickname: "Keeper", Email: "hpl@example.com"},
+		member.ID: {ID: member.ID, DisplayName: "Annie Wilkes", FirstName: "Annie", Email: "annie@example.com"},
+		hermit.ID: {ID: hermit.ID, DisplayName: "hermit@example.com", Email: "hermit@example.com"},
+	}
+	clock := func() time.Time { return f.now }
+	mentionRepo := &fakeMentions{}
+	f.mentions = services.NewMentionService(mentionRepo, f.rooms, f.messages, directory, &f.online, &fakePublisher{})
+	f.mentions.SetClock(clock)
+	f.notifications = services.NewNotificationService(f.repo, mentionRepo, f.rooms, f.messages, directory, &f.online)
+	f.notifications.SetClock(clock)
+	f.notifications.SetMailer(f.mailer)
+	return f
+}
+
+// post stores a message of the owner in the table and records its mentions.
+func (f *digestFixture) post(text string, visibleTo ...string) {
+	f.postIn(1, text, visibleTo...)
+}
+
+// postIn stores a message of the owner in a room and records its mentions.
+func (f *digestFixture) postIn(roomID int64, text string, visibleTo ...string) {
+	msg := models.Message{RoomID: roomID, UserID: owner.ID, User: "Keeper", Text: text, VisibleTo: visibleTo, Timestamp: f.now}
+	f.messages.CreateMessage(&msg)
+	f.mentions.Publish(models.Event{Type: models.EventMessageCreated, RoomID: roomID, Message: &msg})
+	f.mentions.RecordQueued()
+}
+
+// send sends the digests due after d has passed.
+func (f *digestFixture) send(t *testing.T, d time.Duration) []models.Email {
+	t.Helper()
+	f.now = f.now.Add(d)
+	before := len(f.mailer.emails)
+	if _, err := f.notifications.SendDigests(context.Background()); err != nil {
+		t.Fatalf("SendDigests() failed: %v", err)
+	}
+	return f.mailer.emails[before:]
+}
+
+func TestNotificationService_SendDigests(t *testing.T) {
+	f := newDigestFixture()
+	f.post("@annie the door is open")
+	f.post("psst, the mirror", owner.ID, hermit.ID)
+
+	if emails := f.send(t, 5*time.Minute); len(emails) != 0 {
+		t.Fatalf("Expected no emails before the digest delay, got %+v", emails)
+	}
+	emails := f.send(t, 15*time.Minute)
+	if len(emails) != 2 {
+		t.Fatalf("Expected digests for annie and hermit, got %+v", emails)
+	}
+	hermitMail, annie := emails[0], emails[1] // By user ID
+	if annie.To != "annie@example.com" || annie.ToName != "Annie Wilkes" || annie.Subject != "You missed 1 mention in Keeper Chat" ||
+		!strings.HasPrefix(annie.Text, "Hi Annie Wilkes,") || !strings.Contains(annie.Text, "#table\n  Keeper at Oct 18 19:00 UTC: @annie the door is open\n") ||
+		!strings.Contains(annie.Text, "at most once an hour") {
+		t.Errorf("Unexpected digest for annie: %+v", annie)
+	}
+	if hermitMail.To != "hermit@example.com" || hermitMail.ToName != "" || hermitMail.Subject != "You missed 1 direct message in Keeper Chat" ||
+		!strings.HasPrefix(hermitMail.Text, "Hi there,") || !strings.Contains(hermitMail.Text, "Keeper whispered at Oct 18 19:00 UTC: psst, the mirror") {
+		t.Errorf("Unexpected digest for hermit: %+v", hermitMail)
+	}
+
+	f.post("@annie and again")
+	if emails := f.send(t, 30*time.Minute); len(emails) != 0 {
+		t.Errorf("Expected at most one digest an hour, got %+v", emails)
+	}
+	emails = f.send(t, 40*time.Minute)
+	if len(emails) != 1 || emails[0].To != "annie@example.com" || strings.Contains(emails[0].Text, "door") || !strings.Contains(emails[0].Text, "and again") {
+		t.Errorf("Expected a digest of the new mention only, got %+v", emails)
+	}
+	if emails := f.send(t, 2*time.Hour); len(emails) != 0 {
+		t.Errorf("Expected mentions to be emailed once, got %+v", emails)
+	}
+}
+
+func TestNotificationService_SendDigests_ManyMentions(t *testing.T) {
+	f := newDigestFixture()
+	for i := 1; i <= 150; i++ {
+		f.post(fmt.Sprintf("@annie clue %d", i))
+	}
+
+	emails := f.send(t, 20*time.Minute)
+	if len(emails) != 1 || emails[0].Subject != "You missed 150 mentions in Keeper Chat" {
+		t.Fatalf("Expected one digest of all 150 mentions, got %+v", emails)
+	}
+	if text := emails[0].Text; !strings.Contains(text, "@annie clue 1\n") || !strings.Contains(text, "@annie clue 20\n") ||
+		strings.Contains(text, "@annie clue 21\n") || !strings.Contains(text, "...and 130 more.") {
+		t.Errorf("Expected the oldest 20 mentions and a count of the rest, got:\n%s", text)
+	}
+	f.post("@annie clue 151")
+	emails = f.send(t, 2*time.Hour)
+	if len(emails) != 1 || emails[0].Subject != "You missed 1 mention in Keeper Chat" || !strings.Contains(emails[0].Text, "clue 151") {
+		t.Errorf("Expected a digest of the new mention only, got %+v", emails)
+	}
+}
+
+func TestNotificationService_SendDigests_RoomsWithTheSameName(t *testing.T) {
+	f := newDigestFixture()
+	f.rooms.rooms = append(f.rooms.rooms, models.Room{ID: 2, Name: "table"})
+	f.rooms.members = append(f.rooms.members,
+		models.RoomMember{RoomID: 2, UserID: owner.ID, Role: models.RoomRoleOwner},
+		models.RoomMember{RoomID: 2, UserID: member.ID, Role: models.RoomRoleMember},
+	)
+	f.postIn(1, "@annie first")
+	f.postIn(2, "@annie elsewhere")
+	f.postIn(1, "@annie second")
+
+	emails := f.send(t, 20*time.Minute)
+	if len(emails) != 1 {
+		t.Fatalf("Expected one digest, got %+v", emails)
+	}
+	want := "\n#table\n  Keeper at Oct 18 19:00 UTC: @annie first\n  Keeper at Oct 18 19:00 UTC: @annie second\n" +
+		"\n#table\n  Keeper at Oct 18 19:00 UTC: @annie elsewhere\n"
+	if !strings.Contains(emails[0].Text, want) {
+		t.Errorf("Expected each room under its own heading, got:\n%s", emails[0].Text)
+	}
+}
+
+func TestNotificationService_SendDigests_SkipsOnlineAndRead(t *testing.T) {
+	f := newDigestFixture()
+	f.online = fakePresence{member.ID}
+	f.post("@room roll Luck")
+	if _, err := f.mentions.MarkRead(hermit, nil); err != nil {
+		t.Fatalf("MarkRead() failed: %v", err)
+	}
+
+	if emails := f.send(t, time.Hour); len(emails) != 0 {
+		t.Errorf("Expected no digests for online users and read mentions, got %+v", emails)
+	}
+	f.online = nil
+	if emails := f.send(t, time.Minute); len(emails) != 1 || emails[0].To != "annie@example.com" {
+		t.Errorf("Expected annie to get the digest once offline, got %+v", emails)
+	}
+}
+
+func TestNotificationService_SendDigests_Preferences(t *testing.T) {
+	f := newDigestFixture()
+	if _, err := f.notifications.SetPreferences(member, models.NotificationPreferences{EmailDigest: models.DigestOff, Mentions: true}); err != nil {
+		t.Fatalf("SetPreferences() failed: %v", err)
+	}
+	if _, err := f.notifications.SetPreferences(hermit, models.NotificationPreferences{EmailDigest: models.DigestDaily, Mentions: true}); err != nil {
+		t.Fatalf("SetPreferences() failed: %v", err)
+	}
+	f.post("psst", owner.ID, hermit.ID)
+	f.post("@annie @hermit look")
+
+	emails := f.send(t, time.Hour)
+	if len(emails) != 1 || emails[0].To != "hermit@example.com" || strings.Contains(emails[0].Text, "psst") || !strings.Contains(emails[0].Text, "at most once a day") {
+		t.Errorf("Expected hermit's digest without direct messages and nothing for annie, got %+v", emails)
+	}
+	f.post("@hermit once more")
+	if emails := f.send(t, 12*time.Hour); len(emails) != 0 {
+		t.Errorf("Expected daily digests to wait a day, got %+v", emails)
+	}
+	if emails := f.send(t, 12*time.Hour); len(emails) != 1 {
+		t.Errorf("Expected the next daily digest, got %+v", emails)
+	}
+}
+
+func TestNotificationService_Preferences(t *testing.T) {
+	f := newDigestFixture()
+
+	prefs, err := f.notifications.Preferences(member)
+	if err != nil || prefs.EmailDigest != models.DigestHourly || !prefs.Mentions || !prefs.DirectMessages || prefs.UpdatedAt != nil {
+		t.Errorf("Expected the defaults, got %+v (%v)", prefs, err)
+	}
+	if _, err := f.notifications.SetPreferences(member, models.NotificationPreferences{EmailDigest: "weekly"}); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a weekly digest, got %v", err)
+	}
+	if _, err := f.notifications.Preferences(bot); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a bot, got %v", err)
+	}
+	if _, err := f.notifications.SetPreferences(member, models.NotificationPreferences{EmailDigest: models.DigestDaily, DirectMessages: true}); err != nil {
+		t.Fatalf("SetPreferences() failed: %v", err)
+	}
+	if prefs, _ := f.notifications.Preferences(member); prefs.EmailDigest != models.DigestDaily || prefs.Mentions || prefs.UpdatedAt == nil {
+		t.Errorf("Expected the saved preferences, got %+v", prefs)
+	}
+}
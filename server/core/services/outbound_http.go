@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// blockedNetworks are not connected to besides private, loopback, link-local
+// and other non-global addresses: shared, reserved and documentation ranges,
+// and IPv6 prefixes that embed IPv4 addresses.
+var blockedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// errBlockedAddress is returned when a URL resolves to an address that
+// must not be connected to.
+var errBlockedAddress = errors.New("address is not public")
+
+// addressGuard decides which addresses the server may connect to for URLs
+// that users or bots chose, so that they cannot reach internal services
+// such as the Kratos admin API or cloud metadata endpoints.
+type addressGuard struct {
+	allowed []netip.Prefix // Non-public networks that may be connected to anyway
+}
+
+// checkDial refuses connections to addresses that are not public, unless
+// their network is allowed. It runs for every connection, after DNS.
+func (g *addressGuard) checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", address, err)
+	}
+	if !g.allowAddress(addrPort.Addr()) {
+		return fmt.Errorf("dialing %s: %w", address, errBlockedAddress)
+	}
+	return nil
+}
+
+// allowAddress reports whether the server may connect to an address.
+func (g *addressGuard) allowAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range g.allowed {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newGuardedClient returns an HTTP client that only connects to addresses
+// the guard allows, checked when connecting so that neither DNS nor
+// redirects can lead elsewhere. Proxies from the environment are not used,
+// as they would connect on our behalf, unchecked.
+func newGuardedClient(guard *addressGuard, timeout time.Duration, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: guard.checkDial}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("more than %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
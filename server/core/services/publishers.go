@@ -0,0 +1,16 @@
+package services
+
+import (
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Publishers fans events out to several publishers, in order.
+type Publishers []ports.EventPublisher
+
+// Publish implements ports.EventPublisher.
+func (ps Publishers) Publish(event models.Event) {
+	for _, p := range ps {
+		p.Publish(event)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiterMaxIdle is how many idle buckets are kept before they are pruned.
+const rateLimiterMaxIdle = 10000
+
+// RateLimiter is an in-memory token bucket per key. Each key may spend burst
+// requests at once and regains one request every interval.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    float64
+	buckets  map[string]*bucket
+	now      func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a new RateLimiter.
+func NewRateLimiter(interval time.Duration, burst int) *RateLimiter {
+	return &RateLimiter{interval: interval, burst: float64(burst), buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Allow spends a request of key. If none is left, it returns false and how
+// long until the next one.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateLimiterMaxIdle {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+float64(now.Sub(b.updated))/float64(l.interval))
+	b.updated = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(l.interval))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops buckets that have refilled completely, which behave like new ones.
+func (l *RateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+float64(now.Sub(b.updated))/float64(l.interval) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// RoomAuthorizer authorizes principals by their room membership.
+type RoomAuthorizer struct {
+	rooms ports.RoomRepository
+}
+
+// NewRoomAuthorizer creates a new RoomAuthorizer.
+func NewRoomAuthorizer(rooms ports.RoomRepository) *RoomAuthorizer {
+	if rooms == nil {
+		log.Fatal("RoomRepository cannot be nil in NewRoomAuthorizer")
+	}
+	return &RoomAuthorizer{rooms: rooms}
+}
+
+// RoomMember returns the principal's membership of a room. It fails with
+// ErrRoomNotFound or ErrNotRoomMember. Incoming webhooks are not listed as
+// members but act as one in their own room.
+func (a *RoomAuthorizer) RoomMember(p *models.Principal, roomID int64) (*models.RoomMember, error) {
+	room, err := a.rooms.GetRoom(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up room %d: %w", roomID, err)
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	if p.IsWebhook() {
+		if p.RoomID != roomID {
+			return nil, ErrNotRoomMember
+		}
+		return &models.RoomMember{RoomID: roomID, UserID: p.ID, Role: models.RoomRoleMember}, nil
+	}
+	member, err := a.rooms.GetMember(roomID, p.ID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up membership of %s in room %d: %w", p.ID, roomID, err)
+	}
+	if member == nil {
+		return nil, ErrNotRoomMember
+	}
+	return member, nil
+}
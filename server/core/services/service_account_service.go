@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize in logs and secret scanners.
+const APIKeyPrefix = "kpr_"
+
+// ServiceAccountIDPrefix starts the ID of every service account, which tells
+// them apart from the Kratos identities of users.
+const ServiceAccountIDPrefix = "sa_"
+
+// apiKeyTouchInterval limits how often the last use of a key is written back.
+const apiKeyTouchInterval = time.Minute
+
+// ErrInvalidAPIKey is returned when an API key is malformed, unknown, revoked,
+// expired or belongs to a disabled service account.
+var ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// ErrServiceAccountNotFound is returned when a service account does not exist.
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+// ErrAPIKeyNotFound is returned when an API key does not exist or belongs to another service account.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// ErrInvalidServiceAccountRequest is returned for malformed names, scopes or lifetimes.
+var ErrInvalidServiceAccountRequest = errors.New("invalid service account request")
+
+// IssuedKey is a newly created API key. Key is the secret and is only available once.
+type IssuedKey struct {
+	Key    string        `json:"key"`
+	APIKey models.APIKey `json:"api_key"`
+}
+
+// ServiceAccountService manages service accounts and authenticates their API keys.
+type ServiceAccountService struct {
+	repo ports.ServiceAccountRepository
+	now  func() time.Time
+}
+
+// NewServiceAccountService creates a new ServiceAccountService.
+func NewServiceAccountService(repo ports.ServiceAccountRepository) *ServiceAccountService {
+	if repo == nil {
+		log.Fatal("ServiceAccountRepository cannot be nil in NewServiceAccountService")
+	}
+	return &ServiceAccountService{repo: repo, now: time.Now}
+}
+
+// CreateServiceAccount creates a service account and its first API key.
+func (s *ServiceAccountService) CreateServiceAccount(name, description, createdBy string, scopes []string) (*models.ServiceAccount, *IssuedKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil, fmt.Errorf("%w: name is required", ErrInvalidServiceAccountRequest)
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, nil, err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	account := models.ServiceAccount{
+		ID:          ServiceAccountIDPrefix + id,
+		Name:        name,
+		Description: description,
+		CreatedBy:   createdBy,
+		CreatedAt:   s.now().UTC(),
+	}
+	if err := s.repo.CreateServiceAccount(account); err != nil {
+		return nil, nil, fmt.Errorf("failed to create service account %s: %w", name, err)
+	}
+	issued, err := s.IssueKey(account.ID, scopes, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &account, issued, nil
+}
+
+// ListServiceAccounts returns all service accounts.
+func (s *ServiceAccountService) ListServiceAccounts() ([]models.ServiceAccount, error) {
+	return s.repo.ListServiceAccounts()
+}
+
+// SetDisabled disables or re-enables a service account. Keys of a disabled
+// account are rejected but kept, so re-enabling restores access.
+func (s *ServiceAccountService) SetDisabled(id string, disabled bool) (*models.ServiceAccount, error) {
+	account, err := s.getServiceAccount(id)
+	if err != nil {
+		return nil, err
+	}
+	var disabledAt *time.Time
+	if disabled {
+		now := s.now().UTC()
+		disabledAt = &now
+	}
+	if err := s.repo.SetServiceAccountDisabled(id, disabledAt); err != nil {
+		return nil, fmt.Errorf("failed to update service account %s: %w", id, err)
+	}
+	account.DisabledAt = disabledAt
+	return account, nil
+}
+
+// ListKeys returns the keys of a service account, without their secrets.
+func (s *ServiceAccountService) ListKeys(accountID string) ([]models.APIKey, error) {
+	if _, err := s.getServiceAccount(accountID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAPIKeys(accountID)
+}
+
+// IssueKey creates a new API key for the account. A ttl of 0 means the key does not expire.
+func (s *ServiceAccountService) IssueKey(accountID string, scopes []string, ttl time.Duration) (*IssuedKey, error) {
+	if err := validateScopes(scopes); err != nil {
+		return nil, err
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("%w: key lifetime must not be negative", ErrInvalidServiceAccountRequest)
+	}
+	if _, err := s.getServiceAccount(accountID); err != nil {
+		return nil, err
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return nil, err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key := models.APIKey{
+		ServiceAccountID: accountID,
+		Prefix:           prefix,
+		Hash:             hashSecret(secret),
+		Scopes:           scopes,
+		CreatedAt:        s.now().UTC(),
+	}
+	if ttl > 0 {
+		expiresAt := key.CreatedAt.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := s.repo.CreateAPIKey(&key); err != nil {
+		return nil, fmt.Errorf("failed to store API key: %w", err)
+	}
+	return &IssuedKey{Key: APIKeyPrefix + prefix + "_" + secret, APIKey: key}, nil
+}
+
+// RotateKey issues a replacement with the same scopes and lifetime and
+// retires the old key after grace, so clients can switch without downtime.
+// A grace of 0 revokes the old key immediately.
+func (s *ServiceAccountService) RotateKey(accountID string, keyID int64, grace time.Duration) (*IssuedKey, error) {
+	if grace < 0 {
+		return nil, fmt.Errorf("%w: grace period must not be negative", ErrInvalidServiceAccountRequest)
+	}
+	old, err := s.getKey(accountID, keyID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	if !old.Usable(now) {
+		return nil, fmt.Errorf("%w: key %d is already revoked or expired", ErrInvalidServiceAccountRequest, keyID)
+	}
+
+	var ttl time.Duration
+	if old.ExpiresAt != nil {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+	issued, err := s.IssueKey(accountID, old.Scopes, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if grace == 0 {
+		err = s.repo.RevokeAPIKey(keyID, now)
+	} else {
+		err = s.repo.ExpireAPIKey(keyID, now.Add(grace))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire API key %d: %w", keyID, err)
+	}
+	return issued, nil
+}
+
+// RevokeKey revokes an API key immediately.
+func (s *ServiceAccountService) RevokeKey(accountID string, keyID int64) error {
+	if _, err := s.getKey(accountID, keyID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeAPIKey(keyID, s.now().UTC()); err != nil {
+		return fmt.Errorf("failed to revoke API key %d: %w", keyID, err)
+	}
+	return nil
+}
+
+// AuthenticateAPIKey validates an API key and returns the bot principal it belongs to.
+func (s *ServiceAccountService) AuthenticateAPIKey(ctx context.Context, key string) (*models.Principal, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !strings.HasPrefix(key, APIKeyPrefix) || !ok || prefix == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	stored, err := s.repo.GetAPIKeyByPrefix(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+	now := s.now().UTC()
+	if stored == nil || !stored.Usable(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	if !secretMatches(stored.Hash, secret) {
+		return nil, ErrInvalidAPIKey
+	}
+	account, err := s.repo.GetServiceAccount(stored.ServiceAccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up service account: %w", err)
+	}
+	if account == nil || account.DisabledAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.repo.TouchAPIKey(stored.ID, now); err != nil {
+			log.Printf("Failed to record use of API key %d: %v", stored.ID, err) // Not fatal for the request
+		}
+	}
+	return &models.Principal{
+		ID:          account.ID,
+		Type:        models.AuthorTypeBot,
+		DisplayName: account.Name,
+		Scopes:      stored.Scopes,
+	}, nil
+}
+
+func (s *ServiceAccountService) getServiceAccount(id string) (*models.ServiceAccount, error) {
+	account, err := s.repo.GetServiceAccount(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up service account %s: %w", id, err)
+	}
+	if account == nil {
+		return nil, ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+func (s *ServiceAccountService) getKey(accountID string, keyID int64) (*models.APIKey, error) {
+	key, err := s.repo.GetAPIKey(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key %d: %w", keyID, err)
+	}
+	if key == nil || key.ServiceAccountID != accountID {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrInvalidServiceAccountRequest)
+	}
+	for _, scope := range scopes {
+		if !models.IsValidScope(scope) {
+			return fmt.Errorf("%w: unknown scope %q", ErrInvalidServiceAccountRequest, scope)
+		}
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashSecret returns the digest stored for a generated secret: its hex
+// SHA-256. The secrets are random and long, so a slow password hash would
+// add nothing but CPU time to every request.
+func hashSecret(secret string) string {
+	digest := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(digest[:])
+}
+
+// secretMatches reports whether a secret has the stored digest, in constant
+// time.
+func secretMatches(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(secret))) == 1
+}
@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	authsqlite "keeper/server/adapters/auth/sqlite"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func newTestServiceAccountService(t *testing.T) *services.ServiceAccountService {
+	t.Helper()
+	db := newTestDB(t)
+
+	repo := authsqlite.NewSQLiteServiceAccountRepository(db)
+	if err := repo.InitServiceAccountSchema(); err != nil {
+		t.Fatalf("InitServiceAccountSchema() failed: %v", err)
+	}
+	return services.NewServiceAccountService(repo)
+}
+
+func TestServiceAccountService_CreateAndAuthenticate(t *testing.T) {
+	svc := newTestServiceAccountService(t)
+
+	account, issued, err := svc.CreateServiceAccount("dice-bot", "Rolls dice", "admin-id", []string{models.ScopeMessagesWrite})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() failed: %v", err)
+	}
+	if !strings.HasPrefix(issued.Key, services.APIKeyPrefix) {
+		t.Errorf("Expected key to start with %q, got %q", services.APIKeyPrefix, issued.Key)
+	}
+	if strings.Contains(issued.APIKey.Hash, issued.Key) || len(issued.APIKey.Hash) != 64 {
+		t.Errorf("Expected only a SHA-256 digest of the key to be stored, got %q", issued.APIKey.Hash)
+	}
+
+	principal, err := svc.AuthenticateAPIKey(context.Background(), issued.Key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey() failed: %v", err)
+	}
+	if principal.ID != account.ID || principal.DisplayName != "dice-bot" || !principal.IsBot() {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+	if !principal.Can(models.ScopeMessagesWrite) || principal.Can(models.ScopeUsersRead) {
+		t.Errorf("Expected principal limited to %s, got scopes %v", models.ScopeMessagesWrite, principal.Scopes)
+	}
+
+	for _, bad := range []string{"", "kpr_", "not-a-key", issued.Key + "x", strings.Replace(issued.Key, "kpr_", "kpr_00", 1)} {
+		if _, err := svc.AuthenticateAPIKey(context.Background(), bad); !errors.Is(err, services.ErrInvalidAPIKey) {
+			t.Errorf("Expected ErrInvalidAPIKey for %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestServiceAccountService_CreateServiceAccount_InvalidScope(t *testing.T) {
+	svc := newTestServiceAccountService(t)
+
+	_, _, err := svc.CreateServiceAccount("bot", "", "admin-id", []string{"rooms:destroy"})
+	if !errors.Is(err, services.ErrInvalidServiceAccountRequest) {
+		t.Errorf("Expected ErrInvalidServiceAccountRequest, got %v", err)
+	}
+}
+
+func TestServiceAccountService_RotateKey(t *testing.T) {
+	svc := newTestServiceAccountService(t)
+	account, old, err := svc.CreateServiceAccount("ci", "", "admin-id", []string{models.ScopeMessagesWrite})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() failed: %v", err)
+	}
+
+	// With a grace period both keys work until it ends.
+	rotated, err := svc.RotateKey(account.ID, old.APIKey.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("RotateKey() failed: %v", err)
+	}
+	if rotated.Key == old.Key || rotated.APIKey.Scopes[0] != models.ScopeMessagesWrite {
+		t.Errorf("Expected a new key with the same scopes, got %+v", rotated.APIKey)
+	}
+	for _, key := range []string{old.Key, rotated.Key} {
+		if _, err := svc.AuthenticateAPIKey(context.Background(), key); err != nil {
+			t.Errorf("Expected key to work during the grace period, got %v", err)
+		}
+	}
+
+	// Without one the old key stops working immediately.
+	again, err := svc.RotateKey(account.ID, rotated.APIKey.ID, 0)
+	if err != nil {
+		t.Fatalf("RotateKey() without grace failed: %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(context.Background(), rotated.Key); !errors.Is(err, services.ErrInvalidAPIKey) {
+		t.Errorf("Expected rotated key to be revoked, got %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(context.Background(), again.Key); err != nil {
+		t.Errorf("Expected replacement key to work, got %v", err)
+	}
+
+	if _, err := svc.RotateKey("sa_other", again.APIKey.ID, 0); !errors.Is(err, services.ErrAPIKeyNotFound) {
+		t.Errorf("Expected ErrAPIKeyNotFound for another account's key, got %v", err)
+	}
+}
+
+func TestServiceAccountService_RevokeAndDisable(t *testing.T) {
+	svc := newTestServiceAccountService(t)
+	account, issued, err := svc.CreateServiceAccount("reminders", "", "admin-id", []string{models.ScopeMessagesWrite})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() failed: %v", err)
+	}
+	second, err := svc.IssueKey(account.ID, []string{models.ScopeMessagesRead}, 0)
+	if err != nil {
+		t.Fatalf("IssueKey() failed: %v", err)
+	}
+
+	if _, err := svc.SetDisabled(account.ID, true); err != nil {
+		t.Fatalf("SetDisabled() failed: %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(context.Background(), second.Key); !errors.Is(err, services.ErrInvalidAPIKey) {
+		t.Errorf("Expected keys of a disabled account to be rejected, got %v", err)
+	}
+	if _, err := svc.SetDisabled(account.ID, false); err != nil {
+		t.Fatalf("SetDisabled(false) failed: %v", err)
+	}
+
+	if err := svc.RevokeKey(account.ID, issued.APIKey.ID); err != nil {
+		t.Fatalf("RevokeKey() failed: %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(context.Background(), issued.Key); !errors.Is(err, services.ErrInvalidAPIKey) {
+		t.Errorf("Expected revoked key to be rejected, got %v", err)
+	}
+	if _, err := svc.AuthenticateAPIKey(context.Background(), second.Key); err != nil {
+		t.Errorf("Expected other key to keep working, got %v", err)
+	}
+
+	keys, err := svc.ListKeys(account.ID)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d (err %v)", len(keys), err)
+	}
+	if keys[1].RevokedAt == nil || keys[0].LastUsedAt == nil {
+		t.Errorf("Expected revocation and last use to be recorded, got %+v", keys)
+	}
+}
+
+func TestServiceAccountService_IssueKey_Expiry(t *testing.T) {
+	svc := newTestServiceAccountService(t)
+	account, _, err := svc.CreateServiceAccount("short-lived", "", "admin-id", []string{models.ScopeMessagesRead})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() failed: %v", err)
+	}
+
+	issued, err := svc.IssueKey(account.ID, []string{models.ScopeMessagesRead}, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("IssueKey() failed: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := svc.AuthenticateAPIKey(context.Background(), issued.Key); !errors.Is(err, services.ErrInvalidAPIKey) {
+		t.Errorf("Expected expired key to be rejected, got %v", err)
+	}
+	if _, err := svc.IssueKey("sa_missing", []string{models.ScopeMessagesRead}, 0); !errors.Is(err, services.ErrServiceAccountNotFound) {
+		t.Errorf("Expected ErrServiceAccountNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// MaxSessionTitleLength bounds session titles, in bytes.
+const MaxSessionTitleLength = 128
+
+// MaxTranscriptMessages bounds the messages of one transcript.
+const MaxTranscriptMessages = 20000
+
+// ErrSessionNotFound is returned for sessions that do not exist or belong to
+// a room the principal is not a member of.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService keeps the game sessions of rooms and exports their
+// transcripts. Room owners (the GMs) start and end sessions, which posts a
+// marker message through the ChatService; every member can export what
+// they saw of a session.
+type SessionService struct {
+	repo  ports.SessionRepository
+	authz ports.Authorizer
+	chat  ports.ChatService
+	now   func() time.Time
+}
+
+// NewSessionService creates a new SessionService.
+func NewSessionService(repo ports.SessionRepository, authz ports.Authorizer, chat ports.ChatService) *SessionService {
+	if repo == nil || authz == nil || chat == nil {
+		log.Fatal("SessionRepository, Authorizer and ChatService cannot be nil in NewSessionService")
+	}
+	return &SessionService{repo: repo, authz: authz, chat: chat, now: time.Now}
+}
+
+// ListSessions returns the sessions of a room, oldest first.
+func (s *SessionService) ListSessions(p *models.Principal, roomID int64) ([]models.Session, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.authz.RoomMember(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListSessions(roomID)
+}
+
+// GetSession returns a session of a room the principal is a member of.
+func (s *SessionService) GetSession(p *models.Principal, id int64) (*models.Session, error) {
+	if err := RequireScope(p, models.ScopeMessagesRead); err != nil {
+		return nil, err
+	}
+	session, err := s.repo.GetSession(id)
+	if err != nil {
+		return nil, fmt.Errorf("looking up session %d: %w", id, err)
+	}
+	if session == nil {
+		return nil, ErrSessionNotFound
+	}
+	if _, err := s.authz.RoomMember(p, session.RoomID); err != nil {
+		if errors.Is(err, ErrNotRoomMember) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// StartSession posts a start marker and begins a session. Without a title
+// it is numbered, e.g. "Session 3". Only room owners can start sessions, and
+// only one at a time.
+func (s *SessionService) StartSession(p *models.Principal, roomID int64, title string) (*models.Session, error) {
+	sessions, err := s.ownedSessions(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if running := runningSession(sessions); running != nil {
+		return nil, fmt.Errorf("%w: %s is still running", ErrInvalidInput, running.Title)
+	}
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		title = fmt.Sprintf("Session %d", len(sessions)+1)
+	}
+	if len(title) > MaxSessionTitleLength {
+		return nil, fmt.Errorf("%w: session title exceeds %d bytes", ErrInvalidInput, MaxSessionTitleLength)
+	}
+
+	marker, err := s.chat.SendMessage(p, ports.MessageDraft{RoomID: roomID, Text: "started " + title, Kind: models.MessageKindSession})
+	if err != nil {
+		return nil, err
+	}
+	session := &models.Session{
+		RoomID:         roomID,
+		Title:          title,
+		StartedBy:      p.ID,
+		StartMessageID: marker.ID,
+		StartedAt:      marker.Timestamp,
+	}
+	if err := s.repo.CreateSession(session); err != nil {
+		return nil, fmt.Errorf("starting session in room %d: %w", roomID, err)
+	}
+	return session, nil
+}
+
+// EndSession posts an end marker and ends the running session of a room.
+// Only room owners can end sessions.
+func (s *SessionService) EndSession(p *models.Principal, roomID int64) (*models.Session, error) {
+	sessions, err := s.ownedSessions(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	session := runningSession(sessions)
+	if session == nil {
+		return nil, fmt.Errorf("%w: no session is running", ErrInvalidInput)
+	}
+
+	marker, err := s.chat.SendMessage(p, ports.MessageDraft{RoomID: roomID, Text: "ended " + session.Title, Kind: models.MessageKindSession})
+	if err != nil {
+		return nil, err
+	}
+	session.EndMessageID, session.EndedAt = marker.ID, &marker.Timestamp
+	if err := s.repo.EndSession(session); err != nil {
+		return nil, fmt.Errorf("ending session %d: %w", session.ID, err)
+	}
+	return session, nil
+}
+
+// Transcript returns the messages of a session that the principal may see,
+// from the start marker to the end marker, or to now while it runs. With
+// inCharacter, table talk and the markers are left out.
+func (s *SessionService) Transcript(p *models.Principal, id int64, inCharacter bool) (*models.Transcript, error) {
+	session, err := s.GetSession(p, id)
+	if err != nil {
+		return nil, err
+	}
+	room, err := s.chat.GetRoom(p, session.RoomID)
+	if err != nil {
+		return nil, err
+	}
+
+	// History pages backwards from the newest message, so collect pages from
+	// the end marker down to the start marker.
+	query := ports.MessageQuery{RoomID: session.RoomID, AfterID: session.StartMessageID - 1, InCharacter: inCharacter}
+	if session.EndMessageID != 0 {
+		query.BeforeID = session.EndMessageID + 1
+	}
+	var messages []models.Message
+	for {
+		page, err := s.chat.History(p, query)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(page, messages...)
+		if len(page) < ports.MaxMessagePageSize {
+			break
+		}
+		if len(messages) > MaxTranscriptMessages {
+			return nil, fmt.Errorf("%w: the session has more than %d messages", ErrInvalidInput, MaxTranscriptMessages)
+		}
+		query.BeforeID = page[0].ID
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	return &models.Transcript{Session: *session, Room: room.Name, Messages: messages, ExportedAt: s.now().UTC()}, nil
+}
+
+// ownedSessions checks that the principal owns the room and lists its sessions.
+func (s *SessionService) ownedSessions(p *models.Principal, roomID int64) ([]models.Session, error) {
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != models.RoomRoleOwner {
+		return nil, fmt.Errorf("%w: only room owners can start and end sessions", ErrForbidden)
+	}
+	sessions, err := s.repo.ListSessions(roomID)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions of room %d: %w", roomID, err)
+	}
+	return sessions, nil
+}
+
+// runningSession returns the session that has not ended, or nil.
+func runningSession(sessions []models.Session) *models.Session {
+	for i := range sessions {
+		if sessions[i].EndMessageID == 0 {
+			return &sessions[i]
+		}
+	}
+	return nil
+}
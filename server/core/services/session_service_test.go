@@ -0,0 +1,172 @@
+package services_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	sessionssqlite "keeper/server/adapters/sessions/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+func newTestSessionService(t *testing.T) (*services.ChatService, *services.SessionService) {
+	t.Helper()
+	chat, _, rooms, _ := newTestCommandRegistry(t)
+	db := newTestDB(t)
+	sessionRepo := sessionssqlite.NewSQLiteSessionRepository(db)
+	if err := sessionRepo.InitSessionSchema(); err != nil {
+		t.Fatalf("InitSessionSchema() failed: %v", err)
+	}
+	sessions := services.NewSessionService(sessionRepo, services.NewRoomAuthorizer(rooms), chat)
+	chat.SetSessions(sessions)
+	return chat, sessions
+}
+
+// transcriptTexts lists the authors and texts of a transcript's messages.
+func transcriptTexts(transcript *models.Transcript) string {
+	texts := make([]string, 0, len(transcript.Messages))
+	for _, msg := range transcript.Messages {
+		texts = append(texts, msg.User+": "+msg.Text)
+	}
+	return strings.Join(texts, " | ")
+}
+
+func TestSessionService_Transcript(t *testing.T) {
+	chat, sessions := newTestSessionService(t)
+	if _, err := chat.PostMessage(member, 1, "Before the game"); err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "/session start"); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a member starting a session, got %v", err)
+	}
+	reply, err := chat.PostMessage(owner, 1, "/session start  The   Haunting")
+	if err != nil || !reply.Ephemeral {
+		t.Fatalf("Expected an ephemeral reply to /session start, got %+v, %v", reply, err)
+	}
+	if _, err := sessions.StartSession(owner, 1, ""); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput while a session runs, got %v", err)
+	}
+
+	hello, err := chat.PostMessage(member, 1, "Hello <b>everyone</b>")
+	if err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+	if _, err := chat.EditMessage(member, 1, hello.ID, "Hello <b>everyone</b>!"); err != nil {
+		t.Fatalf("EditMessage() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(owner, 1, "/hroll d6 sanity"); err != nil {
+		t.Fatalf("/hroll failed: %v", err)
+	}
+	if _, err := chat.PostMessage(owner, 1, "/ic The lights go out."); err != nil {
+		t.Fatalf("/ic failed: %v", err)
+	}
+	session, err := sessions.EndSession(owner, 1)
+	if err != nil || session.Title != "The Haunting" || session.EndedAt == nil {
+		t.Fatalf("Expected The Haunting to end, got %+v, %v", session, err)
+	}
+	if _, err := sessions.EndSession(owner, 1); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput without a running session, got %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "After the game"); err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+
+	transcript, err := sessions.Transcript(member, session.ID, false)
+	if err != nil {
+		t.Fatalf("Transcript() failed: %v", err)
+	}
+	expected := "Owner: started The Haunting | Member: Hello <b>everyone</b>! | Owner: The lights go out. | Owner: ended The Haunting"
+	if got := transcriptTexts(transcript); got != expected || transcript.Room != "table" {
+		t.Errorf("Expected the member's transcript of table to be %q, got %q in %q", expected, got, transcript.Room)
+	}
+	if transcript.Messages[0].Kind != models.MessageKindSession || transcript.Messages[1].EditedAt == nil {
+		t.Errorf("Expected a session marker and an edited message, got %+v", transcript.Messages)
+	}
+	ownerTranscript, err := sessions.Transcript(owner, session.ID, false)
+	if err != nil || len(ownerTranscript.Messages) != 5 || ownerTranscript.Messages[2].Kind != models.MessageKindRoll {
+		t.Errorf("Expected the owner to see the hidden roll, got %q, %v", transcriptTexts(ownerTranscript), err)
+	}
+	inCharacter, err := sessions.Transcript(member, session.ID, true)
+	if err != nil || transcriptTexts(inCharacter) != "Owner: The lights go out." {
+		t.Errorf("Expected only the narration in character, got %q, %v", transcriptTexts(inCharacter), err)
+	}
+	if _, err := sessions.Transcript(hermit, session.ID, false); !errors.Is(err, services.ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound for a non-member, got %v", err)
+	}
+
+	next, err := sessions.StartSession(owner, 1, "")
+	if err != nil || next.Title != "Session 2" {
+		t.Errorf("Expected the next session to be numbered, got %+v, %v", next, err)
+	}
+	list, err := sessions.ListSessions(member, 1)
+	if err != nil || len(list) != 2 || list[0].EndMessageID == 0 || list[1].EndMessageID != 0 {
+		t.Errorf("Expected an ended and a running session, got %+v, %v", list, err)
+	}
+}
+
+func TestWriteTranscript(t *testing.T) {
+	chat, sessions := newTestSessionService(t)
+	session, err := sessions.StartSession(owner, 1, "The Haunting")
+	if err != nil {
+		t.Fatalf("StartSession() failed: %v", err)
+	}
+	hello, err := chat.PostMessage(member, 1, "Hello <b>everyone</b>")
+	if err != nil {
+		t.Fatalf("PostMessage() failed: %v", err)
+	}
+	if _, err := chat.EditMessage(member, 1, hello.ID, "Hello <b>everyone</b>!"); err != nil {
+		t.Fatalf("EditMessage() failed: %v", err)
+	}
+	if _, err := chat.PostMessage(member, 1, "/me searches the desk"); err != nil {
+		t.Fatalf("/me failed: %v", err)
+	}
+	if _, err := chat.SendMessage(member, ports.MessageDraft{RoomID: 1, Text: "**Clue:** a <i>diary</i>", Format: models.MessageFormatMarkdown}); err != nil {
+		t.Fatalf("SendMessage() failed: %v", err)
+	}
+	transcript, err := sessions.Transcript(member, session.ID, false)
+	if err != nil {
+		t.Fatalf("Transcript() failed: %v", err)
+	}
+
+	var markdown bytes.Buffer
+	if err := services.WriteTranscript(&markdown, services.TranscriptMarkdown, transcript); err != nil {
+		t.Fatalf("WriteTranscript(markdown) failed: %v", err)
+	}
+	for _, want := range []string{"# The Haunting\n", "*Owner started The Haunting*", "**Member:** Hello <b>everyone</b>! *(edited ", "*Member* searches the desk\n"} {
+		if !strings.Contains(markdown.String(), want) {
+			t.Errorf("Expected the Markdown transcript to contain %q, got:\n%s", want, markdown.String())
+		}
+	}
+
+	var html bytes.Buffer
+	if err := services.WriteTranscript(&html, services.TranscriptHTML, transcript); err != nil {
+		t.Fatalf("WriteTranscript(html) failed: %v", err)
+	}
+	if !strings.Contains(html.String(), "Hello &lt;b&gt;everyone&lt;/b&gt;!") || strings.Contains(html.String(), "<b>everyone") {
+		t.Errorf("Expected messages to be escaped in the HTML transcript, got:\n%s", html.String())
+	}
+	if !strings.Contains(html.String(), `<div class="markdown"><p><strong>Clue:</strong> a &lt;i&gt;diary&lt;/i&gt;</p></div>`) {
+		t.Errorf("Expected Markdown to be shown rendered in the HTML transcript, got:\n%s", html.String())
+	}
+
+	var decoded models.Transcript
+	var raw bytes.Buffer
+	if err := services.WriteTranscript(&raw, services.TranscriptJSON, transcript); err != nil {
+		t.Fatalf("WriteTranscript(json) failed: %v", err)
+	}
+	if err := json.Unmarshal(raw.Bytes(), &decoded); err != nil || len(decoded.Messages) != 4 || decoded.Session.Title != "The Haunting" {
+		t.Errorf("Expected the JSON transcript to round-trip, got %+v, %v", decoded, err)
+	}
+
+	if err := services.WriteTranscript(&raw, "pdf", transcript); !errors.Is(err, services.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown format, got %v", err)
+	}
+	contentType, name, err := services.TranscriptFile(services.TranscriptHTML, transcript)
+	if err != nil || contentType != "text/html; charset=utf-8" || name != "table-1-the-haunting.html" {
+		t.Errorf("Expected an HTML file named after the room and session, got %q %q, %v", contentType, name, err)
+	}
+}
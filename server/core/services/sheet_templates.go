@@ -0,0 +1,140 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"keeper/server/models"
+)
+
+// maxSheetBytes bounds the JSON of a character sheet.
+const maxSheetBytes = 64 << 10
+
+// maxSkillNameLength bounds skill names on sheets, in bytes.
+const maxSkillNameLength = 64
+
+//go:embed sheets/*.schema.json
+var sheetSchemas embed.FS
+
+// sheetTemplate is a kind of character sheet: a JSON schema, and how to find
+// the values that checks are rolled against.
+type sheetTemplate struct {
+	source []byte // The schema as served to clients
+	schema *openapi3.Schema
+	// values returns the skills and characteristics of a valid sheet by name.
+	values func(sheet json.RawMessage) (map[string]int, error)
+}
+
+// sheetTemplates holds the templates by name. The schemas use the JSON
+// Schema subset of OpenAPI 3.0, so kin-openapi can validate sheets.
+var sheetTemplates = map[string]*sheetTemplate{
+	models.CharacterTemplateCoC7: loadSheetTemplate(models.CharacterTemplateCoC7, coc7Values),
+}
+
+// loadSheetTemplate reads the embedded schema of a template. A broken schema
+// is a programming error.
+func loadSheetTemplate(name string, values func(json.RawMessage) (map[string]int, error)) *sheetTemplate {
+	source, err := sheetSchemas.ReadFile("sheets/" + name + ".schema.json")
+	if err != nil {
+		panic(fmt.Sprintf("reading the schema of sheet template %s: %v", name, err))
+	}
+	var schema openapi3.Schema
+	if err := json.Unmarshal(source, &schema); err != nil {
+		panic(fmt.Sprintf("parsing the schema of sheet template %s: %v", name, err))
+	}
+	return &sheetTemplate{source: source, schema: &schema, values: values}
+}
+
+// SheetTemplates returns the names of the character sheet templates, sorted.
+func SheetTemplates() []string {
+	names := make([]string, 0, len(sheetTemplates))
+	for name := range sheetTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks a sheet against the template's schema. Errors wrap
+// ErrInvalidInput and point at the offending field.
+func (t *sheetTemplate) validate(sheet json.RawMessage) error {
+	if len(sheet) > maxSheetBytes {
+		return fmt.Errorf("%w: sheet exceeds %d bytes", ErrInvalidInput, maxSheetBytes)
+	}
+	var value interface{}
+	if err := json.Unmarshal(sheet, &value); err != nil {
+		return fmt.Errorf("%w: sheet is not valid JSON", ErrInvalidInput)
+	}
+	if err := t.schema.VisitJSON(value); err != nil {
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			return fmt.Errorf("%w: sheet /%s: %s", ErrInvalidInput, strings.Join(schemaErr.JSONPointer(), "/"), schemaErr.Reason)
+		}
+		return fmt.Errorf("%w: sheet: %v", ErrInvalidInput, err)
+	}
+	values, err := t.values(sheet)
+	if err != nil {
+		return err
+	}
+	for name := range values {
+		if len(name) > maxSkillNameLength || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%w: skill names must be 1 to %d bytes", ErrInvalidInput, maxSkillNameLength)
+		}
+	}
+	return nil
+}
+
+// coc7Sheet holds the parts of a Call of Cthulhu sheet that checks roll against.
+type coc7Sheet struct {
+	Characteristics map[string]int `json:"characteristics"`
+	Skills          map[string]int `json:"skills"`
+	Luck            *int           `json:"luck"`
+	Sanity          *struct {
+		Current int `json:"current"`
+	} `json:"sanity"`
+}
+
+// coc7Values returns the skills, the characteristics by abbreviation, Luck,
+// and the current Sanity as both "SAN" and "Sanity".
+func coc7Values(sheet json.RawMessage) (map[string]int, error) {
+	var s coc7Sheet
+	if err := json.Unmarshal(sheet, &s); err != nil {
+		return nil, fmt.Errorf("%w: sheet: %v", ErrInvalidInput, err)
+	}
+	values := make(map[string]int, len(s.Skills)+len(s.Characteristics)+3)
+	for name, value := range s.Skills {
+		values[name] = value
+	}
+	for name, value := range s.Characteristics {
+		values[name] = value
+	}
+	if s.Luck != nil {
+		values["Luck"] = *s.Luck
+	}
+	if s.Sanity != nil {
+		values["SAN"] = s.Sanity.Current
+		values["Sanity"] = s.Sanity.Current
+	}
+	return values, nil
+}
+
+// lookupValue finds a skill or characteristic by name, ignoring case and
+// repeated spaces. It returns the name as written on the sheet.
+func lookupValue(values map[string]int, name string) (string, int, bool) {
+	want := strings.Join(strings.Fields(name), " ")
+	if value, ok := values[want]; ok {
+		return want, value, true
+	}
+	for key, value := range values {
+		if strings.EqualFold(strings.Join(strings.Fields(key), " "), want) {
+			return key, value, true
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,21 @@
+package services_test
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// newTestDB opens an in-memory SQLite database that is closed when the test
+// ends. Callers create the schemas they need.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open in-memory database: %v", err)
+	}
+	db.SetMaxOpenConns(1) // Each connection to :memory: is a separate database.
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"keeper/server/models"
+)
+
+// Formats of exported transcripts.
+const (
+	TranscriptMarkdown = "markdown"
+	TranscriptHTML     = "html"
+	TranscriptJSON     = "json"
+)
+
+// transcriptFormat is how a transcript is written and downloaded.
+type transcriptFormat struct {
+	contentType string
+	extension   string
+	write       func(w io.Writer, t *models.Transcript) error
+}
+
+var transcriptFormats = map[string]transcriptFormat{
+	TranscriptMarkdown: {"text/markdown; charset=utf-8", ".md", writeTranscriptMarkdown},
+	TranscriptHTML:     {"text/html; charset=utf-8", ".html", writeTranscriptHTML},
+	TranscriptJSON:     {"application/json", ".json", writeTranscriptJSON},
+}
+
+// WriteTranscript writes a transcript in one of the Transcript formats.
+func WriteTranscript(w io.Writer, format string, t *models.Transcript) error {
+	f, ok := transcriptFormats[format]
+	if !ok {
+		return fmt.Errorf("%w: unknown transcript format %q, try markdown, html or json", ErrInvalidInput, format)
+	}
+	return f.write(w, t)
+}
+
+// TranscriptFile returns the content type of a transcript format and a file
+// name for the transcript, e.g. "table-3-the-haunting.md".
+func TranscriptFile(format string, t *models.Transcript) (contentType, name string, err error) {
+	f, ok := transcriptFormats[format]
+	if !ok {
+		return "", "", fmt.Errorf("%w: unknown transcript format %q, try markdown, html or json", ErrInvalidInput, format)
+	}
+	name = slug(fmt.Sprintf("%s %d %s", t.Room, t.Session.ID, t.Session.Title))
+	return f.contentType, name + f.extension, nil
+}
+
+// nonSlug matches what file names leave out.
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slug(s string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// transcriptLine is a message as the Markdown and HTML transcripts show it.
+type transcriptLine struct {
+	ID          int64
+	Time        string // "19:04", in UTC
+	Speaker     string // The character, with the author in parentheses, or the author
+	Text        string
+	HTML        template.HTML // Rendered Markdown, shown instead of Text in HTML transcripts
+	Action      bool          // Emotes, rolls and session markers read "Speaker text"
+	Session     bool          // A start or end marker
+	InCharacter bool
+	Whisper     bool // Only some members saw it
+	Edited      string
+	Attachments []models.Attachment
+}
+
+func transcriptLines(t *models.Transcript) []transcriptLine {
+	lines := make([]transcriptLine, 0, len(t.Messages))
+	for _, msg := range t.Messages {
+		line := transcriptLine{
+			ID:          msg.ID,
+			Time:        msg.Timestamp.UTC().Format("15:04"),
+			Speaker:     msg.User,
+			Text:        msg.Text,
+			HTML:        template.HTML(msg.HTML), // Only ever set by RenderMarkdown
+			Action:      msg.Kind != "",
+			Session:     msg.Kind == models.MessageKindSession,
+			InCharacter: msg.InCharacter,
+			Whisper:     len(msg.VisibleTo) > 0 && msg.RevealedAt == nil,
+			Attachments: msg.Attachments,
+		}
+		if msg.Character != nil {
+			line.Speaker = fmt.Sprintf("%s (%s)", msg.Character.Name, msg.User)
+		}
+		if msg.EditedAt != nil {
+			line.Edited = msg.EditedAt.UTC().Format("15:04")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// transcriptPeriod describes when a session ran, e.g.
+// "2026-10-16 19:00 – 23:10 UTC" or "since 2026-10-16 19:00 UTC".
+func transcriptPeriod(s models.Session) string {
+	start := s.StartedAt.UTC()
+	switch {
+	case s.EndedAt == nil:
+		return "since " + start.Format("2006-01-02 15:04") + " UTC"
+	case s.EndedAt.UTC().Format(time.DateOnly) == start.Format(time.DateOnly):
+		return start.Format("2006-01-02 15:04") + " – " + s.EndedAt.UTC().Format("15:04") + " UTC"
+	default:
+		return start.Format("2006-01-02 15:04") + " – " + s.EndedAt.UTC().Format("2006-01-02 15:04") + " UTC"
+	}
+}
+
+// markdownEscaper escapes names, which are shown in bold or italics. Texts
+// are kept as written, since players use Markdown in them.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `_`, `\_`, "`", "\\`", `[`, `\[`, `]`, `\]`)
+
+func writeTranscriptMarkdown(w io.Writer, t *models.Transcript) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", t.Session.Title)
+	fmt.Fprintf(&b, "%s, %s\n\n", markdownEscaper.Replace(t.Room), transcriptPeriod(t.Session))
+	for _, line := range transcriptLines(t) {
+		text := strings.ReplaceAll(line.Text, "\n", "  \n")
+		switch {
+		case line.Session:
+			fmt.Fprintf(&b, "---\n\n%s *%s %s*\n\n", line.Time, markdownEscaper.Replace(line.Speaker), markdownEscaper.Replace(text))
+			continue
+		case line.Action:
+			fmt.Fprintf(&b, "%s *%s* %s", line.Time, markdownEscaper.Replace(line.Speaker), text)
+		default:
+			fmt.Fprintf(&b, "%s **%s:** %s", line.Time, markdownEscaper.Replace(line.Speaker), text)
+		}
+		if line.Whisper {
+			b.WriteString(" *(whisper)*")
+		}
+		if line.Edited != "" {
+			fmt.Fprintf(&b, " *(edited %s)*", line.Edited)
+		}
+		b.WriteString("\n")
+		for _, a := range line.Attachments {
+			title := markdownEscaper.Replace(a.Title)
+			if a.URL != "" {
+				title = fmt.Sprintf("[%s](%s)", title, a.URL)
+			}
+			fmt.Fprintf(&b, "> %s %s\n", title, strings.ReplaceAll(a.Text, "\n", " "))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Session.Title}}</title>
+<style>
+body { font-family: Georgia, serif; max-width: 46em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+.message { margin: 0.4em 0; }
+.text { white-space: pre-wrap; }
+.markdown { margin-left: 3em; }
+.markdown p, .markdown pre, .markdown ul, .markdown ol, .markdown blockquote { margin: 0.2em 0; }
+.time, .note { color: #777; font-size: 0.85em; }
+.in-character { font-style: italic; }
+.action { color: #444; }
+.session { text-align: center; border-top: 1px solid #ccc; border-bottom: 1px solid #ccc; padding: 0.3em; }
+.attachment { margin: 0.2em 0 0.2em 3em; padding-left: 0.6em; border-left: 3px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>{{.Session.Title}}</h1>
+<p>{{.Room}}, {{.Period}}</p>
+{{range .Lines}}<div class="message{{if .Session}} session{{else if .Action}} action{{end}}{{if .InCharacter}} in-character{{end}}" id="m{{.ID}}">
+<span class="time">{{.Time}}</span> {{if .Action}}<em>{{.Speaker}}</em>{{else}}<strong>{{.Speaker}}:</strong>{{end}} {{if .HTML}}<div class="markdown">{{.HTML}}</div>{{else}}<span class="text">{{.Text}}</span>{{end}}{{if .Whisper}} <span class="note">(whisper)</span>{{end}}{{if .Edited}} <span class="note">(edited {{.Edited}})</span>{{end}}
+{{range .Attachments}}<div class="attachment">{{if .URL}}<a href="{{.URL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}} {{.Text}}</div>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
+
+func writeTranscriptHTML(w io.Writer, t *models.Transcript) error {
+	return transcriptTemplate.Execute(w, struct {
+		*models.Transcript
+		Period string
+		Lines  []transcriptLine
+	}{t, transcriptPeriod(t.Session), transcriptLines(t)})
+}
+
+func writeTranscriptJSON(w io.Writer, t *models.Transcript) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(t)
+}
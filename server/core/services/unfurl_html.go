@@ -0,0 +1,157 @@
+package services
+
+import (
+	"html"
+	"slices"
+	"strings"
+)
+
+// pageMeta is the metadata in the head of an HTML page.
+type pageMeta struct {
+	values map[string]string // <meta> content by lower-case property or name, and "<title>"
+	oEmbed string            // Link to the page's JSON oEmbed endpoint
+}
+
+// first returns the first of the keys the page has a value for.
+func (m pageMeta) first(keys ...string) string {
+	for _, key := range keys {
+		if value := strings.TrimSpace(m.values[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parsePageMeta reads the title, <meta> tags and oEmbed link of an HTML
+// page. Pages are often malformed, so this only looks for tags, skipping
+// comments, scripts and styles, and stops where the body starts.
+func parsePageMeta(page []byte) pageMeta {
+	meta := pageMeta{values: map[string]string{}}
+	doc := string(page)
+	for i := 0; i < len(doc); {
+		start := strings.IndexByte(doc[i:], '<')
+		if start < 0 {
+			break
+		}
+		i += start
+		if strings.HasPrefix(doc[i:], "<!--") {
+			end := strings.Index(doc[i+4:], "-->")
+			if end < 0 {
+				break
+			}
+			i += 4 + end + 3
+			continue
+		}
+		name, attrs, next := parseTag(doc, i)
+		i = next
+		switch name {
+		case "meta":
+			key := strings.ToLower(strings.TrimSpace(attrs["property"]))
+			if key == "" {
+				key = strings.ToLower(strings.TrimSpace(attrs["name"]))
+			}
+			if _, seen := meta.values[key]; key != "" && !seen {
+				meta.values[key] = attrs["content"]
+			}
+		case "link":
+			rel := strings.Fields(strings.ToLower(attrs["rel"]))
+			if meta.oEmbed == "" && strings.EqualFold(attrs["type"], "application/json+oembed") && slices.Contains(rel, "alternate") {
+				meta.oEmbed = attrs["href"]
+			}
+		case "title", "script", "style":
+			end := indexFold(doc[i:], "</"+name)
+			if end < 0 {
+				end = len(doc) - i
+			}
+			if _, seen := meta.values["<title>"]; name == "title" && !seen {
+				meta.values["<title>"] = html.UnescapeString(doc[i : i+end])
+			}
+			i += end
+		case "/head", "body":
+			return meta
+		}
+	}
+	return meta
+}
+
+// parseTag reads the tag starting at doc[i], which is '<'. It returns the
+// lower-case name, prefixed with '/' for end tags, the unescaped attributes
+// and where the tag ends. Things that are not tags have no name.
+func parseTag(doc string, i int) (string, map[string]string, int) {
+	j := i + 1
+	if j < len(doc) && doc[j] == '/' {
+		j++
+	}
+	for j < len(doc) && isNameByte(doc[j]) {
+		j++
+	}
+	name := strings.ToLower(doc[i+1 : j])
+	if name == "" || name == "/" {
+		return "", nil, i + 1
+	}
+	attrs := map[string]string{}
+	for j < len(doc) {
+		for j < len(doc) && (isSpace(doc[j]) || doc[j] == '/') {
+			j++
+		}
+		if j >= len(doc) || doc[j] == '>' {
+			break
+		}
+		start := j
+		for j < len(doc) && !isSpace(doc[j]) && doc[j] != '=' && doc[j] != '>' && doc[j] != '/' {
+			j++
+		}
+		key := strings.ToLower(doc[start:j])
+		if key == "" {
+			j++ // A stray '=' or quote
+			continue
+		}
+		for j < len(doc) && isSpace(doc[j]) {
+			j++
+		}
+		value := ""
+		if j < len(doc) && doc[j] == '=' {
+			j++
+			for j < len(doc) && isSpace(doc[j]) {
+				j++
+			}
+			if j < len(doc) && (doc[j] == '"' || doc[j] == '\'') {
+				end := strings.IndexByte(doc[j+1:], doc[j])
+				if end < 0 {
+					end = len(doc) - j - 1
+				}
+				value = doc[j+1 : j+1+end]
+				j += end + 2
+			} else {
+				start := j
+				for j < len(doc) && !isSpace(doc[j]) && doc[j] != '>' {
+					j++
+				}
+				value = doc[start:j]
+			}
+		}
+		if _, seen := attrs[key]; !seen {
+			attrs[key] = html.UnescapeString(value)
+		}
+	}
+	return name, attrs, min(j+1, len(doc))
+}
+
+// indexFold is strings.Index ignoring the case of ASCII letters in sub,
+// which must be ASCII.
+func indexFold(s, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if strings.EqualFold(s[i:i+len(sub)], sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == ':'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// MaxMessagePreviews is how many links of a message are previewed.
+const MaxMessagePreviews = 3
+
+// LinkPreviewTTL is how long previews are cached. Links that had nothing to
+// show, or could not be fetched, are tried again sooner.
+const LinkPreviewTTL = 24 * time.Hour
+
+const (
+	emptyPreviewTTL       = time.Hour
+	unfurlTimeout         = 5 * time.Second // For everything about one URL, redirects included
+	unfurlMaxRedirects    = 3
+	unfurlMaxPageSize     = 512 << 10 // Metadata is in the head, so the rest is not read
+	unfurlMaxOEmbedSize   = 64 << 10
+	unfurlQueueSize       = 256
+	maxPreviewTitle       = 300 // Runes
+	maxPreviewDescription = 500
+	maxPreviewURL         = 2048
+)
+
+// linkPattern finds http and https links in text. Punctuation at their end
+// is trimmed by ExtractLinks.
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'` + "`" + `]+`)
+
+// UnfurlService adds previews of links to messages. It is an event
+// publisher: created and edited messages are queued, and Run fetches the
+// OpenGraph or oEmbed metadata of their links and publishes the message
+// again with the previews.
+//
+// Links are fetched from the server, so only public addresses are
+// connected to, checked when connecting so that DNS and redirects cannot
+// point elsewhere. Time and size are limited.
+type UnfurlService struct {
+	repo     ports.LinkPreviewRepository
+	messages ports.MessageRepository
+	events   ports.EventPublisher
+	client   *http.Client
+	guard    *addressGuard
+	queue    chan int64
+	now      func() time.Time
+}
+
+// NewUnfurlService creates an UnfurlService that publishes updated messages
+// to events.
+func NewUnfurlService(repo ports.LinkPreviewRepository, messages ports.MessageRepository, events ports.EventPublisher) *UnfurlService {
+	if repo == nil || messages == nil || events == nil {
+		log.Fatal("LinkPreviewRepository, MessageRepository and EventPublisher cannot be nil in NewUnfurlService")
+	}
+	guard := &addressGuard{}
+	return &UnfurlService{
+		repo:     repo,
+		messages: messages,
+		events:   events,
+		client:   newGuardedClient(guard, unfurlTimeout, unfurlMaxRedirects),
+		guard:    guard,
+		queue:    make(chan int64, unfurlQueueSize),
+		now:      time.Now,
+	}
+}
+
+// SetAllowedNetworks lets links to these networks be previewed even though
+// they are not public, e.g. a wiki on the LAN of the group.
+func (s *UnfurlService) SetAllowedNetworks(networks []netip.Prefix) {
+	s.guard.allowed = networks
+}
+
+// Publish implements ports.EventPublisher. It queues messages whose links
+// may have changed; the queue is worked through by Run. A full queue drops
+// the message, as previews are only nice to have.
+func (s *UnfurlService) Publish(event models.Event) {
+	msg := event.Message
+	if (event.Type != models.EventMessageCreated && event.Type != models.EventMessageUpdated) || msg == nil || msg.ID == 0 || msg.Kind == models.MessageKindRoll {
+		return
+	}
+	if previewedLinks(msg.Previews, ExtractLinks(msg.Text)) {
+		return
+	}
+	select {
+	case s.queue <- msg.ID:
+	default:
+		log.Printf("Link preview queue is full; skipping message %d", msg.ID)
+	}
+}
+
+// Run unfurls queued messages and prunes the cache until ctx is done.
+func (s *UnfurlService) Run(ctx context.Context) {
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			if err := s.Unfurl(ctx, id); err != nil {
+				log.Printf("Error previewing links of message %d: %v", id, err)
+			}
+		case <-prune.C:
+			if _, err := s.repo.DeleteLinkPreviewsBefore(s.now().UTC().Add(-LinkPreviewTTL)); err != nil {
+				log.Printf("Error pruning link previews: %v", err)
+			}
+		}
+	}
+}
+
+// Unfurl previews the links of a message and, if its previews changed,
+// saves them and publishes the message as updated. Deleted messages are
+// skipped.
+func (s *UnfurlService) Unfurl(ctx context.Context, messageID int64) error {
+	msg, err := s.messages.GetMessage(messageID)
+	if err != nil {
+		return fmt.Errorf("looking up message %d: %w", messageID, err)
+	}
+	if msg == nil {
+		return nil
+	}
+	var previews []models.LinkPreview
+	for _, link := range ExtractLinks(msg.Text) {
+		preview, err := s.Preview(ctx, link)
+		if err != nil {
+			return err
+		}
+		if !preview.IsEmpty() {
+			previews = append(previews, *preview)
+		}
+	}
+	if slices.Equal(previews, msg.Previews) {
+		return nil
+	}
+	if err := s.messages.SetMessagePreviews(msg.ID, previews); err != nil {
+		return fmt.Errorf("saving previews of message %d: %w", msg.ID, err)
+	}
+	msg.Previews = previews
+	s.events.Publish(messageEvent(models.EventMessageUpdated, msg))
+	return nil
+}
+
+// Preview returns the preview of a link, from the cache if it is fresh.
+// Links that cannot be fetched get an empty preview, which is cached too;
+// only cache errors are returned.
+func (s *UnfurlService) Preview(ctx context.Context, link string) (*models.LinkPreview, error) {
+	now := s.now().UTC()
+	cached, fetchedAt, err := s.repo.GetLinkPreview(link)
+	if err != nil {
+		return nil, fmt.Errorf("looking up preview of %s: %w", link, err)
+	}
+	if cached != nil {
+		ttl := LinkPreviewTTL
+		if cached.IsEmpty() {
+			ttl = emptyPreviewTTL
+		}
+		if now.Sub(fetchedAt) < ttl {
+			return cached, nil
+		}
+	}
+	preview, err := s.fetch(ctx, link)
+	if err != nil {
+		log.Printf("No preview of %s: %v", link, err)
+		preview = &models.LinkPreview{URL: link}
+	}
+	if err := s.repo.SaveLinkPreview(*preview, now); err != nil {
+		return nil, fmt.Errorf("caching preview of %s: %w", link, err)
+	}
+	return preview, nil
+}
+
+// ExtractLinks returns the distinct http and https links in text, at most
+// MaxMessagePreviews of them. Punctuation ending a sentence and unbalanced
+// closing brackets are not taken as part of a link.
+func ExtractLinks(text string) []string {
+	var links []string
+	for _, match := range linkPattern.FindAllString(text, -1) {
+		link := trimLink(match)
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Host == "" || parsed.User != nil || slices.Contains(links, link) {
+			continue
+		}
+		links = append(links, link)
+		if len(links) == MaxMessagePreviews {
+			break
+		}
+	}
+	return links
+}
+
+func trimLink(link string) string {
+	for link != "" {
+		last := link[len(link)-1]
+		switch {
+		case strings.IndexByte(".,;:!?*_~", last) >= 0:
+		case last == ')' && strings.Count(link, "(") < strings.Count(link, ")"):
+		case last == ']' && strings.Count(link, "[") < strings.Count(link, "]"):
+		default:
+			return link
+		}
+		link = link[:len(link)-1]
+	}
+	return link
+}
+
+// previewedLinks reports whether the previews are of exactly these links,
+// so that publishing a message with its previews does not queue it again.
+// Messages with a link that had nothing to show are queued again, and
+// Unfurl then finds their previews unchanged.
+func previewedLinks(previews []models.LinkPreview, links []string) bool {
+	if len(previews) != len(links) {
+		return false
+	}
+	for i := range previews {
+		if previews[i].URL != links[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch reads the preview of a link from its page. Images linked directly
+// are previewed as themselves.
+func (s *UnfurlService) fetch(ctx context.Context, link string) (*models.LinkPreview, error) {
+	resp, err := s.get(ctx, link, "text/html,application/xhtml+xml;q=0.9,*/*;q=0.5")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	preview := &models.LinkPreview{URL: link}
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		preview.Title = clipText(path.Base(resp.Request.URL.Path), maxPreviewTitle)
+		preview.ImageURL = resp.Request.URL.String()
+		return preview, nil
+	case mediaType != "text/html" && mediaType != "application/xhtml+xml":
+		return preview, nil
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, unfurlMaxPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading page: %w", err)
+	}
+	base := resp.Request.URL // After redirects
+	meta := parsePageMeta(page)
+	preview.Title = clipText(meta.first("og:title", "twitter:title", "<title>"), maxPreviewTitle)
+	preview.Description = clipText(meta.first("og:description", "twitter:description", "description"), maxPreviewDescription)
+	preview.SiteName = clipText(meta.first("og:site_name", "application-name"), maxPreviewTitle)
+	preview.ImageURL = absoluteLink(base, meta.first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"))
+	if endpoint := absoluteLink(base, meta.oEmbed); endpoint != "" && (preview.Title == "" || preview.ImageURL == "") {
+		if err := s.addOEmbed(ctx, preview, endpoint); err != nil {
+			log.Printf("No oEmbed data for %s: %v", link, err)
+		}
+	}
+	return preview, nil
+}
+
+// oEmbed is the part of an oEmbed response used for previews. Its html is
+// never used, since it would run on clients.
+type oEmbed struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// addOEmbed fills what the page's metadata left out from its oEmbed endpoint.
+func (s *UnfurlService) addOEmbed(ctx context.Context, preview *models.LinkPreview, endpoint string) error {
+	resp, err := s.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var data oEmbed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, unfurlMaxOEmbedSize)).Decode(&data); err != nil {
+		return fmt.Errorf("decoding oEmbed response: %w", err)
+	}
+	if preview.Title == "" {
+		preview.Title = clipText(data.Title, maxPreviewTitle)
+	}
+	if preview.Description == "" && data.AuthorName != "" {
+		preview.Description = clipText("By "+data.AuthorName, maxPreviewDescription)
+	}
+	if preview.SiteName == "" {
+		preview.SiteName = clipText(data.ProviderName, maxPreviewTitle)
+	}
+	if preview.ImageURL == "" {
+		preview.ImageURL = absoluteLink(resp.Request.URL, data.ThumbnailURL)
+	}
+	return nil
+}
+
+// get fetches a URL with the guarded client. Anything but 200 is an error.
+func (s *UnfurlService) get(ctx context.Context, link, accept string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, unfurlTimeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Keeper-LinkPreview/1")
+	req.Header.Set("Accept", accept)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels the context of a request when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// absoluteLink resolves a link of a page against the page's URL. Only http
+// and https links are kept.
+func absoluteLink(base *url.URL, link string) string {
+	link = strings.TrimSpace(link)
+	if link == "" || len(link) > maxPreviewURL {
+		return ""
+	}
+	ref, err := base.Parse(link)
+	if err != nil || (ref.Scheme != "http" && ref.Scheme != "https") || ref.Host == "" {
+		return ""
+	}
+	return ref.String()
+}
+
+// clipText collapses the whitespace of text from a page and shortens it to
+// max runes.
+func clipText(text string, max int) string {
+	text = strings.Join(strings.Fields(strings.ToValidUTF8(text, "")), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
@@ -0,0 +1,273 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+type cachedPreview struct {
+	preview   models.LinkPreview
+	fetchedAt time.Time
+}
+
+type fakeLinkPreviews struct {
+	previews map[string]cachedPreview
+}
+
+func (f *fakeLinkPreviews) GetLinkPreview(url string) (*models.LinkPreview, time.Time, error) {
+	cached, ok := f.previews[url]
+	if !ok {
+		return nil, time.Time{}, nil
+	}
+	return &cached.preview, cached.fetchedAt, nil
+}
+
+func (f *fakeLinkPreviews) SaveLinkPreview(preview models.LinkPreview, fetchedAt time.Time) error {
+	f.previews[preview.URL] = cachedPreview{preview, fetchedAt}
+	return nil
+}
+
+func (f *fakeLinkPreviews) DeleteLinkPreviewsBefore(t time.Time) (int64, error) {
+	var deleted int64
+	for url, cached := range f.previews {
+		if cached.fetchedAt.Before(t) {
+			delete(f.previews, url)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// newTestUnfurler creates an UnfurlService with a message store and the
+// publisher its updates go to. allowed lets it fetch from test servers.
+func newTestUnfurler(now *time.Time, allowed ...string) (*services.UnfurlService, *fakeMessages, *fakePublisher) {
+	messages := &fakeMessages{messages: map[int64]*models.Message{}}
+	events := &fakePublisher{}
+	unfurl := services.NewUnfurlService(&fakeLinkPreviews{previews: map[string]cachedPreview{}}, messages, events)
+	unfurl.SetClock(func() time.Time { return *now })
+	var networks []netip.Prefix
+	for _, network := range allowed {
+		networks = append(networks, netip.MustParsePrefix(network))
+	}
+	unfurl.SetAllowedNetworks(networks)
+	return unfurl, messages, events
+}
+
+func TestExtractLinks(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no links here", nil},
+		{"See https://example.com/a.", []string{"https://example.com/a"}},
+		{"(see https://en.wikipedia.org/wiki/Cthulhu_(novel)) and HTTP://example.org/x?y=1, ok", []string{"https://en.wikipedia.org/wiki/Cthulhu_(novel)", "HTTP://example.org/x?y=1"}},
+		{"[map](https://example.com/map.png) <https://example.com/b>", []string{"https://example.com/map.png", "https://example.com/b"}},
+		{"https://a.example https://a.example ftp://b.example https://user:pw@c.example https://", []string{"https://a.example"}},
+		{"https://1.example https://2.example https://3.example https://4.example", []string{"https://1.example", "https://2.example", "https://3.example"}},
+	}
+	for _, tt := range tests {
+		if got := services.ExtractLinks(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("ExtractLinks(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestUnfurlService_Unfurl(t *testing.T) {
+	var pageHits, oEmbedHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scenario", func(w http.ResponseWriter, r *http.Request) {
+		pageHits.Add(1)
+		if r.Header.Get("User-Agent") != "Keeper-LinkPreview/1" {
+			t.Errorf("Unexpected User-Agent %q", r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE html><html><head>
+<title>Ignored   title</title>
+<!-- <meta property="og:title" content="Commented out"> -->
+<script>var s = "<meta property='og:title' content='In a script'>";</script>
+<META Property="og:title" content="The Haunting &amp; Other Tales">
+<meta name=description content='A   classic
+scenario'>
+<meta property="og:image" content="/images/corbitt.jpg">
+</head><body><meta property="og:site_name" content="In the body"></body></html>`)
+	})
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		pageHits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="alternate" type="application/json+oembed" href="/oembed?url=video"></head></html>`)
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		oEmbedHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type":"video","title":"Session zero","author_name":"Keeper","provider_name":"Tube","thumbnail_url":"https://img.example/t.jpg","html":"<iframe src=\"https://evil.example\"></iframe>"}`)
+	})
+	mux.HandleFunc("/map.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(smallPNG))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "nothing to see")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	unfurl, messages, events := newTestUnfurler(&now, "127.0.0.0/8")
+	ctx := context.Background()
+
+	text := fmt.Sprintf("Tonight: %[1]s/scenario, recap at %[1]s/video and %[1]s/plain.", server.URL)
+	msg := &models.Message{RoomID: 1, Text: text, VisibleTo: []string{"owner-id", "member-id"}}
+	messages.CreateMessage(msg)
+	if err := unfurl.Unfurl(ctx, msg.ID); err != nil {
+		t.Fatalf("Unfurl() failed: %v", err)
+	}
+	want := []models.LinkPreview{
+		{URL: server.URL + "/scenario", Title: "The Haunting & Other Tales", Description: "A classic scenario", ImageURL: server.URL + "/images/corbitt.jpg"},
+		{URL: server.URL + "/video", Title: "Session zero", Description: "By Keeper", SiteName: "Tube", ImageURL: "https://img.example/t.jpg"},
+	}
+	if stored := messages.messages[msg.ID]; !slices.Equal(stored.Previews, want) {
+		t.Errorf("Expected previews\n%+v, got\n%+v", want, stored.Previews)
+	}
+	if len(events.events) != 1 || events.events[0].Type != models.EventMessageUpdated || !slices.Equal(events.events[0].Message.Previews, want) {
+		t.Fatalf("Expected one message.updated event with the previews, got %+v", events.events)
+	}
+	if recipients := events.events[0].Recipients; !slices.Equal(recipients, msg.VisibleTo) {
+		t.Errorf("Expected the update to go to the whisper's recipients, got %v", recipients)
+	}
+
+	// Unchanged previews are not published again, and the second message is
+	// previewed from the cache.
+	if err := unfurl.Unfurl(ctx, msg.ID); err != nil || len(events.events) != 1 {
+		t.Errorf("Expected no second update, got %d events and %v", len(events.events), err)
+	}
+	again := &models.Message{RoomID: 1, Text: "Same as " + server.URL + "/scenario"}
+	messages.CreateMessage(again)
+	if err := unfurl.Unfurl(ctx, again.ID); err != nil {
+		t.Fatalf("Unfurl() failed: %v", err)
+	}
+	if pageHits.Load() != 2 || oEmbedHits.Load() != 1 {
+		t.Errorf("Expected each link to be fetched once, got %d pages and %d oEmbeds", pageHits.Load(), oEmbedHits.Load())
+	}
+	now = now.Add(services.LinkPreviewTTL)
+	later := &models.Message{RoomID: 1, Text: server.URL + "/scenario"}
+	messages.CreateMessage(later)
+	if err := unfurl.Unfurl(ctx, later.ID); err != nil || pageHits.Load() != 3 {
+		t.Errorf("Expected an expired preview to be fetched again, got %d page hits and %v", pageHits.Load(), err)
+	}
+
+	image := &models.Message{RoomID: 1, Text: server.URL + "/map.png"}
+	messages.CreateMessage(image)
+	if err := unfurl.Unfurl(ctx, image.ID); err != nil {
+		t.Fatalf("Unfurl() failed: %v", err)
+	}
+	if previews := messages.messages[image.ID].Previews; len(previews) != 1 || previews[0].Title != "map.png" || previews[0].ImageURL != server.URL+"/map.png" {
+		t.Errorf("Expected an image to be previewed as itself, got %+v", previews)
+	}
+
+	// Removing the links removes their previews.
+	messages.messages[msg.ID].Text = "Tonight, no links."
+	if err := unfurl.Unfurl(ctx, msg.ID); err != nil {
+		t.Fatalf("Unfurl() failed: %v", err)
+	}
+	if last := events.events[len(events.events)-1]; messages.messages[msg.ID].Previews != nil || last.Message.ID != msg.ID || last.Message.Previews != nil {
+		t.Errorf("Expected the previews to be removed, got %+v", messages.messages[msg.ID].Previews)
+	}
+	if err := unfurl.Unfurl(ctx, 99); err != nil {
+		t.Errorf("Expected deleted messages to be skipped, got %v", err)
+	}
+}
+
+func TestUnfurlService_BlocksPrivateAddresses(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Internal dashboard</title>`)
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	unfurl, messages, events := newTestUnfurler(&now)
+	localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	msg := &models.Message{RoomID: 1, Text: server.URL + " " + localhost}
+	messages.CreateMessage(msg)
+	if err := unfurl.Unfurl(context.Background(), msg.ID); err != nil {
+		t.Fatalf("Unfurl() failed: %v", err)
+	}
+	if hits.Load() != 0 || len(events.events) != 0 || messages.messages[msg.ID].Previews != nil {
+		t.Errorf("Expected loopback links not to be fetched, got %d hits and %+v", hits.Load(), events.events)
+	}
+
+	for addr, allowed := range map[string]bool{
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"255.255.255.255":  false,
+		"224.0.0.1":        false,
+		"::1":              false,
+		"::":               false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:10.0.0.1":  false,
+		"64:ff9b::a00:1":   false,
+		"93.184.216.34":    true,
+		"2606:2800:220::1": true,
+	} {
+		if got := unfurl.AllowsAddress(addr); got != allowed {
+			t.Errorf("AllowsAddress(%s) = %v, want %v", addr, got, allowed)
+		}
+	}
+	unfurl.SetAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	if !unfurl.AllowsAddress("10.1.2.3") || unfurl.AllowsAddress("192.168.1.1") {
+		t.Error("Expected only the allowed network to be fetched from")
+	}
+}
+
+func TestUnfurlService_LimitsSizeAndTime(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/long", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head>"+strings.Repeat("<!-- padding -->", 40_000)+`<title>Too far down</title>`)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	now := time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)
+	unfurl, _, _ := newTestUnfurler(&now, "127.0.0.0/8")
+	unfurl.SetTimeout(200 * time.Millisecond)
+	ctx := context.Background()
+	for _, path := range []string{"/long", "/slow", "/loop"} {
+		preview, err := unfurl.Preview(ctx, server.URL+path)
+		if err != nil {
+			t.Fatalf("Preview(%s) failed: %v", path, err)
+		}
+		if !preview.IsEmpty() {
+			t.Errorf("Expected no preview of %s, got %+v", path, preview)
+		}
+	}
+}
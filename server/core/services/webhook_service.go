@@ -0,0 +1,376 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"keeper/server/core/ports"
+	"keeper/server/models"
+)
+
+// Headers of outgoing webhook requests. The signature is
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body)), so receivers
+// can reject replayed requests by checking the timestamp.
+const (
+	WebhookEventHeader     = "X-Keeper-Event"
+	WebhookDeliveryHeader  = "X-Keeper-Delivery"
+	WebhookTimestampHeader = "X-Keeper-Timestamp"
+	WebhookSignatureHeader = "X-Keeper-Signature"
+)
+
+// MaxWebhookAttempts is how often a delivery is tried before it is dead-lettered.
+const MaxWebhookAttempts = 8
+
+const (
+	webhookSecretPrefix   = "whsec_"
+	webhookInitialBackoff = 30 * time.Second
+	webhookMaxBackoff     = time.Hour
+	webhookTimeout        = 10 * time.Second
+	webhookMaxRedirects   = 3
+	webhookBatchSize      = 20
+	webhookMaxErrorLength = 512
+)
+
+// ErrWebhookNotFound is returned when a webhook does not exist or belongs to another room.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrDeliveryNotFound is returned when a webhook delivery does not exist.
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// WebhookPayload is the JSON body of a webhook request.
+type WebhookPayload struct {
+	models.Event
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// WebhookService manages outgoing webhooks of rooms. It is an event publisher:
+// published events are queued in the database for every subscribed webhook,
+// and Run delivers the queue with retries.
+//
+// Webhook URLs are chosen by room owners, so deliveries only connect to
+// public addresses, like link previews.
+type WebhookService struct {
+	repo   ports.WebhookRepository
+	authz  ports.Authorizer
+	client *http.Client
+	guard  *addressGuard
+	now    func() time.Time
+}
+
+// NewWebhookService creates a new WebhookService.
+func NewWebhookService(repo ports.WebhookRepository, authz ports.Authorizer) *WebhookService {
+	if repo == nil || authz == nil {
+		log.Fatal("WebhookRepository and Authorizer cannot be nil in NewWebhookService")
+	}
+	guard := &addressGuard{}
+	return &WebhookService{
+		repo:   repo,
+		authz:  authz,
+		client: newGuardedClient(guard, webhookTimeout, webhookMaxRedirects),
+		guard:  guard,
+		now:    time.Now,
+	}
+}
+
+// SetAllowedNetworks lets webhooks deliver to these networks even though
+// they are not public, e.g. a CI server on the LAN of the group.
+func (s *WebhookService) SetAllowedNetworks(networks []netip.Prefix) {
+	s.guard.allowed = networks
+}
+
+// SignWebhookPayload returns the signature header value of a webhook body.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireOwner fails unless the principal owns the room.
+func (s *WebhookService) requireOwner(p *models.Principal, roomID int64) error {
+	member, err := s.authz.RoomMember(p, roomID)
+	if err != nil {
+		return err
+	}
+	if member.Role != models.RoomRoleOwner {
+		return fmt.Errorf("%w: only room owners can manage webhooks", ErrForbidden)
+	}
+	return nil
+}
+
+// CreateWebhook subscribes an URL to events of a room. An empty events list
+// subscribes to all of models.WebhookEvents. The returned secret signs the
+// requests and is not shown again.
+func (s *WebhookService) CreateWebhook(p *models.Principal, roomID int64, rawURL string, events []string) (*models.Webhook, string, error) {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return nil, "", err
+	}
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, "", fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidInput)
+	}
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+	for _, event := range events {
+		if !models.IsValidWebhookEvent(event) {
+			return nil, "", fmt.Errorf("%w: unknown event %q", ErrInvalidInput, event)
+		}
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	webhook := &models.Webhook{
+		RoomID:    roomID,
+		URL:       target.String(),
+		Secret:    webhookSecretPrefix + secret,
+		Events:    events,
+		CreatedBy: p.ID,
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.repo.CreateWebhook(webhook); err != nil {
+		return nil, "", fmt.Errorf("creating webhook for room %d: %w", roomID, err)
+	}
+	return webhook, webhook.Secret, nil
+}
+
+// ListWebhooks returns the webhooks of a room the principal owns.
+func (s *WebhookService) ListWebhooks(p *models.Principal, roomID int64) ([]models.Webhook, error) {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListWebhooks(roomID)
+}
+
+// DeleteWebhook removes a webhook of a room the principal owns, with its queued deliveries.
+func (s *WebhookService) DeleteWebhook(p *models.Principal, roomID, webhookID int64) error {
+	if err := s.requireOwner(p, roomID); err != nil {
+		return err
+	}
+	webhook, err := s.repo.GetWebhook(webhookID)
+	if err != nil {
+		return fmt.Errorf("looking up webhook %d: %w", webhookID, err)
+	}
+	if webhook == nil || webhook.RoomID != roomID {
+		return ErrWebhookNotFound
+	}
+	return s.repo.DeleteWebhook(webhookID)
+}
+
+// Publish queues a delivery of the event for every webhook of its room that
+// subscribes to it. Events for some principals only, like whispers, are
+// skipped. Failures are logged; they must not fail the chat operation.
+func (s *WebhookService) Publish(event models.Event) {
+	if len(event.Recipients) > 0 {
+		return
+	}
+	webhooks, err := s.repo.ListWebhooks(event.RoomID)
+	if err != nil {
+		log.Printf("Error listing webhooks of room %d: %v", event.RoomID, err)
+		return
+	}
+	now := s.now().UTC()
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(WebhookPayload{Event: event, OccurredAt: now}); err != nil {
+				log.Printf("Error encoding %s webhook payload: %v", event.Type, err)
+				return
+			}
+		}
+		delivery := &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		if err := s.repo.CreateDelivery(delivery); err != nil {
+			log.Printf("Error queuing %s for webhook %d: %v", event.Type, webhook.ID, err)
+		}
+	}
+}
+
+// ListDeliveries returns deliveries for inspection, newest first.
+func (s *WebhookService) ListDeliveries(query ports.DeliveryQuery) ([]models.WebhookDelivery, error) {
+	if query.Status != "" && query.Status != models.DeliveryPending && query.Status != models.DeliveryDelivered && query.Status != models.DeliveryDead {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInput, query.Status)
+	}
+	return s.repo.ListDeliveries(query)
+}
+
+// GetDelivery returns a delivery for inspection.
+func (s *WebhookService) GetDelivery(id int64) (*models.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(id)
+	if err != nil {
+		return nil, fmt.Errorf("looking up delivery %d: %w", id, err)
+	}
+	if delivery == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// ReplayDelivery queues the payload of a delivery again, as a new delivery
+// that is attempted right away. The original is kept for inspection.
+func (s *WebhookService) ReplayDelivery(id int64) (*models.WebhookDelivery, error) {
+	original, err := s.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now().UTC()
+	replay := &models.WebhookDelivery{
+		WebhookID:     original.WebhookID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: now,
+		ReplayOf:      original.ID,
+		CreatedAt:     now,
+	}
+	if err := s.repo.CreateDelivery(replay); err != nil {
+		return nil, fmt.Errorf("queuing replay of delivery %d: %w", id, err)
+	}
+	return replay, nil
+}
+
+// Run delivers due deliveries every interval until ctx is done.
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.DeliverDue(ctx); err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts the deliveries that are due and returns how many were attempted.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		due, err := s.repo.DueDeliveries(s.now().UTC(), webhookBatchSize)
+		if err != nil {
+			return attempted, fmt.Errorf("loading due deliveries: %w", err)
+		}
+		for i := range due {
+			s.attempt(ctx, &due[i])
+			attempted++
+		}
+		if len(due) < webhookBatchSize {
+			break
+		}
+	}
+	return attempted, nil
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// with exponential backoff or dead-lettering it after MaxWebhookAttempts.
+func (s *WebhookService) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	webhook, err := s.repo.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		log.Printf("Error looking up webhook %d: %v", delivery.WebhookID, err)
+		return // Retried on the next run.
+	}
+
+	now := s.now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	if webhook == nil {
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = "webhook was deleted"
+	} else if status, err := s.send(ctx, webhook, delivery, now); err != nil {
+		delivery.LastStatusCode = status
+		delivery.LastError = truncate(err.Error(), webhookMaxErrorLength)
+		if delivery.Attempts >= MaxWebhookAttempts {
+			delivery.Status = models.DeliveryDead
+			log.Printf("Webhook delivery %d to webhook %d dead after %d attempts: %v", delivery.ID, webhook.ID, delivery.Attempts, err)
+		} else {
+			delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+		}
+	} else {
+		delivery.LastStatusCode = status
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+	}
+
+	if err := s.repo.UpdateDelivery(delivery); err != nil {
+		log.Printf("Error recording attempt of delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send POSTs the signed payload. Any status other than 2xx is an error.
+func (s *WebhookService) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Keeper-Webhooks/1")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxErrorLength))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(excerpt)))
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff is the delay after the given number of failed attempts:
+// 30s, 1m, 2m, ... capped at an hour.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookInitialBackoff
+	for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	return delay
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,241 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	webhookssqlite "keeper/server/adapters/webhooks/sqlite"
+	"keeper/server/core/ports"
+	"keeper/server/core/services"
+	"keeper/server/models"
+)
+
+// testClock is a settable clock for WebhookService.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// receiver records webhook requests and answers with status.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	w.WriteHeader(r.status)
+}
+
+func newTestWebhookService(t *testing.T) (*services.WebhookService, *testClock) {
+	t.Helper()
+	db := newTestDB(t)
+
+	repo := webhookssqlite.NewSQLiteWebhookRepository(db)
+	if err := repo.InitWebhookSchema(); err != nil {
+		t.Fatalf("InitWebhookSchema() failed: %v", err)
+	}
+	authz := &fakeAuthorizer{roles: map[string]string{owner.ID: models.RoomRoleOwner, member.ID: models.RoomRoleMember}}
+	svc := services.NewWebhookService(repo, authz)
+	svc.SetAllowedNetworks([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}) // Receivers are local test servers
+	clock := &testClock{now: time.Date(2026, 5, 1, 20, 0, 0, 0, time.UTC)}
+	svc.SetClock(clock.Now)
+	return svc, clock
+}
+
+func TestWebhookService_DeliversSignedPayload(t *testing.T) {
+	svc, _ := newTestWebhookService(t)
+	recv := &receiver{status: http.StatusNoContent}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	webhook, secret, err := svc.CreateWebhook(owner, 1, server.URL+"/hook", nil)
+	if err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	if len(webhook.Events) != len(models.WebhookEvents) {
+		t.Errorf("Expected all events by default, got %v", webhook.Events)
+	}
+
+	svc.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 1, Message: &models.Message{ID: 5, RoomID: 1, Text: "hello"}})
+	svc.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 2, Message: &models.Message{ID: 6, RoomID: 2}}) // Other room
+	if n, err := svc.DeliverDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DeliverDue() = %d, %v; want 1 delivery", n, err)
+	}
+
+	req, body := recv.requests[0], recv.bodies[0]
+	if req.Header.Get(services.WebhookEventHeader) != models.EventMessageCreated {
+		t.Errorf("Expected the event header, got %q", req.Header.Get(services.WebhookEventHeader))
+	}
+	want := services.SignWebhookPayload(secret, req.Header.Get(services.WebhookTimestampHeader), body)
+	if got := req.Header.Get(services.WebhookSignatureHeader); got != want {
+		t.Errorf("Expected signature %s, got %s", want, got)
+	}
+	var payload services.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Message == nil || payload.Message.Text != "hello" {
+		t.Errorf("Unexpected payload %s (%v)", body, err)
+	}
+
+	deliveries, _ := svc.ListDeliveries(ports.DeliveryQuery{Status: models.DeliveryDelivered})
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].DeliveredAt == nil {
+		t.Errorf("Expected one delivered delivery, got %+v", deliveries)
+	}
+}
+
+func TestWebhookService_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	svc, clock := newTestWebhookService(t)
+	recv := &receiver{status: http.StatusInternalServerError}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	if _, _, err := svc.CreateWebhook(owner, 1, server.URL, []string{models.EventMessageDeleted}); err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	svc.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 1}) // Not subscribed
+	svc.Publish(models.Event{Type: models.EventMessageDeleted, RoomID: 1, MessageID: 5})
+
+	if n, _ := svc.DeliverDue(context.Background()); n != 1 {
+		t.Fatalf("Expected only the subscribed event to be delivered, got %d", n)
+	}
+	pending, _ := svc.ListDeliveries(ports.DeliveryQuery{Status: models.DeliveryPending})
+	if len(pending) != 1 || pending[0].LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("Expected a pending delivery after a 500, got %+v", pending)
+	}
+	if delay := pending[0].NextAttemptAt.Sub(clock.Now()); delay != 30*time.Second {
+		t.Errorf("Expected the first retry after 30s, got %v", delay)
+	}
+	if n, _ := svc.DeliverDue(context.Background()); n != 0 {
+		t.Errorf("Expected no attempt before the backoff elapsed, got %d", n)
+	}
+
+	for attempt := 2; attempt <= services.MaxWebhookAttempts; attempt++ {
+		clock.Advance(time.Hour)
+		if n, _ := svc.DeliverDue(context.Background()); n != 1 {
+			t.Fatalf("Expected attempt %d, got %d deliveries", attempt, n)
+		}
+	}
+	dead, _ := svc.ListDeliveries(ports.DeliveryQuery{Status: models.DeliveryDead})
+	if len(dead) != 1 || dead[0].Attempts != services.MaxWebhookAttempts {
+		t.Fatalf("Expected a dead delivery after %d attempts, got %+v", services.MaxWebhookAttempts, dead)
+	}
+
+	recv.mu.Lock()
+	recv.status = http.StatusOK
+	recv.mu.Unlock()
+	replay, err := svc.ReplayDelivery(dead[0].ID)
+	if err != nil {
+		t.Fatalf("ReplayDelivery() failed: %v", err)
+	}
+	if replay.ReplayOf != dead[0].ID || replay.Payload != dead[0].Payload {
+		t.Errorf("Expected a copy of the dead delivery, got %+v", replay)
+	}
+	if n, _ := svc.DeliverDue(context.Background()); n != 1 {
+		t.Fatalf("Expected the replay to be delivered right away, got %d", n)
+	}
+	if got, _ := svc.GetDelivery(replay.ID); got.Status != models.DeliveryDelivered {
+		t.Errorf("Expected the replay to be delivered, got %+v", got)
+	}
+	if _, err := svc.ReplayDelivery(999); !errors.Is(err, services.ErrDeliveryNotFound) {
+		t.Errorf("Expected ErrDeliveryNotFound, got %v", err)
+	}
+}
+
+func TestWebhookService_RefusesLoopback(t *testing.T) {
+	svc, _ := newTestWebhookService(t)
+	svc.SetAllowedNetworks(nil)
+	recv := &receiver{status: http.StatusOK} // Stands in for an internal API, like Kratos admin
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	if _, _, err := svc.CreateWebhook(owner, 1, server.URL+"/admin/identities", nil); err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	svc.Publish(models.Event{Type: models.EventMessageCreated, RoomID: 1, Message: &models.Message{ID: 5, RoomID: 1}})
+	if n, err := svc.DeliverDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("DeliverDue() = %d, %v; want 1 attempt", n, err)
+	}
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if len(recv.requests) != 0 {
+		t.Errorf("Expected no request to reach a loopback address, got %d", len(recv.requests))
+	}
+	pending, _ := svc.ListDeliveries(ports.DeliveryQuery{Status: models.DeliveryPending})
+	if len(pending) != 1 || pending[0].LastStatusCode != 0 || !strings.Contains(pending[0].LastError, "address is not public") {
+		t.Errorf("Expected the delivery to fail without a response, got %+v", pending)
+	}
+}
+
+func TestWebhookService_CreateWebhook_Rejected(t *testing.T) {
+	svc, _ := newTestWebhookService(t)
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		url       string
+		events    []string
+		want      error
+	}{
+		{"member", member, "https://example.com/hook", nil, services.ErrForbidden},
+		{"not a member", hermit, "https://example.com/hook", nil, services.ErrNotRoomMember},
+		{"relative url", owner, "/hook", nil, services.ErrInvalidInput},
+		{"ftp url", owner, "ftp://example.com/hook", nil, services.ErrInvalidInput},
+		{"unknown event", owner, "https://example.com/hook", []string{"room.deleted"}, services.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := svc.CreateWebhook(tt.principal, 1, tt.url, tt.events); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestWebhookService_DeleteWebhook_DropsQueuedDeliveries(t *testing.T) {
+	svc, _ := newTestWebhookService(t)
+	webhook, _, err := svc.CreateWebhook(owner, 1, "https://example.invalid/hook", nil)
+	if err != nil {
+		t.Fatalf("CreateWebhook() failed: %v", err)
+	}
+	svc.Publish(models.Event{Type: models.EventMemberJoined, RoomID: 1, Member: &models.RoomMember{RoomID: 1, UserID: "new-id"}})
+
+	if err := svc.DeleteWebhook(owner, 2, webhook.ID); !errors.Is(err, services.ErrRoomNotFound) {
+		t.Errorf("Expected ErrRoomNotFound for another room, got %v", err)
+	}
+	if err := svc.DeleteWebhook(owner, 1, webhook.ID); err != nil {
+		t.Fatalf("DeleteWebhook() failed: %v", err)
+	}
+	if deliveries, _ := svc.ListDeliveries(ports.DeliveryQuery{}); len(deliveries) != 0 {
+		t.Errorf("Expected queued deliveries to be deleted, got %+v", deliveries)
+	}
+	if n, _ := svc.DeliverDue(context.Background()); n != 0 {
+		t.Errorf("Expected nothing to deliver, got %d", n)
+	}
+}
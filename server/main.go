@@ -1,33 +1,79 @@
 package main
 
 import (
-	"context" // Added for ValidateToken
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"errors"
-	// authsqlite "keeper/server/adapters/auth/sqlite" // Old user repo
-	messagingsqlite "keeper/server/adapters/messaging/sqlite" // For messageRepo
+	authsqlite "keeper/server/adapters/auth/sqlite"                   // Service accounts (and the old user repo)
+	"keeper/server/adapters/blobs/local"                              // Uploads on disk
+	"keeper/server/adapters/blobs/s3"                                 // Uploads in an S3-compatible bucket
+	calendarsqlite "keeper/server/adapters/calendar/sqlite"           // Scheduled sessions, RSVPs and reminders
+	characterssqlite "keeper/server/adapters/characters/sqlite"       // Characters and their sheets
+	commandssqlite "keeper/server/adapters/commands/sqlite"           // Slash commands registered by bots
+	filessqlite "keeper/server/adapters/files/sqlite"                 // Metadata of uploaded files
+	initiativesqlite "keeper/server/adapters/initiative/sqlite"       // Turn orders of fights
+	"keeper/server/adapters/mail/smtp"                                // Email digests
+	mentionssqlite "keeper/server/adapters/mentions/sqlite"           // Mentions inboxes
+	messagingsqlite "keeper/server/adapters/messaging/sqlite"         // For messageRepo
+	notificationssqlite "keeper/server/adapters/notifications/sqlite" // Notification preferences and digests
+	previewssqlite "keeper/server/adapters/previews/sqlite"           // Cached link previews
+	"keeper/server/adapters/realtime"
+	sessionssqlite "keeper/server/adapters/sessions/sqlite" // Game sessions and their transcripts
+	webhookssqlite "keeper/server/adapters/webhooks/sqlite" // Outgoing and incoming webhooks
 	"keeper/server/core/ports"
 	"keeper/server/core/services"
-	"keeper/server/models"                           // Old user model, still used by wsHandler temporarily
+	"keeper/server/models"
 	usersmanagement "keeper/server/users-management" // New user management package
 
 	"github.com/gorilla/websocket"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// webhookPollInterval is how often queued webhook deliveries are checked.
+const webhookPollInterval = 5 * time.Second
+
+// reminderPollInterval is how often due event reminders are checked.
+const reminderPollInterval = time.Minute
+
+// digestPollInterval is how often due email digests are checked.
+const digestPollInterval = time.Minute
+
+// defaultMailFrom is the sender of emails unless SMTP_FROM_ADDRESS is set.
+const defaultMailFrom = "Keeper Chat <no-reply@keeper.local>"
+
+// allowedOrigins are the web apps, besides the server itself, whose pages may
+// use the API and WebSocket with the visitor's session cookie.
+var allowedOrigins = []string{"http://localhost:8081"} // Kratos UI / Test UI
+
 // --- WebSocket Upgrader ---
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin refuses WebSocket connections from pages of other sites, which
+// would otherwise act as the visitor through their session cookie. Clients
+// that are not browsers send no Origin.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(allowedOrigins, origin) {
 		return true
-	},
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
 }
 
 // --- Request/Response Structs ---
@@ -89,32 +135,178 @@ func loginHandler(authSvc ports.AuthService) http.HandlerFunc {
 }
 */
 
-func wsHandler(w http.ResponseWriter, r *http.Request, messageRepo ports.MessageRepository, authSvc *services.AuthServiceImpl) {
-	// Extract Kratos session cookie
-	// The actual cookie name is 'ory_kratos_session'.
-	sessionCookie, err := r.Cookie("ory_kratos_session")
-	if err != nil {
+// sessionTokenFromRequest extracts the Kratos session token from the
+// ory_kratos_session cookie, falling back to the X-Session-Token header used
+// by non-browser clients.
+func sessionTokenFromRequest(r *http.Request) string {
+	if sessionCookie, err := r.Cookie("ory_kratos_session"); err == nil && sessionCookie.Value != "" {
+		return sessionCookie.Value
+	}
+	return r.Header.Get("X-Session-Token")
+}
+
+// authenticateRequest validates the Kratos session carried by the request.
+// On failure it writes a 401 response and returns nil.
+func authenticateRequest(w http.ResponseWriter, r *http.Request, authSvc ports.AuthService) *usersmanagement.User {
+	kratosSessionToken := sessionTokenFromRequest(r)
+	if kratosSessionToken == "" {
 		// If cookie is not found, it means the user is not logged in via Kratos.
-		log.Printf("WebSocket: Kratos session cookie not found: %v", err)
+		log.Printf("%s %s: Kratos session cookie not found", r.Method, r.URL.Path)
 		respondError(w, http.StatusUnauthorized, "Authentication required: Missing session cookie")
-		return
+		return nil
 	}
-	kratosSessionToken := sessionCookie.Value
 
-	// Validate Kratos session token
-	// Pass context.Background() for now, or a request-specific context if available.
-	authUser, err := authSvc.ValidateToken(context.Background(), kratosSessionToken)
+	authUser, err := authSvc.ValidateToken(r.Context(), kratosSessionToken)
 	if err != nil {
-		log.Printf("WebSocket: Kratos session validation failed: %v", err)
+		log.Printf("%s %s: Kratos session validation failed: %v", r.Method, r.URL.Path, err)
 		if errors.Is(err, services.ErrInvalidToken) {
 			respondError(w, http.StatusUnauthorized, "Invalid or expired session")
 		} else {
 			respondError(w, http.StatusUnauthorized, "Authentication failed")
 		}
+		return nil
+	}
+	return authUser
+}
+
+// apiKeyFromRequest extracts a service account API key from the
+// Authorization header ("Bearer kpr_...") or the X-API-Key header.
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer "+services.APIKeyPrefix) {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticatePrincipal accepts both Kratos sessions and service account API
+// keys. Bots additionally need one of the given scopes (if any).
+// On failure it writes a 401 or 403 response and returns nil.
+func authenticatePrincipal(w http.ResponseWriter, r *http.Request, authSvc ports.AuthService, anyOf ...string) *models.Principal {
+	key := apiKeyFromRequest(r)
+	if key == "" {
+		authUser := authenticateRequest(w, r, authSvc)
+		if authUser == nil {
+			return nil
+		}
+		return userPrincipal(authUser)
+	}
+
+	principal, err := authSvc.AuthenticateAPIKey(r.Context(), key)
+	if err != nil {
+		log.Printf("%s %s: API key rejected: %v", r.Method, r.URL.Path, err)
+		respondError(w, http.StatusUnauthorized, "Invalid or revoked API key")
+		return nil
+	}
+	if len(anyOf) > 0 && !slices.ContainsFunc(anyOf, principal.Can) {
+		log.Printf("%s %s: service account %s lacks scope %v", r.Method, r.URL.Path, principal.ID, anyOf)
+		respondError(w, http.StatusForbidden, "API key lacks the required scope")
+		return nil
+	}
+	return principal
+}
+
+// userPrincipal describes a Kratos user as a message author.
+func userPrincipal(u *usersmanagement.User) *models.Principal {
+	return &models.Principal{ID: u.ID, Type: models.AuthorTypeUser, DisplayName: u.DisplayName()}
+}
+
+// userLookup finds Kratos users by identity ID; *usersmanagement.UserService
+// implements it.
+type userLookup interface {
+	LookupUser(ctx context.Context, id string) (*usersmanagement.User, error)
+	LookupUsers(ctx context.Context, ids []string) (map[string]*usersmanagement.User, error)
+}
+
+// userDirectory adapts a userLookup to ports.IdentityDirectory.
+type userDirectory struct {
+	users userLookup
+}
+
+// LookupIdentity implements ports.IdentityDirectory.
+func (d userDirectory) LookupIdentity(ctx context.Context, id string) (*models.Identity, error) {
+	u, err := d.users.LookupUser(ctx, id)
+	if errors.Is(err, usersmanagement.ErrIdentityNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return userIdentity(u), nil
+}
+
+// LookupIdentities implements ports.IdentityDirectory.
+func (d userDirectory) LookupIdentities(ctx context.Context, ids []string) (map[string]*models.Identity, error) {
+	users, err := d.users.LookupUsers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	identities := make(map[string]*models.Identity, len(users))
+	for id, u := range users {
+		identities[id] = userIdentity(u)
+	}
+	return identities, nil
+}
+
+// userIdentity describes a Kratos user to the services.
+func userIdentity(u *usersmanagement.User) *models.Identity {
+	return &models.Identity{ID: u.ID, DisplayName: u.DisplayName(), Nickname: u.Profile.Nickname, FirstName: u.FirstName, Email: u.Email}
+}
+
+// WebSocket frame types sent by clients. Frames without a type post a message.
+const (
+	frameMessageCreate = "message.create"
+	frameMessageEdit   = "message.edit"
+	frameMessageDelete = "message.delete"
+	frameMessageReveal = "message.reveal"
+	frameSubscribe     = "subscribe"
+	frameUnsubscribe   = "unsubscribe"
+)
+
+// ClientFrame is a frame sent by a WebSocket client.
+type ClientFrame struct {
+	Type      string   `json:"type,omitempty"`
+	RoomID    int64    `json:"room_id,omitempty"`
+	MessageID int64    `json:"message_id,omitempty"`
+	Text      string   `json:"text,omitempty"`
+	Format    string   `json:"format,omitempty"`     // "plain" or "markdown" for new messages
+	VisibleTo []string `json:"visible_to,omitempty"` // Members who may see a whisper, besides the sender
+	// CharacterID posts as a character; InCharacter marks narration as part of the fiction.
+	CharacterID int64 `json:"character_id,omitempty"`
+	InCharacter bool  `json:"in_character,omitempty"`
+	// FileIDs posts uploaded files with the message.
+	FileIDs []int64 `json:"file_ids,omitempty"`
+}
+
+// ServerFrame is a reply to a single client. Room events are sent as models.Event.
+type ServerFrame struct {
+	Type   string `json:"type"` // "error", "subscribed" or "unsubscribed"
+	RoomID int64  `json:"room_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// wsHandler upgrades the connection, subscribes it to the principal's rooms
+// and handles client frames until the connection closes. Changes made over
+// the socket are broadcast to the room by the chat service, like REST changes.
+func wsHandler(w http.ResponseWriter, r *http.Request, chatSvc ports.ChatService, hub *realtime.Hub, authSvc ports.AuthService) {
+	principal := authenticatePrincipal(w, r, authSvc, models.ScopeMessagesRead, models.ScopeMessagesWrite)
+	if principal == nil {
 		return
 	}
-	// authUser is now *usersmanagement.User. We need to adapt how its fields are used.
-	log.Printf("User %s (ID: %s) authenticated via Kratos for WebSocket connection.", authUser.Email, authUser.ID)
+	log.Printf("%s %s (ID: %s) authenticated for WebSocket connection.", principal.Type, principal.DisplayName, principal.ID)
+
+	// Subscribe before upgrading, so no event is missed once the client is connected.
+	client := realtime.NewClient(principal.ID)
+	hub.Register(client)
+	defer hub.Unregister(client)
+	if principal.Can(models.ScopeMessagesRead) {
+		rooms, err := chatSvc.ListRooms(principal)
+		if err != nil {
+			log.Printf("Error listing rooms of %s: %v", principal.ID, err)
+		}
+		for _, room := range rooms {
+			hub.Subscribe(client, room.ID)
+		}
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -123,36 +315,95 @@ func wsHandler(w http.ResponseWriter, r *http.Request, messageRepo ports.Message
 		return
 	}
 	defer conn.Close()
-	log.Printf("WebSocket connection established for user: %s (Kratos ID: %s)", authUser.Email, authUser.ID)
+	log.Printf("WebSocket connection established for %s (ID: %s)", principal.DisplayName, principal.ID)
+	// ctx ends with the connection, so a bot answering a command is not waited for.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		writeFrames(conn, client)
+		cancel()
+	}()
 
-	// Adapt sampleMessage to use fields from usersmanagement.User
-	sampleMessage := models.Message{ // This is the old models.Message
-		User:      authUser.Email, // Using email as username, or choose another trait
-		Text:      "Hello from the Kratos authenticated server!",
-		Timestamp: time.Now(),
+	for {
+		var frame ClientFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Error reading from WebSocket of %s: %v", principal.ID, err)
+			}
+			return
+		}
+		if reply := handleClientFrame(ctx, chatSvc, hub, client, principal, frame); reply != nil {
+			hub.SendTo(client, reply)
+		}
 	}
+}
 
-	err = messageRepo.SaveMessage(sampleMessage)
+// handleClientFrame applies a client frame. It returns a frame to send back
+// to the client only, or nil when the result is broadcast as a room event.
+func handleClientFrame(ctx context.Context, chatSvc ports.ChatService, hub *realtime.Hub, client *realtime.Client, principal *models.Principal, frame ClientFrame) *ServerFrame {
+	var err error
+	switch frame.Type {
+	case "", frameMessageCreate:
+		_, err = chatSvc.SendMessageContext(ctx, principal, ports.MessageDraft{
+			RoomID:      frame.RoomID,
+			Text:        frame.Text,
+			Format:      frame.Format,
+			VisibleTo:   frame.VisibleTo,
+			CharacterID: frame.CharacterID,
+			InCharacter: frame.InCharacter,
+			FileIDs:     frame.FileIDs,
+		})
+	case frameMessageEdit:
+		_, err = chatSvc.EditMessage(principal, 0, frame.MessageID, frame.Text)
+	case frameMessageDelete:
+		err = chatSvc.DeleteMessage(principal, 0, frame.MessageID)
+	case frameMessageReveal:
+		_, err = chatSvc.RevealMessage(principal, 0, frame.MessageID)
+	case frameSubscribe:
+		if err = services.RequireScope(principal, models.ScopeMessagesRead); err == nil {
+			_, err = chatSvc.GetRoom(principal, frame.RoomID)
+		}
+		if err == nil {
+			hub.Subscribe(client, frame.RoomID)
+			return &ServerFrame{Type: "subscribed", RoomID: frame.RoomID}
+		}
+	case frameUnsubscribe:
+		hub.Unsubscribe(client, frame.RoomID)
+		return &ServerFrame{Type: "unsubscribed", RoomID: frame.RoomID}
+	default:
+		err = fmt.Errorf("%w: unknown frame type %q", services.ErrInvalidInput, frame.Type)
+	}
 	if err != nil {
-		log.Printf("Error saving message from user %s: %v", authUser.Email, err)
-	} else {
-		log.Printf("Message from %s saved successfully", authUser.Email)
+		_, message := chatErrorStatus(err)
+		return &ServerFrame{Type: "error", RoomID: frame.RoomID, Error: message}
 	}
+	return nil
+}
 
-	if err := conn.WriteJSON(sampleMessage); err != nil {
-		log.Printf("Error writing JSON to WebSocket for user %s: %v", authUser.Email, err)
+// writeFrames writes queued frames to the connection until the hub closes the
+// client's channel, then closes the connection so the read loop ends as well.
+func writeFrames(conn *websocket.Conn, client *realtime.Client) {
+	defer conn.Close()
+	for frame := range client.Send() {
+		if err := conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+			log.Printf("Error writing to WebSocket of %s: %v", client.ID, err)
+			return
+		}
 	}
 }
 
 // --- CORS Middleware ---
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:8081") // Kratos UI / Test UI
-		w.Header().Set("Access-Control-Allow-Credentials", "true")             // Important for Kratos cookies
+		w.Header().Add("Vary", "Origin")
+		if origin := r.Header.Get("Origin"); slices.Contains(allowedOrigins, origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true") // Important for Kratos cookies
+		}
 
 		if r.Method == http.MethodOptions {
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, X-Session-Token") // Added X-Session-Token
+			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, Accept, X-Session-Token, X-API-Key")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -161,6 +412,85 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// loadTraitMapping picks the identity trait mapping: an explicit mapping file
+// (TRAIT_MAPPING_PATH) wins over annotations in the Kratos identity schema
+// (KRATOS_IDENTITY_SCHEMA_PATH); without either the defaults are used.
+func loadTraitMapping() (usersmanagement.TraitMapping, error) {
+	if path := os.Getenv("TRAIT_MAPPING_PATH"); path != "" {
+		log.Printf("Loading identity trait mapping from %s", path)
+		return usersmanagement.LoadTraitMapping(path)
+	}
+	if path := os.Getenv("KRATOS_IDENTITY_SCHEMA_PATH"); path != "" {
+		log.Printf("Deriving identity trait mapping from schema %s", path)
+		return usersmanagement.LoadTraitMappingFromSchemaFile(path)
+	}
+	return usersmanagement.DefaultTraitMapping(), nil
+}
+
+// openBlobStore picks where uploaded files are kept: a directory (BLOB_DIR)
+// by default, or an S3-compatible bucket when BLOB_STORE is s3.
+func openBlobStore() (ports.BlobStore, error) {
+	switch store := os.Getenv("BLOB_STORE"); store {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		log.Printf("Storing uploads in %s", dir)
+		return local.NewStore(dir)
+	case "s3":
+		cfg := s3.Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		}
+		log.Printf("Storing uploads in bucket %s at %s", cfg.Bucket, cfg.Endpoint)
+		return s3.NewStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q, use local or s3", store)
+	}
+}
+
+// parseReminderOffsets parses EVENT_REMINDERS, a comma-separated list of
+// durations before the start of events such as "24h,1h,10m", into minutes.
+// "none" turns reminders off unless an event asks for them.
+func parseReminderOffsets(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "none" {
+		return []int{}, nil
+	}
+	var minutes []int
+	for _, part := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Minute || d > services.MaxReminderOffset*time.Minute {
+			return nil, fmt.Errorf("%s is not between 1m and %s", part, services.MaxReminderOffset*time.Minute)
+		}
+		minutes = append(minutes, int(d/time.Minute))
+	}
+	if len(minutes) > services.MaxEventReminders {
+		return nil, fmt.Errorf("at most %d reminders are allowed", services.MaxEventReminders)
+	}
+	return minutes, nil
+}
+
+// parseNetworks parses LINK_PREVIEW_NETWORKS, a comma-separated list of
+// CIDR prefixes such as "10.0.0.0/8,fd00::/8".
+func parseNetworks(value string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, part := range strings.Split(value, ",") {
+		network, err := netip.ParsePrefix(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
 func main() {
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
@@ -178,6 +508,68 @@ func main() {
 		log.Fatalf("Failed to initialize message database schema: %v", err)
 	}
 
+	roomRepo := messagingsqlite.NewSQLiteRoomRepository(db)
+	if err := roomRepo.InitRoomSchema(); err != nil {
+		log.Fatalf("Failed to initialize room database schema: %v", err)
+	}
+
+	serviceAccountRepo := authsqlite.NewSQLiteServiceAccountRepository(db)
+	if err := serviceAccountRepo.InitServiceAccountSchema(); err != nil {
+		log.Fatalf("Failed to initialize service account database schema: %v", err)
+	}
+	serviceAccountSvc := services.NewServiceAccountService(serviceAccountRepo)
+
+	webhookRepo := webhookssqlite.NewSQLiteWebhookRepository(db)
+	if err := webhookRepo.InitWebhookSchema(); err != nil {
+		log.Fatalf("Failed to initialize webhook database schema: %v", err)
+	}
+
+	commandRepo := commandssqlite.NewSQLiteCommandRepository(db)
+	if err := commandRepo.InitCommandSchema(); err != nil {
+		log.Fatalf("Failed to initialize command database schema: %v", err)
+	}
+
+	characterRepo := characterssqlite.NewSQLiteCharacterRepository(db)
+	if err := characterRepo.InitCharacterSchema(); err != nil {
+		log.Fatalf("Failed to initialize character database schema: %v", err)
+	}
+
+	initiativeRepo := initiativesqlite.NewSQLiteInitiativeRepository(db)
+	if err := initiativeRepo.InitInitiativeSchema(); err != nil {
+		log.Fatalf("Failed to initialize initiative database schema: %v", err)
+	}
+
+	sessionRepo := sessionssqlite.NewSQLiteSessionRepository(db)
+	if err := sessionRepo.InitSessionSchema(); err != nil {
+		log.Fatalf("Failed to initialize session database schema: %v", err)
+	}
+
+	calendarRepo := calendarsqlite.NewSQLiteCalendarRepository(db)
+	if err := calendarRepo.InitCalendarSchema(); err != nil {
+		log.Fatalf("Failed to initialize calendar database schema: %v", err)
+	}
+
+	fileRepo := filessqlite.NewSQLiteFileRepository(db)
+	if err := fileRepo.InitFileSchema(); err != nil {
+		log.Fatalf("Failed to initialize file database schema: %v", err)
+	}
+	previewRepo := previewssqlite.NewSQLiteLinkPreviewRepository(db)
+	if err := previewRepo.InitLinkPreviewSchema(); err != nil {
+		log.Fatalf("Failed to initialize link preview database schema: %v", err)
+	}
+	mentionRepo := mentionssqlite.NewSQLiteMentionRepository(db)
+	if err := mentionRepo.InitMentionSchema(); err != nil {
+		log.Fatalf("Failed to initialize mention database schema: %v", err)
+	}
+	notificationRepo := notificationssqlite.NewSQLiteNotificationRepository(db)
+	if err := notificationRepo.InitNotificationSchema(); err != nil {
+		log.Fatalf("Failed to initialize notification database schema: %v", err)
+	}
+	blobs, err := openBlobStore()
+	if err != nil {
+		log.Fatalf("Failed to open blob store: %v", err)
+	}
+
 	// Remove old user repository
 	// userRepo := authsqlite.NewSQLiteUserRepository(db)
 	// if err := userRepo.InitUserSchema(); err != nil {
@@ -203,7 +595,11 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to create Kratos client: %v", err)
 	}
-	kratosUserService := usersmanagement.NewUserService(kratosClient)
+	traitMapping, err := loadTraitMapping()
+	if err != nil {
+		log.Fatalf("Failed to load identity trait mapping: %v", err)
+	}
+	kratosUserService := usersmanagement.NewUserServiceWithMapping(kratosClient, traitMapping)
 
 	// Initialize Auth Service with the new Kratos User Service
 	// jwtSecret := os.Getenv("JWT_SECRET") // No longer needed for Kratos sessions
@@ -211,16 +607,106 @@ func main() {
 	// 	jwtSecret = "your-super-secret-key-for-dev"
 	// 	log.Println("Warning: Using hardcoded JWT_SECRET. This is not secure for production.")
 	// }
-	authSvc := services.NewAuthService(kratosUserService /*, jwtSecret */) // Pass Kratos user service
+	authSvc := services.NewAuthService(kratosUserService, serviceAccountSvc /*, jwtSecret */) // Pass Kratos user service
 
 	// Setup HTTP handlers with CORS middleware
 	// http.Handle("/api/register", corsMiddleware(registerHandler(authSvc))) // Deprecated
 	// http.Handle("/api/login", corsMiddleware(loginHandler(authSvc)))       // Deprecated
 
-	// Ensure wsHandler gets the correctly typed authSvc
-	http.Handle("/ws", corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		wsHandler(w, r, messageRepo, authSvc) // authSvc is now *services.AuthServiceImpl
-	})))
+	mux := http.NewServeMux()
+	hub := realtime.NewHub()
+	authz := services.NewRoomAuthorizer(roomRepo)
+	var webhookNetworks []netip.Prefix // Private networks of webhooks and bot commands
+	if value := os.Getenv("WEBHOOK_NETWORKS"); value != "" {
+		if webhookNetworks, err = parseNetworks(value); err != nil {
+			log.Fatalf("Invalid WEBHOOK_NETWORKS: %v", err)
+		}
+	}
+	webhookSvc := services.NewWebhookService(webhookRepo, authz)
+	webhookSvc.SetAllowedNetworks(webhookNetworks)
+	go webhookSvc.Run(context.Background(), webhookPollInterval)
+	publishers := services.Publishers{hub, webhookSvc}
+	if os.Getenv("LINK_PREVIEWS") != "off" {
+		unfurl := services.NewUnfurlService(previewRepo, messageRepo, services.Publishers{hub, webhookSvc})
+		if value := os.Getenv("LINK_PREVIEW_NETWORKS"); value != "" {
+			networks, err := parseNetworks(value)
+			if err != nil {
+				log.Fatalf("Invalid LINK_PREVIEW_NETWORKS: %v", err)
+			}
+			unfurl.SetAllowedNetworks(networks)
+		}
+		go unfurl.Run(context.Background())
+		publishers = append(publishers, unfurl)
+	}
+	mentions := services.NewMentionService(mentionRepo, roomRepo, messageRepo, userDirectory{kratosUserService}, hub, hub)
+	go mentions.Run(context.Background())
+	publishers = append(publishers, mentions)
+	chatSvc := services.NewChatService(messageRepo, roomRepo, authz, publishers)
+	commands := services.NewCommandRegistry(commandRepo, serviceAccountRepo, authz)
+	commands.SetAllowedNetworks(webhookNetworks)
+	chatSvc.SetCommands(commands)
+	characters := services.NewCharacterService(characterRepo, roomRepo, authz)
+	chatSvc.SetCharacters(characters)
+	initiative := services.NewInitiativeService(initiativeRepo, authz, services.Publishers{hub, webhookSvc})
+	initiative.SetCharacters(characters)
+	chatSvc.SetInitiative(initiative)
+	sessions := services.NewSessionService(sessionRepo, authz, chatSvc)
+	chatSvc.SetSessions(sessions)
+	calendar := services.NewCalendarService(calendarRepo, authz, chatSvc)
+	if value := os.Getenv("EVENT_REMINDERS"); value != "" {
+		reminders, err := parseReminderOffsets(value)
+		if err != nil {
+			log.Fatalf("Invalid EVENT_REMINDERS: %v", err)
+		}
+		calendar.SetDefaultReminders(reminders)
+	}
+	chatSvc.SetCalendar(calendar)
+	go calendar.Run(context.Background(), reminderPollInterval)
+	files := services.NewFileService(fileRepo, blobs, messageRepo, authz)
+	if value := os.Getenv("UPLOAD_MAX_BYTES"); value != "" {
+		maxSize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxSize <= 0 {
+			log.Fatalf("Invalid UPLOAD_MAX_BYTES %q", value)
+		}
+		files.SetMaxSize(maxSize)
+	}
+	if secret := os.Getenv("FILE_URL_SECRET"); secret != "" {
+		files.SetURLSecret([]byte(secret))
+	}
+	chatSvc.SetFiles(files)
+	notifications := services.NewNotificationService(notificationRepo, mentionRepo, roomRepo, messageRepo, userDirectory{kratosUserService}, hub)
+	if uri := os.Getenv("SMTP_CONNECTION_URI"); uri != "" {
+		from := os.Getenv("SMTP_FROM_ADDRESS")
+		if from == "" {
+			from = defaultMailFrom
+		}
+		mailer, err := smtp.NewMailer(smtp.Config{URI: uri, From: from})
+		if err != nil {
+			log.Fatalf("Invalid SMTP configuration: %v", err)
+		}
+		notifications.SetMailer(mailer)
+		go notifications.Run(context.Background(), digestPollInterval)
+	} else {
+		log.Println("SMTP_CONNECTION_URI not set, email digests are disabled")
+	}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		wsHandler(w, r, chatSvc, hub, authSvc)
+	})
+	registerRoomRoutes(mux, authSvc, chatSvc)
+	registerUserRoutes(mux, authSvc, kratosUserService)
+	registerAdminRoutes(mux, authSvc, usersmanagement.NewAdminService(kratosClient, kratosUserService))
+	registerServiceAccountRoutes(mux, authSvc, serviceAccountSvc)
+	registerWebhookRoutes(mux, authSvc, webhookSvc)
+	registerIncomingWebhookRoutes(mux, authSvc, services.NewIncomingWebhookService(webhookRepo, authz, chatSvc))
+	registerCommandRoutes(mux, authSvc, commands)
+	registerCharacterRoutes(mux, authSvc, characters)
+	registerInitiativeRoutes(mux, authSvc, initiative)
+	registerGameSessionRoutes(mux, authSvc, sessions)
+	registerCalendarRoutes(mux, authSvc, calendar)
+	registerFileRoutes(mux, authSvc, files)
+	registerMentionRoutes(mux, authSvc, mentions)
+	registerNotificationRoutes(mux, authSvc, notifications)
+	registerSpecRoutes(mux)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -228,7 +714,8 @@ func main() {
 	}
 
 	log.Printf("Starting server on :%s", port)
-	err = http.ListenAndServe(":"+port, nil)
+	// CORS wraps the whole mux so preflight requests reach it before method-based routing.
+	err = http.ListenAndServe(":"+port, corsMiddleware(mux))
 	if err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Answers of attendees to a calendar event.
+const (
+	RSVPYes   = "yes"
+	RSVPNo    = "no"
+	RSVPMaybe = "maybe"
+)
+
+// CalendarEvent is a game session scheduled in a room. StartsAt is an
+// instant; Timezone is the zone it was planned in, which reminders and
+// calendar feeds show it in.
+type CalendarEvent struct {
+	ID          int64      `json:"id"`
+	RoomID      int64      `json:"room_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	StartsAt    time.Time  `json:"starts_at"`
+	Timezone    string     `json:"timezone"`                   // IANA name, e.g. "Europe/Berlin"
+	Duration    int        `json:"duration_minutes,omitempty"` // 0 if open-ended
+	Reminders   []int      `json:"reminders"`                  // Minutes before the start at which the room is reminded
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	Attendees   []Attendee `json:"attendees"` // Members who answered, in the order they first did
+}
+
+// Attendee is a member's answer to a calendar event.
+type Attendee struct {
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`     // Display name at the time of answering
+	Response    string    `json:"response"` // One of the RSVP constants
+	RespondedAt time.Time `json:"responded_at"`
+}
+
+// Reminder is a message to post to the room of a calendar event at DueAt.
+type Reminder struct {
+	ID      int64
+	EventID int64
+	DueAt   time.Time
+}
+
+// CalendarFeed is a member's secret subscription URL for the calendar of a
+// room. Like incoming webhooks, only a hash of its token is stored.
+type CalendarFeed struct {
+	ID        int64
+	RoomID    int64
+	UserID    string
+	Prefix    string
+	Hash      string
+	CreatedAt time.Time
+}
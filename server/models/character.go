@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Character sheet templates.
+const (
+	CharacterTemplateCoC7 = "coc7" // A Call of Cthulhu 7th edition investigator
+)
+
+// Character is a player character or NPC of a room's campaign. Its sheet is
+// JSON validated against the schema of its template.
+type Character struct {
+	ID        int64           `json:"id"`
+	RoomID    int64           `json:"room_id"`
+	OwnerID   string          `json:"owner_id"` // Kratos identity of the player, or of the GM for NPCs
+	Name      string          `json:"name"`     // Unique within the room, ignoring case
+	AvatarURL string          `json:"avatar_url,omitempty"`
+	Template  string          `json:"template"` // One of the CharacterTemplate constants
+	Sheet     json.RawMessage `json:"sheet"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
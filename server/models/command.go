@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Command describes a slash command. Built-in commands have no ID; commands
+// registered by a bot are run by POSTing the invocation to the bot's URL, in
+// rooms the bot is a member of.
+type Command struct {
+	ID               int64     `json:"id,omitempty"`
+	Name             string    `json:"name"` // Without the leading slash
+	Usage            string    `json:"usage,omitempty"`
+	Description      string    `json:"description"`
+	ServiceAccountID string    `json:"service_account_id,omitempty"`
+	URL              string    `json:"url,omitempty"`
+	Secret           string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at,omitzero"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// Room event types, sent to WebSocket clients as the "type" of a frame.
+const (
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	EventMemberJoined   = "member.joined"
+	EventRoomUpdated    = "room.updated"
+
+	// EventMessageRevealed carries a whisper or hidden roll that was made
+	// visible to the whole room.
+	EventMessageRevealed = "message.revealed"
+
+	// EventInitiativeUpdated carries the whole turn order of a room after
+	// any change to it.
+	EventInitiativeUpdated = "initiative.updated"
+
+	// EventMessageEphemeral carries a message that is shown to one principal
+	// only, e.g. the reply to a slash command. It is never stored.
+	EventMessageEphemeral = "message.ephemeral"
+
+	// EventMentionCreated tells a user that a message mentioned them. It
+	// reaches all of their connections, subscribed to the room or not.
+	EventMentionCreated = "mention.created"
+)
+
+// Event is something that happened in a room.
+type Event struct {
+	Type       string      `json:"type"`
+	RoomID     int64       `json:"room_id"`
+	Message    *Message    `json:"message,omitempty"`    // For created and updated messages
+	MessageID  int64       `json:"message_id,omitempty"` // For deleted messages
+	Member     *RoomMember `json:"member,omitempty"`     // For joined members
+	Room       *Room       `json:"room,omitempty"`       // For updated rooms
+	Initiative *Initiative `json:"initiative,omitempty"` // For updated turn orders
+	Mention    *Mention    `json:"mention,omitempty"`    // For mentions, with the message
+	Recipients []string    `json:"-"`                    // If set, only these principals receive the event
+	Personal   bool        `json:"-"`                    // Sent to the recipients even if they are not subscribed to the room
+}
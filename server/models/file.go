@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// File is an upload kept in the blob store, e.g. a map, a handout or a
+// screenshot. It belongs to a room and stays private to its uploader until
+// it is posted with a message; from then on whoever sees the message can
+// download it.
+type File struct {
+	ID          int64       `json:"id"`
+	RoomID      int64       `json:"room_id"`
+	MessageID   int64       `json:"message_id,omitempty"` // 0 until posted
+	UploadedBy  string      `json:"uploaded_by"`
+	Name        string      `json:"name"`            // File name given by the uploader
+	ContentType string      `json:"content_type"`    // Detected from the content, not taken from the client
+	Size        int64       `json:"size"`            // In bytes
+	URL         string      `json:"url"`             // Download path; needs the same credentials as the API
+	Width       int         `json:"width,omitempty"` // Of images, in pixels, upright; 0 for other files
+	Height      int         `json:"height,omitempty"`
+	Thumbnails  []Thumbnail `json:"thumbnails,omitempty"`
+	Key         string      `json:"-"` // Key of the content in the blob store
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Thumbnail is a smaller copy of an image, made when the image is larger
+// than the thumbnail size.
+type Thumbnail struct {
+	Name        string `json:"name"` // ThumbnailSmall, ThumbnailMedium or ThumbnailLarge
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"` // In bytes
+	URL         string `json:"url"`
+}
+
+// Thumbnail sizes, from smallest to largest.
+const (
+	ThumbnailSmall  = "small"  // Fits 160x160, e.g. for lists of files
+	ThumbnailMedium = "medium" // Fits 480x480, e.g. inline in the chat
+	ThumbnailLarge  = "large"  // Fits 1280x1280, e.g. for a lightbox
+)
+
+// Thumbnail returns the thumbnail with the given name, or nil if the file
+// has none of that size.
+func (f *File) Thumbnail(name string) *Thumbnail {
+	for i := range f.Thumbnails {
+		if f.Thumbnails[i].Name == name {
+			return &f.Thumbnails[i]
+		}
+	}
+	return nil
+}
+
+// IsImage reports whether clients can show the file inline.
+func (f *File) IsImage() bool {
+	return len(f.ContentType) > 6 && f.ContentType[:6] == "image/"
+}
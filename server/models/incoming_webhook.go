@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// IncomingWebhook lets an external system such as a CI pipeline post to a
+// room without a user session. Only a hash of its token is stored; Prefix
+// identifies the token and is safe to show.
+type IncomingWebhook struct {
+	ID         int64      `json:"id"`
+	RoomID     int64      `json:"room_id"`
+	Name       string     `json:"name"` // Default author name of its messages
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PrincipalID is the author ID of the webhook's messages.
+func (h *IncomingWebhook) PrincipalID() string {
+	return "wh_" + strconv.FormatInt(h.ID, 10)
+}
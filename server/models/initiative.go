@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Initiative is the turn order of a fight in a room. Each room has at most
+// one; it is shared by all members and published whole on every change.
+type Initiative struct {
+	RoomID     int64       `json:"room_id"`
+	Round      int         `json:"round"`             // 0 until the first turn, then counts up from 1
+	TurnID     int64       `json:"turn_id,omitempty"` // The combatant whose turn it is, or 0 before the first turn
+	Combatants []Combatant `json:"combatants"`        // In turn order
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Combatant is one participant of a fight: a character of the room, or
+// anyone else the GM names, e.g. "Cultist 2".
+type Combatant struct {
+	ID          int64     `json:"id"`
+	RoomID      int64     `json:"room_id"`
+	Name        string    `json:"name"`
+	CharacterID int64     `json:"character_id,omitempty"`
+	OwnerID     string    `json:"owner_id"`             // Who added the combatant; they and room owners may roll for or remove it
+	Dice        string    `json:"dice,omitempty"`       // Rolled for initiative, e.g. "d20+2"; empty for a fixed value
+	Initiative  *int      `json:"initiative,omitempty"` // Nil until rolled
+	Roll        *Roll     `json:"roll,omitempty"`       // The last initiative roll
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+// LinkPreview is what a link in a message points to, read from the
+// OpenGraph or oEmbed metadata of the page. Clients show it as a card below
+// the message.
+type LinkPreview struct {
+	URL         string `json:"url"` // The link as it appears in the message
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"` // Absolute http or https URL on the linked site
+}
+
+// IsEmpty reports whether the page had nothing to show.
+func (p *LinkPreview) IsEmpty() bool {
+	return p.Title == "" && p.Description == "" && p.ImageURL == ""
+}
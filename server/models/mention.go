@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Mention kinds: how a message mentioned a user.
+const (
+	MentionUser = "user" // By name, e.g. @alice
+	MentionRoom = "room" // @room, which mentions every member
+	MentionHere = "here" // @here, which mentions the members who are online
+
+	// MentionDirect is a whisper to the user, which is their direct message
+	// whether or not it names them.
+	MentionDirect = "direct"
+)
+
+// Mention is an entry of a user's mentions inbox: a message that mentioned
+// them. A user is mentioned once per message: directly if it was a whisper
+// to them, otherwise by name if they were.
+type Mention struct {
+	ID        int64      `json:"id"`
+	UserID    string     `json:"user_id"` // Who was mentioned
+	RoomID    int64      `json:"room_id"`
+	MessageID int64      `json:"message_id"`
+	Kind      string     `json:"kind"` // One of the Mention constants
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	Message   *Message   `json:"message,omitempty"` // Filled in for the inbox and notifications
+}
+
+// Identity is what the chat knows of a person from their Kratos identity.
+type Identity struct {
+	ID          string
+	DisplayName string // Nickname, full name or email
+	Nickname    string
+	FirstName   string
+	Email       string
+}
@@ -1,11 +1,72 @@
 package models
 
-import "time"
+import (
+	"slices"
+	"time"
+)
+
+// Author types of a message.
+const (
+	AuthorTypeUser    = "user"    // A person signed in through Kratos
+	AuthorTypeBot     = "bot"     // A service account authenticated with an API key
+	AuthorTypeWebhook = "webhook" // An incoming webhook of a room
+	AuthorTypeSystem  = "system"  // The server itself, e.g. replies to slash commands
+)
+
+// Message kinds. Plain messages have no kind.
+const (
+	MessageKindEmote   = "emote"   // An action of the author, posted with /me
+	MessageKindRoll    = "roll"    // A dice roll made by the server; the message has a Roll
+	MessageKindSession = "session" // Marks the start or end of a game session
+)
+
+// Message formats. Plain text is shown as it is; Markdown is rendered by
+// the server into the message's HTML.
+const (
+	MessageFormatPlain    = "plain"
+	MessageFormatMarkdown = "markdown"
+)
 
 // Message represents a chat message
 type Message struct {
-	ID        int64     `json:"id"`
-	User      string    `json:"user"`
-	Text      string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
+	ID          int64         `json:"id"`
+	RoomID      int64         `json:"room_id"`           // 0 for messages predating rooms
+	UserID      string        `json:"user_id,omitempty"` // Kratos identity, service account or incoming webhook ID of the author
+	User        string        `json:"user"`              // Author display name at the time of posting
+	AuthorType  string        `json:"author_type"`       // One of the AuthorType constants
+	Kind        string        `json:"kind,omitempty"`    // "" or one of the MessageKind constants
+	Text        string        `json:"text"`
+	Format      string        `json:"format,omitempty"` // "" for plain text, or one of the MessageFormat constants
+	HTML        string        `json:"html,omitempty"`   // Sanitized rendering of Markdown text; clients show it instead of Text
+	Attachments []Attachment  `json:"attachments,omitempty"`
+	Files       []File        `json:"files,omitempty"`        // Uploads posted with the message
+	Previews    []LinkPreview `json:"previews,omitempty"`     // Of links in the text; added shortly after the message is posted
+	Roll        *Roll         `json:"roll,omitempty"`         // Set on MessageKindRoll messages
+	Character   *Speaker      `json:"character,omitempty"`    // Set when posted as a character
+	InCharacter bool          `json:"in_character,omitempty"` // Part of the fiction rather than table talk; always set with Character
+	VisibleTo   []string      `json:"visible_to,omitempty"`   // If set, only these principals see the message, e.g. a whisper
+	Timestamp   time.Time     `json:"timestamp"`
+	EditedAt    *time.Time    `json:"edited_at,omitempty"`
+	RevealedAt  *time.Time    `json:"revealed_at,omitempty"` // When a hidden message was shown to the whole room
+	Ephemeral   bool          `json:"ephemeral,omitempty"`   // Shown to one principal and never stored
+}
+
+// IsVisibleTo reports whether a principal may see the message.
+func (m *Message) IsVisibleTo(principalID string) bool {
+	return len(m.VisibleTo) == 0 || slices.Contains(m.VisibleTo, principalID)
+}
+
+// Speaker is the character a message was posted as, as it was at the time.
+type Speaker struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+// Attachment is a card shown below a message, e.g. the result of a CI build.
+type Attachment struct {
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url,omitempty"` // Link of the title
+	Text  string `json:"text,omitempty"`
+	Color string `json:"color,omitempty"` // Accent color as #rrggbb
 }
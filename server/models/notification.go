@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// How often a user gets email digests of what they missed.
+const (
+	DigestOff    = "off"
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+// NotificationPreferences are a user's choices about email notifications.
+// Users who never chose get DefaultNotificationPreferences.
+type NotificationPreferences struct {
+	UserID         string     `json:"-"`
+	EmailDigest    string     `json:"email_digest"`    // One of the Digest constants
+	Mentions       bool       `json:"mentions"`        // Include mentions by name, @room and @here
+	DirectMessages bool       `json:"direct_messages"` // Include whispers to the user
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultNotificationPreferences returns the preferences of a user who never
+// chose: hourly digests of mentions and direct messages.
+func DefaultNotificationPreferences(userID string) NotificationPreferences {
+	return NotificationPreferences{UserID: userID, EmailDigest: DigestHourly, Mentions: true, DirectMessages: true}
+}
+
+// Email is a message to send to one person.
+type Email struct {
+	To      string // Address
+	ToName  string // Display name, if known
+	Subject string
+	Text    string // Plain-text body
+}
@@ -0,0 +1,32 @@
+package models
+
+import "slices"
+
+// Principal is the authenticated author of a request: a person signed in
+// through Kratos, a service account using an API key or an incoming webhook.
+type Principal struct {
+	ID          string   // Kratos identity, service account or incoming webhook ID
+	Type        string   // AuthorTypeUser, AuthorTypeBot or AuthorTypeWebhook
+	DisplayName string   // Name shown on messages
+	Scopes      []string // API key scopes; unused for users
+	RoomID      int64    // The only room an incoming webhook may post to
+}
+
+// IsBot reports whether the principal is a service account.
+func (p *Principal) IsBot() bool {
+	return p.Type == AuthorTypeBot
+}
+
+// IsWebhook reports whether the principal is an incoming webhook.
+func (p *Principal) IsWebhook() bool {
+	return p.Type == AuthorTypeWebhook
+}
+
+// Can reports whether the principal may act within scope. Users are limited
+// by room permissions only; bots and webhooks need the scope explicitly.
+func (p *Principal) Can(scope string) bool {
+	if !p.IsBot() && !p.IsWebhook() {
+		return true
+	}
+	return slices.Contains(p.Scopes, scope)
+}
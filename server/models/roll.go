@@ -0,0 +1,48 @@
+package models
+
+// Roll is the structured result of a dice roll made by the server. It is
+// stored with the message announcing it, so clients can render each die and
+// nobody can fake a result by typing it.
+type Roll struct {
+	Expression string     `json:"expression"`      // Normalized notation, e.g. "4d6kh3+2"
+	Label      string     `json:"label,omitempty"` // What the roll is for, e.g. "Stealth"
+	Terms      []RollTerm `json:"terms"`
+	Total      int        `json:"total"`
+	Check      *RollCheck `json:"check,omitempty"` // Set when rolling against a skill of a character
+}
+
+// Success levels of a Call of Cthulhu skill check, from best to worst.
+const (
+	CheckCritical = "critical" // A roll of 01
+	CheckExtreme  = "extreme"  // At most a fifth of the skill
+	CheckHard     = "hard"     // At most half of the skill
+	CheckRegular  = "regular"  // At most the skill
+	CheckFailure  = "failure"
+	CheckFumble   = "fumble" // 100, or 96 and above for skills below 50
+)
+
+// RollCheck is the outcome of a percentile roll against a character's skill
+// or characteristic. The roll's label names the skill.
+type RollCheck struct {
+	CharacterID int64  `json:"character_id"`
+	Character   string `json:"character"` // Name of the character at the time of the roll
+	Target      int    `json:"target"`    // The skill value rolled against
+	Level       string `json:"level"`     // One of the Check constants
+}
+
+// RollTerm is one summand of a roll: a group of dice or a constant.
+type RollTerm struct {
+	Notation string `json:"notation"`           // The term without its sign, e.g. "4d6kh3" or "2"
+	Negative bool   `json:"negative,omitempty"` // The term is subtracted
+	Sides    int    `json:"sides,omitempty"`    // 0 for constants
+	Dice     []Die  `json:"dice,omitempty"`     // In the order rolled
+	Value    int    `json:"value"`              // Contribution to the total, negative if Negative
+}
+
+// Die is a single rolled die.
+type Die struct {
+	Result   int  `json:"result"`
+	Dropped  bool `json:"dropped,omitempty"`  // Not counted, e.g. the lowest die of 4d6kh3
+	Exploded bool `json:"exploded,omitempty"` // Rolled its maximum, so another die was added
+	Tens     bool `json:"tens,omitempty"`     // A tens die (00-90) of a percentile roll with bonus or penalty dice
+}
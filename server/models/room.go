@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Room roles. The owner created the room; members can read and post.
+const (
+	RoomRoleOwner  = "owner"
+	RoomRoleMember = "member"
+)
+
+// Room represents a chat room.
+type Room struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Topic     string    `json:"topic,omitempty"`
+	CreatedBy string    `json:"created_by"` // Kratos identity ID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoomMember links a Kratos identity to a room.
+type RoomMember struct {
+	RoomID   int64     `json:"room_id"`
+	UserID   string    `json:"user_id"` // Kratos identity ID
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// API key scopes. Keys only grant the scopes they were issued with.
+const (
+	ScopeMessagesRead     = "messages:read"
+	ScopeMessagesWrite    = "messages:write"
+	ScopeUsersRead        = "users:read"
+	ScopeCommandsRegister = "commands:register"
+)
+
+// Scopes lists every scope an API key can be granted.
+var Scopes = []string{ScopeMessagesRead, ScopeMessagesWrite, ScopeUsersRead, ScopeCommandsRegister}
+
+// IsValidScope reports whether scope is one of Scopes.
+func IsValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// ServiceAccount is a non-human author (reminder bot, dice bot, CI) that
+// authenticates with API keys instead of a Kratos session.
+type ServiceAccount struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   string     `json:"created_by"` // Kratos identity ID of the admin
+	CreatedAt   time.Time  `json:"created_at"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+}
+
+// APIKey is a credential of a service account. Only a hash of the secret is
+// stored; Prefix identifies the key and is safe to show.
+type APIKey struct {
+	ID               int64      `json:"id"`
+	ServiceAccountID string     `json:"service_account_id"`
+	Prefix           string     `json:"prefix"`
+	Hash             string     `json:"-"`
+	Scopes           []string   `json:"scopes"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Usable reports whether the key is neither revoked nor expired at now.
+func (k *APIKey) Usable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session is one evening of play in a room. It spans the messages from the
+// marker posted when it started to the marker posted when it ended.
+type Session struct {
+	ID             int64      `json:"id"`
+	RoomID         int64      `json:"room_id"`
+	Title          string     `json:"title"`
+	StartedBy      string     `json:"started_by"`
+	StartMessageID int64      `json:"start_message_id"`         // The marker posted when the session started
+	EndMessageID   int64      `json:"end_message_id,omitempty"` // The marker posted when it ended; 0 while it runs
+	StartedAt      time.Time  `json:"started_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+}
+
+// Transcript is the log of a session as one member saw it.
+type Transcript struct {
+	Session    Session   `json:"session"`
+	Room       string    `json:"room"`     // Name of the room
+	Messages   []Message `json:"messages"` // In chronological order, including the markers
+	ExportedAt time.Time `json:"exported_at"`
+}
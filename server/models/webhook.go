@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// Webhook delivery states. Pending deliveries are retried until they succeed
+// or run out of attempts, after which they stay dead until replayed.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookEvents are the event types an outgoing webhook can subscribe to.
+var WebhookEvents = []string{EventMessageCreated, EventMessageUpdated, EventMessageDeleted, EventMemberJoined, EventRoomUpdated, EventMessageRevealed}
+
+// IsValidWebhookEvent reports whether event is one of WebhookEvents.
+func IsValidWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook sends a room's events to an external URL.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	RoomID    int64     `json:"room_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`      // HMAC key for signatures, only shown when the webhook is created
+	Events    []string  `json:"events"` // Event types to send
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribes to an event type.
+func (w Webhook) Wants(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for, or sent to, a webhook.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"` // JSON body, signed as sent
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	ReplayOf       int64      `json:"replay_of,omitempty"` // Delivery this one replays
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,277 @@
+package usersmanagement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	kratos "github.com/ory/kratos-client-go"
+)
+
+// Identity states understood by Kratos.
+const (
+	IdentityStateActive   = "active"
+	IdentityStateInactive = "inactive"
+)
+
+// DefaultIdentitySchemaID is the Kratos schema new identities are created with.
+const DefaultIdentitySchemaID = "default"
+
+// ErrIdentityExists is returned when creating an identity whose credential
+// identifier (email) is already taken.
+var ErrIdentityExists = errors.New("identity already exists")
+
+// ErrInvalidAdminRequest is returned when an admin request is malformed.
+var ErrInvalidAdminRequest = errors.New("invalid admin request")
+
+// KratosAdminAPI defines the Kratos admin operations used by AdminService.
+// KratosClient implements it; tests can substitute a mock.
+type KratosAdminAPI interface {
+	CreateIdentity(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error)
+	PatchIdentity(ctx context.Context, id string, patches []kratos.JsonPatch) (*kratos.Identity, *http.Response, error)
+	DeleteIdentitySessions(ctx context.Context, id string) (*http.Response, error)
+	CreateRecoveryLink(ctx context.Context, id string, expiresIn string) (*kratos.RecoveryLinkForIdentity, *http.Response, error)
+	ListIdentitySessions(ctx context.Context, id string, activeOnly bool) ([]kratos.Session, *http.Response, error)
+}
+
+// CreateUserRequest describes an identity to create through the admin API.
+type CreateUserRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password,omitempty"` // Optional; without it the user must use a recovery link.
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Nickname  string `json:"nickname,omitempty"`
+	Admin     bool   `json:"admin,omitempty"`
+	// PasswordHash imports an existing password hash (e.g. bcrypt) instead of
+	// setting Password. Only used by migrations, never accepted over the API.
+	PasswordHash string `json:"-"`
+}
+
+// SessionInfo is an operator-facing summary of a Kratos session.
+type SessionInfo struct {
+	ID              string       `json:"id"`
+	Active          bool         `json:"active"`
+	AuthenticatedAt *time.Time   `json:"authenticated_at,omitempty"`
+	ExpiresAt       *time.Time   `json:"expires_at,omitempty"`
+	Devices         []DeviceInfo `json:"devices,omitempty"`
+}
+
+// DeviceInfo describes a device a session was used from.
+type DeviceInfo struct {
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Location  string `json:"location,omitempty"`
+}
+
+// RecoveryLink is a one-time account recovery link generated by Kratos.
+type RecoveryLink struct {
+	Link      string     `json:"recovery_link"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AdminService performs operator actions on identities through the Kratos admin API.
+type AdminService struct {
+	kratosAdmin  KratosAdminAPI
+	users        *UserService
+	traitMapping TraitMapping
+}
+
+// NewAdminService creates a new AdminService. users is used to map created
+// and updated identities and has its directory cache invalidated on changes.
+func NewAdminService(kratosAdmin KratosAdminAPI, users *UserService) *AdminService {
+	if kratosAdmin == nil {
+		log.Fatal("KratosAdminAPI cannot be nil in NewAdminService")
+	}
+	if users == nil {
+		log.Fatal("UserService cannot be nil in NewAdminService")
+	}
+	return &AdminService{
+		kratosAdmin:  kratosAdmin,
+		users:        users,
+		traitMapping: users.traitMapping,
+	}
+}
+
+// CreateUser creates a new Kratos identity.
+func (s *AdminService) CreateUser(ctx context.Context, req CreateUserRequest) (*User, error) {
+	if req.Email == "" {
+		return nil, fmt.Errorf("%w: email is required", ErrInvalidAdminRequest)
+	}
+	traits, err := s.traitMapping.BuildTraits(map[string]string{
+		FieldEmail:     req.Email,
+		FieldFirstName: req.FirstName,
+		FieldLastName:  req.LastName,
+		FieldNickname:  req.Nickname,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build traits for %s: %w", req.Email, err)
+	}
+
+	body := kratos.CreateIdentityBody{
+		SchemaId: DefaultIdentitySchemaID,
+		Traits:   traits,
+	}
+	if req.Password != "" && req.PasswordHash != "" {
+		return nil, fmt.Errorf("%w: password and password hash are mutually exclusive", ErrInvalidAdminRequest)
+	}
+	if req.Password != "" || req.PasswordHash != "" {
+		config := &kratos.IdentityWithCredentialsPasswordConfig{}
+		if req.Password != "" {
+			password := req.Password
+			config.Password = &password
+		} else {
+			hash := req.PasswordHash
+			config.HashedPassword = &hash
+		}
+		body.Credentials = &kratos.IdentityWithCredentials{
+			Password: &kratos.IdentityWithCredentialsPassword{Config: config},
+		}
+	}
+	if req.Admin {
+		body.MetadataPublic = map[string]interface{}{"roles": []string{RoleAdmin}}
+	}
+
+	identity, resp, err := s.kratosAdmin.CreateIdentity(ctx, body)
+	if err != nil {
+		return nil, wrapKratosError(resp, err, "failed to create identity for %s", req.Email)
+	}
+	s.users.InvalidateDirectory()
+	return s.users.userFromIdentity(identity)
+}
+
+// DeactivateUser marks the identity inactive and revokes its sessions, which
+// signs the user out everywhere and prevents them from logging back in.
+func (s *AdminService) DeactivateUser(ctx context.Context, id string) (*User, error) {
+	user, err := s.setState(ctx, id, IdentityStateInactive)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.RevokeSessions(ctx, id); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ReactivateUser marks the identity active again.
+func (s *AdminService) ReactivateUser(ctx context.Context, id string) (*User, error) {
+	return s.setState(ctx, id, IdentityStateActive)
+}
+
+// SetAdmin grants or removes the admin role in the identity's public metadata.
+func (s *AdminService) SetAdmin(ctx context.Context, id string, admin bool) (*User, error) {
+	current, err := s.users.getIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	existing := rolesFromMetadata(current.MetadataPublic)
+	roles := make([]string, 0, len(existing)+1)
+	for _, r := range existing {
+		if r != RoleAdmin {
+			roles = append(roles, r)
+		}
+	}
+	if admin {
+		roles = append(roles, RoleAdmin)
+	}
+
+	// Only the roles are replaced, so other public metadata is kept. A JSON
+	// patch cannot add a member to a missing object, so it is created first.
+	var patches []kratos.JsonPatch
+	if _, ok := current.MetadataPublic.(map[string]interface{}); !ok {
+		patches = append(patches, kratos.JsonPatch{Op: "add", Path: "/metadata_public", Value: map[string]interface{}{}})
+	}
+	patches = append(patches, kratos.JsonPatch{Op: "add", Path: "/metadata_public/roles", Value: roles})
+	identity, resp, err := s.kratosAdmin.PatchIdentity(ctx, id, patches)
+	if err != nil {
+		return nil, wrapKratosError(resp, err, "failed to update roles of identity %s", id)
+	}
+	s.users.InvalidateDirectory()
+	return s.users.userFromIdentity(identity)
+}
+
+// RevokeSessions revokes every session of the identity.
+func (s *AdminService) RevokeSessions(ctx context.Context, id string) error {
+	resp, err := s.kratosAdmin.DeleteIdentitySessions(ctx, id)
+	if err != nil {
+		// Kratos answers 404 when the identity has no sessions to revoke.
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return wrapKratosError(resp, err, "failed to revoke sessions of identity %s", id)
+	}
+	return nil
+}
+
+// CreateRecoveryLink generates a recovery link the operator can hand to the
+// user. expiresIn is a Go-style duration understood by Kratos (e.g. "1h");
+// empty uses the Kratos default.
+func (s *AdminService) CreateRecoveryLink(ctx context.Context, id string, expiresIn string) (*RecoveryLink, error) {
+	if expiresIn != "" {
+		if _, err := time.ParseDuration(expiresIn); err != nil {
+			return nil, fmt.Errorf("%w: invalid expiry %q: %v", ErrInvalidAdminRequest, expiresIn, err)
+		}
+	}
+	link, resp, err := s.kratosAdmin.CreateRecoveryLink(ctx, id, expiresIn)
+	if err != nil {
+		return nil, wrapKratosError(resp, err, "failed to create recovery link for identity %s", id)
+	}
+	return &RecoveryLink{Link: link.RecoveryLink, ExpiresAt: link.ExpiresAt}, nil
+}
+
+// ListSessions lists the sessions of an identity; activeOnly hides expired
+// and revoked ones.
+func (s *AdminService) ListSessions(ctx context.Context, id string, activeOnly bool) ([]SessionInfo, error) {
+	sessions, resp, err := s.kratosAdmin.ListIdentitySessions(ctx, id, activeOnly)
+	if err != nil {
+		return nil, wrapKratosError(resp, err, "failed to list sessions of identity %s", id)
+	}
+	infos := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		info := SessionInfo{
+			ID:              session.Id,
+			Active:          session.GetActive(),
+			AuthenticatedAt: session.AuthenticatedAt,
+			ExpiresAt:       session.ExpiresAt,
+		}
+		for _, device := range session.Devices {
+			info.Devices = append(info.Devices, DeviceInfo{
+				IPAddress: device.GetIpAddress(),
+				UserAgent: device.GetUserAgent(),
+				Location:  device.GetLocation(),
+			})
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (s *AdminService) setState(ctx context.Context, id string, state string) (*User, error) {
+	identity, resp, err := s.kratosAdmin.PatchIdentity(ctx, id, []kratos.JsonPatch{
+		{Op: "replace", Path: "/state", Value: state},
+	})
+	if err != nil {
+		return nil, wrapKratosError(resp, err, "failed to set identity %s %s", id, state)
+	}
+	s.users.InvalidateDirectory()
+	return s.users.userFromIdentity(identity)
+}
+
+// wrapKratosError adds the HTTP status to a Kratos error and maps 404 to
+// ErrIdentityNotFound.
+func wrapKratosError(resp *http.Response, err error, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	if statusCode == http.StatusNotFound && !errors.Is(err, ErrIdentityNotFound) {
+		return fmt.Errorf("%s: %w: %w", msg, ErrIdentityNotFound, err)
+	}
+	if statusCode == http.StatusConflict {
+		return fmt.Errorf("%s: %w: %w", msg, ErrIdentityExists, err)
+	}
+	return fmt.Errorf("%s (status %d): %w", msg, statusCode, err)
+}
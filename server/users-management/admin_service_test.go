@@ -0,0 +1,271 @@
+package usersmanagement
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	kratos "github.com/ory/kratos-client-go"
+)
+
+// MockKratosAdmin is a mock implementation of KratosAdminAPI.
+type MockKratosAdmin struct {
+	CreateIdentityFunc         func(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error)
+	PatchIdentityFunc          func(ctx context.Context, id string, patches []kratos.JsonPatch) (*kratos.Identity, *http.Response, error)
+	DeleteIdentitySessionsFunc func(ctx context.Context, id string) (*http.Response, error)
+	CreateRecoveryLinkFunc     func(ctx context.Context, id string, expiresIn string) (*kratos.RecoveryLinkForIdentity, *http.Response, error)
+	ListIdentitySessionsFunc   func(ctx context.Context, id string, activeOnly bool) ([]kratos.Session, *http.Response, error)
+}
+
+func (m *MockKratosAdmin) CreateIdentity(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error) {
+	if m.CreateIdentityFunc != nil {
+		return m.CreateIdentityFunc(ctx, body)
+	}
+	return nil, nil, errors.New("CreateIdentityFunc not implemented in mock")
+}
+
+func (m *MockKratosAdmin) PatchIdentity(ctx context.Context, id string, patches []kratos.JsonPatch) (*kratos.Identity, *http.Response, error) {
+	if m.PatchIdentityFunc != nil {
+		return m.PatchIdentityFunc(ctx, id, patches)
+	}
+	return nil, nil, errors.New("PatchIdentityFunc not implemented in mock")
+}
+
+func (m *MockKratosAdmin) DeleteIdentitySessions(ctx context.Context, id string) (*http.Response, error) {
+	if m.DeleteIdentitySessionsFunc != nil {
+		return m.DeleteIdentitySessionsFunc(ctx, id)
+	}
+	return nil, errors.New("DeleteIdentitySessionsFunc not implemented in mock")
+}
+
+func (m *MockKratosAdmin) CreateRecoveryLink(ctx context.Context, id string, expiresIn string) (*kratos.RecoveryLinkForIdentity, *http.Response, error) {
+	if m.CreateRecoveryLinkFunc != nil {
+		return m.CreateRecoveryLinkFunc(ctx, id, expiresIn)
+	}
+	return nil, nil, errors.New("CreateRecoveryLinkFunc not implemented in mock")
+}
+
+func (m *MockKratosAdmin) ListIdentitySessions(ctx context.Context, id string, activeOnly bool) ([]kratos.Session, *http.Response, error) {
+	if m.ListIdentitySessionsFunc != nil {
+		return m.ListIdentitySessionsFunc(ctx, id, activeOnly)
+	}
+	return nil, nil, errors.New("ListIdentitySessionsFunc not implemented in mock")
+}
+
+func newTestAdminService(admin *MockKratosAdmin) *AdminService {
+	return NewAdminService(admin, NewUserService(&MockKratosClient{}))
+}
+
+func TestAdminService_CreateUser(t *testing.T) {
+	var captured kratos.CreateIdentityBody
+	admin := &MockKratosAdmin{
+		CreateIdentityFunc: func(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error) {
+			captured = body
+			return &kratos.Identity{
+				Id:             "new-id",
+				Traits:         body.Traits,
+				MetadataPublic: map[string]interface{}{"roles": []interface{}{RoleAdmin}},
+			}, &http.Response{StatusCode: http.StatusCreated}, nil
+		},
+	}
+
+	user, err := newTestAdminService(admin).CreateUser(context.Background(), CreateUserRequest{
+		Email:     "dana@example.com",
+		Password:  "s3cret-pass",
+		FirstName: "Dana",
+		Nickname:  "Dee",
+		Admin:     true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	name, ok := captured.Traits["name"].(map[string]interface{})
+	if !ok || name["first"] != "Dana" {
+		t.Errorf("Expected traits.name.first 'Dana', got %+v", captured.Traits["name"])
+	}
+	if captured.Traits["nickname"] != "Dee" {
+		t.Errorf("Expected traits.nickname 'Dee', got %v", captured.Traits["nickname"])
+	}
+	if _, ok := captured.Traits["avatar"]; ok {
+		t.Error("Expected empty fields to be omitted from traits")
+	}
+	if captured.Credentials == nil || captured.Credentials.Password.Config.GetPassword() != "s3cret-pass" {
+		t.Error("Expected password credentials to be set")
+	}
+	if captured.SchemaId != DefaultIdentitySchemaID {
+		t.Errorf("Expected schema '%s', got '%s'", DefaultIdentitySchemaID, captured.SchemaId)
+	}
+	if !user.IsAdmin() {
+		t.Error("Expected created user to have the admin role")
+	}
+}
+
+func TestAdminService_CreateUser_Conflict(t *testing.T) {
+	admin := &MockKratosAdmin{
+		CreateIdentityFunc: func(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error) {
+			return nil, &http.Response{StatusCode: http.StatusConflict}, errors.New("409 Conflict")
+		},
+	}
+
+	_, err := newTestAdminService(admin).CreateUser(context.Background(), CreateUserRequest{Email: "dup@example.com"})
+	if !errors.Is(err, ErrIdentityExists) {
+		t.Errorf("Expected ErrIdentityExists, got %v", err)
+	}
+}
+
+func TestAdminService_CreateUser_ImportsPasswordHash(t *testing.T) {
+	var captured kratos.CreateIdentityBody
+	admin := &MockKratosAdmin{
+		CreateIdentityFunc: func(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error) {
+			captured = body
+			return &kratos.Identity{Id: "imported-id", Traits: body.Traits}, &http.Response{StatusCode: http.StatusCreated}, nil
+		},
+	}
+	svc := newTestAdminService(admin)
+
+	hash := "$2a$10$abcdefghijklmnopqrstuu5vZ0Yk1E1Lh0VtQ6lY6lH7y0m0f9j1e"
+	if _, err := svc.CreateUser(context.Background(), CreateUserRequest{Email: "old@example.com", PasswordHash: hash}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	config := captured.Credentials.Password.Config
+	if config.GetHashedPassword() != hash || config.Password != nil {
+		t.Errorf("Expected only the hashed password to be imported, got %+v", config)
+	}
+
+	_, err := svc.CreateUser(context.Background(), CreateUserRequest{Email: "old@example.com", Password: "x", PasswordHash: hash})
+	if !errors.Is(err, ErrInvalidAdminRequest) {
+		t.Errorf("Expected ErrInvalidAdminRequest for password and hash, got %v", err)
+	}
+}
+
+func TestAdminService_CreateUser_RequiresEmail(t *testing.T) {
+	_, err := newTestAdminService(&MockKratosAdmin{}).CreateUser(context.Background(), CreateUserRequest{})
+	if !errors.Is(err, ErrInvalidAdminRequest) {
+		t.Errorf("Expected ErrInvalidAdminRequest, got %v", err)
+	}
+}
+
+func TestAdminService_DeactivateUser_RevokesSessions(t *testing.T) {
+	var patches []kratos.JsonPatch
+	revoked := false
+	admin := &MockKratosAdmin{
+		PatchIdentityFunc: func(ctx context.Context, id string, p []kratos.JsonPatch) (*kratos.Identity, *http.Response, error) {
+			patches = p
+			return &kratos.Identity{Id: id, Traits: map[string]interface{}{"email": "x@example.com"}}, &http.Response{StatusCode: http.StatusOK}, nil
+		},
+		DeleteIdentitySessionsFunc: func(ctx context.Context, id string) (*http.Response, error) {
+			revoked = true
+			return &http.Response{StatusCode: http.StatusNoContent}, nil
+		},
+	}
+
+	if _, err := newTestAdminService(admin).DeactivateUser(context.Background(), "x"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(patches) != 1 || patches[0].Path != "/state" || patches[0].Value != IdentityStateInactive {
+		t.Errorf("Expected a single replace of /state with 'inactive', got %+v", patches)
+	}
+	if !revoked {
+		t.Error("Expected sessions to be revoked on deactivation")
+	}
+}
+
+func TestAdminService_SetAdmin_KeepsOtherMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata interface{}
+		admin    bool
+		want     []kratos.JsonPatch
+	}{
+		{"grant", map[string]interface{}{"roles": []interface{}{"gm"}, "plan": "pro"}, true, []kratos.JsonPatch{
+			{Op: "add", Path: "/metadata_public/roles", Value: []string{"gm", RoleAdmin}},
+		}},
+		{"revoke", map[string]interface{}{"roles": []interface{}{RoleAdmin, "gm"}}, false, []kratos.JsonPatch{
+			{Op: "add", Path: "/metadata_public/roles", Value: []string{"gm"}},
+		}},
+		{"no metadata", nil, true, []kratos.JsonPatch{
+			{Op: "add", Path: "/metadata_public", Value: map[string]interface{}{}},
+			{Op: "add", Path: "/metadata_public/roles", Value: []string{RoleAdmin}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patches []kratos.JsonPatch
+			admin := &MockKratosAdmin{
+				PatchIdentityFunc: func(ctx context.Context, id string, p []kratos.JsonPatch) (*kratos.Identity, *http.Response, error) {
+					patches = p
+					return &kratos.Identity{Id: id, Traits: map[string]interface{}{"email": "x@example.com"}}, &http.Response{StatusCode: http.StatusOK}, nil
+				},
+			}
+			client := &MockKratosClient{
+				GetIdentityFunc: func(ctx context.Context, id string) (*kratos.Identity, *http.Response, error) {
+					return &kratos.Identity{Id: id, Traits: map[string]interface{}{"email": "x@example.com"}, MetadataPublic: tt.metadata}, &http.Response{StatusCode: http.StatusOK}, nil
+				},
+			}
+
+			if _, err := NewAdminService(admin, NewUserService(client)).SetAdmin(context.Background(), "x", tt.admin); err != nil {
+				t.Fatalf("SetAdmin() failed: %v", err)
+			}
+			if !reflect.DeepEqual(patches, tt.want) {
+				t.Errorf("Expected patches %+v, got %+v", tt.want, patches)
+			}
+		})
+	}
+}
+
+func TestAdminService_RevokeSessions_NoSessions(t *testing.T) {
+	admin := &MockKratosAdmin{
+		DeleteIdentitySessionsFunc: func(ctx context.Context, id string) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusNotFound}, errors.New("404 Not Found")
+		},
+	}
+
+	if err := newTestAdminService(admin).RevokeSessions(context.Background(), "x"); err != nil {
+		t.Errorf("Expected 404 (no sessions) to be treated as success, got %v", err)
+	}
+}
+
+func TestAdminService_CreateRecoveryLink_InvalidExpiry(t *testing.T) {
+	called := false
+	admin := &MockKratosAdmin{
+		CreateRecoveryLinkFunc: func(ctx context.Context, id string, expiresIn string) (*kratos.RecoveryLinkForIdentity, *http.Response, error) {
+			called = true
+			return nil, nil, nil
+		},
+	}
+
+	_, err := newTestAdminService(admin).CreateRecoveryLink(context.Background(), "x", "tomorrow")
+	if !errors.Is(err, ErrInvalidAdminRequest) {
+		t.Errorf("Expected ErrInvalidAdminRequest, got %v", err)
+	}
+	if called {
+		t.Error("Expected Kratos not to be called with an invalid expiry")
+	}
+}
+
+func TestAdminService_ListSessions(t *testing.T) {
+	ip := "10.0.0.1"
+	admin := &MockKratosAdmin{
+		ListIdentitySessionsFunc: func(ctx context.Context, id string, activeOnly bool) ([]kratos.Session, *http.Response, error) {
+			if !activeOnly {
+				t.Error("Expected activeOnly to be passed through")
+			}
+			return []kratos.Session{{
+				Id:      "s1",
+				Active:  boolPtr(true),
+				Devices: []kratos.SessionDevice{{Id: "d1", IpAddress: &ip}},
+			}}, &http.Response{StatusCode: http.StatusOK}, nil
+		},
+	}
+
+	sessions, err := newTestAdminService(admin).ListSessions(context.Background(), "x", true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(sessions) != 1 || !sessions[0].Active || sessions[0].Devices[0].IPAddress != ip {
+		t.Errorf("Unexpected sessions: %+v", sessions)
+	}
+}
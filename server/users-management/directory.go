@@ -0,0 +1,203 @@
+package usersmanagement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDirectoryTTL is how long the cached identity listing is reused
+// before SearchUsers lists identities from Kratos again.
+const DefaultDirectoryTTL = time.Minute
+
+// directoryPageSize is the page size used when listing identities from Kratos.
+const directoryPageSize int64 = 250
+
+// MaxSearchResults caps the number of users SearchUsers returns.
+const MaxSearchResults = 100
+
+// directoryCache holds a snapshot of all identities mapped to users.
+type directoryCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	users    []*User
+	byID     map[string]*User
+	loadedAt time.Time
+}
+
+func newDirectoryCache(ttl time.Duration) *directoryCache {
+	return &directoryCache{ttl: ttl}
+}
+
+// snapshot returns the cached users, reloading them through load when the
+// cache is empty or stale.
+func (c *directoryCache) snapshot(ctx context.Context, load func(context.Context) ([]*User, error)) ([]*User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byID != nil && time.Since(c.loadedAt) < c.ttl {
+		return c.users, nil
+	}
+	users, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.users = users
+	c.byID = make(map[string]*User, len(users))
+	for _, u := range users {
+		c.byID[u.ID] = u
+	}
+	c.loadedAt = time.Now()
+	return users, nil
+}
+
+// lookup returns a cached user by ID if the cache is fresh.
+func (c *directoryCache) lookup(id string) (*User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byID == nil || time.Since(c.loadedAt) >= c.ttl {
+		return nil, false
+	}
+	u, ok := c.byID[id]
+	return u, ok
+}
+
+// invalidate drops the cached snapshot so the next search reloads it.
+func (c *directoryCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.byID = nil
+	c.users = nil
+}
+
+// SetDirectoryTTL changes how long identity listings are cached.
+func (s *UserService) SetDirectoryTTL(ttl time.Duration) {
+	s.directory.mu.Lock()
+	defer s.directory.mu.Unlock()
+	s.directory.ttl = ttl
+}
+
+// InvalidateDirectory forces the next search to list identities from Kratos again.
+func (s *UserService) InvalidateDirectory() {
+	s.directory.invalidate()
+}
+
+// SearchUsers returns the users whose nickname or first/last name contains
+// query, or whose email is query (case-insensitively), ordered by display
+// name. Emails are only matched whole so that they cannot be guessed a
+// letter at a time. An empty query returns every user. At most limit users are returned;
+// limit <= 0 or above MaxSearchResults means MaxSearchResults.
+func (s *UserService) SearchUsers(ctx context.Context, query string, limit int) ([]*User, error) {
+	if limit <= 0 || limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+	users, err := s.directory.snapshot(ctx, s.listAllUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	needle := strings.ToLower(strings.TrimSpace(query))
+	matches := make([]*User, 0)
+	for _, u := range users {
+		if needle == "" || userMatches(u, needle) {
+			matches = append(matches, u)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return strings.ToLower(matches[i].DisplayName()) < strings.ToLower(matches[j].DisplayName())
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// LookupUser returns a user by identity ID, served from the directory cache
+// when possible and from Kratos otherwise.
+func (s *UserService) LookupUser(ctx context.Context, id string) (*User, error) {
+	if u, ok := s.directory.lookup(id); ok {
+		return u, nil
+	}
+	return s.GetUserByID(ctx, id)
+}
+
+// LookupUsers returns the users with these identity IDs, by ID, from the
+// cached directory listing, which is reloaded from Kratos when stale. IDs
+// without an identity are left out.
+func (s *UserService) LookupUsers(ctx context.Context, ids []string) (map[string]*User, error) {
+	users, err := s.directory.snapshot(ctx, s.listAllUsers)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	found := make(map[string]*User, len(ids))
+	for _, u := range users {
+		if wanted[u.ID] {
+			found[u.ID] = u
+		}
+	}
+	return found, nil
+}
+
+// GetUserByEmail looks a user up by the email they log in with.
+// It returns an error wrapping ErrIdentityNotFound if no identity matches.
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	identity, resp, err := s.kratosClient.GetIdentityByCredentialIdentifier(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			return nil, fmt.Errorf("no user with email %s: %w", email, err)
+		}
+		statusCode := 0
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		return nil, fmt.Errorf("failed to look up user %s in Kratos (status %d): %w", email, statusCode, err)
+	}
+	return s.userFromIdentity(identity)
+}
+
+// listAllUsers pages through every identity in Kratos.
+func (s *UserService) listAllUsers(ctx context.Context) ([]*User, error) {
+	var users []*User
+	pageToken := ""
+	for {
+		identities, next, resp, err := s.kratosClient.ListIdentities(ctx, directoryPageSize, pageToken)
+		if err != nil {
+			statusCode := 0
+			if resp != nil {
+				statusCode = resp.StatusCode
+			}
+			return nil, fmt.Errorf("failed to list users from Kratos (status %d): %w", statusCode, err)
+		}
+		for i := range identities {
+			user, err := s.userFromIdentity(&identities[i])
+			if err != nil {
+				// One malformed identity should not hide the whole directory.
+				continue
+			}
+			users = append(users, user)
+		}
+		if next == "" || next == pageToken {
+			return users, nil
+		}
+		pageToken = next
+	}
+}
+
+func userMatches(u *User, needle string) bool {
+	fullName := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	for _, candidate := range []string{u.Profile.Nickname, fullName, u.FirstName, u.LastName} {
+		if candidate != "" && strings.Contains(strings.ToLower(candidate), needle) {
+			return true
+		}
+	}
+	return u.Email != "" && strings.EqualFold(u.Email, needle)
+}
@@ -0,0 +1,228 @@
+package usersmanagement
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	kratos "github.com/ory/kratos-client-go"
+)
+
+func identity(id, email, first, nickname string) kratos.Identity {
+	traits := map[string]interface{}{"email": email}
+	if first != "" {
+		traits["name"] = map[string]interface{}{"first": first}
+	}
+	if nickname != "" {
+		traits["nickname"] = nickname
+	}
+	return kratos.Identity{Id: id, Traits: traits}
+}
+
+// pagedDirectoryClient serves identities two at a time and counts list calls.
+func pagedDirectoryClient(identities []kratos.Identity, calls *int) *MockKratosClient {
+	return &MockKratosClient{
+		ListIdentitiesFunc: func(ctx context.Context, pageSize int64, pageToken string) ([]kratos.Identity, string, *http.Response, error) {
+			*calls++
+			start := 0
+			if pageToken != "" {
+				for i, ident := range identities {
+					if ident.Id == pageToken {
+						start = i
+					}
+				}
+			}
+			end := start + 2
+			if end >= len(identities) {
+				return identities[start:], "", &http.Response{StatusCode: http.StatusOK}, nil
+			}
+			return identities[start:end], identities[end].Id, &http.Response{StatusCode: http.StatusOK}, nil
+		},
+	}
+}
+
+func TestUserService_SearchUsers_PaginatesAndFilters(t *testing.T) {
+	calls := 0
+	client := pagedDirectoryClient([]kratos.Identity{
+		identity("1", "alice@example.com", "Alice", ""),
+		identity("2", "bob@example.com", "Bob", "Bobby"),
+		identity("3", "charlie@example.com", "Charlie", ""),
+		identity("4", "mallory@example.org", "", ""),
+		identity("5", "alfred@example.com", "Alfred", ""),
+	}, &calls)
+
+	userService := NewUserService(client)
+	users, err := userService.SearchUsers(context.Background(), "AL", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 paged list calls, got %d", calls)
+	}
+
+	// "al" matches Alice and Alfred by name, but not mallory by part of
+	// their email; sorted by display name.
+	expectedIDs := []string{"5", "1"}
+	if len(users) != len(expectedIDs) {
+		t.Fatalf("Expected %d users, got %d", len(expectedIDs), len(users))
+	}
+	for i, id := range expectedIDs {
+		if users[i].ID != id {
+			t.Errorf("Result %d: expected user ID '%s', got '%s'", i, id, users[i].ID)
+		}
+	}
+}
+
+func TestUserService_SearchUsers_MatchesWholeEmail(t *testing.T) {
+	calls := 0
+	client := pagedDirectoryClient([]kratos.Identity{
+		identity("1", "alice@example.com", "Alice", ""),
+		identity("4", "mallory@example.org", "", ""),
+	}, &calls)
+	userService := NewUserService(client)
+
+	for _, query := range []string{"mallory@", "example.org", "mallory@example"} {
+		users, err := userService.SearchUsers(context.Background(), query, 0)
+		if err != nil {
+			t.Fatalf("SearchUsers(%q) failed: %v", query, err)
+		}
+		if len(users) != 0 {
+			t.Errorf("SearchUsers(%q): expected no users for part of an email, got %d", query, len(users))
+		}
+	}
+
+	users, err := userService.SearchUsers(context.Background(), "Mallory@Example.org", 0)
+	if err != nil {
+		t.Fatalf("SearchUsers() failed: %v", err)
+	}
+	if len(users) != 1 || users[0].ID != "4" {
+		t.Errorf("Expected the whole email to find user '4', got %v", users)
+	}
+}
+
+func TestUserService_SearchUsers_UsesCache(t *testing.T) {
+	calls := 0
+	client := pagedDirectoryClient([]kratos.Identity{
+		identity("1", "alice@example.com", "Alice", ""),
+	}, &calls)
+
+	userService := NewUserService(client)
+	for i := 0; i < 3; i++ {
+		if _, err := userService.SearchUsers(context.Background(), "", 10); err != nil {
+			t.Fatalf("SearchUsers() failed: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected a single Kratos listing while the cache is fresh, got %d", calls)
+	}
+
+	userService.InvalidateDirectory()
+	if _, err := userService.SearchUsers(context.Background(), "", 10); err != nil {
+		t.Fatalf("SearchUsers() failed: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected a reload after invalidation, got %d calls", calls)
+	}
+
+	// LookupUser is served from the fresh cache without GetIdentity.
+	user, err := userService.LookupUser(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("LookupUser() failed: %v", err)
+	}
+	if user.Email != "alice@example.com" {
+		t.Errorf("Expected cached user 'alice@example.com', got '%s'", user.Email)
+	}
+}
+
+func TestUserService_LookupUsers(t *testing.T) {
+	calls := 0
+	client := pagedDirectoryClient([]kratos.Identity{
+		identity("1", "alice@example.com", "Alice", ""),
+		identity("2", "bob@example.com", "Bob", "Bobby"),
+		identity("3", "charlie@example.com", "Charlie", ""),
+	}, &calls)
+	userService := NewUserService(client)
+
+	for i := 0; i < 2; i++ {
+		users, err := userService.LookupUsers(context.Background(), []string{"1", "3", "missing"})
+		if err != nil {
+			t.Fatalf("LookupUsers() failed: %v", err)
+		}
+		if len(users) != 2 || users["1"].Email != "alice@example.com" || users["3"].Email != "charlie@example.com" {
+			t.Errorf("Expected users 1 and 3, got %v", users)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected one paged listing for both lookups, got %d list calls", calls)
+	}
+}
+
+func TestUserService_SearchUsers_Limit(t *testing.T) {
+	calls := 0
+	client := pagedDirectoryClient([]kratos.Identity{
+		identity("1", "a@example.com", "A", ""),
+		identity("2", "b@example.com", "B", ""),
+		identity("3", "c@example.com", "C", ""),
+	}, &calls)
+
+	users, err := NewUserService(client).SearchUsers(context.Background(), "", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(users) != 2 {
+		t.Errorf("Expected 2 users, got %d", len(users))
+	}
+}
+
+func TestUserService_GetUserByEmail_NotFound(t *testing.T) {
+	client := &MockKratosClient{
+		GetIdentityByCredentialIdentifierFunc: func(ctx context.Context, identifier string) (*kratos.Identity, *http.Response, error) {
+			return nil, &http.Response{StatusCode: http.StatusOK}, ErrIdentityNotFound
+		},
+	}
+
+	_, err := NewUserService(client).GetUserByEmail(context.Background(), "ghost@example.com")
+	if !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Expected ErrIdentityNotFound, got %v", err)
+	}
+}
+
+func TestUserService_GetUserByID_NotFoundIsTyped(t *testing.T) {
+	client := &MockKratosClient{
+		GetIdentityFunc: func(ctx context.Context, id string) (*kratos.Identity, *http.Response, error) {
+			return nil, &http.Response{StatusCode: http.StatusNotFound}, errors.New("404 Not Found")
+		},
+	}
+
+	_, err := NewUserService(client).GetUserByID(context.Background(), "missing")
+	if !errors.Is(err, ErrIdentityNotFound) {
+		t.Errorf("Expected ErrIdentityNotFound, got %v", err)
+	}
+}
+
+func TestUser_PublicProfile_HidesEmail(t *testing.T) {
+	user := &User{ID: "1", Email: "secret@example.com", Traits: map[string]interface{}{"email": "secret@example.com"}}
+
+	profile := user.PublicProfile()
+	if profile.DisplayName != "secret" {
+		t.Errorf("Expected display name 'secret', got '%s'", profile.DisplayName)
+	}
+
+	user.Profile.Nickname = "Shade"
+	if user.PublicProfile().DisplayName != "Shade" {
+		t.Errorf("Expected nickname as display name, got '%s'", user.PublicProfile().DisplayName)
+	}
+}
+
+func TestNextPageToken(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Link", `</admin/identities?page_size=250&page_token=abc>; rel="first",</admin/identities?page_size=250&page_token=def>; rel="next"`)
+
+	if token := nextPageToken(resp); token != "def" {
+		t.Errorf("Expected next page token 'def', got '%s'", token)
+	}
+	if token := nextPageToken(&http.Response{Header: http.Header{}}); token != "" {
+		t.Errorf("Expected empty token without Link header, got '%s'", token)
+	}
+}
@@ -2,9 +2,11 @@ package usersmanagement
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	kratos "github.com/ory/kratos-client-go"
 )
@@ -20,8 +22,24 @@ type KratosClient struct {
 type KratosClientAPI interface {
 	GetIdentity(ctx context.Context, id string) (*kratos.Identity, *http.Response, error)
 	ToSession(ctx context.Context, sessionCookieValue string) (*kratos.Session, *http.Response, error)
+	// ListIdentities returns one page of identities and the token of the next
+	// page, which is empty on the last page.
+	ListIdentities(ctx context.Context, pageSize int64, pageToken string) ([]kratos.Identity, string, *http.Response, error)
+	// GetIdentityByCredentialIdentifier looks an identity up by a credential
+	// identifier such as the email used to log in. It returns ErrIdentityNotFound
+	// if no identity matches.
+	GetIdentityByCredentialIdentifier(ctx context.Context, identifier string) (*kratos.Identity, *http.Response, error)
 }
 
+// ErrIdentityNotFound is returned when Kratos has no identity matching a lookup.
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// Verify KratosClient implements both client interfaces.
+var (
+	_ KratosClientAPI = (*KratosClient)(nil)
+	_ KratosAdminAPI  = (*KratosClient)(nil)
+)
+
 // NewKratosClient creates a new KratosClient.
 // kratosAdminURL is the base URL of the Kratos admin API (e.g., "http://kratos:4434").
 // kratosPublicURL is the base URL of the Kratos public/frontend API (e.g., "http://127.0.0.1:4433" or "http://kratos:4433")
@@ -80,6 +98,105 @@ func (c *KratosClient) GetIdentity(ctx context.Context, id string) (*kratos.Iden
 	return identity, resp, nil
 }
 
+// ListIdentities fetches a page of identities using the Admin API's keyset pagination.
+func (c *KratosClient) ListIdentities(ctx context.Context, pageSize int64, pageToken string) ([]kratos.Identity, string, *http.Response, error) {
+	req := c.adminAPI.IdentityAPI.ListIdentities(ctx).PageSize(pageSize)
+	if pageToken != "" {
+		req = req.PageToken(pageToken)
+	}
+	identities, resp, err := req.Execute()
+	if err != nil {
+		return nil, "", resp, fmt.Errorf("failed to list identities from Kratos Admin API: %w", err)
+	}
+	return identities, nextPageToken(resp), resp, nil
+}
+
+// GetIdentityByCredentialIdentifier finds the identity owning the given credential identifier.
+func (c *KratosClient) GetIdentityByCredentialIdentifier(ctx context.Context, identifier string) (*kratos.Identity, *http.Response, error) {
+	identities, resp, err := c.adminAPI.IdentityAPI.ListIdentities(ctx).CredentialsIdentifier(identifier).Execute()
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to look up identity by identifier %s in Kratos Admin API: %w", identifier, err)
+	}
+	if len(identities) == 0 {
+		return nil, resp, ErrIdentityNotFound
+	}
+	return &identities[0], resp, nil
+}
+
+// CreateIdentity creates an identity using the Admin API.
+func (c *KratosClient) CreateIdentity(ctx context.Context, body kratos.CreateIdentityBody) (*kratos.Identity, *http.Response, error) {
+	identity, resp, err := c.adminAPI.IdentityAPI.CreateIdentity(ctx).CreateIdentityBody(body).Execute()
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to create identity in Kratos Admin API: %w", err)
+	}
+	return identity, resp, nil
+}
+
+// PatchIdentity applies JSON patches (e.g. to /state or /metadata_public) to an identity.
+func (c *KratosClient) PatchIdentity(ctx context.Context, id string, patches []kratos.JsonPatch) (*kratos.Identity, *http.Response, error) {
+	identity, resp, err := c.adminAPI.IdentityAPI.PatchIdentity(ctx, id).JsonPatch(patches).Execute()
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to patch identity %s in Kratos Admin API: %w", id, err)
+	}
+	return identity, resp, nil
+}
+
+// DeleteIdentitySessions revokes all sessions of an identity.
+func (c *KratosClient) DeleteIdentitySessions(ctx context.Context, id string) (*http.Response, error) {
+	resp, err := c.adminAPI.IdentityAPI.DeleteIdentitySessions(ctx, id).Execute()
+	if err != nil {
+		return resp, fmt.Errorf("failed to delete sessions of identity %s in Kratos Admin API: %w", id, err)
+	}
+	return resp, nil
+}
+
+// CreateRecoveryLink creates a recovery link for an identity. An empty
+// expiresIn uses the Kratos default lifespan.
+func (c *KratosClient) CreateRecoveryLink(ctx context.Context, id string, expiresIn string) (*kratos.RecoveryLinkForIdentity, *http.Response, error) {
+	body := kratos.CreateRecoveryLinkForIdentityBody{IdentityId: id}
+	if expiresIn != "" {
+		body.ExpiresIn = &expiresIn
+	}
+	link, resp, err := c.adminAPI.IdentityAPI.CreateRecoveryLinkForIdentity(ctx).CreateRecoveryLinkForIdentityBody(body).Execute()
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to create recovery link for identity %s in Kratos Admin API: %w", id, err)
+	}
+	return link, resp, nil
+}
+
+// ListIdentitySessions lists the sessions of an identity.
+func (c *KratosClient) ListIdentitySessions(ctx context.Context, id string, activeOnly bool) ([]kratos.Session, *http.Response, error) {
+	req := c.adminAPI.IdentityAPI.ListIdentitySessions(ctx, id)
+	if activeOnly {
+		req = req.Active(true)
+	}
+	sessions, resp, err := req.Execute()
+	if err != nil {
+		return nil, resp, fmt.Errorf("failed to list sessions of identity %s in Kratos Admin API: %w", id, err)
+	}
+	return sessions, resp, nil
+}
+
+// nextPageToken extracts the page_token of the rel="next" entry of a Link header.
+func nextPageToken(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	for _, link := range strings.Split(resp.Header.Get("Link"), ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 || !strings.Contains(strings.Join(parts[1:], ";"), `rel="next"`) {
+			continue
+		}
+		target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+		u, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		return u.Query().Get("page_token")
+	}
+	return ""
+}
+
 // WhoAmI validates a Kratos session cookie and returns the session details.
 // It uses the Kratos Frontend API's ToSession endpoint.
 // The `cookie` parameter should be the value of the Kratos session cookie (e.g., "ory_kratos_session=VALUE").
@@ -0,0 +1,259 @@
+package usersmanagement
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// User fields that identity traits can be mapped onto.
+const (
+	FieldEmail     = "email"
+	FieldFirstName = "first_name"
+	FieldLastName  = "last_name"
+	FieldNickname  = "nickname"
+	FieldAvatarURL = "avatar_url"
+	FieldPronouns  = "pronouns"
+	FieldTimezone  = "timezone"
+)
+
+// SchemaFieldKeyword is the custom keyword used inside the Kratos identity
+// schema to annotate which User field a trait maps to, e.g.
+// "keeper.chat/field": "nickname". Kratos ignores unknown keywords.
+const SchemaFieldKeyword = "keeper.chat/field"
+
+// TraitMapping maps User fields (see the Field* constants) to dot-separated
+// paths inside the Kratos identity traits, e.g. "first_name" -> "name.first".
+type TraitMapping map[string]string
+
+// fieldSetters assigns a string trait value to the matching User field.
+var fieldSetters = map[string]func(u *User, v string){
+	FieldEmail:     func(u *User, v string) { u.Email = v },
+	FieldFirstName: func(u *User, v string) { u.FirstName = v },
+	FieldLastName:  func(u *User, v string) { u.LastName = v },
+	FieldNickname:  func(u *User, v string) { u.Profile.Nickname = v },
+	FieldAvatarURL: func(u *User, v string) { u.Profile.AvatarURL = v },
+	FieldPronouns:  func(u *User, v string) { u.Profile.Pronouns = v },
+	FieldTimezone:  func(u *User, v string) { u.Profile.Timezone = v },
+}
+
+// DefaultTraitMapping returns the mapping matching config/kratos/identity.schema.json.
+func DefaultTraitMapping() TraitMapping {
+	return TraitMapping{
+		FieldEmail:     "email",
+		FieldFirstName: "name.first",
+		FieldLastName:  "name.last",
+		FieldNickname:  "nickname",
+		FieldAvatarURL: "avatar",
+		FieldPronouns:  "pronouns",
+		FieldTimezone:  "timezone",
+	}
+}
+
+// Validate checks that every key of the mapping is a known User field and
+// every path is non-empty.
+func (m TraitMapping) Validate() error {
+	for field, path := range m {
+		if _, ok := fieldSetters[field]; !ok {
+			return fmt.Errorf("unknown user field %q in trait mapping", field)
+		}
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("empty trait path for user field %q", field)
+		}
+	}
+	return nil
+}
+
+// LoadTraitMapping reads a JSON trait mapping file of the form
+// {"nickname": "nickname", "first_name": "name.first"}.
+// Fields not present in the file keep their default mapping; mapping a field
+// to "-" disables it.
+func LoadTraitMapping(path string) (TraitMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trait mapping file %s: %w", path, err)
+	}
+	var overrides map[string]string
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse trait mapping file %s: %w", path, err)
+	}
+
+	mapping := DefaultTraitMapping()
+	for field, traitPath := range overrides {
+		if traitPath == "-" {
+			delete(mapping, field)
+			continue
+		}
+		mapping[field] = traitPath
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid trait mapping file %s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// TraitMappingFromSchema derives a mapping from a Kratos identity schema.
+// Every property below "traits" annotated with SchemaFieldKeyword is mapped
+// to the named User field. Fields left unannotated fall back to the default
+// mapping so that existing schemas keep working.
+func TraitMappingFromSchema(schema []byte) (TraitMapping, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse identity schema: %w", err)
+	}
+	traits, ok := lookupPath(doc, "properties.traits")
+	if !ok {
+		return nil, fmt.Errorf("identity schema has no properties.traits object")
+	}
+	traitsSchema, ok := traits.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("identity schema properties.traits is not an object")
+	}
+
+	mapping := DefaultTraitMapping()
+	if err := collectSchemaFields(traitsSchema, "", mapping); err != nil {
+		return nil, err
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid identity schema annotations: %w", err)
+	}
+	return mapping, nil
+}
+
+// LoadTraitMappingFromSchemaFile is TraitMappingFromSchema for a file on disk.
+func LoadTraitMappingFromSchemaFile(path string) (TraitMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity schema %s: %w", path, err)
+	}
+	return TraitMappingFromSchema(data)
+}
+
+func collectSchemaFields(node map[string]interface{}, prefix string, mapping TraitMapping) error {
+	props, ok := node["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// Sort for deterministic error reporting.
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, ok := props[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if field, ok := prop[SchemaFieldKeyword].(string); ok {
+			if _, known := fieldSetters[field]; !known {
+				return fmt.Errorf("trait %q is annotated with unknown user field %q", path, field)
+			}
+			mapping[field] = path
+		}
+		if err := collectSchemaFields(prop, path, mapping); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply maps raw Kratos identity traits onto a User. Traits that are missing
+// or not strings are skipped, so identities created under an older or newer
+// schema still map cleanly. Only a non-object traits value is an error.
+func (m TraitMapping) Apply(identityID string, rawTraits interface{}) (*User, error) {
+	user := &User{ID: identityID}
+	if rawTraits == nil {
+		user.Traits = map[string]interface{}{}
+		return user, nil
+	}
+	traits, ok := rawTraits.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("kratos identity traits for user %s are not in the expected format: %T", identityID, rawTraits)
+	}
+	user.Traits = traits
+
+	for field, path := range m {
+		setter, ok := fieldSetters[field]
+		if !ok {
+			continue
+		}
+		value, found := lookupPath(traits, path)
+		if !found || value == nil {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			log.Printf("Trait %q for identity %s has type %T, expected string; ignoring", path, identityID, value)
+			continue
+		}
+		setter(user, str)
+	}
+	return user, nil
+}
+
+// lookupPath walks a dot-separated path through nested JSON objects.
+func lookupPath(obj map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = obj
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// BuildTraits is the inverse of Apply: it places the given field values at
+// their mapped trait paths, producing a traits object suitable for creating
+// an identity. Empty values are skipped; unmapped fields are an error.
+func (m TraitMapping) BuildTraits(values map[string]string) (map[string]interface{}, error) {
+	traits := map[string]interface{}{}
+	for field, value := range values {
+		if value == "" {
+			continue
+		}
+		path, ok := m[field]
+		if !ok {
+			return nil, fmt.Errorf("user field %q has no trait mapping", field)
+		}
+		if err := setPath(traits, path, value); err != nil {
+			return nil, err
+		}
+	}
+	return traits, nil
+}
+
+// setPath stores value at a dot-separated path, creating intermediate objects.
+func setPath(obj map[string]interface{}, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	current := obj
+	for _, part := range parts[:len(parts)-1] {
+		next, exists := current[part]
+		if !exists {
+			child := map[string]interface{}{}
+			current[part] = child
+			current = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("trait path %q conflicts with an existing value at %q", path, part)
+		}
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
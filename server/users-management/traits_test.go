@@ -0,0 +1,220 @@
+package usersmanagement
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	kratos "github.com/ory/kratos-client-go"
+)
+
+func TestTraitMapping_Apply_LegacyIdentity(t *testing.T) {
+	// An identity created before nickname/avatar/pronouns/timezone existed.
+	traits := map[string]interface{}{
+		"email": "old@example.com",
+		"name":  map[string]interface{}{"first": "Old", "last": "Timer"},
+	}
+
+	user, err := DefaultTraitMapping().Apply("legacy-id", traits)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Email != "old@example.com" {
+		t.Errorf("Expected email 'old@example.com', got '%s'", user.Email)
+	}
+	if user.FirstName != "Old" || user.LastName != "Timer" {
+		t.Errorf("Expected name 'Old Timer', got '%s %s'", user.FirstName, user.LastName)
+	}
+	if user.Profile != (Profile{}) {
+		t.Errorf("Expected empty profile, got %+v", user.Profile)
+	}
+	if user.DisplayName() != "Old Timer" {
+		t.Errorf("Expected display name 'Old Timer', got '%s'", user.DisplayName())
+	}
+}
+
+func TestTraitMapping_Apply_ExtendedIdentity(t *testing.T) {
+	traits := map[string]interface{}{
+		"email":    "new@example.com",
+		"nickname": "Nyx",
+		"avatar":   "https://example.com/nyx.png",
+		"pronouns": "they/them",
+		"timezone": "Europe/Lisbon",
+		"unknown":  map[string]interface{}{"future": "trait"},
+	}
+
+	user, err := DefaultTraitMapping().Apply("new-id", traits)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := Profile{
+		Nickname:  "Nyx",
+		AvatarURL: "https://example.com/nyx.png",
+		Pronouns:  "they/them",
+		Timezone:  "Europe/Lisbon",
+	}
+	if user.Profile != expected {
+		t.Errorf("Expected profile %+v, got %+v", expected, user.Profile)
+	}
+	if user.DisplayName() != "Nyx" {
+		t.Errorf("Expected display name 'Nyx', got '%s'", user.DisplayName())
+	}
+	if _, ok := user.Traits["unknown"]; !ok {
+		t.Error("Expected raw traits to keep unmapped trait 'unknown'")
+	}
+}
+
+func TestTraitMapping_Apply_WrongTypesAreIgnored(t *testing.T) {
+	traits := map[string]interface{}{
+		"email": "typed@example.com",
+		"name":  "not-an-object",
+		"avatar": map[string]interface{}{
+			"url": "https://example.com/a.png",
+		},
+	}
+
+	user, err := DefaultTraitMapping().Apply("typed-id", traits)
+	if err != nil {
+		t.Fatalf("Expected no error for unexpected trait shapes, got %v", err)
+	}
+	if user.Email != "typed@example.com" {
+		t.Errorf("Expected email 'typed@example.com', got '%s'", user.Email)
+	}
+	if user.FirstName != "" || user.Profile.AvatarURL != "" {
+		t.Errorf("Expected mismatched traits to be skipped, got %+v", user)
+	}
+}
+
+func TestTraitMapping_Apply_NonObjectTraits(t *testing.T) {
+	_, err := DefaultTraitMapping().Apply("bad-id", []interface{}{"email"})
+	if err == nil {
+		t.Fatal("Expected error for non-object traits, got nil")
+	}
+}
+
+func TestTraitMappingFromSchema_Annotations(t *testing.T) {
+	schema := []byte(`{
+		"properties": {
+			"traits": {
+				"type": "object",
+				"properties": {
+					"email": {"type": "string"},
+					"handle": {"type": "string", "keeper.chat/field": "nickname"},
+					"profile": {
+						"type": "object",
+						"properties": {
+							"picture": {"type": "string", "keeper.chat/field": "avatar_url"}
+						}
+					}
+				}
+			}
+		}
+	}`)
+
+	mapping, err := TraitMappingFromSchema(schema)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if mapping[FieldNickname] != "handle" {
+		t.Errorf("Expected nickname mapped to 'handle', got '%s'", mapping[FieldNickname])
+	}
+	if mapping[FieldAvatarURL] != "profile.picture" {
+		t.Errorf("Expected avatar_url mapped to 'profile.picture', got '%s'", mapping[FieldAvatarURL])
+	}
+	if mapping[FieldEmail] != "email" {
+		t.Errorf("Expected unannotated email to keep default mapping, got '%s'", mapping[FieldEmail])
+	}
+
+	user, err := mapping.Apply("id", map[string]interface{}{
+		"email":   "a@example.com",
+		"handle":  "Ace",
+		"profile": map[string]interface{}{"picture": "https://example.com/ace.png"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Profile.Nickname != "Ace" || user.Profile.AvatarURL != "https://example.com/ace.png" {
+		t.Errorf("Expected profile mapped from schema annotations, got %+v", user.Profile)
+	}
+}
+
+func TestTraitMappingFromSchema_UnknownField(t *testing.T) {
+	schema := []byte(`{"properties": {"traits": {"properties": {
+		"shoe": {"type": "string", "keeper.chat/field": "shoe_size"}
+	}}}}`)
+
+	if _, err := TraitMappingFromSchema(schema); err == nil {
+		t.Fatal("Expected error for unknown annotated field, got nil")
+	}
+}
+
+func TestTraitMappingFromSchema_RepositorySchema(t *testing.T) {
+	mapping, err := LoadTraitMappingFromSchemaFile(filepath.Join("..", "..", "config", "kratos", "identity.schema.json"))
+	if err != nil {
+		t.Fatalf("Expected repository identity schema to load, got %v", err)
+	}
+	defaults := DefaultTraitMapping()
+	for field, path := range defaults {
+		if mapping[field] != path {
+			t.Errorf("Expected field '%s' mapped to '%s', got '%s'", field, path, mapping[field])
+		}
+	}
+}
+
+func TestLoadTraitMapping_Overrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	content := `{"nickname": "display.handle", "timezone": "-"}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write mapping file: %v", err)
+	}
+
+	mapping, err := LoadTraitMapping(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if mapping[FieldNickname] != "display.handle" {
+		t.Errorf("Expected nickname override 'display.handle', got '%s'", mapping[FieldNickname])
+	}
+	if _, ok := mapping[FieldTimezone]; ok {
+		t.Error("Expected timezone mapping to be disabled")
+	}
+	if mapping[FieldEmail] != "email" {
+		t.Errorf("Expected email to keep default mapping, got '%s'", mapping[FieldEmail])
+	}
+}
+
+func TestLoadTraitMapping_InvalidField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"favourite_colour": "colour"}`), 0o600); err != nil {
+		t.Fatalf("Failed to write mapping file: %v", err)
+	}
+
+	if _, err := LoadTraitMapping(path); err == nil {
+		t.Fatal("Expected error for unknown field in mapping file, got nil")
+	}
+}
+
+func TestUserService_GetUserByID_CustomMapping(t *testing.T) {
+	mockClient := &MockKratosClient{
+		GetIdentityFunc: func(ctx context.Context, id string) (*kratos.Identity, *http.Response, error) {
+			return &kratos.Identity{
+				Id: id,
+				Traits: map[string]interface{}{
+					"contact": map[string]interface{}{"mail": "custom@example.com"},
+				},
+			}, &http.Response{StatusCode: http.StatusOK}, nil
+		},
+	}
+	mapping := TraitMapping{FieldEmail: "contact.mail"}
+
+	userService := NewUserServiceWithMapping(mockClient, mapping)
+	user, err := userService.GetUserByID(context.Background(), "custom-id")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if user.Email != "custom@example.com" {
+		t.Errorf("Expected email 'custom@example.com', got '%s'", user.Email)
+	}
+}
@@ -1,10 +1,87 @@
 package usersmanagement
 
+import "strings"
+
 // User represents a simplified user object mapped from Kratos Identity.
 type User struct {
 	ID        string                 `json:"id"`
 	Email     string                 `json:"email"`
 	FirstName string                 `json:"first_name,omitempty"`
 	LastName  string                 `json:"last_name,omitempty"`
-	Traits    map[string]interface{} `json:"traits"` // Raw traits from Kratos
+	Profile   Profile                `json:"profile"`
+	Roles     []string               `json:"roles,omitempty"` // From the identity's metadata_public.roles
+	Traits    map[string]interface{} `json:"traits"`          // Raw traits from Kratos
+}
+
+// Profile holds the optional, display-oriented traits of a user.
+// Every field may be empty if the identity schema does not define it.
+type Profile struct {
+	Nickname  string `json:"nickname,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Pronouns  string `json:"pronouns,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+}
+
+// DisplayName returns the best human-readable name for the user:
+// nickname, then full name, then email.
+func (u *User) DisplayName() string {
+	if u.Profile.Nickname != "" {
+		return u.Profile.Nickname
+	}
+	if full := strings.TrimSpace(u.FirstName + " " + u.LastName); full != "" {
+		return full
+	}
+	return u.Email
+}
+
+// RoleAdmin grants access to the admin API and commands.
+const RoleAdmin = "admin"
+
+// HasRole reports whether the user has been granted role.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the user may use the admin API.
+func (u *User) IsAdmin() bool {
+	return u.HasRole(RoleAdmin)
+}
+
+// PublicProfile is the subset of a user that may be shown to other members.
+// It deliberately omits the email address and raw traits.
+type PublicProfile struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	Nickname    string `json:"nickname,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Pronouns    string `json:"pronouns,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+}
+
+// PublicProfile returns the publicly visible profile of the user.
+func (u *User) PublicProfile() PublicProfile {
+	return PublicProfile{
+		ID:          u.ID,
+		DisplayName: u.publicDisplayName(),
+		Nickname:    u.Profile.Nickname,
+		AvatarURL:   u.Profile.AvatarURL,
+		Pronouns:    u.Profile.Pronouns,
+		Timezone:    u.Profile.Timezone,
+	}
+}
+
+// publicDisplayName is DisplayName without exposing the full email address.
+func (u *User) publicDisplayName() string {
+	name := u.DisplayName()
+	if name == u.Email {
+		if at := strings.Index(name, "@"); at > 0 {
+			return name[:at]
+		}
+	}
+	return name
 }
@@ -4,60 +4,66 @@ import (
 	"context"
 	"fmt"
 	"log"
-	// kratos "github.com/ory/kratos-client-go" // Already imported in KratosClient
+	"net/http"
+
+	kratos "github.com/ory/kratos-client-go"
 )
 
 // UserService provides operations for user management via Kratos.
 type UserService struct {
 	kratosClient KratosClientAPI // Use the interface type
+	traitMapping TraitMapping
+	directory    *directoryCache
 }
 
-// NewUserService creates a new UserService.
+// NewUserService creates a new UserService using DefaultTraitMapping.
 func NewUserService(kratosClient KratosClientAPI) *UserService { // Accept the interface type
+	return NewUserServiceWithMapping(kratosClient, DefaultTraitMapping())
+}
+
+// NewUserServiceWithMapping creates a new UserService that maps identity
+// traits onto users with the given TraitMapping.
+func NewUserServiceWithMapping(kratosClient KratosClientAPI, mapping TraitMapping) *UserService {
 	if kratosClient == nil {
 		log.Fatal("KratosClientAPI cannot be nil in NewUserService")
 	}
+	if mapping == nil {
+		mapping = DefaultTraitMapping()
+	}
 	return &UserService{
 		kratosClient: kratosClient,
+		traitMapping: mapping,
+		directory:    newDirectoryCache(DefaultDirectoryTTL),
 	}
 }
 
 // GetUserByID retrieves a user's details from Kratos by their Kratos Identity ID.
 func (s *UserService) GetUserByID(ctx context.Context, id string) (*User, error) {
+	identity, err := s.getIdentity(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.userFromIdentity(identity)
+}
+
+// getIdentity fetches an identity from Kratos by its ID.
+func (s *UserService) getIdentity(ctx context.Context, id string) (*kratos.Identity, error) {
 	identity, resp, err := s.kratosClient.GetIdentity(ctx, id)
 	if err != nil {
 		statusCode := 0
 		if resp != nil {
 			statusCode = resp.StatusCode
 		}
+		if statusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("failed to get user %s from Kratos: %w: %w", id, ErrIdentityNotFound, err)
+		}
 		return nil, fmt.Errorf("failed to get user %s from Kratos (status %d): %w", id, statusCode, err)
 	}
 
 	if identity == nil {
 		return nil, fmt.Errorf("no identity found for ID %s, though Kratos request was successful", id)
 	}
-
-	user := &User{
-		ID: identity.Id,
-	}
-	if traitsMap, ok := identity.Traits.(map[string]interface{}); ok {
-		user.Traits = traitsMap // Store all traits
-		if email, ok := traitsMap["email"].(string); ok {
-			user.Email = email
-		}
-		if nameMap, ok := traitsMap["name"].(map[string]interface{}); ok {
-			if firstName, ok := nameMap["first"].(string); ok {
-				user.FirstName = firstName
-			}
-			if lastName, ok := nameMap["last"].(string); ok {
-				user.LastName = lastName
-			}
-		}
-	} else {
-		return nil, fmt.Errorf("kratos identity traits for user %s are not in the expected format: %T", id, identity.Traits)
-	}
-
-	return user, nil
+	return identity, nil
 }
 
 // ValidateKratosSession validates a Kratos session token (cookie value).
@@ -81,26 +87,35 @@ func (s *UserService) ValidateKratosSession(ctx context.Context, sessionTokenVal
 	}
 
 	// Map Kratos Identity from session to our User model
-	identity := session.Identity
-	user := &User{
-		ID: identity.Id,
+	return s.userFromIdentity(session.Identity)
+}
+
+// userFromIdentity maps a Kratos identity to a User: traits through the
+// trait mapping, roles from metadata_public.roles.
+func (s *UserService) userFromIdentity(identity *kratos.Identity) (*User, error) {
+	user, err := s.traitMapping.Apply(identity.Id, identity.Traits)
+	if err != nil {
+		return nil, err
 	}
-	if traitsMap, ok := identity.Traits.(map[string]interface{}); ok {
-		user.Traits = traitsMap
-		if email, ok := traitsMap["email"].(string); ok {
-			user.Email = email
-		}
-		if nameMap, ok := traitsMap["name"].(map[string]interface{}); ok {
-			if firstName, ok := nameMap["first"].(string); ok {
-				user.FirstName = firstName
-			}
-			if lastName, ok := nameMap["last"].(string); ok {
-				user.LastName = lastName
-			}
+	user.Roles = rolesFromMetadata(identity.MetadataPublic)
+	return user, nil
+}
+
+// rolesFromMetadata reads the "roles" string array from identity metadata.
+func rolesFromMetadata(metadata interface{}) []string {
+	m, ok := metadata.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	raw, ok := m["roles"].([]interface{})
+	if !ok {
+		return nil
+	}
+	roles := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
 		}
-	} else {
-		return nil, fmt.Errorf("kratos identity traits from session for user %s are not in the expected format: %T", identity.Id, identity.Traits)
 	}
-
-	return user, nil
+	return roles
 }
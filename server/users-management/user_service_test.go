@@ -19,6 +19,9 @@ func timePtr(t time.Time) *time.Time { return &t }
 type MockKratosClient struct {
 	GetIdentityFunc func(ctx context.Context, id string) (*kratos.Identity, *http.Response, error)
 	ToSessionFunc   func(ctx context.Context, sessionToken string) (*kratos.Session, *http.Response, error)
+
+	ListIdentitiesFunc                    func(ctx context.Context, pageSize int64, pageToken string) ([]kratos.Identity, string, *http.Response, error)
+	GetIdentityByCredentialIdentifierFunc func(ctx context.Context, identifier string) (*kratos.Identity, *http.Response, error)
 }
 
 func (m *MockKratosClient) GetIdentity(ctx context.Context, id string) (*kratos.Identity, *http.Response, error) {
@@ -35,6 +38,20 @@ func (m *MockKratosClient) ToSession(ctx context.Context, sessionToken string) (
 	return nil, nil, errors.New("ToSessionFunc not implemented in mock")
 }
 
+func (m *MockKratosClient) ListIdentities(ctx context.Context, pageSize int64, pageToken string) ([]kratos.Identity, string, *http.Response, error) {
+	if m.ListIdentitiesFunc != nil {
+		return m.ListIdentitiesFunc(ctx, pageSize, pageToken)
+	}
+	return nil, "", nil, errors.New("ListIdentitiesFunc not implemented in mock")
+}
+
+func (m *MockKratosClient) GetIdentityByCredentialIdentifier(ctx context.Context, identifier string) (*kratos.Identity, *http.Response, error) {
+	if m.GetIdentityByCredentialIdentifierFunc != nil {
+		return m.GetIdentityByCredentialIdentifierFunc(ctx, identifier)
+	}
+	return nil, nil, errors.New("GetIdentityByCredentialIdentifierFunc not implemented in mock")
+}
+
 func TestUserService_GetUserByID_Success(t *testing.T) {
 	mockIdentity := &kratos.Identity{
 		Id: "test-id",